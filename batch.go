@@ -0,0 +1,383 @@
+package mountinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/moby/sys/mountinfo"
+	sglog "github.com/sourcegraph/log"
+	"go.uber.org/multierr"
+)
+
+// DeviceResult is the result of discovering the block device that a single file path is
+// stored on, as part of a batch.
+type DeviceResult struct {
+	// Name is the name of the block device that the file path is stored on (example: "sdb").
+	// Name is empty if Err is set.
+	Name string
+
+	// Err describes why the block device couldn't be discovered (nil if discovery succeeded).
+	Err error
+}
+
+// DiscoverDevices discovers the block device that each of the provided file paths is stored on,
+// and returns the results keyed by file path.
+//
+// DiscoverDevices is faster than calling DiscoverDeviceNameContext for each file path: the mount
+// table is only read once, and file paths that are stored on the same filesystem are only resolved
+// once.
+//
+// A file path whose device can't be discovered doesn't abort the whole batch: its result carries
+// the error instead, so that callers can use the devices of all of the other file paths.
+//
+// See the doc comment for NewCollector for the list of supported operating systems.
+func (d *Discoverer) DiscoverDevices(logger sglog.Logger, paths []string) map[string]DeviceResult {
+	return d.discoverDevices(context.Background(), logger, paths, BatchOpts{})
+}
+
+// DiscoverDevices calls DiscoverDevices on a Discoverer that inspects the current system.
+func DiscoverDevices(logger sglog.Logger, paths []string) map[string]DeviceResult {
+	return defaultDiscoverer.DiscoverDevices(logger, paths)
+}
+
+// BatchOpts modifies the behavior of DiscoverDevicesContext.
+type BatchOpts struct {
+	// Concurrency is the maximum number of file paths whose devices are discovered at the
+	// same time. If Concurrency isn't positive, file paths are discovered one at a time.
+	Concurrency int
+
+	// If positive, PathTimeout limits how long discovering the device of a single file path
+	// may take. File paths that take longer have a result whose error wraps
+	// context.DeadlineExceeded.
+	PathTimeout time.Duration
+}
+
+// DiscoverDevicesContext is like DiscoverDevices, but discovers the devices of up to
+// opts.Concurrency file paths in parallel, and gives up on each file path once ctx is done or
+// opts.PathTimeout has elapsed.
+//
+// A file path that hangs (e.x. because it's stored on an unresponsive NFS server) only fails its
+// own result: the devices of all of the other file paths are still discovered. Once ctx is done,
+// the results of all file paths that haven't been discovered yet carry ctx's error.
+func (d *Discoverer) DiscoverDevicesContext(ctx context.Context, logger sglog.Logger, paths []string, opts BatchOpts) map[string]DeviceResult {
+	return d.discoverDevices(ctx, logger, paths, opts)
+}
+
+// DiscoverDevicesContext calls DiscoverDevicesContext on a Discoverer that inspects the current system.
+func DiscoverDevicesContext(ctx context.Context, logger sglog.Logger, paths []string, opts BatchOpts) map[string]DeviceResult {
+	return defaultDiscoverer.DiscoverDevicesContext(ctx, logger, paths, opts)
+}
+
+// DiscoverDevicesGlob discovers the block devices that the file paths matching the provided
+// glob pattern (example: "/data/*/index", see filepath.Match for the syntax) are stored on.
+//
+// The returned map is keyed by device name, and contains the first matching file path (in
+// lexical order) that's stored on each device, so every device is only listed once.
+//
+// If the pattern doesn't match any file paths, or is malformed, an error is returned. If the
+// devices of some of the matching file paths can't be discovered, the devices of all of the
+// others are still returned, along with an error that combines the failures (errors.Is and
+// errors.As can be used to inspect them).
+//
+// See the doc comment for NewCollector for the list of supported operating systems.
+func (d *Discoverer) DiscoverDevicesGlob(logger sglog.Logger, pattern string) (map[string]string, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("DiscoverDevicesGlob: expanding pattern %q: %w", pattern, err)
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("DiscoverDevicesGlob: pattern %q doesn't match any file paths", pattern)
+	}
+
+	results := d.discoverDevices(context.Background(), logger, paths, BatchOpts{})
+
+	devices := make(map[string]string)
+	for _, filePath := range paths {
+		result := results[filePath]
+		if result.Err != nil {
+			err = multierr.Append(err, fmt.Errorf("DiscoverDevicesGlob: discovering device of %q: %w", filePath, result.Err))
+			continue
+		}
+
+		if _, ok := devices[result.Name]; !ok {
+			devices[result.Name] = filePath
+		}
+	}
+
+	return devices, err
+}
+
+// DiscoverDevicesGlob calls DiscoverDevicesGlob on a Discoverer that inspects the current system.
+func DiscoverDevicesGlob(logger sglog.Logger, pattern string) (map[string]string, error) {
+	return defaultDiscoverer.DiscoverDevicesGlob(logger, pattern)
+}
+
+// DevicesUnder discovers the block devices that store the directory tree rooted at filePath,
+// including the filesystems that are mounted underneath it (example: for "/data", both the
+// device of "/data" and the one of a separate disk mounted at "/data/index").
+//
+// The returned map is keyed by device name, and contains the first mountpoint (in lexical
+// order) that's stored on each device, where filePath itself (with its symlinks resolved) stands
+// in for the filesystem that contains it. Mounts that aren't backed by a local block device (e.x. tmpfs or NFS) are
+// skipped. If the devices of some of the mounts can't be discovered, the devices of all of the
+// others are still returned, along with an error that combines the failures.
+//
+// DevicesUnder discards all of the logs that discovery produces. It isn't supported on
+// operating systems whose mount table can't be listed (Windows, NetBSD, illumos, Solaris,
+// and AIX), where the returned error wraps ErrUnsupportedPlatform.
+func (d *Discoverer) DevicesUnder(filePath string) (map[string]string, error) {
+	resolvedPath, err := d.resolvePath(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("DevicesUnder: %w", err)
+	}
+
+	mounts, err := d.listMounts()
+	if err != nil {
+		return nil, fmt.Errorf("DevicesUnder: %w", err)
+	}
+
+	// filesystem type of each mountpoint at or below filePath (including the one of the
+	// filesystem that contains filePath itself). A later mount at the same mountpoint shadows
+	// the earlier ones, so the type of the last one wins.
+	fsTypes := make(map[string]string)
+
+	var parents []*mountinfo.Info
+	filter := parentsFilter(resolvedPath)
+
+	for _, mount := range mounts {
+		if skip, _ := filter(mount); !skip {
+			parents = append(parents, mount)
+		} else if isSubpath(resolvedPath, mount.Mountpoint) {
+			fsTypes[mount.Mountpoint] = mount.FSType
+		}
+	}
+
+	if mount := mostSpecificMount(parents); mount != nil {
+		fsTypes[resolvedPath] = mount.FSType
+	}
+
+	// filePath itself sorts before all of the mountpoints underneath it
+	var paths []string
+	for mountpoint, fsType := range fsTypes {
+		if !isNetworkFilesystemType(fsType) {
+			paths = append(paths, mountpoint)
+		}
+	}
+
+	sort.Strings(paths)
+
+	results := d.discoverDevices(context.Background(), sglog.NoOp(), paths, BatchOpts{})
+
+	devices := make(map[string]string)
+	var errs error
+
+	for _, mountpoint := range paths {
+		result := results[mountpoint]
+		if errors.Is(result.Err, ErrNoBlockDevice) {
+			continue
+		}
+
+		if result.Err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("DevicesUnder: discovering device of %q: %w", mountpoint, result.Err))
+			continue
+		}
+
+		if _, ok := devices[result.Name]; !ok {
+			devices[result.Name] = mountpoint
+		}
+	}
+
+	return devices, errs
+}
+
+// DevicesUnder calls DevicesUnder on a Discoverer that inspects the current system.
+func DevicesUnder(filePath string) (map[string]string, error) {
+	return defaultDiscoverer.DevicesUnder(filePath)
+}
+
+// deviceNumber is the major and minor device number of a filesystem.
+type deviceNumber struct{ major, minor uint32 }
+
+// batchNames remembers the device name that has been discovered for each filesystem during
+// a batch, so that file paths stored on the same filesystem are only resolved once.
+//
+// batchNames is safe for concurrent use by multiple goroutines.
+type batchNames struct {
+	mu       sync.Mutex
+	byNumber map[deviceNumber]string
+}
+
+func (n *batchNames) get(number deviceNumber) (string, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	name, ok := n.byNumber[number]
+	return name, ok
+}
+
+func (n *batchNames) set(number deviceNumber, name string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.byNumber[number] = name
+}
+
+func (d *Discoverer) discoverDevices(ctx context.Context, logger sglog.Logger, paths []string, opts BatchOpts) map[string]DeviceResult {
+	batch := d.snapshot(logger)
+	names := &batchNames{byNumber: make(map[deviceNumber]string)}
+
+	var unique []string
+	seen := make(map[string]struct{}, len(paths))
+	for _, filePath := range paths {
+		if _, ok := seen[filePath]; ok {
+			continue
+		}
+
+		seen[filePath] = struct{}{}
+		unique = append(unique, filePath)
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	if concurrency > len(unique) {
+		concurrency = len(unique)
+	}
+
+	var mu sync.Mutex
+	results := make(map[string]DeviceResult, len(unique))
+
+	work := make(chan string)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for filePath := range work {
+				result := batch.discoverBatchDeviceWithTimeout(ctx, logger, filePath, opts.PathTimeout, names)
+
+				mu.Lock()
+				results[filePath] = result
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, filePath := range unique {
+		work <- filePath
+	}
+
+	close(work)
+	wg.Wait()
+
+	return results
+}
+
+// discoverBatchDeviceWithTimeout calls discoverBatchDevice, but gives up once ctx is done or
+// timeout (if positive) has elapsed.
+//
+// Some system calls (e.x. stat on a hung NFS mount) can't be interrupted, so giving up leaves
+// the discovery running in the background until the call returns. This keeps a single hung
+// file path from stalling the rest of the batch.
+func (d *Discoverer) discoverBatchDeviceWithTimeout(ctx context.Context, logger sglog.Logger, filePath string, timeout time.Duration, names *batchNames) DeviceResult {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return DeviceResult{Err: err}
+	}
+
+	done := make(chan DeviceResult, 1)
+	go func() {
+		done <- d.discoverBatchDevice(ctx, logger, filePath, names)
+	}()
+
+	select {
+	case result := <-done:
+		return result
+	case <-ctx.Done():
+		logger.Debug("gave up discovering device", sglog.String("path", filePath), sglog.Error(ctx.Err()))
+		return DeviceResult{Err: ctx.Err()}
+	}
+}
+
+// discoverBatchDevice discovers the device that filePath is stored on, reusing the device
+// names that have already been discovered for other file paths in the batch.
+func (d *Discoverer) discoverBatchDevice(ctx context.Context, logger sglog.Logger, filePath string, names *batchNames) DeviceResult {
+	start := time.Now()
+	discoveryLogger := logger.With(sglog.String("path", filePath))
+
+	resolvedPath, err := d.resolvePath(filePath)
+	if err != nil {
+		discoveryLogger.Debug("failed to resolve file path", sglog.Error(err))
+
+		if d.metrics != nil {
+			d.metrics.observe(cacheMiss, start, err)
+		}
+
+		return DeviceResult{Err: err}
+	}
+
+	// file paths with the same device number are stored on the same filesystem,
+	// so they're stored on the same block device
+	major, minor, numberErr := d.getDeviceNumber(resolvedPath)
+	if numberErr == nil {
+		if name, ok := names.get(deviceNumber{major, minor}); ok {
+			if d.metrics != nil {
+				d.metrics.observe(cacheHit, start, nil)
+			}
+
+			return DeviceResult{Name: name}
+		}
+	}
+
+	// resolving the already resolved file path again is a no-op, but keeps the discovery on
+	// the same (measured) path as single discoveries
+	device, err := d.discoverDeviceAt(ctx, discoveryLogger, resolvedPath)
+	if err != nil {
+		discoveryLogger.Debug("failed to discover device", sglog.Error(err))
+		return DeviceResult{Err: err}
+	}
+
+	if numberErr == nil {
+		names.set(deviceNumber{major, minor}, device.Name)
+	}
+
+	return DeviceResult{Name: device.Name}
+}
+
+// snapshot returns a Discoverer that behaves like d, but reads the mount table only once.
+//
+// If the mount table can't be read up front, d itself is returned (so that every discovery
+// reports the failure for its own file path).
+func (d *Discoverer) snapshot(logger sglog.Logger) *Discoverer {
+	findMount, err := d.findMountSnapshot()
+	if err != nil {
+		logger.Debug("failed to take snapshot of mount table", sglog.Error(err))
+		return d
+	}
+
+	return d.withFindMount(findMount)
+}
+
+// withFindMount returns a Discoverer that shares the configuration (and the cached sysfs
+// mountpoint) of d, but looks the mounts of file paths up with findMount.
+func (d *Discoverer) withFindMount(findMount func(filePath string) (*mountinfo.Info, error)) *Discoverer {
+	c := *d
+	c.findMount = findMount
+
+	return &c
+}
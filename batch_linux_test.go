@@ -0,0 +1,427 @@
+package mountinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/moby/sys/mountinfo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/log/logtest"
+)
+
+func Test_DiscoverDevices(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"class/block":                           {Mode: fs.ModeDir},
+		"dev/block/8:1":                         symlink("../../devices/pci0/block/sda/sda1"),
+		"dev/block/8:17":                        symlink("../../devices/pci0/block/sdb/sdb1"),
+		"devices/pci0/block/sda/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sda/sda1/partition": {Data: []byte("1\n")},
+		"devices/pci0/block/sdb/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sdb/sdb1/partition": {Data: []byte("1\n")},
+	}
+
+	deviceNumbers := map[string][2]uint32{
+		"/":          {8, 1},
+		"/home":      {8, 1},
+		"/data":      {8, 17},
+		"/data/logs": {8, 17},
+		"/missing":   {259, 0},
+	}
+
+	snapshots := 0
+	lookups := 0
+
+	d := NewDiscoverer(WithSysfs(sysfs))
+	d.resolvePath = unresolvedPath
+	d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+		number, ok := deviceNumbers[filePath]
+		if !ok {
+			return 0, 0, fmt.Errorf("stat %s: %w", filePath, fs.ErrNotExist)
+		}
+
+		return number[0], number[1], nil
+	}
+	d.findMount = func(filePath string) (*mountinfo.Info, error) {
+		t.Fatalf("expected mounts to be looked up in the snapshot, but %q was looked up in the mount table", filePath)
+		return nil, nil
+	}
+	d.findMountSnapshot = func() (func(filePath string) (*mountinfo.Info, error), error) {
+		snapshots++
+
+		return func(filePath string) (*mountinfo.Info, error) {
+			lookups++
+			return &mountinfo.Info{Mountpoint: "/", FSType: "ext4"}, nil
+		}, nil
+	}
+
+	results := d.DiscoverDevices(logtest.Scoped(t), []string{"/", "/home", "/data", "/data/logs", "/data", "/missing", "/gone"})
+
+	// failed file paths still have results, which carry their errors
+	if err := results["/missing"].Err; err == nil {
+		t.Errorf("expected error for %q, got device name %q", "/missing", results["/missing"].Name)
+	}
+
+	if err := results["/gone"].Err; !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected error for %q wrapping fs.ErrNotExist, got %v", "/gone", err)
+	}
+
+	names := make(map[string]string)
+	for filePath, result := range results {
+		if result.Err == nil {
+			names[filePath] = result.Name
+		}
+	}
+
+	expected := map[string]string{
+		"/":          "sda",
+		"/home":      "sda",
+		"/data":      "sdb",
+		"/data/logs": "sdb",
+	}
+
+	if diff := cmp.Diff(expected, names); diff != "" {
+		t.Fatalf("recieved unexpected device names (-want +got):\n%s", diff)
+	}
+
+	if len(results) != 6 {
+		t.Errorf("expected results for 6 distinct file paths, got %d", len(results))
+	}
+
+	if snapshots != 1 {
+		t.Errorf("expected the mount table to be read once, got %d", snapshots)
+	}
+
+	// file paths on the same device are only resolved once ("/", "/data", "/missing", and "/gone"
+	// are resolved, and each resolution looks its mount up once)
+	if lookups != 4 {
+		t.Errorf("expected 4 mount lookups, got %d", lookups)
+	}
+}
+
+func Test_DiscoverDevices_Metrics(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"class/block":                           {Mode: fs.ModeDir},
+		"dev/block/8:1":                         symlink("../../devices/pci0/block/sda/sda1"),
+		"devices/pci0/block/sda/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sda/sda1/partition": {Data: []byte("1\n")},
+	}
+
+	registry := prometheus.NewRegistry()
+
+	d := NewDiscoverer(WithSysfs(sysfs), WithMetrics(registry))
+	d.resolvePath = func(filePath string) (string, error) {
+		if filePath == "/gone" {
+			return "", fmt.Errorf("stat %s: %w", filePath, fs.ErrNotExist)
+		}
+
+		return filePath, nil
+	}
+	d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+		if filePath == "/missing" {
+			return 259, 0, nil
+		}
+
+		return 8, 1, nil
+	}
+	d.findMountSnapshot = func() (func(filePath string) (*mountinfo.Info, error), error) {
+		return func(filePath string) (*mountinfo.Info, error) {
+			return &mountinfo.Info{Mountpoint: "/", FSType: "ext4"}, nil
+		}, nil
+	}
+
+	d.DiscoverDevices(logtest.Scoped(t), []string{"/", "/home", "/missing", "/gone"})
+
+	// "/home" is answered by the device that was already discovered for "/", while "/missing"
+	// (which isn't in sysfs) and "/gone" (which can't be resolved) fail
+	expected := map[string]map[string]uint64{
+		"mountinfo_device_discovery_duration_seconds": {
+			"backend=" + runtime.GOOS + ",cache=hit,":  1,
+			"backend=" + runtime.GOOS + ",cache=miss,": 3,
+		},
+		"mountinfo_device_discovery_errors_total": {
+			"backend=" + runtime.GOOS + ",": 2,
+		},
+	}
+
+	if diff := cmp.Diff(expected, gatherDiscoveryMetrics(t, registry)); diff != "" {
+		t.Fatalf("recieved unexpected metrics (-want +got):\n%s", diff)
+	}
+}
+
+func Test_DiscoverDevicesContext(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"class/block":                           {Mode: fs.ModeDir},
+		"dev/block/8:1":                         symlink("../../devices/pci0/block/sda/sda1"),
+		"dev/block/8:17":                        symlink("../../devices/pci0/block/sdb/sdb1"),
+		"devices/pci0/block/sda/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sda/sda1/partition": {Data: []byte("1\n")},
+		"devices/pci0/block/sdb/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sdb/sdb1/partition": {Data: []byte("1\n")},
+	}
+
+	deviceNumbers := map[string][2]uint32{
+		"/data/0": {8, 1},
+		"/data/1": {8, 17},
+		"/data/2": {8, 1},
+		"/data/3": {8, 17},
+		"/data/4": {8, 1},
+		"/data/5": {8, 17},
+	}
+
+	// stat on "/nfs" hangs until the test is over, like it would on an unresponsive NFS server
+	hung := make(chan struct{})
+	t.Cleanup(func() { close(hung) })
+
+	var inFlight, maxInFlight int32
+
+	d := NewDiscoverer(WithSysfs(sysfs))
+	d.resolvePath = unresolvedPath
+	d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+				break
+			}
+		}
+
+		if filePath == "/nfs" {
+			<-hung
+			return 0, 0, errors.New("nfs server not responding")
+		}
+
+		// give the other workers a chance to run at the same time
+		time.Sleep(10 * time.Millisecond)
+
+		number := deviceNumbers[filePath]
+		return number[0], number[1], nil
+	}
+	d.findMountSnapshot = func() (func(filePath string) (*mountinfo.Info, error), error) {
+		return func(filePath string) (*mountinfo.Info, error) {
+			return &mountinfo.Info{Mountpoint: "/", FSType: "ext4"}, nil
+		}, nil
+	}
+
+	paths := []string{"/nfs", "/data/0", "/data/1", "/data/2", "/data/3", "/data/4", "/data/5"}
+
+	results := d.DiscoverDevicesContext(context.Background(), logtest.Scoped(t), paths, BatchOpts{
+		Concurrency: 2,
+		PathTimeout: 100 * time.Millisecond,
+	})
+
+	if err := results["/nfs"].Err; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error for %q wrapping context.DeadlineExceeded, got %v", "/nfs", err)
+	}
+
+	names := make(map[string]string)
+	for filePath, result := range results {
+		if result.Err == nil {
+			names[filePath] = result.Name
+		}
+	}
+
+	expected := map[string]string{
+		"/data/0": "sda",
+		"/data/1": "sdb",
+		"/data/2": "sda",
+		"/data/3": "sdb",
+		"/data/4": "sda",
+		"/data/5": "sdb",
+	}
+
+	if diff := cmp.Diff(expected, names); diff != "" {
+		t.Fatalf("recieved unexpected device names (-want +got):\n%s", diff)
+	}
+
+	// the hung stat keeps running after its file path has timed out, so it can be
+	// in flight along with both workers
+	if max := atomic.LoadInt32(&maxInFlight); max > 3 {
+		t.Errorf("expected at most 3 device lookups at the same time, got %d", max)
+	}
+
+	// once the context is done, the remaining file paths aren't discovered
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results = d.DiscoverDevicesContext(ctx, logtest.Scoped(t), paths[1:], BatchOpts{Concurrency: 2})
+	for _, filePath := range paths[1:] {
+		if err := results[filePath].Err; !errors.Is(err, context.Canceled) {
+			t.Errorf("expected error for %q wrapping context.Canceled, got %v", filePath, err)
+		}
+	}
+}
+
+func Test_DiscoverDevicesGlob(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"class/block":                           {Mode: fs.ModeDir},
+		"dev/block/8:1":                         symlink("../../devices/pci0/block/sda/sda1"),
+		"dev/block/8:17":                        symlink("../../devices/pci0/block/sdb/sdb1"),
+		"devices/pci0/block/sda/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sda/sda1/partition": {Data: []byte("1\n")},
+		"devices/pci0/block/sdb/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sdb/sdb1/partition": {Data: []byte("1\n")},
+	}
+
+	root := t.TempDir()
+
+	// repo1 and repo2 are stored on sda, repo3 on sdb, and repo4's device can't be discovered
+	deviceNumbers := make(map[string][2]uint32)
+	for repo, number := range map[string][2]uint32{
+		"repo1": {8, 1},
+		"repo2": {8, 1},
+		"repo3": {8, 17},
+		"repo4": {259, 0},
+	} {
+		dir := filepath.Join(root, repo, "index")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("creating directory: %s", err)
+		}
+
+		deviceNumbers[dir] = number
+	}
+
+	d := NewDiscoverer(WithSysfs(sysfs))
+	d.resolvePath = unresolvedPath
+	d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+		number := deviceNumbers[filePath]
+		return number[0], number[1], nil
+	}
+	d.findMountSnapshot = func() (func(filePath string) (*mountinfo.Info, error), error) {
+		return func(filePath string) (*mountinfo.Info, error) {
+			return &mountinfo.Info{Mountpoint: "/", FSType: "ext4"}, nil
+		}, nil
+	}
+
+	devices, err := d.DiscoverDevicesGlob(logtest.Scoped(t), filepath.Join(root, "*", "index"))
+	if err == nil || !strings.Contains(err.Error(), filepath.Join(root, "repo4", "index")) {
+		t.Errorf("expected error for %q, got %v", filepath.Join(root, "repo4", "index"), err)
+	}
+
+	expected := map[string]string{
+		"sda": filepath.Join(root, "repo1", "index"),
+		"sdb": filepath.Join(root, "repo3", "index"),
+	}
+
+	if diff := cmp.Diff(expected, devices); diff != "" {
+		t.Fatalf("recieved unexpected devices (-want +got):\n%s", diff)
+	}
+
+	if _, err := d.DiscoverDevicesGlob(logtest.Scoped(t), filepath.Join(root, "*", "missing")); err == nil {
+		t.Error("expected error for pattern that doesn't match anything, got nil")
+	}
+
+	if _, err := d.DiscoverDevicesGlob(logtest.Scoped(t), filepath.Join(root, "[")); !errors.Is(err, filepath.ErrBadPattern) {
+		t.Errorf("expected error wrapping filepath.ErrBadPattern, got %v", err)
+	}
+}
+
+func Test_DevicesUnder(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"class/block":                           {Mode: fs.ModeDir},
+		"dev/block/8:1":                         symlink("../../devices/pci0/block/sda/sda1"),
+		"dev/block/8:17":                        symlink("../../devices/pci0/block/sdb/sdb1"),
+		"dev/block/259:1":                       symlink("../../devices/pci0/nvme/block/nvme0n1/nvme0n1p1"),
+		"devices/pci0/block/sda/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sda/sda1/partition": {Data: []byte("1\n")},
+		"devices/pci0/block/sdb/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sdb/sdb1/partition": {Data: []byte("1\n")},
+
+		"devices/pci0/nvme/block/nvme0n1/subsystem":           symlink("../../../../../class/block"),
+		"devices/pci0/nvme/block/nvme0n1/nvme0n1p1/partition": {Data: []byte("1\n")},
+	}
+
+	// the mount table (in mount order) of a machine with a data root that has nested mounts
+	mounts := []*mountinfo.Info{
+		{Mountpoint: "/", FSType: "ext4", Major: 8, Minor: 1},
+		{Mountpoint: "/data", FSType: "ext4", Major: 8, Minor: 17},
+		{Mountpoint: "/data/index", FSType: "xfs", Major: 259, Minor: 1},
+		{Mountpoint: "/data/logs", FSType: "ext4", Major: 8, Minor: 17}, // bind mount of a directory on /data
+		{Mountpoint: "/data/tmp", FSType: "tmpfs", Major: 0, Minor: 50},
+		{Mountpoint: "/data/remote", FSType: "nfs4", Major: 0, Minor: 51},
+		{Mountpoint: "/database", FSType: "ext4", Major: 8, Minor: 1},
+	}
+
+	findMount := func(filePath string) (*mountinfo.Info, error) {
+		var parents []*mountinfo.Info
+
+		filter := parentsFilter(filePath)
+		for _, m := range mounts {
+			if skip, _ := filter(m); !skip {
+				parents = append(parents, m)
+			}
+		}
+
+		return mostSpecificMount(parents), nil
+	}
+
+	d := NewDiscoverer(WithSysfs(sysfs))
+	d.resolvePath = unresolvedPath
+	d.listMounts = func() ([]*mountinfo.Info, error) {
+		return mounts, nil
+	}
+	d.findMountSnapshot = func() (func(filePath string) (*mountinfo.Info, error), error) {
+		return findMount, nil
+	}
+	d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+		if filePath == "/data/remote" {
+			t.Errorf("expected network filesystem %q to be skipped", filePath)
+		}
+
+		mount, _ := findMount(filePath)
+		return uint32(mount.Major), uint32(mount.Minor), nil
+	}
+
+	for _, test := range []struct {
+		name     string
+		filePath string
+
+		expected map[string]string
+	}{
+		{
+			name:     "mountpoint with nested mounts",
+			filePath: "/data",
+			expected: map[string]string{"sdb": "/data", "nvme0n1": "/data/index"},
+		},
+		{
+			name:     "directory that isn't a mountpoint",
+			filePath: "/home/user",
+			expected: map[string]string{"sda": "/home/user"},
+		},
+		{
+			name:     "root",
+			filePath: "/",
+			expected: map[string]string{"sda": "/", "sdb": "/data", "nvme0n1": "/data/index"},
+		},
+		{
+			name:     "filesystem that isn't backed by a block device",
+			filePath: "/data/tmp",
+			expected: map[string]string{},
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := d.DevicesUnder(test.filePath)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if diff := cmp.Diff(test.expected, actual); diff != "" {
+				t.Fatalf("recieved unexpected devices (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package mountinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+// discoverAnonymousDeviceNames returns the names of the block devices that back the
+// filesystem that filePath is stored on, if that filesystem has an anonymous device
+// number (one with major number 0).
+//
+// Only btrfs, overlay, and ZFS filesystems are supported, since all other filesystems with
+// anonymous device numbers (e.x. tmpfs) aren't backed by block devices.
+func (d *Discoverer) discoverAnonymousDeviceNames(ctx context.Context, logger sglog.Logger, sysfs fs.FS, filePath string) ([]string, error) {
+	mount, err := d.findMount(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("finding mountpoint: %w", err)
+	}
+
+	if mount.FSType == "overlay" {
+		return d.discoverOverlayDeviceNames(ctx, logger, sysfs, mount)
+	}
+
+	if mount.FSType == "zfs" {
+		return d.discoverZFSDeviceNames(ctx, logger, sysfs, mount)
+	}
+
+	if mount.FSType != "btrfs" {
+		return nil, fmt.Errorf("filesystem (type %q) mounted at %q has an anonymous device number: %w", mount.FSType, mount.Mountpoint, ErrNoBlockDevice)
+	}
+
+	devicePaths, err := btrfsSourceDevicePaths(logger, sysfs, mount.Source)
+	if err != nil {
+		return nil, fmt.Errorf("discovering btrfs member devices: %w", err)
+	}
+
+	logger.Debug("discovered btrfs member devices",
+		sglog.String("source", mount.Source),
+		sglog.Strings("devicePaths", devicePaths),
+	)
+
+	return d.resolveDevicePaths(ctx, logger, sysfs, devicePaths)
+}
+
+// btrfsSourceDevicePaths returns the sysfs paths of all the member devices of the btrfs
+// filesystem that's mounted from source.
+//
+// The mount source is one of the filesystem's member devices (e.x. "/dev/sdb"), or a symlink
+// to one (e.x. "/dev/mapper/vg-data" -> "../dm-0"). Symlinks that udev creates for the
+// filesystem itself (e.x. "/dev/disk/by-uuid/<uuid>") are looked up in sysfs directly, so they
+// don't need to exist on the current system.
+func btrfsSourceDevicePaths(logger sglog.Logger, sysfs fs.FS, source string) ([]string, error) {
+	dir, name := path.Split(source)
+
+	switch dir {
+	case "/dev/disk/by-uuid/":
+		devicePaths, err := btrfsFilesystemDevicePaths(sysfs, name)
+		if err == nil {
+			return devicePaths, nil
+		}
+
+		logger.Debug("failed to look btrfs filesystem up by uuid",
+			sglog.String("source", source),
+			sglog.Error(err),
+		)
+
+	case "/dev/disk/by-label/":
+		filesystems, err := fs.ReadDir(sysfs, path.Join("fs", "btrfs"))
+		if err != nil {
+			return nil, fmt.Errorf("btrfsDevicePaths: failed to list btrfs filesystems: %w", err)
+		}
+
+		for _, filesystem := range filesystems {
+			if readSysfsAttribute(logger, sysfs, path.Join("fs", "btrfs", filesystem.Name(), "label")) == name {
+				return btrfsFilesystemDevicePaths(sysfs, filesystem.Name())
+			}
+		}
+	}
+
+	return btrfsDevicePaths(sysfs, mountSourceDeviceName(logger, sysfs, source))
+}
+
+// btrfsDevicePaths returns the sysfs paths of all the member devices of the btrfs
+// filesystem that the device with the provided name (e.x. "sdb") is a member of.
+//
+// The member devices of each btrfs filesystem are listed in /sys/fs/btrfs/<uuid>/devices,
+// and are returned in name order.
+func btrfsDevicePaths(sysfs fs.FS, name string) ([]string, error) {
+	filesystems, err := fs.ReadDir(sysfs, path.Join("fs", "btrfs"))
+	if err != nil {
+		return nil, fmt.Errorf("btrfsDevicePaths: failed to list btrfs filesystems: %w", err)
+	}
+
+	for _, filesystem := range filesystems {
+		devicesDir := path.Join("fs", "btrfs", filesystem.Name(), "devices")
+
+		// not every entry is a filesystem (e.x. "features")
+		members, err := fs.ReadDir(sysfs, devicesDir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("btrfsDevicePaths: failed to list member devices of btrfs filesystem %q: %w", filesystem.Name(), err)
+		}
+
+		if !containsEntry(members, name) {
+			continue
+		}
+
+		return btrfsFilesystemDevicePaths(sysfs, filesystem.Name())
+	}
+
+	return nil, fmt.Errorf("btrfsDevicePaths: device %q isn't a member of any btrfs filesystem", name)
+}
+
+// btrfsFilesystemDevicePaths returns the sysfs paths of all the member devices of the btrfs
+// filesystem with the provided uuid, in name order.
+func btrfsFilesystemDevicePaths(sysfs fs.FS, uuid string) ([]string, error) {
+	devicesDir := path.Join("fs", "btrfs", uuid, "devices")
+
+	members, err := fs.ReadDir(sysfs, devicesDir)
+	if err != nil {
+		return nil, fmt.Errorf("btrfsDevicePaths: failed to list member devices of btrfs filesystem %q: %w", uuid, err)
+	}
+
+	var devicePaths []string
+	for _, member := range members {
+		memberLink := path.Join(devicesDir, member.Name())
+
+		devicePath, err := evalSymlinks(sysfs, memberLink)
+		if err != nil {
+			return nil, fmt.Errorf("btrfsDevicePaths: failed to evaluate member device symlink %q: %w", memberLink, err)
+		}
+
+		devicePaths = append(devicePaths, devicePath)
+	}
+
+	return devicePaths, nil
+}
+
+// containsEntry returns true if one of the provided directory entries is named name.
+func containsEntry(entries []fs.DirEntry, name string) bool {
+	for _, entry := range entries {
+		if entry.Name() == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,233 @@
+package mountinfo
+
+import (
+	"container/list"
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+// CachingDiscoverer wraps a Discoverer, and caches the results of successful discoveries
+// for each file path.
+//
+// Cached results expire after a fixed TTL, so that changes (e.x. a volume that's moved to
+// another device) are eventually reflected. Failed discoveries are never cached.
+//
+// A CachingDiscoverer is safe for concurrent use by multiple goroutines.
+type CachingDiscoverer struct {
+	// discoverDevice returns information about the block device that filePath is stored on.
+	discoverDevice func(ctx context.Context, logger sglog.Logger, filePath string) (Device, error)
+
+	// discoverDeviceNames returns the names of all the block devices that filePath is stored on.
+	discoverDeviceNames func(ctx context.Context, logger sglog.Logger, filePath string) ([]string, error)
+
+	devices *lruCache[Device]
+	names   *lruCache[[]string]
+
+	// metrics records how long cache hits take (nil if they aren't measured). Cache misses
+	// are measured by the wrapped Discoverer.
+	metrics *discoveryMetrics
+}
+
+// NewCachingDiscoverer returns a CachingDiscoverer that caches the results of d for ttl.
+//
+// At most maxEntries file paths are cached for each kind of discovery. Once that limit is reached,
+// the least recently used file path is evicted. If maxEntries is zero or negative, the number of
+// cached file paths isn't bounded.
+func NewCachingDiscoverer(d *Discoverer, ttl time.Duration, maxEntries int) *CachingDiscoverer {
+	return &CachingDiscoverer{
+		discoverDevice:      d.discoverDeviceAt,
+		discoverDeviceNames: d.discoverDeviceNamesAt,
+
+		devices: newLRUCache[Device](ttl, maxEntries),
+		names:   newLRUCache[[]string](ttl, maxEntries),
+
+		metrics: d.metrics,
+	}
+}
+
+// DiscoverDevice calls DiscoverDevice on the wrapped Discoverer, unless the result for
+// filePath is already cached.
+func (c *CachingDiscoverer) DiscoverDevice(logger sglog.Logger, filePath string) (Device, error) {
+	return c.discoverDeviceContext(context.Background(), logger, filePath)
+}
+
+// DiscoverDeviceNames calls DiscoverDeviceNames on the wrapped Discoverer, unless the result
+// for filePath is already cached.
+func (c *CachingDiscoverer) DiscoverDeviceNames(logger sglog.Logger, filePath string) ([]string, error) {
+	start := c.now()
+
+	key, err := cacheKey(filePath)
+	if err != nil {
+		return c.discoverDeviceNames(context.Background(), logger, filePath)
+	}
+
+	if names, ok := c.names.get(key); ok {
+		c.observeHit(start)
+		return append([]string(nil), names...), nil
+	}
+
+	names, err := c.discoverDeviceNames(context.Background(), logger, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	c.names.add(key, append([]string(nil), names...))
+	return names, nil
+}
+
+// DiscoverDeviceNameContext calls DiscoverDeviceNameContext on the wrapped Discoverer, unless
+// the result for filePath is already cached.
+func (c *CachingDiscoverer) DiscoverDeviceNameContext(ctx context.Context, logger sglog.Logger, filePath string) (string, error) {
+	device, err := c.discoverDeviceContext(ctx, logger, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	return device.Name, nil
+}
+
+// Purge discards all of the cached results.
+func (c *CachingDiscoverer) Purge() {
+	c.devices.purge()
+	c.names.purge()
+}
+
+func (c *CachingDiscoverer) discoverDeviceContext(ctx context.Context, logger sglog.Logger, filePath string) (Device, error) {
+	start := c.now()
+
+	key, err := cacheKey(filePath)
+	if err != nil {
+		return c.discoverDevice(ctx, logger, filePath)
+	}
+
+	if device, ok := c.devices.get(key); ok {
+		c.observeHit(start)
+		return device, nil
+	}
+
+	device, err := c.discoverDevice(ctx, logger, filePath)
+	if err != nil {
+		return Device{}, err
+	}
+
+	c.devices.add(key, device)
+	return device, nil
+}
+
+// now returns the current time if cache hits are measured, so that unmeasured lookups
+// don't pay for reading the clock.
+func (c *CachingDiscoverer) now() time.Time {
+	if c.metrics == nil {
+		return time.Time{}
+	}
+
+	return time.Now()
+}
+
+// observeHit records a cache hit for a lookup that started at start.
+func (c *CachingDiscoverer) observeHit(start time.Time) {
+	if c.metrics != nil {
+		c.metrics.observe(cacheHit, start, nil)
+	}
+}
+
+// cacheKey returns the key that the results for filePath are cached under, so that
+// different spellings of the same path (e.x. "./data" and "/home/data") share an entry.
+func cacheKey(filePath string) (string, error) {
+	// filepath.Abs also cleans the path
+	return filepath.Abs(filePath)
+}
+
+// lruCache is a map with a bounded number of entries, which expire after a fixed TTL.
+type lruCache[V any] struct {
+	ttl        time.Duration
+	maxEntries int
+
+	// now returns the current time
+	now func() time.Time
+
+	// mu protects entries and order
+	mu sync.Mutex
+
+	// entries maps each key to its element in order
+	entries map[string]*list.Element
+
+	// order contains the *lruEntry values, ordered from most to least recently used
+	order *list.List
+}
+
+type lruEntry[V any] struct {
+	key       string
+	value     V
+	expiresAt time.Time
+}
+
+func newLRUCache[V any](ttl time.Duration, maxEntries int) *lruCache[V] {
+	return &lruCache[V]{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// get returns the value cached for key, if there's one that hasn't expired yet.
+func (c *lruCache[V]) get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+
+	element, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+
+	entry := element.Value.(*lruEntry[V])
+	if !c.now().Before(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+
+		return zero, false
+	}
+
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// add caches value for key, evicting the least recently used entry if the cache is full.
+func (c *lruCache[V]) add(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &lruEntry[V]{key: key, value: value, expiresAt: c.now().Add(c.ttl)}
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+
+	if c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry[V]).key)
+	}
+}
+
+// purge discards all of the cached entries.
+func (c *lruCache[V]) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
@@ -0,0 +1,119 @@
+package mountinfo
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	sglog "github.com/sourcegraph/log"
+	"github.com/sourcegraph/log/logtest"
+)
+
+func Test_CachingDiscoverer(t *testing.T) {
+	logger := logtest.Scoped(t)
+
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	fail := false
+
+	c := NewCachingDiscoverer(NewDiscoverer(), time.Minute, 2)
+	c.discoverDevice = func(ctx context.Context, logger sglog.Logger, filePath string) (Device, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls[filepath.Clean(filePath)]++
+		if fail {
+			return Device{}, errors.New("discovery failed")
+		}
+
+		return Device{Name: "sda", Mountpoint: "/"}, nil
+	}
+
+	now := time.Now()
+	c.devices.now = func() time.Time { return now }
+
+	discover := func(filePath string, expectedCalls int) {
+		t.Helper()
+
+		device, err := c.DiscoverDevice(logger, filePath)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if device.Name != "sda" {
+			t.Fatalf("expected device name %q, got %q", "sda", device.Name)
+		}
+
+		if actualCalls := calls[filepath.Clean(filePath)]; actualCalls != expectedCalls {
+			t.Fatalf("expected %q to be discovered %d time(s), got %d", filePath, expectedCalls, actualCalls)
+		}
+	}
+
+	discover("/data", 1)
+	discover("/data", 1)         // cached
+	discover("/data/../data", 1) // cached under the cleaned path
+
+	// entries expire after the TTL
+	now = now.Add(time.Minute)
+	discover("/data", 2)
+
+	// the least recently used entry is evicted once the cache is full
+	discover("/home", 1)
+	discover("/data", 2)
+	discover("/var", 1) // evicts /home
+	discover("/data", 2)
+	discover("/home", 2)
+
+	c.Purge()
+	discover("/data", 3)
+
+	// errors aren't cached
+	c.Purge()
+	fail = true
+
+	if _, err := c.DiscoverDevice(logger, "/data"); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	fail = false
+	discover("/data", 5)
+}
+
+func Test_CachingDiscoverer_Concurrent(t *testing.T) {
+	logger := logtest.Scoped(t)
+
+	c := NewCachingDiscoverer(NewDiscoverer(), time.Minute, 0)
+	c.discoverDeviceNames = func(ctx context.Context, logger sglog.Logger, filePath string) ([]string, error) {
+		return []string{"sda", "sdb"}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				names, err := c.DiscoverDeviceNames(logger, "/data")
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+					return
+				}
+
+				if len(names) != 2 {
+					t.Errorf("expected 2 device names, got %q", names)
+					return
+				}
+
+				// callers are free to modify the returned slice
+				names[0] = "modified"
+			}
+		}()
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,184 @@
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+// Confidence describes how sure discovery is that a candidate device is the physical device that
+// a file path is stored on. Higher values are more confident.
+type Confidence int
+
+const (
+	// ConfidenceLow means that discovery couldn't reach the physical device, and fell back to a
+	// less useful device (e.x. a device-mapper device that doesn't list the devices that back it).
+	ConfidenceLow Confidence = iota + 1
+
+	// ConfidenceMedium means that the device is one of several physical devices that the file
+	// path's filesystem is stored on (e.x. a member of a RAID array, or of a btrfs filesystem
+	// that spans multiple disks), and it isn't known which of them stores the file itself.
+	ConfidenceMedium
+
+	// ConfidenceHigh means that the device is the only physical device that the file path's
+	// filesystem is stored on.
+	ConfidenceHigh
+)
+
+// CandidateReason describes why a device is a candidate for the device that a file path is stored on.
+type CandidateReason string
+
+const (
+	// CandidateOnlyDevice means that the device is the only device that the filesystem is stored on.
+	CandidateOnlyDevice CandidateReason = "only_device"
+
+	// CandidateOneOfMany means that the device is one of several devices that the filesystem is
+	// stored on.
+	CandidateOneOfMany CandidateReason = "one_of_many"
+
+	// CandidateFallback means that discovery fell back to the device (see DeviceCandidate.Fallback
+	// for the reason).
+	CandidateFallback CandidateReason = "fallback"
+)
+
+// DeviceCandidate is one of the devices that a file path might be stored on.
+type DeviceCandidate struct {
+	// Name is the name of the device (example: "sda"), in the same form as the names that
+	// DiscoverDeviceNames returns.
+	Name string
+
+	// Confidence is how sure discovery is that the device is the one that stores the file path.
+	Confidence Confidence
+
+	// Reason is why the device is a candidate.
+	Reason CandidateReason
+
+	// Fallback is why discovery fell back to the device (empty unless Reason is CandidateFallback).
+	Fallback FallbackReason
+}
+
+// DiscoverDeviceCandidates returns all of the devices that filePath might be stored on, ranked
+// from the most to the least confident. It's meant for cases where a single answer hides
+// information: filesystems that span multiple devices (e.x. RAID arrays and multi-device btrfs
+// filesystems), and devices that discovery couldn't follow down to a physical disk.
+//
+// Callers that want a single answer can use the first candidate, and diagnostics can show all of
+// them (along with the steps of DiscoverDeviceTrace). Candidates with the same confidence are
+// returned in the order that DiscoverDeviceNames returns them in, so unless discovery fell back
+// to a less useful device for some of them, the first candidate is the device that
+// DiscoverDevice reports.
+//
+// See the doc comment for NewCollector for the list of supported operating systems.
+func (d *Discoverer) DiscoverDeviceCandidates(logger sglog.Logger, filePath string) ([]DeviceCandidate, error) {
+	collector := &fallbackCollector{}
+
+	c := *d
+	c.fallbacks = collector
+
+	names, err := c.discoverDeviceNamesAt(context.Background(), logger, filePath)
+	if err != nil {
+		return nil, fmt.Errorf("DiscoverDeviceCandidates: %w", err)
+	}
+
+	return rankCandidates(names, collector.recorded()), nil
+}
+
+// DiscoverDeviceCandidates calls DiscoverDeviceCandidates on a Discoverer that inspects the current system.
+func DiscoverDeviceCandidates(logger sglog.Logger, filePath string) ([]DeviceCandidate, error) {
+	return defaultDiscoverer.DiscoverDeviceCandidates(logger, filePath)
+}
+
+// rankCandidates returns the candidates for the device names that discovery reported, given the
+// fallbacks that it took along the way, ranked from the most to the least confident.
+func rankCandidates(names []string, fallbacks []recordedFallback) []DeviceCandidate {
+	byName, forAll := unresolvedFallbacks(fallbacks)
+
+	candidates := make([]DeviceCandidate, 0, len(names))
+	for _, name := range names {
+		candidate := DeviceCandidate{Name: name, Confidence: ConfidenceHigh, Reason: CandidateOnlyDevice}
+		if len(names) > 1 {
+			candidate.Confidence, candidate.Reason = ConfidenceMedium, CandidateOneOfMany
+		}
+
+		reason, ok := byName[NormalizeDeviceName(name)]
+		if !ok {
+			reason, ok = forAll, forAll != ""
+		}
+
+		if ok {
+			candidate.Confidence, candidate.Reason, candidate.Fallback = ConfidenceLow, CandidateFallback, reason
+		}
+
+		candidates = append(candidates, candidate)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Confidence > candidates[j].Confidence
+	})
+
+	return candidates
+}
+
+// recordedFallback is a fallback that discovery took.
+type recordedFallback struct {
+	// reason is why discovery fell back
+	reason FallbackReason
+
+	// device is the name of the device that discovery reported because of the fallback (empty
+	// if it isn't known)
+	device string
+}
+
+// fallbackCollector records the fallbacks that discovery takes.
+type fallbackCollector struct {
+	// mu protects fallbacks
+	mu sync.Mutex
+
+	fallbacks []recordedFallback
+}
+
+// record records that discovery fell back because of reason, and reported device because of it.
+func (c *fallbackCollector) record(reason FallbackReason, device string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.fallbacks = append(c.fallbacks, recordedFallback{reason: reason, device: device})
+}
+
+// recorded returns all of the fallbacks that have been recorded so far.
+func (c *fallbackCollector) recorded() []recordedFallback {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]recordedFallback(nil), c.fallbacks...)
+}
+
+// unresolvedFallbacks returns the provided fallbacks that made discovery report a device other
+// than a physical disk, keyed by the name of that device. Fallbacks that don't name the device
+// (e.x. because the operating system only ever reports a single one) are returned as forAll
+// instead.
+//
+// Fallbacks that still report the physical disk (e.x. FallbackDiskutilList) are skipped.
+func unresolvedFallbacks(fallbacks []recordedFallback) (byName map[string]FallbackReason, forAll FallbackReason) {
+	byName = make(map[string]FallbackReason)
+
+	for _, fallback := range fallbacks {
+		switch fallback.reason {
+		case FallbackLoopBackingFileUnresolved, FallbackDeviceMapperWithoutSlaves, FallbackThinPoolUnresolved, FallbackDiskutilUnavailable:
+		default:
+			continue
+		}
+
+		if fallback.device == "" {
+			forAll = fallback.reason
+			continue
+		}
+
+		byName[NormalizeDeviceName(fallback.device)] = fallback.reason
+	}
+
+	return byName, forAll
+}
@@ -0,0 +1,91 @@
+package mountinfo
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/moby/sys/mountinfo"
+	"github.com/sourcegraph/log/logtest"
+)
+
+func Test_DiscoverDeviceCandidates(t *testing.T) {
+	// sdb1 is a partition of a single disk, md0 is a RAID array of sdc and sdd, and dm-6
+	// doesn't list its slaves
+	sysfs := fstest.MapFS{
+		"class/block": {Mode: fs.ModeDir},
+
+		"dev/block/8:17":  symlink("../../devices/pci0/host1/block/sdb/sdb1"),
+		"dev/block/9:0":   symlink("../../devices/virtual/block/md0"),
+		"dev/block/253:6": symlink("../../devices/virtual/block/dm-6"),
+
+		"devices/pci0/host1/block/sdb/subsystem":      symlink("../../../../../class/block"),
+		"devices/pci0/host1/block/sdb/sdb1/partition": {Data: []byte("1\n")},
+		"devices/pci0/host2/block/sdc/subsystem":      symlink("../../../../../class/block"),
+		"devices/pci0/host3/block/sdd/subsystem":      symlink("../../../../../class/block"),
+
+		"devices/virtual/block/md0/subsystem":  symlink("../../../../class/block"),
+		"devices/virtual/block/md0/slaves/sdc": symlink("../../../../pci0/host2/block/sdc"),
+		"devices/virtual/block/md0/slaves/sdd": symlink("../../../../pci0/host3/block/sdd"),
+		"devices/virtual/block/dm-6/subsystem": symlink("../../../../class/block"),
+		"devices/virtual/block/dm-6/dm/name":   {Data: []byte("vg0-scratch\n")},
+	}
+
+	for _, test := range []struct {
+		name string
+
+		deviceMajor uint32
+		deviceMinor uint32
+
+		expected []DeviceCandidate
+	}{
+		{
+			name:        "single disk",
+			deviceMajor: 8,
+			deviceMinor: 17,
+			expected: []DeviceCandidate{
+				{Name: "sdb", Confidence: ConfidenceHigh, Reason: CandidateOnlyDevice},
+			},
+		},
+		{
+			name:        "raid array",
+			deviceMajor: 9,
+			deviceMinor: 0,
+			expected: []DeviceCandidate{
+				{Name: "sdc", Confidence: ConfidenceMedium, Reason: CandidateOneOfMany},
+				{Name: "sdd", Confidence: ConfidenceMedium, Reason: CandidateOneOfMany},
+			},
+		},
+		{
+			name:        "device-mapper device without slaves",
+			deviceMajor: 253,
+			deviceMinor: 6,
+			expected: []DeviceCandidate{
+				{Name: "dm-6", Confidence: ConfidenceLow, Reason: CandidateFallback, Fallback: FallbackDeviceMapperWithoutSlaves},
+			},
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			d := NewDiscoverer(WithSysfs(sysfs))
+			d.resolvePath = unresolvedPath
+			d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+				return test.deviceMajor, test.deviceMinor, nil
+			}
+			d.findMount = func(filePath string) (*mountinfo.Info, error) {
+				return &mountinfo.Info{Mountpoint: "/data", FSType: "xfs"}, nil
+			}
+
+			candidates, err := d.DiscoverDeviceCandidates(logtest.Scoped(t), "doesn't matter")
+			if err != nil {
+				t.Fatalf("discovering device candidates: %s", err)
+			}
+
+			if diff := cmp.Diff(test.expected, candidates); diff != "" {
+				t.Fatalf("recieved unexpected device candidates (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
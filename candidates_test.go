@@ -0,0 +1,81 @@
+package mountinfo
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_UnresolvedFallbacks(t *testing.T) {
+	fallbacks := []recordedFallback{
+		{reason: FallbackThinPoolUnresolved, device: "vg0-pool0-tpool"},
+		{reason: FallbackLoopBackingFileUnresolved, device: "loop0"},
+		{reason: FallbackDiskutilList},
+	}
+
+	byName, forAll := unresolvedFallbacks(fallbacks)
+
+	expected := map[string]FallbackReason{
+		"vg0-pool0-tpool": FallbackThinPoolUnresolved,
+		"loop0":           FallbackLoopBackingFileUnresolved,
+	}
+
+	if diff := cmp.Diff(expected, byName); diff != "" {
+		t.Fatalf("recieved unexpected fallbacks (-want +got):\n%s", diff)
+	}
+
+	// diskutil list still reports the physical disk
+	if forAll != "" {
+		t.Fatalf("expected no fallback for all devices, got %q", forAll)
+	}
+}
+
+func Test_RankCandidates(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		names     []string
+		fallbacks []recordedFallback
+		expected  []DeviceCandidate
+	}{
+		{
+			name:     "single device",
+			names:    []string{"sda"},
+			expected: []DeviceCandidate{{Name: "sda", Confidence: ConfidenceHigh, Reason: CandidateOnlyDevice}},
+		},
+		{
+			// the BSD device "disk3s1s1" is logged, but its whole disk is what's reported
+			name:      "fallback for reported device",
+			names:     []string{"disk3"},
+			fallbacks: []recordedFallback{{reason: FallbackDiskutilUnavailable, device: "disk3"}},
+			expected: []DeviceCandidate{
+				{Name: "disk3", Confidence: ConfidenceLow, Reason: CandidateFallback, Fallback: FallbackDiskutilUnavailable},
+			},
+		},
+		{
+			name:      "fallback for one of many devices",
+			names:     []string{"dm-6", "sdc", "sdd"},
+			fallbacks: []recordedFallback{{reason: FallbackDeviceMapperWithoutSlaves, device: "dm-6"}},
+			expected: []DeviceCandidate{
+				{Name: "sdc", Confidence: ConfidenceMedium, Reason: CandidateOneOfMany},
+				{Name: "sdd", Confidence: ConfidenceMedium, Reason: CandidateOneOfMany},
+				{Name: "dm-6", Confidence: ConfidenceLow, Reason: CandidateFallback, Fallback: FallbackDeviceMapperWithoutSlaves},
+			},
+		},
+		{
+			name:      "fallback without device",
+			names:     []string{"sda"},
+			fallbacks: []recordedFallback{{reason: FallbackLoopBackingFileUnresolved}},
+			expected: []DeviceCandidate{
+				{Name: "sda", Confidence: ConfidenceLow, Reason: CandidateFallback, Fallback: FallbackLoopBackingFileUnresolved},
+			},
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.expected, rankCandidates(test.names, test.fallbacks)); diff != "" {
+				t.Fatalf("recieved unexpected candidates (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package mountinfo
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/moby/sys/mountinfo"
+	sglog "github.com/sourcegraph/log"
+)
+
+// CgroupIOStats contains the amount of IO that the current process's cgroup has done on
+// a single block device.
+//
+// Unlike DiskStats (which covers all of the IO that the device has done, including the IO
+// of other containers on the same host), these statistics only cover the IO that's
+// accounted to the cgroup.
+type CgroupIOStats struct {
+	// ReadBytes is the number of bytes that the cgroup has read from the device.
+	ReadBytes uint64
+
+	// WrittenBytes is the number of bytes that the cgroup has written to the device.
+	WrittenBytes uint64
+}
+
+// ReadCgroupIOStats returns the IO statistics of the current process's cgroup for each of the
+// block devices that filePath is stored on, keyed by device name (example: "sda").
+//
+// Both the unified (v2) cgroup hierarchy and the blkio controller of the legacy (v1) hierarchy
+// are supported. If neither is mounted, the returned error wraps ErrCgroupNotMounted.
+//
+// Devices that the cgroup hasn't done any IO on are reported with zero values.
+//
+// This operation is currently only supported on Linux. On all other operating systems, the returned
+// error wraps ErrUnsupportedPlatform.
+func (d *Discoverer) ReadCgroupIOStats(logger sglog.Logger, filePath string) (map[string]CgroupIOStats, error) {
+	return d.cgroupIOStats(context.Background(), logger, filePath)
+}
+
+// ReadCgroupIOStats calls ReadCgroupIOStats on a Discoverer that inspects the current system.
+func ReadCgroupIOStats(logger sglog.Logger, filePath string) (map[string]CgroupIOStats, error) {
+	return defaultDiscoverer.ReadCgroupIOStats(logger, filePath)
+}
+
+// cgroupVersion identifies the cgroup hierarchy that IO statistics are read from.
+type cgroupVersion int
+
+const (
+	cgroupV1 cgroupVersion = 1
+	cgroupV2 cgroupVersion = 2
+)
+
+// cgroupIOStatsFile returns the location of the file that contains the IO statistics of the
+// cgroup described by procCgroup (the contents of /proc/self/cgroup), along with the version
+// of the hierarchy that it's part of. mounts must contain the mounted cgroup filesystems.
+//
+// On hosts that use the "hybrid" layout (where both hierarchies are mounted), the blkio controller
+// can only be bound to one of them, so the legacy (v1) hierarchy is used if it has the controller.
+func cgroupIOStatsFile(mounts []*mountinfo.Info, procCgroup string) (string, cgroupVersion, error) {
+	var v2Path string
+	var v1Path string
+	hasV2, hasV1 := false, false
+
+	for _, line := range strings.Split(procCgroup, "\n") {
+		// <hierarchy ID>:<comma separated controllers>:<path>
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		if parts[0] == "0" && parts[1] == "" {
+			v2Path, hasV2 = parts[2], true
+			continue
+		}
+
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller == "blkio" {
+				v1Path, hasV1 = parts[2], true
+			}
+		}
+	}
+
+	for _, mount := range mounts {
+		if hasV1 && mount.FSType == "cgroup" && hasMountOption(mount.VFSOptions, "blkio") {
+			return cgroupPath(mount, v1Path, "blkio.throttle.io_service_bytes"), cgroupV1, nil
+		}
+	}
+
+	for _, mount := range mounts {
+		if hasV2 && mount.FSType == "cgroup2" {
+			return cgroupPath(mount, v2Path, "io.stat"), cgroupV2, nil
+		}
+	}
+
+	return "", 0, fmt.Errorf("cgroupIOStatsFile: %w", ErrCgroupNotMounted)
+}
+
+// cgroupPath returns the location of the file with the provided name that belongs to the
+// cgroup at cgroup (as listed in /proc/self/cgroup) in the hierarchy mounted at mount.
+func cgroupPath(mount *mountinfo.Info, cgroup, name string) string {
+	// the mount can be rooted at a nested cgroup (e.x. when a container runtime bind-mounts
+	// the container's own cgroup), in which case cgroup paths are relative to that cgroup
+	if mount.Root != "/" && (cgroup == mount.Root || strings.HasPrefix(cgroup, mount.Root+"/")) {
+		cgroup = strings.TrimPrefix(cgroup, mount.Root)
+	}
+
+	return path.Join(mount.Mountpoint, cgroup, name)
+}
+
+// hasMountOption returns true if the comma separated list of mount options contains option.
+func hasMountOption(options, option string) bool {
+	for _, o := range strings.Split(options, ",") {
+		if o == option {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseCgroupV2IOStat parses the contents of a cgroup v2 io.stat file into a set of
+// device number (in <major>:<minor> format) -> IO statistics mappings.
+//
+// See https://docs.kernel.org/admin-guide/cgroup-v2.html#io-interface-files
+func parseCgroupV2IOStat(r io.Reader) (map[string]CgroupIOStats, error) {
+	stats := make(map[string]CgroupIOStats)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// <major>:<minor> rbytes=<n> wbytes=<n> rios=<n> wios=<n> dbytes=<n> dios=<n>
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		var s CgroupIOStats
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				return nil, fmt.Errorf("parseCgroupV2IOStat: malformed line %q", scanner.Text())
+			}
+
+			var counter *uint64
+			switch key {
+			case "rbytes":
+				counter = &s.ReadBytes
+			case "wbytes":
+				counter = &s.WrittenBytes
+			default:
+				continue
+			}
+
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parseCgroupV2IOStat: malformed counter in line %q: %w", scanner.Text(), err)
+			}
+
+			*counter = n
+		}
+
+		stats[fields[0]] = s
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("parseCgroupV2IOStat: %w", err)
+	}
+
+	return stats, nil
+}
+
+// parseCgroupV1IOServiceBytes parses the contents of a cgroup v1 blkio.throttle.io_service_bytes
+// file into a set of device number (in <major>:<minor> format) -> IO statistics mappings.
+//
+// See https://docs.kernel.org/admin-guide/cgroup-v1/blkio-controller.html
+func parseCgroupV1IOServiceBytes(r io.Reader) (map[string]CgroupIOStats, error) {
+	stats := make(map[string]CgroupIOStats)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// <major>:<minor> <operation> <bytes>, followed by a "Total <bytes>" line
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+
+		n, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parseCgroupV1IOServiceBytes: malformed counter in line %q: %w", scanner.Text(), err)
+		}
+
+		s := stats[fields[0]]
+		switch fields[1] {
+		case "Read":
+			s.ReadBytes = n
+		case "Write":
+			s.WrittenBytes = n
+		default:
+			continue
+		}
+
+		stats[fields[0]] = s
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("parseCgroupV1IOServiceBytes: %w", err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,83 @@
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/moby/sys/mountinfo"
+	sglog "github.com/sourcegraph/log"
+)
+
+// procSelfCgroupPath is the location of the list of cgroups that the current process is a member of.
+const procSelfCgroupPath = "/proc/self/cgroup"
+
+func (d *Discoverer) cgroupIOStats(ctx context.Context, logger sglog.Logger, filePath string) (map[string]CgroupIOStats, error) {
+	names, err := d.discoverDeviceNamesAt(ctx, logger, filePath)
+	if err != nil {
+		return nil, fmt.Errorf("cgroupIOStats: discovering device names: %w", err)
+	}
+
+	sysfs, err := d.sysfs()
+	if err != nil {
+		return nil, fmt.Errorf("cgroupIOStats: %w", err)
+	}
+
+	statsByNumber, err := readCgroupIOStats(logger)
+	if err != nil {
+		return nil, fmt.Errorf("cgroupIOStats: %w", err)
+	}
+
+	stats := make(map[string]CgroupIOStats, len(names))
+	for _, name := range names {
+		// /sys/block/<name>/dev contains the device's number in <major>:<minor> format
+		contents, err := readSysfsFile(sysfs, path.Join("block", name, "dev"))
+		if err != nil {
+			return nil, fmt.Errorf("cgroupIOStats: discovering number of device %q: %w", name, err)
+		}
+
+		// the cgroup doesn't list devices that it hasn't done any IO on
+		stats[name] = statsByNumber[strings.TrimSpace(string(contents))]
+	}
+
+	return stats, nil
+}
+
+// readCgroupIOStats returns the IO statistics of the current process's cgroup, keyed by
+// device number (in <major>:<minor> format).
+func readCgroupIOStats(logger sglog.Logger) (map[string]CgroupIOStats, error) {
+	mounts, err := getMounts(mountinfo.FSTypeFilter("cgroup2", "cgroup"))
+	if err != nil {
+		return nil, fmt.Errorf("readCgroupIOStats: %w", procfsError(standardProcfsMountpoint, err))
+	}
+
+	procCgroup, err := os.ReadFile(procSelfCgroupPath)
+	if err != nil {
+		return nil, fmt.Errorf("readCgroupIOStats: %w", procfsError(standardProcfsMountpoint, err))
+	}
+
+	statsPath, version, err := cgroupIOStatsFile(mounts, string(procCgroup))
+	if err != nil {
+		return nil, fmt.Errorf("readCgroupIOStats: %w", err)
+	}
+
+	logger.Debug("discovered cgroup IO statistics file",
+		sglog.String("statsPath", statsPath),
+		sglog.Int("cgroupVersion", int(version)),
+	)
+
+	f, err := os.Open(statsPath)
+	if err != nil {
+		return nil, fmt.Errorf("readCgroupIOStats: %w", err)
+	}
+
+	defer f.Close()
+
+	if version == cgroupV1 {
+		return parseCgroupV1IOServiceBytes(f)
+	}
+
+	return parseCgroupV2IOStat(f)
+}
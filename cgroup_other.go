@@ -0,0 +1,15 @@
+//go:build !linux
+
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+func (d *Discoverer) cgroupIOStats(ctx context.Context, logger sglog.Logger, filePath string) (map[string]CgroupIOStats, error) {
+	return nil, fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
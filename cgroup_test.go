@@ -0,0 +1,154 @@
+package mountinfo
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/moby/sys/mountinfo"
+)
+
+func Test_CgroupIOStatsFile(t *testing.T) {
+	v2Mount := &mountinfo.Info{Mountpoint: "/sys/fs/cgroup", Root: "/", FSType: "cgroup2", VFSOptions: "rw,nsdelegate"}
+	v1Mount := &mountinfo.Info{Mountpoint: "/sys/fs/cgroup/blkio", Root: "/", FSType: "cgroup", VFSOptions: "rw,blkio"}
+	v1CPUMount := &mountinfo.Info{Mountpoint: "/sys/fs/cgroup/cpu", Root: "/", FSType: "cgroup", VFSOptions: "rw,cpu,cpuacct"}
+
+	for _, test := range []struct {
+		name       string
+		mounts     []*mountinfo.Info
+		procCgroup string
+
+		expectedPath    string
+		expectedVersion cgroupVersion
+		expectError     bool
+	}{
+		{
+			name:            "cgroup v2",
+			mounts:          []*mountinfo.Info{v2Mount},
+			procCgroup:      "0::/system.slice/app.service\n",
+			expectedPath:    "/sys/fs/cgroup/system.slice/app.service/io.stat",
+			expectedVersion: cgroupV2,
+		},
+		{
+			name:            "cgroup v2 with a cgroup namespace",
+			mounts:          []*mountinfo.Info{v2Mount},
+			procCgroup:      "0::/\n",
+			expectedPath:    "/sys/fs/cgroup/io.stat",
+			expectedVersion: cgroupV2,
+		},
+		{
+			name: "cgroup v2 mount rooted at the container's cgroup",
+			mounts: []*mountinfo.Info{
+				{Mountpoint: "/sys/fs/cgroup", Root: "/docker/abc", FSType: "cgroup2"},
+			},
+			procCgroup:      "0::/docker/abc\n",
+			expectedPath:    "/sys/fs/cgroup/io.stat",
+			expectedVersion: cgroupV2,
+		},
+		{
+			name:            "cgroup v1",
+			mounts:          []*mountinfo.Info{v1CPUMount, v1Mount},
+			procCgroup:      "5:cpu,cpuacct:/docker/abc\n4:blkio:/docker/abc\n1:name=systemd:/docker/abc\n",
+			expectedPath:    "/sys/fs/cgroup/blkio/docker/abc/blkio.throttle.io_service_bytes",
+			expectedVersion: cgroupV1,
+		},
+		{
+			name:            "hybrid hierarchy with blkio bound to cgroup v1",
+			mounts:          []*mountinfo.Info{v2Mount, v1Mount},
+			procCgroup:      "4:blkio:/user.slice\n0::/user.slice\n",
+			expectedPath:    "/sys/fs/cgroup/blkio/user.slice/blkio.throttle.io_service_bytes",
+			expectedVersion: cgroupV1,
+		},
+		{
+			name:            "hybrid hierarchy without blkio bound to cgroup v1",
+			mounts:          []*mountinfo.Info{v1CPUMount, v2Mount},
+			procCgroup:      "5:cpu,cpuacct:/user.slice\n0::/user.slice\n",
+			expectedPath:    "/sys/fs/cgroup/user.slice/io.stat",
+			expectedVersion: cgroupV2,
+		},
+		{
+			name:        "no blkio controller",
+			mounts:      []*mountinfo.Info{v1CPUMount},
+			procCgroup:  "5:cpu,cpuacct:/\n",
+			expectError: true,
+		},
+		{
+			name:        "nothing mounted",
+			procCgroup:  "0::/\n",
+			expectError: true,
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			actualPath, actualVersion, err := cgroupIOStatsFile(test.mounts, test.procCgroup)
+			if test.expectError {
+				if !errors.Is(err, ErrCgroupNotMounted) {
+					t.Fatalf("expected error wrapping ErrCgroupNotMounted, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if actualPath != test.expectedPath {
+				t.Errorf("recieved unexpected path (want %q, got %q)", test.expectedPath, actualPath)
+			}
+
+			if actualVersion != test.expectedVersion {
+				t.Errorf("recieved unexpected cgroup version (want %d, got %d)", test.expectedVersion, actualVersion)
+			}
+		})
+	}
+}
+
+func Test_ParseCgroupIOStats(t *testing.T) {
+	expected := map[string]CgroupIOStats{
+		"8:0":   {ReadBytes: 1048576, WrittenBytes: 4096},
+		"259:0": {ReadBytes: 0, WrittenBytes: 8192},
+	}
+
+	v2 := strings.Join([]string{
+		"8:0 rbytes=1048576 wbytes=4096 rios=256 wios=1 dbytes=0 dios=0",
+		"259:0 rbytes=0 wbytes=8192 rios=0 wios=2 dbytes=0 dios=0",
+	}, "\n")
+
+	actual, err := parseCgroupV2IOStat(strings.NewReader(v2))
+	if err != nil {
+		t.Fatalf("parsing io.stat: %s", err)
+	}
+
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("recieved unexpected cgroup v2 stats (-want +got):\n%s", diff)
+	}
+
+	v1 := strings.Join([]string{
+		"8:0 Read 1048576",
+		"8:0 Write 4096",
+		"8:0 Sync 1052672",
+		"8:0 Async 0",
+		"8:0 Discard 0",
+		"8:0 Total 1052672",
+		"259:0 Read 0",
+		"259:0 Write 8192",
+		"259:0 Total 8192",
+		"Total 1060864",
+	}, "\n")
+
+	actual, err = parseCgroupV1IOServiceBytes(strings.NewReader(v1))
+	if err != nil {
+		t.Fatalf("parsing blkio.throttle.io_service_bytes: %s", err)
+	}
+
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("recieved unexpected cgroup v1 stats (-want +got):\n%s", diff)
+	}
+
+	if _, err := parseCgroupV2IOStat(strings.NewReader("8:0 rbytes=abc")); err == nil {
+		t.Fatal("expected error for malformed io.stat, got nil")
+	}
+}
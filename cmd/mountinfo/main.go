@@ -0,0 +1,109 @@
+// Command mountinfo prints information about the block device that a file path is stored on.
+//
+// It's intended for debugging device discovery on a machine where disk metrics are missing or
+// mislabeled:
+//
+//	$ mountinfo /home/.zoekt
+//	device:      sdb
+//	mountpoint:  /home
+//	fstype:      ext4
+//	major:minor: 8:16
+//
+// With -json, the device is printed as a JSON object instead. With -v, the steps that discovery
+// took are printed to standard error as well.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	sglog "github.com/sourcegraph/log"
+
+	"github.com/sourcegraph/mountinfo"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command with the provided arguments (excluding the program name), and
+// returns its exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("mountinfo", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: mountinfo [-json] [-v] <path>")
+		flags.PrintDefaults()
+	}
+
+	jsonOutput := flags.Bool("json", false, "print the device as a JSON object")
+	verbose := flags.Bool("v", false, "print the steps that discovery took to standard error")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	logger := sglog.NoOp()
+	filePath := flags.Arg(0)
+
+	if *verbose {
+		// the steps are printed even if discovery fails, since that's when they're most useful
+		_, steps, _ := mountinfo.DiscoverDeviceTrace(logger, filePath)
+		printTrace(stderr, steps)
+	}
+
+	device, err := mountinfo.DiscoverDevice(logger, filePath)
+	if err != nil {
+		fmt.Fprintf(stderr, "mountinfo: failed to discover the device that %q is stored on: %s\n", filePath, err)
+		return 1
+	}
+
+	if err := printDevice(stdout, device, *jsonOutput); err != nil {
+		fmt.Fprintf(stderr, "mountinfo: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// printDevice writes device to w, either as a JSON object or as human-readable text.
+func printDevice(w io.Writer, device mountinfo.Device, jsonOutput bool) error {
+	if jsonOutput {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(device)
+	}
+
+	_, err := fmt.Fprintf(w, "device:      %s\nmountpoint:  %s\nfstype:      %s\nmajor:minor: %d:%d\n",
+		device.Name, device.Mountpoint, device.FSType, device.Major, device.Minor)
+	return err
+}
+
+// printTrace writes the steps that discovery took to w, one per line.
+func printTrace(w io.Writer, steps []mountinfo.TraceStep) {
+	for _, step := range steps {
+		keys := make([]string, 0, len(step.Attributes))
+		for key := range step.Attributes {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		fmt.Fprint(w, step.Message)
+		for _, key := range keys {
+			fmt.Fprintf(w, " %s=%v", key, step.Attributes[key])
+		}
+
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sourcegraph/mountinfo"
+)
+
+func Test_Run_Usage(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"a", "b"},
+		{"-unknown", "a"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := run(args, &stdout, &stderr); code != 2 {
+			t.Errorf("expected exit code 2 for arguments %q, got %d", args, code)
+		}
+
+		if !strings.Contains(stderr.String(), "usage: mountinfo") {
+			t.Errorf("expected usage for arguments %q, got %q", args, stderr.String())
+		}
+	}
+}
+
+func Test_Run_Failure(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "deleted")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{filePath}, &stdout, &stderr); code != 1 {
+		t.Fatalf("expected exit code 1, got %d", code)
+	}
+
+	if stdout.Len() != 0 {
+		t.Errorf("expected no output, got %q", stdout.String())
+	}
+
+	if !strings.Contains(stderr.String(), filePath) {
+		t.Errorf("expected error message to mention %q, got %q", filePath, stderr.String())
+	}
+}
+
+func Test_PrintDevice(t *testing.T) {
+	device := mountinfo.Device{Name: "sdb", Major: 8, Minor: 16, Mountpoint: "/home", FSType: "ext4"}
+
+	var text bytes.Buffer
+	if err := printDevice(&text, device, false); err != nil {
+		t.Fatalf("printing device: %s", err)
+	}
+
+	expected := "device:      sdb\nmountpoint:  /home\nfstype:      ext4\nmajor:minor: 8:16\n"
+	if diff := cmp.Diff(expected, text.String()); diff != "" {
+		t.Errorf("recieved unexpected output (-want +got):\n%s", diff)
+	}
+
+	var jsonOutput bytes.Buffer
+	if err := printDevice(&jsonOutput, device, true); err != nil {
+		t.Fatalf("printing device: %s", err)
+	}
+
+	var decoded mountinfo.Device
+	if err := json.Unmarshal(jsonOutput.Bytes(), &decoded); err != nil {
+		t.Fatalf("decoding JSON output %q: %s", jsonOutput.String(), err)
+	}
+
+	if diff := cmp.Diff(device, decoded); diff != "" {
+		t.Errorf("recieved unexpected device (-want +got):\n%s", diff)
+	}
+}
+
+func Test_PrintTrace(t *testing.T) {
+	var output bytes.Buffer
+	printTrace(&output, []mountinfo.TraceStep{
+		{Message: "discovered device number", Attributes: map[string]interface{}{"deviceNumber": "8:1"}},
+		{Message: "stripped partition", Attributes: map[string]interface{}{"partitionPath": "block/sda/sda1", "diskPath": "block/sda"}},
+	})
+
+	expected := "discovered device number deviceNumber=8:1\nstripped partition diskPath=block/sda partitionPath=block/sda/sda1\n"
+	if diff := cmp.Diff(expected, output.String()); diff != "" {
+		t.Errorf("recieved unexpected output (-want +got):\n%s", diff)
+	}
+}
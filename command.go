@@ -0,0 +1,28 @@
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// runCommand runs the command with the provided name and arguments, and returns its standard
+// output.
+//
+// The command is killed if it doesn't finish within the Discoverer's command timeout (or once ctx
+// is done), in which case the returned error wraps the context's error (e.x. context.DeadlineExceeded).
+func (d *Discoverer) runCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if d.commandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.commandTimeout)
+		defer cancel()
+	}
+
+	output, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil && ctx.Err() != nil {
+		// the error that's returned for a killed command only says that it was killed
+		return output, fmt.Errorf("%s was killed: %w", name, ctx.Err())
+	}
+
+	return output, err
+}
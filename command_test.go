@@ -0,0 +1,37 @@
+//go:build unix
+
+package mountinfo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_RunCommand_Timeout(t *testing.T) {
+	d := NewDiscoverer(WithCommandTimeout(10 * time.Millisecond))
+
+	_, err := d.runCommand(context.Background(), "sleep", "10")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected error wrapping context.DeadlineExceeded, got %v", err)
+	}
+
+	// commands that finish in time aren't affected
+	output, err := NewDiscoverer().runCommand(context.Background(), "echo", "disk0")
+	if err != nil {
+		t.Fatalf("running echo: %s", err)
+	}
+
+	if string(output) != "disk0\n" {
+		t.Fatalf("recieved unexpected output (want %q, got %q)", "disk0\n", string(output))
+	}
+
+	// without a timeout, commands are still killed once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := NewDiscoverer(WithCommandTimeout(0)).runCommand(ctx, "sleep", "10"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected error wrapping context.Canceled, got %v", err)
+	}
+}
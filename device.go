@@ -1,14 +1,19 @@
-//go:build !(linux || darwin || windows)
+//go:build !(linux || darwin || windows || freebsd || netbsd || openbsd || solaris || aix)
 
 package mountinfo
 
 import (
+	"context"
 	"fmt"
 	"runtime"
 
 	sglog "github.com/sourcegraph/log"
 )
 
-func discoverDeviceName(logger sglog.Logger, filePath string) (string, error) {
-	return "", fmt.Errorf("not implemented on %s", runtime.GOOS)
+func (d *Discoverer) discoverDevice(ctx context.Context, logger sglog.Logger, filePath string) (Device, error) {
+	return Device{}, fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
+
+func (d *Discoverer) discoverDeviceNames(ctx context.Context, logger sglog.Logger, filePath string) ([]string, error) {
+	return nil, fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
 }
@@ -0,0 +1,138 @@
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/moby/sys/mountinfo"
+	sglog "github.com/sourcegraph/log"
+)
+
+// discoverDevice returns information about the block device that filePath is
+// stored on.
+func (d *Discoverer) discoverDevice(ctx context.Context, logger sglog.Logger, filePath string) (Device, error) {
+	mount, names, err := d.discoverPhysicalVolumes(ctx, logger, filePath)
+	if err != nil {
+		return Device{}, err
+	}
+
+	major, minor, err := d.getDeviceNumber(filePath)
+	if err != nil {
+		return Device{}, fmt.Errorf("discovering device number: %w", err)
+	}
+
+	// if the logical volume spans multiple physical volumes,
+	// deterministically pick the first one
+	return Device{
+		Name:       names[0],
+		Major:      major,
+		Minor:      minor,
+		Mountpoint: mount.Mountpoint,
+		FSType:     mount.FSType,
+	}, nil
+}
+
+// discoverDeviceNames returns the names of all the block devices that filePath is
+// stored on.
+func (d *Discoverer) discoverDeviceNames(ctx context.Context, logger sglog.Logger, filePath string) ([]string, error) {
+	_, names, err := d.discoverPhysicalVolumes(ctx, logger, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// discoverPhysicalVolumes returns the mount that contains filePath, along with the names of
+// the physical volumes (example: "hdisk0") that store the logical volume that's mounted there.
+func (d *Discoverer) discoverPhysicalVolumes(ctx context.Context, logger sglog.Logger, filePath string) (*mountinfo.Info, []string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	mount, err := d.findMount(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("finding mountpoint: %w", err)
+	}
+
+	logger.Debug("discovered mount",
+		sglog.String("mountpoint", mount.Mountpoint),
+		sglog.String("source", mount.Source),
+	)
+
+	// the mount's source is the special file of the logical
+	// volume that stores the filesystem (e.x. "/dev/hd4")
+	lv, err := aixLogicalVolume(mount.Source)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mount %q: %w", mount.Mountpoint, err)
+	}
+
+	// unlike `lsvg -p` (which lists all of the physical volumes in the volume group),
+	// `lslv -l` only lists the physical volumes that store the logical volume
+	output, err := d.runCommand(ctx, "/usr/sbin/lslv", "-l", lv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing physical volumes of logical volume %q: %w", lv, err)
+	}
+
+	names := parseLslvPhysicalVolumes(string(output))
+	if len(names) == 0 {
+		return nil, nil, fmt.Errorf("lslv didn't list any physical volumes of logical volume %q", lv)
+	}
+
+	logger.Debug("discovered physical volumes",
+		sglog.String("logicalVolume", lv),
+		sglog.Strings("physicalVolumes", names),
+	)
+
+	return mount, names, nil
+}
+
+// mountLookup returns the functions that d looks mounts up with, unless it's configured otherwise.
+//
+// There's no mount table that github.com/moby/sys/mountinfo can read on AIX, so each mount is
+// looked up with `df` and `lsfs` (see lookupMount), even during batch discovery.
+func (d *Discoverer) mountLookup() (
+	func(filePath string) (*mountinfo.Info, error),
+	func() (func(filePath string) (*mountinfo.Info, error), error),
+) {
+	findMountSnapshot := func() (func(filePath string) (*mountinfo.Info, error), error) {
+		return d.lookupMount, nil
+	}
+
+	return d.lookupMount, findMountSnapshot
+}
+
+// lookupMount returns the mount that contains filePath.
+//
+// github.com/moby/sys/mountinfo can't read the mount table on AIX, so the mount is
+// looked up with `df` and `lsfs` instead.
+func (d *Discoverer) lookupMount(filePath string) (*mountinfo.Info, error) {
+	ctx := context.Background()
+
+	output, err := d.runCommand(ctx, "/usr/bin/df", "-P", filePath)
+	if err != nil {
+		return nil, fmt.Errorf("findMount: running df: %w", err)
+	}
+
+	source, mountpoint, err := parseDfPortable(string(output))
+	if err != nil {
+		return nil, fmt.Errorf("findMount: %w", err)
+	}
+
+	mount := &mountinfo.Info{Mountpoint: mountpoint, Source: source}
+
+	// `lsfs` only knows about the filesystems that are listed in /etc/filesystems, so
+	// its output is only used to fill in the filesystem type
+	output, err = d.runCommand(ctx, "/usr/sbin/lsfs", "-c", mountpoint)
+	if err == nil {
+		mount.FSType = parseLsfsVFS(string(output), mountpoint)
+	}
+
+	return mount, nil
+}
+
+// listMounts returns an error that wraps ErrUnsupportedPlatform, since there's no mount
+// table that github.com/moby/sys/mountinfo can read on this operating system.
+func listMounts() ([]*mountinfo.Info, error) {
+	return nil, fmt.Errorf("listMounts: %w", ErrUnsupportedPlatform)
+}
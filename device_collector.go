@@ -0,0 +1,129 @@
+package mountinfo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	sglog "github.com/sourcegraph/log"
+)
+
+// NewDeviceCollector returns a Prometheus collector that reports IO statistics for the block
+// devices backing each of the requested file paths.
+//
+// The collector exports the following counters (prefixed like the metric of NewCollector if
+// opts.Namespace is set), each with a single "device" label that contains the name of the block
+// device (example: "sdb"):
+//   - device_read_bytes_total: number of bytes read from the device
+//   - device_written_bytes_total: number of bytes written to the device
+//   - device_io_time_seconds_total: number of seconds that the device spent doing IO
+//
+// If a file path is stored on a device that's backed by multiple block devices (example: an md
+// RAID array), statistics are reported for each of the member devices. File paths that are stored
+// on the same device are only reported once.
+//
+// The block devices backing each file path are re-discovered (like DiscoverDeviceNames does, so
+// symlinks are followed) on every collection, so that remounts are picked up.
+//
+// This collector currently works only on Linux-based operating systems that have access to the
+// sysfs pseudo-filesystem and /proc/diskstats. On all other operating systems, this collector will
+// not emit any values.
+func NewDeviceCollector(logger sglog.Logger, opts CollectorOpts, paths []string) prometheus.Collector {
+	return newDeviceCollector(logger, opts, defaultDiscoverer, readDiskStats, paths)
+}
+
+func newDeviceCollector(logger sglog.Logger, opts CollectorOpts, discoverer *Discoverer, readDiskStats func() (map[string]DiskStats, error), paths []string) *deviceCollector {
+	return &deviceCollector{
+		logger:        logger.Scoped("deviceCollector"),
+		discoverer:    discoverer,
+		readDiskStats: readDiskStats,
+		paths:         paths,
+
+		readBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "", "device_read_bytes_total"),
+			"The total number of bytes read from the device.",
+			[]string{"device"}, nil,
+		),
+		writtenBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "", "device_written_bytes_total"),
+			"The total number of bytes written to the device.",
+			[]string{"device"}, nil,
+		),
+		ioTime: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "", "device_io_time_seconds_total"),
+			"The total number of seconds that the device spent doing IO.",
+			[]string{"device"}, nil,
+		),
+	}
+}
+
+type deviceCollector struct {
+	logger        sglog.Logger
+	discoverer    *Discoverer
+	readDiskStats func() (map[string]DiskStats, error)
+	paths         []string
+
+	readBytes    *prometheus.Desc
+	writtenBytes *prometheus.Desc
+	ioTime       *prometheus.Desc
+}
+
+func (c *deviceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.readBytes
+	ch <- c.writtenBytes
+	ch <- c.ioTime
+}
+
+func (c *deviceCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := c.readDiskStats()
+	if err != nil {
+		if !errors.Is(err, ErrUnsupportedPlatform) {
+			c.logger.Warn("skipping collection",
+				sglog.String("reason", "failed to read disk statistics"),
+				sglog.Error(err),
+			)
+		}
+
+		return
+	}
+
+	seen := make(map[string]struct{})
+
+	for _, filePath := range c.paths {
+		discoveryLogger := c.logger.Scoped("deviceNameDiscovery").With(
+			sglog.String("path", filePath),
+		)
+
+		devices, err := c.discoverer.discoverDeviceNamesAt(context.Background(), discoveryLogger, filePath)
+		if err != nil {
+			discoveryLogger.Warn("skipping metric collection",
+				sglog.String("reason", "failed to discover device names"),
+				sglog.Error(err),
+			)
+
+			continue
+		}
+
+		for _, device := range devices {
+			if _, ok := seen[device]; ok {
+				continue
+			}
+
+			seen[device] = struct{}{}
+
+			s, ok := stats[device]
+			if !ok {
+				discoveryLogger.Warn("skipping metric collection",
+					sglog.String("reason", "device not found in disk statistics"),
+					sglog.String("device", device),
+				)
+
+				continue
+			}
+
+			ch <- prometheus.MustNewConstMetric(c.readBytes, prometheus.CounterValue, float64(s.BytesRead()), device)
+			ch <- prometheus.MustNewConstMetric(c.writtenBytes, prometheus.CounterValue, float64(s.BytesWritten()), device)
+			ch <- prometheus.MustNewConstMetric(c.ioTime, prometheus.CounterValue, s.IOTime.Seconds(), device)
+		}
+	}
+}
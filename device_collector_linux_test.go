@@ -0,0 +1,167 @@
+package mountinfo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/moby/sys/mountinfo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sourcegraph/log/logtest"
+)
+
+func Test_DeviceCollector(t *testing.T) {
+	// both paths are stored on the md0 RAID array, which is backed by sda and sdb
+	d := NewDiscoverer(WithSysfs(mdRAIDSysfs()))
+	d.resolvePath = unresolvedPath
+	d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+		return 9, 0, nil
+	}
+	d.findMount = func(filePath string) (*mountinfo.Info, error) {
+		return &mountinfo.Info{Mountpoint: "/data", FSType: "ext4"}, nil
+	}
+
+	collector := newDeviceCollector(logtest.Scoped(t), CollectorOpts{}, d, readTestDiskStats, []string{"/data/index", "/data/repos"})
+
+	expected := map[string]map[string]float64{
+		"device_read_bytes_total": {
+			"sda": 5.67761408e+09,
+			"sdb": 5.401786368e+09,
+		},
+		"device_written_bytes_total": {
+			"sda": 1.1078603776e+10,
+			"sdb": 1.1078603776e+10,
+		},
+		"device_io_time_seconds_total": {
+			"sda": 668.224,
+			"sdb": 651.904,
+		},
+	}
+
+	if diff := cmp.Diff(expected, gatherDeviceMetrics(t, collector)); diff != "" {
+		t.Fatalf("recieved unexpected metrics (-want +got):\n%s", diff)
+	}
+}
+
+func Test_DeviceCollector_Symlink(t *testing.T) {
+	// the collector is pointed at a symlink (e.x. "/home/.zoekt" -> "/data/zoekt"), so the
+	// device that the symlink's target is stored on must be reported
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("resolving temporary directory: %s", err)
+	}
+
+	target := filepath.Join(dir, "data", "zoekt")
+	if err := os.MkdirAll(target, 0o755); err != nil {
+		t.Fatalf("creating directory %q: %s", target, err)
+	}
+
+	link := filepath.Join(dir, "home", ".zoekt")
+	if err := os.MkdirAll(filepath.Dir(link), 0o755); err != nil {
+		t.Fatalf("creating directory %q: %s", filepath.Dir(link), err)
+	}
+
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatalf("creating symlink (%q -> %q): %s", link, target, err)
+	}
+
+	// only the symlink's target is stored on the md0 RAID array
+	dataDir := filepath.Join(dir, "data")
+	d := NewDiscoverer(WithSysfs(mdRAIDSysfs()))
+	d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+		if !strings.HasPrefix(filePath, dataDir) {
+			return 0, 0, fmt.Errorf("unexpected file path %q", filePath)
+		}
+
+		return 9, 0, nil
+	}
+	d.findMount = func(filePath string) (*mountinfo.Info, error) {
+		if !strings.HasPrefix(filePath, dataDir) {
+			return nil, fmt.Errorf("unexpected file path %q", filePath)
+		}
+
+		return &mountinfo.Info{Mountpoint: dataDir, FSType: "ext4"}, nil
+	}
+
+	collector := newDeviceCollector(logtest.Scoped(t), CollectorOpts{}, d, readTestDiskStats, []string{link})
+
+	expected := map[string]float64{
+		"sda": 668.224,
+		"sdb": 651.904,
+	}
+
+	if diff := cmp.Diff(expected, gatherDeviceMetrics(t, collector)["device_io_time_seconds_total"]); diff != "" {
+		t.Fatalf("recieved unexpected metrics (-want +got):\n%s", diff)
+	}
+}
+
+// readTestDiskStats reads the disk statistics in testdata/diskstats.
+func readTestDiskStats() (map[string]DiskStats, error) {
+	f, err := os.Open(filepath.Join("testdata", "diskstats"))
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return parseDiskStats(f)
+}
+
+// gatherDeviceMetrics registers collector and returns the values of the metrics that it
+// reports, keyed by metric name and device.
+func gatherDeviceMetrics(t *testing.T, collector prometheus.Collector) map[string]map[string]float64 {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %s", err)
+	}
+
+	// metric name -> device -> value
+	actual := make(map[string]map[string]float64)
+	for _, family := range families {
+		values := make(map[string]float64)
+		for _, m := range family.GetMetric() {
+			values[m.GetLabel()[0].GetValue()] = m.GetCounter().GetValue()
+		}
+
+		actual[family.GetName()] = values
+	}
+
+	return actual
+}
+
+func Test_DeviceCollector_Namespace(t *testing.T) {
+	d := NewDiscoverer()
+	readDiskStats := func() (map[string]DiskStats, error) {
+		return nil, ErrUnsupportedPlatform
+	}
+
+	// collectors with different namespaces can be registered side by side
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		newDeviceCollector(logtest.Scoped(t), CollectorOpts{}, d, readDiskStats, nil),
+		newDeviceCollector(logtest.Scoped(t), CollectorOpts{Namespace: "zoekt"}, d, readDiskStats, nil),
+	)
+
+	descs := make(chan *prometheus.Desc, 3)
+	newDeviceCollector(logtest.Scoped(t), CollectorOpts{Namespace: "zoekt"}, d, readDiskStats, nil).Describe(descs)
+	close(descs)
+
+	var actual []string
+	for desc := range descs {
+		actual = append(actual, desc.String())
+	}
+
+	for i, name := range []string{"zoekt_device_read_bytes_total", "zoekt_device_written_bytes_total", "zoekt_device_io_time_seconds_total"} {
+		if !strings.Contains(actual[i], `fqName: "`+name+`"`) {
+			t.Errorf("expected metric %q, got %s", name, actual[i])
+		}
+	}
+}
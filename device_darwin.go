@@ -1,53 +1,265 @@
 package mountinfo
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
 
 	sglog "github.com/sourcegraph/log"
+	"golang.org/x/sys/unix"
 )
 
-// discoverDeviceName returns the name of the block device that filePath is
+// discoverDevice returns information about the block device that filePath is
 // stored on.
-func discoverDeviceName(logger sglog.Logger, filePath string) (string, error) {
-	// on macOS (darwin), use the `stat` and `diskutil` OS tools
-	// diskutil info $(stat -f '%Sd' <path>) | grep 'Part of Whole:' | awk '{print $NF}'
+func (d *Discoverer) discoverDevice(ctx context.Context, logger sglog.Logger, filePath string) (Device, error) {
+	names, err := d.discoverDiskNames(ctx, logger, filePath)
+	if err != nil {
+		return Device{}, err
+	}
+
+	major, minor, err := d.getDeviceNumber(filePath)
+	if err != nil {
+		return Device{}, fmt.Errorf("discovering device number: %w", err)
+	}
+
+	mount, err := d.findMount(filePath)
+	if err != nil {
+		return Device{}, fmt.Errorf("finding mountpoint: %w", err)
+	}
+
+	device := Device{
+		// if the volume is stored on multiple disks (e.x. an APFS Fusion Drive),
+		// deterministically pick the first one
+		Name:       names[0],
+		Major:      major,
+		Minor:      minor,
+		Mountpoint: mount.Mountpoint,
+		FSType:     mount.FSType,
+	}
+
+	// the block size and removability are only informational, so don't fail discovery without them
+	if info, err := d.diskutilInfo(ctx, logger, device.Name); err == nil {
+		device.LogicalBlockSize = diskutilBlockSize(info)
+		device.Removable = diskutilRemovable(info)
+	}
+
+	return device, nil
+}
 
-	// macOS does support using the `unix.Stat_t` struct and `unix.Stat` function,
-	// but finding the device identifier name from the major + minor idendifiers proved difficult,
-	// so just use `stat` to print out the partition identifier name, and `diskutil`
-	// to find the disk identifier name from that
+// discoverDeviceNames returns the names of all the block devices that filePath is
+// stored on.
+func (d *Discoverer) discoverDeviceNames(ctx context.Context, logger sglog.Logger, filePath string) ([]string, error) {
+	return d.discoverDiskNames(ctx, logger, filePath)
+}
+
+// discoverDiskNames returns the names of the physical disks that filePath is
+// stored on.
+func (d *Discoverer) discoverDiskNames(ctx context.Context, logger sglog.Logger, filePath string) ([]string, error) {
+	// on macOS (darwin), find the BSD device (e.x. "disk3s1s1") that filePath's filesystem is
+	// mounted from with statfs, and use `diskutil` to find the physical disks that store it
 
 	filePath, err := filepath.EvalSymlinks(filePath)
 	if err != nil {
-		return "", fmt.Errorf("unable to resolve %s: %w", filePath, err)
+		return nil, fmt.Errorf("unable to resolve %s: %w", filePath, err)
 	}
 	filePath, err = filepath.Abs(filePath)
 	if err != nil {
-		return "", fmt.Errorf("unable to resolve %s: %w", filePath, err)
+		return nil, fmt.Errorf("unable to resolve %s: %w", filePath, err)
 	}
-	stat, err := exec.Command("/usr/bin/stat", "-f", "%Sd", filePath).Output()
+
+	device, err := statfsDeviceName(filePath)
 	if err != nil {
-		return "", fmt.Errorf("unable to stat %s: %w", filePath, err)
+		return nil, err
 	}
 
-	diskinfo, err := exec.Command("/usr/sbin/diskutil", "info", strings.TrimSpace(string(stat))).CombinedOutput()
-	if err != nil {
-		// log the output from `diskutil` instead of including it in the error message because it may be multiline
-		logger.Error(fmt.Sprintf("unable to get disk info on %s. Output is (%s)", string(stat), string(diskinfo)))
-		return "", fmt.Errorf("unable to get disk info on %s: %w", string(stat), err)
+	logger.Debug("discovered BSD device", sglog.String("device", device))
+
+	return d.resolveDiskNames(ctx, logger, device)
+}
+
+// resolveDiskNames returns the names of the physical disks that store the provided BSD device
+// (example: "disk3s1s1").
+//
+// If diskutil can't be used (e.x. because it's restricted on a locked-down CI runner), the whole
+// disk (example: "disk3") is derived from the device's name instead. For APFS volumes, that's the
+// synthesized container disk rather than the physical disks that store it, but a degraded answer
+// is more useful than none.
+func (d *Discoverer) resolveDiskNames(ctx context.Context, logger sglog.Logger, device string) ([]string, error) {
+	names, err := d.resolvePhysicalDisks(ctx, logger, device)
+	if err == nil {
+		return names, nil
+	}
+
+	// diskutil being killed because discovery was aborted (or timed out) doesn't mean
+	// that it's unavailable
+	if ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+
+	name, ok := bsdWholeDiskName(device)
+	if !ok {
+		return nil, err
 	}
 
-	regex := regexp.MustCompile("Part of Whole:[ \t]+(?P<name>\\w+)")
-	match := regex.FindSubmatch(diskinfo)
+	logger.Warn("failed to resolve physical disks with diskutil, falling back to whole disk of BSD device",
+		sglog.String("device", device),
+		sglog.String("disk", name),
+		sglog.Error(err),
+	)
+
+	d.resolutionFallback(logger.With(sglog.String("device", device)), FallbackDiskutilUnavailable, name)
+
+	return []string{name}, nil
+}
+
+// bsdWholeDiskRegex matches the names of BSD devices (e.x. "disk0", "disk0s2", or the APFS
+// snapshot "disk3s1s1"), and captures the name of the whole disk that they're part of.
+var bsdWholeDiskRegex = regexp.MustCompile(`^(disk\d+)(?:s\d+)*$`)
+
+// bsdWholeDiskName returns the name of the whole disk (example: "disk3") that the BSD device
+// with the provided name (example: "disk3s1s1") is part of, according to the device's name.
+func bsdWholeDiskName(device string) (string, bool) {
+	match := bsdWholeDiskRegex.FindStringSubmatch(device)
 	if match == nil {
-		// log the output from `diskutil` instead of including it in the error message because it may be multiline
-		logger.Error(fmt.Sprintf("unable to find disk info in (%s)", string(diskinfo)))
-		return "", fmt.Errorf("unable to find disk info on %s: %w", string(stat), err)
+		return "", false
+	}
+
+	return match[1], true
+}
+
+// statfsDeviceName returns the name of the BSD device (e.x. "disk3s1s1") that the filesystem
+// which contains filePath is mounted from.
+func statfsDeviceName(filePath string) (string, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(filePath, &stat); err != nil {
+		return "", fmt.Errorf("unable to statfs %s: %w", filePath, wrapPathNotFound(err))
+	}
+
+	return mountSourceDeviceName(unix.ByteSliceToString(stat.Mntfromname[:]), unix.ByteSliceToString(stat.Fstypename[:]))
+}
+
+// mountSourceDeviceName returns the name of the BSD device (e.x. "disk3s1s1") that a
+// filesystem of type fsType is mounted from, given the source that it was mounted
+// from (e.x. "/dev/disk3s1s1").
+//
+// Filesystems that aren't mounted from a device node (e.x. devfs, or network filesystems
+// like "//user@server/share") aren't backed by a block device.
+func mountSourceDeviceName(source, fsType string) (string, error) {
+	if !strings.HasPrefix(source, "/dev/") {
+		return "", fmt.Errorf("filesystem (type %q) mounted from %q: %w", fsType, source, ErrNoBlockDevice)
+	}
+
+	return strings.TrimPrefix(source, "/dev/"), nil
+}
+
+// resolvePhysicalDisks returns the names of the physical disks (example: "disk0") that
+// store the provided BSD device (example: "disk3s1s1").
+//
+// APFS volumes are stored on synthesized disks (APFS containers), which aren't useful for
+// reporting physical IO. For those, the disks that store the container's physical stores
+// (example: "disk0s2") are returned instead, including for volumes that are encrypted
+// with FileVault.
+func (d *Discoverer) resolvePhysicalDisks(ctx context.Context, logger sglog.Logger, device string) ([]string, error) {
+	info, err := d.diskutilInfo(ctx, logger, device)
+	if err != nil {
+		return nil, err
+	}
+
+	stores := apfsPhysicalStores(info)
+
+	// volumes list the physical stores of their container, but check the container
+	// itself in case that changes
+	if container := plistString(info, "APFSContainerReference"); len(stores) == 0 && container != "" && container != device {
+		containerInfo, err := d.diskutilInfo(ctx, logger, container)
+		if err != nil {
+			return nil, err
+		}
+
+		stores = apfsPhysicalStores(containerInfo)
+	}
+
+	if len(stores) == 0 {
+		name, err := d.wholeDisk(ctx, logger, device, info)
+		if err != nil {
+			return nil, err
+		}
+
+		// encrypted volumes (e.x. with FileVault) don't necessarily report the container that
+		// they're part of (such as while they're locked), but their whole disk is the
+		// container's synthesized disk, which still lists the container's physical stores
+		if !diskutilEncrypted(info) || name == device {
+			return []string{name}, nil
+		}
+
+		containerInfo, err := d.diskutilInfo(ctx, logger, name)
+		if err != nil {
+			return nil, err
+		}
+
+		stores = apfsPhysicalStores(containerInfo)
+		if len(stores) == 0 {
+			return []string{name}, nil
+		}
+
+		logger.Debug("resolved encrypted volume through its container",
+			sglog.String("device", device),
+			sglog.String("container", name),
+		)
+	}
+
+	var names []string
+	seen := make(map[string]struct{})
+
+	for _, store := range stores {
+		storeInfo, err := d.diskutilInfo(ctx, logger, store)
+		if err != nil {
+			return nil, err
+		}
+
+		name, err := d.wholeDisk(ctx, logger, store, storeInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Debug("resolved apfs physical store",
+			sglog.String("device", device),
+			sglog.String("physicalStore", store),
+			sglog.String("disk", name),
+		)
+
+		if _, ok := seen[name]; ok {
+			continue
+		}
+
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// wholeDisk returns the name of the whole disk that contains the provided BSD device,
+// given the output of `diskutil info` for it.
+func (d *Discoverer) wholeDisk(ctx context.Context, logger sglog.Logger, device string, info map[string]interface{}) (string, error) {
+	if name := plistString(info, "ParentWholeDisk"); name != "" {
+		return name, nil
+	}
+
+	// fall back to looking the device up in the list of all disks
+	d.resolutionFallback(logger.With(sglog.String("device", device)), FallbackDiskutilList, "")
+
+	list, err := d.diskutilList(ctx, logger)
+	if err != nil {
+		return "", err
+	}
+
+	name, ok := findWholeDisk(list, device)
+	if !ok {
+		return "", fmt.Errorf("unable to find disk info on %s: diskutil didn't report a parent whole disk", device)
 	}
 
-	return string(match[1]), nil
+	return name, nil
 }
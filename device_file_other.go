@@ -0,0 +1,16 @@
+//go:build !linux
+
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+func (d *Discoverer) discoverDeviceForFile(ctx context.Context, logger sglog.Logger, f *os.File) (string, error) {
+	return "", fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
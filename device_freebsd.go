@@ -0,0 +1,69 @@
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	sglog "github.com/sourcegraph/log"
+	"golang.org/x/sys/unix"
+)
+
+// discoverDevice returns information about the block device that filePath is
+// stored on.
+func (d *Discoverer) discoverDevice(ctx context.Context, logger sglog.Logger, filePath string) (Device, error) {
+	if err := ctx.Err(); err != nil {
+		return Device{}, err
+	}
+
+	mount, err := d.findMount(filePath)
+	if err != nil {
+		return Device{}, fmt.Errorf("finding mountpoint: %w", err)
+	}
+
+	logger.Debug("discovered mount",
+		sglog.String("mountpoint", mount.Mountpoint),
+		sglog.String("source", mount.Source),
+	)
+
+	major, minor, err := d.getDeviceNumber(filePath)
+	if err != nil {
+		return Device{}, fmt.Errorf("discovering device number: %w", err)
+	}
+
+	// the mount's source is the special file of the GEOM provider that
+	// stores the filesystem (e.x. "/dev/ada0p3" or "/dev/gpt/data")
+	provider := strings.TrimPrefix(mount.Source, "/dev/")
+	if provider == mount.Source {
+		return Device{}, fmt.Errorf("mount %q (source %q) isn't backed by a GEOM provider: %w", mount.Mountpoint, mount.Source, ErrNoBlockDevice)
+	}
+
+	conftxt, err := unix.Sysctl("kern.geom.conftxt")
+	if err != nil {
+		return Device{}, fmt.Errorf("reading GEOM configuration: %w", err)
+	}
+
+	name, err := geomDiskName(conftxt, provider)
+	if err != nil {
+		return Device{}, fmt.Errorf("discovering disk for GEOM provider %q: %w", provider, err)
+	}
+
+	return Device{
+		Name:       name,
+		Major:      major,
+		Minor:      minor,
+		Mountpoint: mount.Mountpoint,
+		FSType:     mount.FSType,
+	}, nil
+}
+
+// discoverDeviceNames returns the names of all the block devices that filePath is
+// stored on.
+func (d *Discoverer) discoverDeviceNames(ctx context.Context, logger sglog.Logger, filePath string) ([]string, error) {
+	device, err := d.discoverDevice(ctx, logger, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{device.Name}, nil
+}
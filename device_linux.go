@@ -1,103 +1,770 @@
 package mountinfo
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/moby/sys/mountinfo"
 	sglog "github.com/sourcegraph/log"
 )
 
-// defined as a variable so that it can be redefined by test routines
-var findSysfsMountpoint = func() (mountpoint string, err error) {
-	fsinfo := func(info *mountinfo.Info) (skip, stop bool) {
-		if info.FSType == "sysfs" {
-			return false, true
-		}
-		return true, false
+// discoverSysfsDevicePath returns the path of the device with the provided number
+// (in <major>:<minor> format) in sysfs.
+func discoverSysfsDevicePath(sysfs fs.FS, deviceNumber string) (string, error) {
+	// /sys/dev/block/<device_number> symlinks to /sys/devices/.../block/.../<deviceName>
+	symlink := path.Join("dev", "block", deviceNumber)
+
+	devicePath, err := evalSymlinks(sysfs, symlink)
+	if err != nil {
+		return "", fmt.Errorf("discoverSysfsDevicePath: failed to evaluate sysfs symlink %q: %w", symlink, err)
+	}
+
+	return devicePath, nil
+}
+
+// resolveSlaves follows the "slaves" directory of virtual block devices (e.x. LVM logical
+// volumes, md RAID arrays) until it reaches the devices that aren't backed by any other
+// block device, and returns those devices' sysfs paths.
+//
+// Slaves are visited in name order, so the returned paths are sorted deterministically.
+// If devicePath doesn't have a "slaves" directory (or it's empty), only devicePath is returned.
+//
+// If keepMultipath is true, multipath maps aren't followed down to the paths (e.x. "sdc", "sdd")
+// that they send IO through, and are returned themselves instead.
+func resolveSlaves(ctx context.Context, logger sglog.Logger, sysfs fs.FS, devicePath string, keepMultipath bool) ([]string, error) {
+	return resolveSlavesOf(ctx, logger, sysfs, devicePath, keepMultipath, make(map[string]struct{}))
+}
+
+// maxSlaveDepth is the maximum number of virtual block devices that resolveSlaves follows
+// down to a block device that isn't backed by any other block device.
+//
+// Real stacks are only a few devices deep (e.x. a dm-crypt volume on an LVM logical volume on
+// an md RAID array), so a deeper one means that sysfs is malformed.
+const maxSlaveDepth = 16
+
+// resolveSlavesOf implements resolveSlaves. ancestors contains the sysfs paths of the
+// devices that are currently being resolved, which is used to detect cycles (which a real
+// sysfs never has, but a malformed one might).
+func resolveSlavesOf(ctx context.Context, logger sglog.Logger, sysfs fs.FS, devicePath string, keepMultipath bool, ancestors map[string]struct{}) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("resolveSlaves: %w", err)
 	}
-	info, err := mountinfo.GetMounts(fsinfo)
-	if err == nil && len(info) == 0 {
-		err = errors.New("findSysfsMountpoint: no sysfs mountpoint found")
+
+	if _, ok := ancestors[devicePath]; ok {
+		return nil, fmt.Errorf("resolveSlaves: device (path %q) is backed by itself", devicePath)
 	}
-	if err != nil {
-		return "", fmt.Errorf("findSysfsMountpoint: %w", err)
+
+	if len(ancestors) > maxSlaveDepth {
+		return nil, fmt.Errorf("resolveSlaves: device (path %q) is stacked more than %d devices deep", devicePath, maxSlaveDepth)
+	}
+
+	ancestors[devicePath] = struct{}{}
+	defer delete(ancestors, devicePath)
+
+	slavesDir := path.Join(devicePath, "slaves")
+
+	entries, err := fs.ReadDir(sysfs, slavesDir)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && len(entries) == 0) {
+		return []string{devicePath}, nil
 	}
-	// the provided sysfs mountpoint could itself be a symlink, so we
-	// resolve it immediately so that future file path
-	// evaluations / massaging doesn't break
-	cleanedPath, err := filepath.EvalSymlinks(filepath.Clean(info[0].Mountpoint))
+
 	if err != nil {
-		return "", fmt.Errorf("findSysfsMountpoint: verifying sysfs mountpoint %q: failed to resolve symlink: %w", info[0].Mountpoint, err)
+		return nil, fmt.Errorf("resolveSlaves: failed to list slaves of device (path %q): %w", devicePath, err)
+	}
+
+	// device-mapper devices (e.x. LVM logical volumes, dm-crypt / LUKS volumes) record what
+	// created them in their UUID
+	if uuid := readSysfsAttribute(logger, sysfs, path.Join(devicePath, "dm", "uuid")); uuid != "" {
+		dmType := deviceMapperType(uuid)
+
+		if keepMultipath && dmType == "multipath" {
+			logger.Debug("kept multipath device",
+				sglog.String("devicePath", devicePath),
+				sglog.String("dmName", readSysfsAttribute(logger, sysfs, path.Join(devicePath, "dm", "name"))),
+			)
+
+			return []string{devicePath}, nil
+		}
+
+		logger.Debug("traversing device-mapper device",
+			sglog.String("devicePath", devicePath),
+			sglog.String("dmName", readSysfsAttribute(logger, sysfs, path.Join(devicePath, "dm", "name"))),
+			sglog.String("dmType", dmType),
+		)
+
+		if dmType == "thin-pool" {
+			return resolveThinPool(ctx, logger, sysfs, devicePath, entries, keepMultipath, ancestors)
+		}
+	}
+
+	var devicePaths []string
+	for _, entry := range entries {
+		slave := path.Join(slavesDir, entry.Name())
+
+		slavePath, err := evalSymlinks(sysfs, slave)
+		if err != nil {
+			return nil, fmt.Errorf("resolveSlaves: failed to evaluate slave symlink %q: %w", slave, err)
+		}
+
+		// slaves can themselves be virtual devices (e.x. a dm-crypt volume on top of a RAID array)
+		slavePaths, err := resolveSlavesOf(ctx, logger, sysfs, slavePath, keepMultipath, ancestors)
+		if err != nil {
+			return nil, err
+		}
+
+		devicePaths = append(devicePaths, slavePaths...)
 	}
-	return cleanedPath, nil
+
+	return devicePaths, nil
 }
 
-func discoverSysfsDevicePath(sysfsMountPoint string, deviceNumber string) (string, error) {
+// resolveThinPool resolves the slaves of the LVM thin pool at devicePath, whose entries are
+// the pool's data ("-tdata") and metadata ("-tmeta") sub-devices.
+//
+// Only the data sub-device is followed, since that's where the data of the pool's thin volumes
+// is stored. If it can't be followed down to a block device that isn't a device-mapper device,
+// the pool itself is returned instead.
+func resolveThinPool(ctx context.Context, logger sglog.Logger, sysfs fs.FS, devicePath string, entries []fs.DirEntry, keepMultipath bool, ancestors map[string]struct{}) ([]string, error) {
+	slavesDir := path.Join(devicePath, "slaves")
 
-	// /sys/dev/block/<device_number> symlinks to /sys/devices/.../block/.../<deviceName>
-	symlink := filepath.Join(sysfsMountPoint, "dev", "block", deviceNumber)
+	var devicePaths []string
+	for _, entry := range entries {
+		slave := path.Join(slavesDir, entry.Name())
 
-	devicePath, err := filepath.EvalSymlinks(symlink)
-	if err != nil {
-		return "", fmt.Errorf("discoverSysfsDevicePath: failed to evaluate sysfs symlink %q: %w", symlink, err)
+		slavePath, err := evalSymlinks(sysfs, slave)
+		if err != nil {
+			return nil, fmt.Errorf("resolveSlaves: failed to evaluate slave symlink %q: %w", slave, err)
+		}
+
+		uuid := readSysfsAttribute(logger, sysfs, path.Join(slavePath, "dm", "uuid"))
+		if deviceMapperType(uuid) != "thin-pool-data" {
+			logger.Debug("skipped thin pool sub-device",
+				sglog.String("devicePath", devicePath),
+				sglog.String("slavePath", slavePath),
+			)
+
+			continue
+		}
+
+		slavePaths, err := resolveSlavesOf(ctx, logger, sysfs, slavePath, keepMultipath, ancestors)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+
+			logger.Warn("failed to resolve thin pool data device, reporting thin pool",
+				sglog.String("devicePath", devicePath),
+				sglog.Error(err),
+			)
+
+			return []string{devicePath}, nil
+		}
+
+		devicePaths = append(devicePaths, slavePaths...)
 	}
 
-	devicePath, err = filepath.Abs(devicePath)
-	if err != nil {
-		return "", fmt.Errorf("discoverSysfsDevicePath: failed to massage device path %q to absolute path: %w", devicePath, err)
+	for _, p := range devicePaths {
+		uuid := readSysfsAttribute(logger, sysfs, path.Join(p, "dm", "uuid"))
+		if uuid != "" && !(keepMultipath && deviceMapperType(uuid) == "multipath") {
+			devicePaths = nil
+			break
+		}
 	}
 
-	return devicePath, nil
+	if len(devicePaths) == 0 {
+		logger.Warn("thin pool data device isn't backed by a block device, reporting thin pool",
+			sglog.String("devicePath", devicePath),
+		)
+
+		return []string{devicePath}, nil
+	}
+
+	return devicePaths, nil
+}
+
+// deviceMapperType returns the kind of mapping (e.x. "crypt" for dm-crypt / LUKS volumes, "linear"
+// for LVM logical volumes) that the device-mapper device with the provided UUID (the contents of
+// /sys/block/dm-<N>/dm/uuid) was created for.
+//
+// The kernel doesn't expose the targets of a device-mapper table in sysfs, so the type is inferred
+// from the prefix that the userspace tools put in front of the UUIDs of the devices they create.
+func deviceMapperType(uuid string) string {
+	prefix, _, _ := strings.Cut(uuid, "-")
+
+	switch prefix {
+	case "CRYPT":
+		return "crypt"
+	case "LVM":
+		return lvmDeviceType(uuid)
+	case "mpath":
+		return "multipath"
+	}
+
+	// kpartx creates the devices for the partitions of other device-mapper devices (e.x. the
+	// partitions of a multipath map), and prefixes their UUIDs with "part<N>"
+	if strings.HasPrefix(prefix, "part") {
+		return "partition"
+	}
+
+	return "unknown"
+}
+
+// lvmDeviceType returns the kind of mapping that the LVM device with the provided UUID was
+// created for. LVM suffixes the UUIDs of the devices that make up a thin pool with their role.
+func lvmDeviceType(uuid string) string {
+	_, suffix, found := cutLast(uuid, "-")
+	if !found {
+		return "linear"
+	}
+
+	switch suffix {
+	case "tpool", "pool":
+		return "thin-pool"
+	case "tdata":
+		return "thin-pool-data"
+	case "tmeta":
+		return "thin-pool-metadata"
+	case "thin":
+		return "thin"
+	}
+
+	return "linear"
+}
+
+// cutLast slices s around the last instance of sep, like strings.Cut does around the first.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+
+	return s, "", false
 }
 
-func getDeviceBlockName(sysfsMountPoint, devicePath string) (string, error) {
+func getDeviceBlockName(ctx context.Context, logger sglog.Logger, sysfs fs.FS, devicePath string) (string, error) {
 
 	// Check to see if devicePath points to a disk partition. If so, we need to find the parent
 	// device.
 
-	// massage the sysfs folder name to ensure that it always ends in a '/'
-	// so that strings.HasPrefix does what we expect when checking to see if
-	// we're still under the /sys sub-folder
-	sysFolderPrefix := strings.TrimSuffix(sysfsMountPoint, string(os.PathSeparator))
-	sysFolderPrefix = sysFolderPrefix + string(os.PathSeparator)
+	// the disk that a partition is looked up by name in can (in a malformed sysfs) be the
+	// partition itself, so remember where we've been instead of walking in circles
+	visited := make(map[string]struct{})
 
 	for {
-		if !strings.HasPrefix(devicePath, sysFolderPrefix) {
-			// ensure that we're still under the /sys/ sub-folder
-			return "", fmt.Errorf("getDeviceBlockName: device path %q isn't a subpath of %q", devicePath, sysFolderPrefix)
+		if err := ctx.Err(); err != nil {
+			return "", fmt.Errorf("getDeviceBlockName: %w", err)
+		}
+
+		if devicePath == "." {
+			// ensure that we haven't walked past the top of sysfs
+			return "", errors.New("getDeviceBlockName: reached the root of sysfs without finding a device that isn't a partition")
 		}
 
-		_, err := os.Stat(filepath.Join(devicePath, "partition"))
-		if errors.Is(err, os.ErrNotExist) {
+		_, err := fs.Stat(sysfs, path.Join(devicePath, "partition"))
+		if errors.Is(err, fs.ErrNotExist) {
 			break
 		}
 
-		parent := filepath.Dir(devicePath)
+		if _, ok := visited[devicePath]; ok {
+			return "", fmt.Errorf("getDeviceBlockName: partition (path %q) is part of itself", devicePath)
+		}
+
+		visited[devicePath] = struct{}{}
+
+		parent := path.Dir(devicePath)
+
+		// partitions are nested in the directory of the disk that they're part of, but if
+		// they aren't (e.x. in an incomplete sysfs snapshot), look the disk up by name instead
+		if name := baseDiskName(path.Base(devicePath)); name != path.Base(devicePath) {
+			if diskPath, err := evalSymlinks(sysfs, path.Join("block", name)); err == nil && diskPath != parent {
+				if _, err := lstat(sysfs, path.Join(parent, "subsystem")); errors.Is(err, fs.ErrNotExist) {
+					parent = diskPath
+				} else {
+					// both disks could contain the partition, so deterministically prefer the
+					// one that the kernel nested it in
+					logger.Debug("multiple disks match partition",
+						sglog.String("partitionPath", devicePath),
+						sglog.String("parentPath", parent),
+						sglog.String("diskPath", diskPath),
+					)
+				}
+			}
+		}
+
+		logger.Debug("stripped partition",
+			sglog.String("partitionPath", devicePath),
+			sglog.String("diskPath", parent),
+		)
+
 		devicePath = parent
 	}
 
 	// If this device is a block device, its device path should have a symlink
 	// to the block subsystem.
 
-	subsystemPath, err := filepath.EvalSymlinks(filepath.Join(devicePath, "subsystem"))
+	subsystemPath, err := evalSymlinks(sysfs, path.Join(devicePath, "subsystem"))
 	if err != nil {
 		return "", fmt.Errorf("getDeviceBlockName: failed to discover subsystem that device (path %q) is part of: %w", devicePath, err)
 	}
 
-	if filepath.Base(subsystemPath) != "block" {
+	if path.Base(subsystemPath) != "block" {
 		return "", fmt.Errorf("getDeviceBlockName: device (path %q) is not part of the block subsystem", devicePath)
 	}
 
-	return filepath.Base(filepath.Base(devicePath)), nil
+	return path.Base(devicePath), nil
+}
+
+// nvmeMultipathPathRegex matches the names of the per-controller paths (e.x. "nvme0c1n1") to a
+// namespace that's shared between multiple controllers of the same NVMe subsystem.
+var nvmeMultipathPathRegex = regexp.MustCompile(`^nvme(\d+)c\d+n(\d+)$`)
+
+// normalizeNVMeMultipathName returns the name of the head namespace device (e.x. "nvme0n1")
+// if name is the name of one of its per-controller paths (e.x. "nvme0c1n1"). Otherwise, name
+// is returned unchanged.
+//
+// With native NVMe multipathing, the kernel exposes the namespace as a single "head" block device
+// named nvme<subsystem>n<namespace>, and hides the per-controller paths that it sends IO through.
+func normalizeNVMeMultipathName(name string) string {
+	match := nvmeMultipathPathRegex.FindStringSubmatch(name)
+	if match == nil {
+		return name
+	}
+
+	return fmt.Sprintf("nvme%sn%s", match[1], match[2])
+}
+
+// deviceMapperNameRegex matches the names of device-mapper devices (e.x. "dm-0").
+var deviceMapperNameRegex = regexp.MustCompile(`^dm-\d+$`)
+
+// deviceMapperName returns the name that the device-mapper device at devicePath was created
+// with (e.x. "mpatha", or "vg0-data" for an LVM logical volume), as listed in its dm/name
+// attribute. If the device doesn't have a name, its kernel name (e.x. "dm-2") is returned.
+func deviceMapperName(logger sglog.Logger, sysfs fs.FS, devicePath, kernelName string) string {
+	name := readSysfsAttribute(logger, sysfs, path.Join(devicePath, "dm", "name"))
+	if name == "" {
+		return kernelName
+	}
+
+	logger.Debug("resolved device-mapper name",
+		sglog.String("kernelName", kernelName),
+		sglog.String("dmName", name),
+	)
+
+	return name
+}
+
+// isThinPool returns true if the device-mapper device at devicePath is an LVM thin pool.
+func isThinPool(logger sglog.Logger, sysfs fs.FS, devicePath string) bool {
+	uuid := readSysfsAttribute(logger, sysfs, path.Join(devicePath, "dm", "uuid"))
+	return uuid != "" && deviceMapperType(uuid) == "thin-pool"
+}
+
+// loopDevicePrefixRegex matches the names of loop devices (e.x. "loop0").
+var loopDevicePrefixRegex = regexp.MustCompile(`^loop\d+$`)
+
+// resolveLoopDevice returns the names of the block devices that store the file backing
+// the loop device with the provided name (e.x. "loop0").
+//
+// If the backing file can't be determined (e.x. because it has been deleted since it was
+// attached), false is returned and the loop device should be reported as-is.
+func (d *Discoverer) resolveLoopDevice(ctx context.Context, logger sglog.Logger, sysfs fs.FS, name string) ([]string, bool) {
+	logger = logger.With(sglog.String("loopDevice", name))
+
+	backingFile, err := loopBackingFile(sysfs, name)
+	if err != nil {
+		logger.Debug("failed to find loop device backing file", sglog.Error(err))
+		return nil, false
+	}
+
+	_, _, names, err := d.discoverFileDeviceNames(ctx, logger, sysfs, backingFile)
+	if err != nil {
+		logger.Debug("failed to discover devices that store loop device backing file",
+			sglog.String("backingFile", backingFile),
+			sglog.Error(err),
+		)
+
+		return nil, false
+	}
+
+	logger.Debug("resolved loop device backing file",
+		sglog.String("backingFile", backingFile),
+		sglog.Strings("names", names),
+	)
+
+	return names, true
+}
+
+// loopBackingFile returns the path of the file that backs the loop device with the
+// provided name (e.x. "loop0").
+func loopBackingFile(sysfs fs.FS, name string) (string, error) {
+	// /sys/block/<name> symlinks to the device's directory, which contains
+	// loop/backing_file if a file is attached to the loop device
+	devicePath, err := evalSymlinks(sysfs, path.Join("block", name))
+	if err != nil {
+		return "", fmt.Errorf("loopBackingFile: %w", err)
+	}
+
+	contents, err := fs.ReadFile(sysfs, path.Join(devicePath, "loop", "backing_file"))
+	if err != nil {
+		return "", fmt.Errorf("loopBackingFile: %w", err)
+	}
+
+	backingFile := strings.TrimSpace(string(contents))
+	if backingFile == "" {
+		return "", fmt.Errorf("loopBackingFile: loop device %q doesn't have a backing file", name)
+	}
+
+	return backingFile, nil
 }
 
-// discoverDeviceName returns the name of the block device that filePath is
+// discoverDevice returns information about the block device that filePath is
 // stored on.
-func discoverDeviceName(logger sglog.Logger, filePath string) (string, error) {
+func (d *Discoverer) discoverDevice(ctx context.Context, logger sglog.Logger, filePath string) (Device, error) {
+	sysfs, err := d.sysfs()
+	if err != nil {
+		return Device{}, fmt.Errorf("finding sysfs mountpoint: %w", err)
+	}
+
+	mount, err := d.findMount(filePath)
+	if err != nil {
+		return Device{}, fmt.Errorf("finding mountpoint: %w", err)
+	}
+
+	logger.Debug("discovered mount",
+		sglog.String("mountpoint", mount.Mountpoint),
+		sglog.String("fsType", mount.FSType),
+	)
+
+	major, minor, names, err := d.discoverMountDeviceNames(ctx, logger, sysfs, mount, filePath)
+	if err != nil {
+		return Device{}, err
+	}
+
+	// if the device is backed by multiple block devices (e.x. a RAID array),
+	// deterministically pick the first one
+	name := names[0]
+
+	// the attributes of devices that are reported by their device-mapper name are listed
+	// under their kernel name
+	sysfsName := name
+	if d.deviceMapperNames {
+		sysfsName = deviceMapperKernelName(logger, sysfs, name)
+	}
+
+	device := Device{
+		Name:       name,
+		Major:      major,
+		Minor:      minor,
+		Mountpoint: mount.Mountpoint,
+		FSType:     mount.FSType,
+	}
+
+	readSysfsDeviceAttributes(logger, sysfs, sysfsName, &device)
+
+	return device, nil
+}
+
+// readSysfsDeviceAttributes fills in the attributes of device that are read from the sysfs
+// entry of the whole disk with the provided kernel name.
+func readSysfsDeviceAttributes(logger sglog.Logger, sysfs fs.FS, name string, device *Device) {
+	device.Size = readSysfsDeviceSize(logger, sysfs, name)
+	device.LogicalBlockSize = readSysfsBlockSize(logger, sysfs, name, "logical_block_size")
+	device.PhysicalBlockSize = readSysfsBlockSize(logger, sysfs, name, "physical_block_size")
+
+	device.Network = isNetworkBlockDevice(name)
+	device.CompressedRAM = isCompressedRAMDevice(name)
+
+	// compressed RAM devices aren't backed by any hardware, so they don't have any of the
+	// attributes of physical disks
+	if device.CompressedRAM {
+		return
+	}
+
+	device.Rotational = readSysfsAttribute(logger, sysfs, path.Join("block", name, "queue", "rotational")) == "1"
+	device.Model = readSysfsAttribute(logger, sysfs, path.Join("block", name, "device", "model"))
+	device.Removable = readSysfsAttribute(logger, sysfs, path.Join("block", name, "removable")) == "1"
+	device.WWN = readSysfsWWN(logger, sysfs, name)
+	device.Serial = readSysfsSerial(logger, sysfs, name)
+}
+
+// readSysfsWWN returns the world-wide name of the block device with the provided name, or an
+// empty string if it doesn't report one.
+func readSysfsWWN(logger sglog.Logger, sysfs fs.FS, name string) string {
+	// NVMe namespaces report it themselves, while SCSI disks report it through their SCSI device
+	for _, attribute := range []string{"wwid", "device/wwid"} {
+		if wwn := readSysfsAttribute(logger, sysfs, path.Join("block", name, attribute)); wwn != "" {
+			return wwn
+		}
+	}
+
+	return ""
+}
+
+// readSysfsSerial returns the serial number of the block device with the provided name, or an
+// empty string if it doesn't report one.
+func readSysfsSerial(logger sglog.Logger, sysfs fs.FS, name string) string {
+	// virtio disks report it themselves, while NVMe namespaces report the one of their controller
+	for _, attribute := range []string{"serial", "device/serial"} {
+		if serial := readSysfsAttribute(logger, sysfs, path.Join("block", name, attribute)); serial != "" {
+			return serial
+		}
+	}
+
+	// SCSI disks only report it in the "unit serial number" page of their vital product data
+	contents, err := readSysfsFile(sysfs, path.Join("block", name, "device", "vpd_pg80"))
+	if err != nil {
+		return ""
+	}
+
+	return parseVPDSerial(contents)
+}
+
+// parseVPDSerial parses the serial number out of the "unit serial number" page (0x80) of a SCSI
+// device's vital product data, which consists of a four byte header (whose last two bytes are the
+// big-endian length of the page) followed by the serial number in ASCII.
+func parseVPDSerial(page []byte) string {
+	if len(page) < 4 || page[1] != 0x80 {
+		return ""
+	}
+
+	length := int(page[2])<<8 | int(page[3])
+	if length > len(page)-4 {
+		length = len(page) - 4
+	}
+
+	return strings.Trim(string(page[4:4+length]), " \x00")
+}
+
+// networkBlockDeviceRegex matches the kernel names of block devices that are backed by a
+// remote server: network block devices (e.x. "nbd0") and Ceph RADOS block devices (e.x. "rbd0").
+var networkBlockDeviceRegex = regexp.MustCompile(`^(?:nbd|rbd)\d+$`)
+
+// isNetworkBlockDevice returns true if the whole disk with the provided kernel name
+// (e.x. "nbd0", not "nbd0p1") is backed by a remote server.
+func isNetworkBlockDevice(name string) bool {
+	return networkBlockDeviceRegex.MatchString(name)
+}
+
+// compressedRAMDeviceRegex matches the kernel names of zram devices (e.x. "zram0"), which store
+// their data compressed in memory.
+var compressedRAMDeviceRegex = regexp.MustCompile(`^zram\d+$`)
+
+// isCompressedRAMDevice returns true if the block device with the provided kernel name stores
+// its data compressed in memory instead of on a disk.
+func isCompressedRAMDevice(name string) bool {
+	return compressedRAMDeviceRegex.MatchString(name)
+}
+
+// mountSourceDeviceName returns the kernel name of the block device (e.x. "dm-0" or "sdb") whose
+// device node is the provided mount source.
+//
+// Mount sources are often symlinks that udev creates (e.x. "/dev/mapper/vg-data" -> "../dm-0", or
+// "/dev/disk/by-id/<id>" -> "../../sdb"), which are resolved on the current system if they exist
+// there. Otherwise (e.x. because the current system's /dev doesn't belong to the same system as
+// sysfs), device-mapper names are looked up in sysfs, and the base name of source is returned for
+// all other sources.
+func mountSourceDeviceName(logger sglog.Logger, sysfs fs.FS, source string) string {
+	if resolved, err := filepath.EvalSymlinks(source); err == nil {
+		return filepath.Base(resolved)
+	}
+
+	dir, name := path.Split(source)
+	if dir == "/dev/mapper/" {
+		return deviceMapperKernelName(logger, sysfs, name)
+	}
+
+	return name
+}
+
+// deviceMapperKernelName returns the kernel name (e.x. "dm-2") of the device-mapper device that
+// was created with the provided name (e.x. "mpatha"). If name is already the kernel name of a
+// block device, or there's no device-mapper device with that name, name is returned unchanged.
+func deviceMapperKernelName(logger sglog.Logger, sysfs fs.FS, name string) string {
+	if _, err := lstat(sysfs, path.Join("block", name)); err == nil {
+		return name
+	}
+
+	entries, err := fs.ReadDir(sysfs, "block")
+	if err != nil {
+		logger.Debug("failed to list block devices", sglog.Error(err))
+		return name
+	}
+
+	for _, entry := range entries {
+		if !deviceMapperNameRegex.MatchString(entry.Name()) {
+			continue
+		}
+
+		if readSysfsAttribute(logger, sysfs, path.Join("block", entry.Name(), "dm", "name")) == name {
+			return entry.Name()
+		}
+	}
+
+	return name
+}
+
+// readSysfsAttribute returns the trimmed contents of the sysfs attribute file at name
+// (example: "block/sda/queue/rotational").
+//
+// Not all devices have every attribute (e.x. virtual devices don't have a model), so an
+// empty string is returned if the attribute can't be read.
+func readSysfsAttribute(logger sglog.Logger, sysfs fs.FS, name string) string {
+	contents, err := readSysfsFile(sysfs, name)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logger.Debug("failed to read sysfs attribute",
+				sglog.String("attribute", name),
+				sglog.Error(err),
+			)
+		}
+
+		return ""
+	}
+
+	return strings.TrimSpace(string(contents))
+}
+
+// readSysfsFile returns the contents of the file at name, after following all of the
+// symbolic links in name.
+func readSysfsFile(sysfs fs.FS, name string) ([]byte, error) {
+	filePath, err := evalSymlinks(sysfs, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.ReadFile(sysfs, filePath)
+}
+
+// discoverDeviceNames returns the names of all the block devices that filePath is
+// stored on.
+func (d *Discoverer) discoverDeviceNames(ctx context.Context, logger sglog.Logger, filePath string) ([]string, error) {
+	sysfs, err := d.sysfs()
+	if err != nil {
+		return nil, fmt.Errorf("finding sysfs mountpoint: %w", err)
+	}
+
+	_, _, names, err := d.discoverFileDeviceNames(ctx, logger, sysfs, filePath)
+	return names, err
+}
+
+// discoverDeviceForFile returns the name of the block device that the open file f
+// is stored on.
+func (d *Discoverer) discoverDeviceForFile(ctx context.Context, logger sglog.Logger, f *os.File) (string, error) {
+	sysfs, err := d.sysfs()
+	if err != nil {
+		return "", fmt.Errorf("finding sysfs mountpoint: %w", err)
+	}
+
+	major, minor, err := d.getFileDeviceNumber(f)
+	if err != nil {
+		return "", fmt.Errorf("discovering device number: %w", err)
+	}
+
+	var names []string
+	if major == 0 {
+		// there's no way to find the mount of an anonymous device through the file descriptor,
+		// so fall back to the file's path
+		d.resolutionFallback(logger, FallbackAnonymousDeviceFilePath, "")
+		names, err = d.discoverAnonymousDeviceNames(ctx, logger, sysfs, f.Name())
+	} else {
+		names, err = d.discoverBlockDeviceNames(ctx, logger, sysfs, major, minor)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return names[0], nil
+}
+
+// discoverDeviceNameFromNumber returns the name of the block device with the provided
+// device number.
+func (d *Discoverer) discoverDeviceNameFromNumber(ctx context.Context, logger sglog.Logger, major, minor uint32) (string, error) {
+	if major == 0 {
+		return "", fmt.Errorf("device number %d:%d is anonymous: %w", major, minor, ErrNoBlockDevice)
+	}
+
+	sysfs, err := d.sysfs()
+	if err != nil {
+		return "", fmt.Errorf("finding sysfs mountpoint: %w", err)
+	}
+
+	names, err := d.discoverBlockDeviceNames(ctx, logger, sysfs, major, minor)
+	if err != nil {
+		return "", err
+	}
+
+	return names[0], nil
+}
+
+// discoverFileDeviceNames returns the number of the device that filePath is stored on,
+// along with the names of all the block devices that back it.
+func (d *Discoverer) discoverFileDeviceNames(ctx context.Context, logger sglog.Logger, sysfs fs.FS, filePath string) (major, minor uint32, names []string, err error) {
+	mount, err := d.findMount(filePath)
+	if err != nil {
+		logger.Debug("failed to find mount, falling back to stat'ing file path",
+			sglog.String("path", filePath),
+			sglog.Error(err),
+		)
+
+		mount = nil
+	}
+
+	return d.discoverMountDeviceNames(ctx, logger, sysfs, mount, filePath)
+}
+
+// discoverMountDeviceNames is like discoverFileDeviceNames, but takes the mount that contains
+// filePath (or nil if it isn't known) instead of looking it up.
+func (d *Discoverer) discoverMountDeviceNames(ctx context.Context, logger sglog.Logger, sysfs fs.FS, mount *mountinfo.Info, filePath string) (major, minor uint32, names []string, err error) {
+	major, minor, err = d.mountDeviceNumber(logger, mount, filePath)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("discovering device number: %w", err)
+	}
+
+	// filesystems that aren't stored on a single block device (e.x. btrfs) report
+	// anonymous device numbers, which don't have an entry in sysfs
+	if major == 0 {
+		names, err = d.discoverAnonymousDeviceNames(ctx, logger, sysfs, filePath)
+	} else {
+		names, err = d.discoverBlockDeviceNames(ctx, logger, sysfs, major, minor)
+	}
+
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	return major, minor, names, nil
+}
+
+// mountDeviceNumber returns the number of the device that filePath is stored on.
+//
+// The number is taken from the mount table entry of mount (the mount that contains filePath),
+// since that's the device that actually stores the data of bind mounts (whose source might be on
+// a different filesystem than the bind target's parent). filePath is only stat'ed if mount is nil,
+// or if the mount table doesn't record device numbers.
+func (d *Discoverer) mountDeviceNumber(logger sglog.Logger, mount *mountinfo.Info, filePath string) (major, minor uint32, err error) {
+	// 0:0 is never a valid device number, so it means that the mount table entry doesn't have one
+	if mount == nil || (mount.Major == 0 && mount.Minor == 0) {
+		return d.getDeviceNumber(filepath.Clean(filePath))
+	}
+
+	logger.Debug("discovered device number from mount",
+		sglog.String("mountpoint", mount.Mountpoint),
+		sglog.String("root", mount.Root),
+	)
+
+	return uint32(mount.Major), uint32(mount.Minor), nil
+}
+
+// discoverBlockDeviceNames returns the names of the block devices that back the
+// device with the provided major and minor numbers.
+func (d *Discoverer) discoverBlockDeviceNames(ctx context.Context, logger sglog.Logger, sysfs fs.FS, major, minor uint32) ([]string, error) {
 	// Note: It's quite involved to implement the device discovery logic for
 	// every possible kind of storage device (e.x. logical volumes, NFS, etc.) See
 	// https://unix.stackexchange.com/a/11312 for more information.
@@ -105,6 +772,11 @@ func discoverDeviceName(logger sglog.Logger, filePath string) (string, error) {
 	// As a result, this logic will only work correctly for filePaths that are either:
 	// - stored directly on a block device
 	// - stored on a block device's partition
+	// - stored on a virtual block device (e.x. an LVM logical volume, dm-crypt / LUKS volume, or md RAID array) that is backed by the above
+	// - stored on a loop device whose backing file is stored on any of the above
+	// - stored on a btrfs filesystem whose member devices are any of the above
+	// - stored on an overlay filesystem whose upper directory is stored on any of the above
+	// - stored on a ZFS dataset whose pool's vdevs are any of the above
 	//
 	// For all other device types, this logic will either:
 	// - return an incorrect device name
@@ -118,33 +790,134 @@ func discoverDeviceName(logger sglog.Logger, filePath string) (string, error) {
 	// - https://unix.stackexchange.com/a/11312
 	// - https://www.kernel.org/doc/ols/2005/ols2005v1-pages-321-334.pdf
 
-	sysfsMountPoint, err := findSysfsMountpoint()
-	if err != nil {
-		return "", fmt.Errorf("finding sysfs mountpoint: %w", err)
-	}
-
-	deviceNumber, err := getDeviceNumber(filepath.Clean(filePath))
-	if err != nil {
-		return "", fmt.Errorf("discovering device number: %w", err)
-	}
+	// Represent the number in <major>:<minor> format.
+	deviceNumber := fmt.Sprintf("%d:%d", major, minor)
 
 	logger.Debug(
 		"discovered device number",
 		sglog.String("deviceNumber", deviceNumber),
+		sglog.Int("major", int(major)),
+		sglog.Int("minor", int(minor)),
 	)
 
-	devicePath, err := discoverSysfsDevicePath(sysfsMountPoint, deviceNumber)
+	var devicePath string
+	err := d.retrySysfs(ctx, logger, func() (err error) {
+		devicePath, err = discoverSysfsDevicePath(sysfs, deviceNumber)
+		return err
+	})
 	if err != nil {
-		return "", fmt.Errorf("discovering device path: %w", err)
+		return nil, fmt.Errorf("discovering device path: %w", err)
 	}
 
 	logger.Debug("discovered device path",
 		sglog.String("devicePath", devicePath),
 	)
 
-	name, err := getDeviceBlockName(sysfsMountPoint, devicePath)
-	if err != nil {
-		return "", fmt.Errorf("failed resolving block device name: %w", err)
+	return d.resolveDevicePaths(ctx, logger, sysfs, []string{devicePath})
+}
+
+// resolveDevicePaths returns the names of the block devices that store the data of the
+// devices at the provided sysfs paths.
+func (d *Discoverer) resolveDevicePaths(ctx context.Context, logger sglog.Logger, sysfs fs.FS, devicePaths []string) ([]string, error) {
+	var names []string
+	seen := make(map[string]struct{})
+
+	for _, devicePath := range devicePaths {
+		// virtual block devices (e.x. LVM logical volumes) don't store any data themselves, so
+		// follow them down to the block devices that actually store the data
+		slavePaths, err := resolveSlaves(ctx, logger, sysfs, devicePath, d.deviceMapperNames)
+		if err != nil {
+			return nil, fmt.Errorf("resolving slaves: %w", err)
+		}
+
+		for _, slavePath := range slavePaths {
+			if slavePath != devicePath {
+				logger.Debug("resolved slave",
+					sglog.String("devicePath", devicePath),
+					sglog.String("slavePath", slavePath),
+				)
+			}
+
+			name, err := getDeviceBlockName(ctx, logger, sysfs, slavePath)
+			if err != nil {
+				return nil, fmt.Errorf("failed resolving block device name: %w", err)
+			}
+
+			if deviceMapperNameRegex.MatchString(name) {
+				if isThinPool(logger, sysfs, slavePath) {
+					// the thin pool's data device couldn't be followed down to a physical disk,
+					// so report the pool by the name it was created with
+					name = deviceMapperName(logger, sysfs, slavePath, name)
+					d.resolutionFallback(logger.With(sglog.String("device", name)), FallbackThinPoolUnresolved, name)
+				} else if d.deviceMapperNames {
+					// multipath maps are kept on purpose, and are reported by their name
+					name = deviceMapperName(logger, sysfs, slavePath, name)
+				} else {
+					// device-mapper devices are virtual, so one that's left over after resolving
+					// slaves doesn't list the devices that actually store its data
+					d.resolutionFallback(logger.With(sglog.String("device", name)), FallbackDeviceMapperWithoutSlaves, name)
+				}
+			}
+
+			if headName := normalizeNVMeMultipathName(name); headName != name {
+				logger.Debug("resolved nvme multipath head namespace",
+					sglog.String("pathName", name),
+					sglog.String("headName", headName),
+				)
+
+				name = headName
+			}
+
+			resolvedNames := []string{name}
+
+			// loop devices are backed by a file, so report the devices that store the file instead
+			if loopDevicePrefixRegex.MatchString(name) {
+				if backingNames, ok := d.resolveLoopDevice(ctx, logger, sysfs, name); ok {
+					resolvedNames = backingNames
+				} else {
+					d.resolutionFallback(logger.With(sglog.String("loopDevice", name)), FallbackLoopBackingFileUnresolved, name)
+				}
+			}
+
+			for _, name := range resolvedNames {
+				// multiple slaves can be partitions of the same disk
+				if _, ok := seen[name]; ok {
+					continue
+				}
+
+				seen[name] = struct{}{}
+				names = append(names, name)
+			}
+		}
 	}
-	return name, nil
+
+	if d.wholeDiskOnly {
+		for _, name := range names {
+			if err := checkWholeDisk(logger, sysfs, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// checkWholeDisk returns an error that wraps ErrNotWholeDisk unless the block device with the
+// provided name is a whole disk: a device that's listed in /sys/block, isn't a partition, and
+// isn't a device-mapper device.
+func checkWholeDisk(logger sglog.Logger, sysfs fs.FS, name string) error {
+	kernelName := deviceMapperKernelName(logger, sysfs, name)
+	if deviceMapperNameRegex.MatchString(kernelName) {
+		return fmt.Errorf("%q is a device-mapper device: %w", name, ErrNotWholeDisk)
+	}
+
+	if _, err := lstat(sysfs, path.Join("block", kernelName)); err != nil {
+		return fmt.Errorf("%q isn't listed in /sys/block: %w", name, ErrNotWholeDisk)
+	}
+
+	if _, err := readSysfsFile(sysfs, path.Join("block", kernelName, "partition")); err == nil {
+		return fmt.Errorf("%q is a partition: %w", name, ErrNotWholeDisk)
+	}
+
+	return nil
 }
@@ -0,0 +1,78 @@
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/moby/sys/mountinfo"
+	sglog "github.com/sourcegraph/log"
+	"golang.org/x/sys/unix"
+)
+
+// discoverDevice returns information about the block device that filePath is
+// stored on.
+func (d *Discoverer) discoverDevice(ctx context.Context, logger sglog.Logger, filePath string) (Device, error) {
+	if err := ctx.Err(); err != nil {
+		return Device{}, err
+	}
+
+	mount, err := d.findMount(filePath)
+	if err != nil {
+		return Device{}, fmt.Errorf("finding mountpoint: %w", err)
+	}
+
+	logger.Debug("discovered mount",
+		sglog.String("mountpoint", mount.Mountpoint),
+		sglog.String("source", mount.Source),
+	)
+
+	major, minor, err := d.getDeviceNumber(filePath)
+	if err != nil {
+		return Device{}, fmt.Errorf("discovering device number: %w", err)
+	}
+
+	// the mount's source is the special file of the disklabel partition that
+	// stores the filesystem (e.x. "/dev/wd0a")
+	name, err := disklabelDiskName(mount.Source)
+	if err != nil {
+		return Device{}, fmt.Errorf("mount %q: %w", mount.Mountpoint, err)
+	}
+
+	return Device{
+		Name:       name,
+		Major:      major,
+		Minor:      minor,
+		Mountpoint: mount.Mountpoint,
+		FSType:     mount.FSType,
+	}, nil
+}
+
+// discoverDeviceNames returns the names of all the block devices that filePath is
+// stored on.
+func (d *Discoverer) discoverDeviceNames(ctx context.Context, logger sglog.Logger, filePath string) ([]string, error) {
+	device, err := d.discoverDevice(ctx, logger, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{device.Name}, nil
+}
+
+// findMount returns the mount that contains filePath.
+//
+// github.com/moby/sys/mountinfo can't read the mount table on NetBSD, so the mount is
+// looked up with statvfs1(2) instead, which returns the same information as getvfsstat(2)
+// but only for the filesystem that contains filePath.
+func findMount(filePath string) (*mountinfo.Info, error) {
+	var stat unix.Statvfs_t
+	if err := unix.Statvfs(filepath.Clean(filePath), &stat); err != nil {
+		return nil, fmt.Errorf("findMount: failed to statvfs %q: %w", filePath, err)
+	}
+
+	return &mountinfo.Info{
+		Mountpoint: unix.ByteSliceToString(stat.Mntonname[:]),
+		Source:     unix.ByteSliceToString(stat.Mntfromname[:]),
+		FSType:     unix.ByteSliceToString(stat.Fstypename[:]),
+	}, nil
+}
@@ -0,0 +1,90 @@
+package mountinfo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// DeviceNodePath returns the location of the device node of the block device that filePath is
+// stored on (example: "/dev/vda"), for callers that hand the device to tools that expect a
+// device node instead of a bare name.
+//
+// The device node is looked up where the current operating system creates it:
+//   - "/dev/<name>" on Linux (or "/dev/mapper/<name>" for the device-mapper names that
+//     WithDeviceMapperNames reports), macOS (example: "/dev/disk0"), FreeBSD, and AIX
+//   - the raw partition that spans the whole disk on OpenBSD and NetBSD (example: "/dev/sd0c")
+//   - the whole disk (example: "/dev/dsk/c1t0d0p0") or its backup slice on illumos and Solaris
+//   - "\\.\<name>" on Windows (example: "\\.\PhysicalDrive0")
+//
+// If the device node doesn't exist (e.x. because the Discoverer inspects the sysfs of another
+// system, or because the device wasn't passed into the current container), the returned error
+// wraps fs.ErrNotExist. Like DeviceName, DeviceNodePath discards all of the logs that discovery
+// produces.
+func (d *Discoverer) DeviceNodePath(filePath string) (string, error) {
+	name, err := d.DeviceName(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	return deviceNodePath(name)
+}
+
+// DeviceNodePath calls DeviceNodePath on a Discoverer that inspects the current system.
+func DeviceNodePath(filePath string) (string, error) {
+	return defaultDiscoverer.DeviceNodePath(filePath)
+}
+
+// deviceNodePath returns the location of the first device node that exists for the block device
+// with the provided name.
+func deviceNodePath(name string) (string, error) {
+	candidates := deviceNodeCandidates(runtime.GOOS, name)
+
+	for _, candidate := range candidates {
+		err := statDeviceNode(candidate)
+		if err == nil {
+			return candidate, nil
+		}
+
+		// the device node might exist, but can't be inspected (e.x. for lack of permissions)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("deviceNodePath: %w", err)
+		}
+	}
+
+	return "", fmt.Errorf("deviceNodePath: no device node found for device %q (tried %s): %w", name, strings.Join(candidates, ", "), fs.ErrNotExist)
+}
+
+// deviceNodeCandidates returns the locations (in order of preference) that the device node of
+// the block device with the provided name can have on the operating system goos.
+func deviceNodeCandidates(goos, name string) []string {
+	switch goos {
+	case "linux":
+		// sysfs (and therefore the reported name) replaces the slashes of device nodes in
+		// subdirectories of /dev with "!" (e.x. "cciss!c0d0" for "/dev/cciss/c0d0")
+		name = strings.ReplaceAll(name, "!", "/")
+		return []string{path.Join("/dev", name), path.Join("/dev", "mapper", name)}
+
+	case "openbsd":
+		// "c" is the raw partition that spans the whole disk
+		return []string{path.Join("/dev", name+"c")}
+
+	case "netbsd":
+		// the raw partition is "d" on x86 and "c" on all other architectures
+		return []string{path.Join("/dev", name+"d"), path.Join("/dev", name+"c")}
+
+	case "illumos", "solaris":
+		// "p0" is the whole disk on x86, and "s2" is the slice that traditionally spans the
+		// whole disk on disks with a VTOC label
+		return []string{path.Join("/dev", "dsk", name+"p0"), path.Join("/dev", "dsk", name+"s2")}
+
+	case "windows":
+		return []string{`\\.\` + name}
+
+	default:
+		return []string{path.Join("/dev", name)}
+	}
+}
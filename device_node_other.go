@@ -0,0 +1,11 @@
+//go:build !windows
+
+package mountinfo
+
+import "os"
+
+// statDeviceNode returns an error if there's no device node at devicePath.
+func statDeviceNode(devicePath string) error {
+	_, err := os.Stat(devicePath)
+	return err
+}
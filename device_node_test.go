@@ -0,0 +1,38 @@
+package mountinfo
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_DeviceNodeCandidates(t *testing.T) {
+	for _, test := range []struct {
+		goos     string
+		name     string
+		expected []string
+	}{
+		{goos: "linux", name: "vda", expected: []string{"/dev/vda", "/dev/mapper/vda"}},
+		{goos: "linux", name: "mpatha", expected: []string{"/dev/mpatha", "/dev/mapper/mpatha"}},
+		{goos: "linux", name: "cciss!c0d0", expected: []string{"/dev/cciss/c0d0", "/dev/mapper/cciss/c0d0"}},
+		{goos: "darwin", name: "disk0", expected: []string{"/dev/disk0"}},
+		{goos: "freebsd", name: "ada0", expected: []string{"/dev/ada0"}},
+		{goos: "openbsd", name: "sd0", expected: []string{"/dev/sd0c"}},
+		{goos: "netbsd", name: "wd0", expected: []string{"/dev/wd0d", "/dev/wd0c"}},
+		{goos: "solaris", name: "c1t0d0", expected: []string{"/dev/dsk/c1t0d0p0", "/dev/dsk/c1t0d0s2"}},
+		{goos: "aix", name: "hdisk0", expected: []string{"/dev/hdisk0"}},
+		{goos: "windows", name: "PhysicalDrive0", expected: []string{`\\.\PhysicalDrive0`}},
+	} {
+		if diff := cmp.Diff(test.expected, deviceNodeCandidates(test.goos, test.name)); diff != "" {
+			t.Errorf("recieved unexpected device node candidates for %q on %s (-want +got):\n%s", test.name, test.goos, diff)
+		}
+	}
+}
+
+func Test_DeviceNodePath_Missing(t *testing.T) {
+	if _, err := deviceNodePath("doesnotexist0"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected error wrapping fs.ErrNotExist, got %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package mountinfo
+
+import "golang.org/x/sys/windows"
+
+// statDeviceNode returns an error if there's no device at devicePath (example:
+// "\\.\PhysicalDrive0").
+//
+// os.Stat can't inspect devices, so the device is opened without requesting any access to it
+// (which doesn't require administrator privileges), like getStorageDeviceNumber does.
+func statDeviceNode(devicePath string) error {
+	path, err := windows.UTF16PtrFromString(devicePath)
+	if err != nil {
+		return err
+	}
+
+	handle, err := windows.CreateFile(path, 0, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	return windows.CloseHandle(handle)
+}
@@ -0,0 +1,17 @@
+//go:build !(unix || windows)
+
+package mountinfo
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func getDeviceNumber(filePath string) (major, minor uint32, err error) {
+	return 0, 0, fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
+
+func getFileDeviceNumber(f *os.File) (major, minor uint32, err error) {
+	return 0, 0, fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
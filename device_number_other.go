@@ -0,0 +1,15 @@
+//go:build !linux
+
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+func (d *Discoverer) discoverDeviceNameFromNumber(ctx context.Context, logger sglog.Logger, major, minor uint32) (string, error) {
+	return "", fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
@@ -0,0 +1,79 @@
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+
+	sglog "github.com/sourcegraph/log"
+	"golang.org/x/sys/unix"
+)
+
+// discoverDevice returns information about the block device that filePath is
+// stored on.
+//
+// Filesystems that are stored on a softraid volume (e.x. "sd1", backed by "sd0")
+// are reported as being stored on the volume itself.
+func (d *Discoverer) discoverDevice(ctx context.Context, logger sglog.Logger, filePath string) (Device, error) {
+	if err := ctx.Err(); err != nil {
+		return Device{}, err
+	}
+
+	mount, err := d.findMount(filePath)
+	if err != nil {
+		return Device{}, fmt.Errorf("finding mountpoint: %w", err)
+	}
+
+	logger.Debug("discovered mount",
+		sglog.String("mountpoint", mount.Mountpoint),
+		sglog.String("source", mount.Source),
+	)
+
+	major, minor, err := d.getDeviceNumber(filePath)
+	if err != nil {
+		return Device{}, fmt.Errorf("discovering device number: %w", err)
+	}
+
+	// the mount's source is either the special file of the disklabel partition that
+	// stores the filesystem (e.x. "/dev/sd0a"), or its DUID (e.x. "3eb7f9da875cb9ee.a")
+	source := mount.Source
+	if duidRegex.MatchString(source) {
+		disknames, err := unix.Sysctl("hw.disknames")
+		if err != nil {
+			return Device{}, fmt.Errorf("reading disk names: %w", err)
+		}
+
+		source, err = resolveDUID(disknames, source)
+		if err != nil {
+			return Device{}, fmt.Errorf("mount %q: %w", mount.Mountpoint, err)
+		}
+
+		logger.Debug("resolved DUID",
+			sglog.String("duid", mount.Source),
+			sglog.String("source", source),
+		)
+	}
+
+	name, err := disklabelDiskName(source)
+	if err != nil {
+		return Device{}, fmt.Errorf("mount %q: %w", mount.Mountpoint, err)
+	}
+
+	return Device{
+		Name:       name,
+		Major:      major,
+		Minor:      minor,
+		Mountpoint: mount.Mountpoint,
+		FSType:     mount.FSType,
+	}, nil
+}
+
+// discoverDeviceNames returns the names of all the block devices that filePath is
+// stored on.
+func (d *Discoverer) discoverDeviceNames(ctx context.Context, logger sglog.Logger, filePath string) ([]string, error) {
+	device, err := d.discoverDevice(ctx, logger, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{device.Name}, nil
+}
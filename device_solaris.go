@@ -0,0 +1,101 @@
+package mountinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/moby/sys/mountinfo"
+	sglog "github.com/sourcegraph/log"
+)
+
+// mnttabPath is the location of the table of mounted filesystems.
+const mnttabPath = "/etc/mnttab"
+
+// discoverDevice returns information about the block device that filePath is
+// stored on.
+func (d *Discoverer) discoverDevice(ctx context.Context, logger sglog.Logger, filePath string) (Device, error) {
+	if err := ctx.Err(); err != nil {
+		return Device{}, err
+	}
+
+	mount, err := d.findMount(filePath)
+	if err != nil {
+		return Device{}, fmt.Errorf("finding mountpoint: %w", err)
+	}
+
+	logger.Debug("discovered mount",
+		sglog.String("mountpoint", mount.Mountpoint),
+		sglog.String("source", mount.Source),
+	)
+
+	major, minor, err := d.getDeviceNumber(filePath)
+	if err != nil {
+		return Device{}, fmt.Errorf("discovering device number: %w", err)
+	}
+
+	// the mount's source is the special file of the slice that stores
+	// the filesystem (e.x. "/dev/dsk/c1t0d0s0")
+	name, err := ctdDiskName(mount.Source)
+	if err != nil {
+		return Device{}, fmt.Errorf("mount %q: %w", mount.Mountpoint, err)
+	}
+
+	return Device{
+		Name:       name,
+		Major:      major,
+		Minor:      minor,
+		Mountpoint: mount.Mountpoint,
+		FSType:     mount.FSType,
+	}, nil
+}
+
+// discoverDeviceNames returns the names of all the block devices that filePath is
+// stored on.
+func (d *Discoverer) discoverDeviceNames(ctx context.Context, logger sglog.Logger, filePath string) ([]string, error) {
+	device, err := d.discoverDevice(ctx, logger, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{device.Name}, nil
+}
+
+// findMount returns the most specific mount that contains filePath.
+//
+// github.com/moby/sys/mountinfo can't read the mount table on illumos and Solaris,
+// so /etc/mnttab is parsed instead.
+func findMount(filePath string) (*mountinfo.Info, error) {
+	// the mount table lists mountpoints as absolute paths with all
+	// symlinks resolved, so massage filePath into the same form before comparing
+	filePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("findMount: failed to massage %q to absolute path: %w", filePath, err)
+	}
+
+	resolvedPath, err := filepath.EvalSymlinks(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("findMount: failed to resolve symlinks for %q: %w", filePath, err)
+	}
+
+	f, err := os.Open(mnttabPath)
+	if err != nil {
+		return nil, fmt.Errorf("findMount: %w", err)
+	}
+
+	defer f.Close()
+
+	mounts, err := parseMnttab(f, parentsFilter(resolvedPath))
+	if err != nil {
+		return nil, fmt.Errorf("findMount: %w", err)
+	}
+
+	mount := mostSpecificMount(mounts)
+	if mount == nil {
+		return nil, errors.New("findMount: no mountpoint found")
+	}
+
+	return mount, nil
+}
@@ -0,0 +1,19 @@
+//go:build !(linux || darwin || windows || freebsd)
+
+package mountinfo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sourcegraph/log/logtest"
+)
+
+func Test_DeviceName_UnsupportedPlatform(t *testing.T) {
+	logger := logtest.Scoped(t)
+
+	_, err := discoverDeviceName(logger, ".")
+	if !errors.Is(err, ErrUnsupportedPlatform) {
+		t.Fatalf("expected error to wrap %q, got: %v", ErrUnsupportedPlatform, err)
+	}
+}
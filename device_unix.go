@@ -1,4 +1,4 @@
-//go:build !windows
+//go:build unix
 
 // file to hold functions that work on both Linux and Unix operating systems
 
@@ -6,24 +6,54 @@ package mountinfo
 
 import (
 	"fmt"
+	"os"
 
 	"golang.org/x/sys/unix"
 )
 
-// defined as a variable so that it can be redefined by test routines
-var getDeviceNumber = func(filePath string) (string, error) {
+// getDeviceNumber returns the major and minor numbers of the device that filePath is stored on.
+//
+// On Linux, the device number is looked up with statx if the running kernel supports it.
+func getDeviceNumber(filePath string) (major, minor uint32, err error) {
+	if major, minor, ok, err := statxDeviceNumber(filePath); ok {
+		return major, minor, err
+	}
+
 	// this is the only explicitely platform-dependent code being used: Stat_t and Stat.
 	// (requires a Unix/Linux OS to compile)
 	// Other code is implicitly dependent on Linux's sysfs, but will compile on other OSs
 	var stat unix.Stat_t
-	err := unix.Stat(filePath, &stat)
+	err = unix.Stat(filePath, &stat)
 	if err != nil {
-		return "", fmt.Errorf("getDeviceNumber: failed to stat %q: %w", filePath, err)
+		return 0, 0, fmt.Errorf("getDeviceNumber: failed to stat %q: %w", filePath, wrapPathNotFound(err))
 	}
 
 	//nolint:unconvert // We need the unix.Major/Minor functions to perform the proper bit-shifts
-	major, minor := unix.Major(uint64(stat.Dev)), unix.Minor(uint64(stat.Dev))
+	return unix.Major(uint64(stat.Dev)), unix.Minor(uint64(stat.Dev)), nil
+}
+
+// getFileDeviceNumber returns the major and minor numbers of the device that the open file f is stored on.
+func getFileDeviceNumber(f *os.File) (major, minor uint32, err error) {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return 0, 0, fmt.Errorf("getFileDeviceNumber: %w", err)
+	}
+
+	var stat unix.Stat_t
+	var statErr error
+
+	// unlike f.Fd(), Control doesn't switch the file descriptor to blocking mode
+	err = conn.Control(func(fd uintptr) {
+		statErr = unix.Fstat(int(fd), &stat)
+	})
+	if err == nil {
+		err = statErr
+	}
 
-	// Represent the number in <major>:<minor> format.
-	return fmt.Sprintf("%d:%d", major, minor), nil
+	if err != nil {
+		return 0, 0, fmt.Errorf("getFileDeviceNumber: failed to fstat %q: %w", f.Name(), err)
+	}
+
+	//nolint:unconvert // We need the unix.Major/Minor functions to perform the proper bit-shifts
+	return unix.Major(uint64(stat.Dev)), unix.Minor(uint64(stat.Dev)), nil
 }
@@ -0,0 +1,27 @@
+//go:build unix
+
+package mountinfo
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+func Test_GetDeviceNumber_PathNotFound(t *testing.T) {
+	_, _, err := getDeviceNumber(filepath.Join(t.TempDir(), "deleted"))
+	if !errors.Is(err, ErrPathNotFound) {
+		t.Fatalf("expected error wrapping ErrPathNotFound, got %v", err)
+	}
+
+	// the underlying error is still available
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected error wrapping fs.ErrNotExist, got %v", err)
+	}
+
+	// other failures aren't reported as missing paths
+	if _, _, err := getDeviceNumber(string([]byte{0})); err == nil || errors.Is(err, ErrPathNotFound) {
+		t.Fatalf("expected error that doesn't wrap ErrPathNotFound, got %v", err)
+	}
+}
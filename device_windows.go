@@ -1,12 +1,258 @@
 package mountinfo
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
+	"unsafe"
 
+	"github.com/moby/sys/mountinfo"
 	sglog "github.com/sourcegraph/log"
+	"golang.org/x/sys/windows"
 )
 
-func discoverDeviceName(logger sglog.Logger, filePath string) (string, error) {
-	return "", fmt.Errorf("not implemented on %s", runtime.GOOS)
+// ioctlStorageGetDeviceNumber is the IOCTL_STORAGE_GET_DEVICE_NUMBER control code, which
+// isn't defined by golang.org/x/sys/windows.
+//
+// See https://learn.microsoft.com/en-us/windows/win32/api/winioctl/ni-winioctl-ioctl_storage_get_device_number
+const ioctlStorageGetDeviceNumber = 0x2d1080
+
+// storageDeviceNumber mirrors the STORAGE_DEVICE_NUMBER struct that's returned by
+// IOCTL_STORAGE_GET_DEVICE_NUMBER.
+//
+// See https://learn.microsoft.com/en-us/windows/win32/api/winioctl/ns-winioctl-storage_device_number
+type storageDeviceNumber struct {
+	DeviceType      uint32
+	DeviceNumber    uint32
+	PartitionNumber uint32
+}
+
+// discoverDevice returns information about the block device that filePath is
+// stored on.
+func (d *Discoverer) discoverDevice(ctx context.Context, logger sglog.Logger, filePath string) (Device, error) {
+	if err := ctx.Err(); err != nil {
+		return Device{}, err
+	}
+
+	mount, err := d.findMount(filePath)
+	if err != nil {
+		return Device{}, fmt.Errorf("finding volume: %w", err)
+	}
+
+	logger.Debug("discovered volume path",
+		sglog.String("volumePath", mount.Mountpoint),
+	)
+
+	name, err := getPhysicalDriveName(logger, mount.Mountpoint)
+	if err != nil {
+		return Device{}, fmt.Errorf("discovering physical drive: %w", err)
+	}
+
+	return Device{
+		Name:       name,
+		Mountpoint: mount.Mountpoint,
+		FSType:     mount.FSType,
+	}, nil
+}
+
+// findMount returns the volume that filePath is stored on.
+//
+// Only the Mountpoint (the root of the volume, example: `C:\`, or `C:\mnt\data\` for a volume
+// that's mounted into a directory) and FSType fields are populated.
+func findMount(filePath string) (*mountinfo.Info, error) {
+	volumePath, err := getVolumePathName(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("findMount: %w", err)
+	}
+
+	fsType, err := getVolumeFilesystemType(volumePath)
+	if err != nil {
+		return nil, fmt.Errorf("findMount: %w", err)
+	}
+
+	return &mountinfo.Info{
+		Mountpoint: volumePath,
+		FSType:     fsType,
+	}, nil
+}
+
+// discoverDeviceNames returns the names of all the block devices that filePath is
+// stored on.
+func (d *Discoverer) discoverDeviceNames(ctx context.Context, logger sglog.Logger, filePath string) ([]string, error) {
+	device, err := d.discoverDevice(ctx, logger, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{device.Name}, nil
+}
+
+// getVolumePathName returns the root of the volume that filePath is stored on (example: `C:\`).
+func getVolumePathName(filePath string) (string, error) {
+	filePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", fmt.Errorf("getVolumePathName: failed to massage %q to absolute path: %w", filePath, err)
+	}
+
+	path, err := windows.UTF16PtrFromString(filePath)
+	if err != nil {
+		return "", fmt.Errorf("getVolumePathName: %w", err)
+	}
+
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	err = windows.GetVolumePathName(path, &buf[0], uint32(len(buf)))
+	if err != nil {
+		return "", fmt.Errorf("getVolumePathName: GetVolumePathNameW(%q): %w", filePath, err)
+	}
+
+	return windows.UTF16ToString(buf), nil
+}
+
+// getPhysicalDriveName returns the name of the physical drive (example: "PhysicalDrive0") that
+// stores the volume mounted at volumePath.
+func getPhysicalDriveName(logger sglog.Logger, volumePath string) (string, error) {
+	root, err := windows.UTF16PtrFromString(volumePath)
+	if err != nil {
+		return "", fmt.Errorf("getPhysicalDriveName: %w", err)
+	}
+
+	if windows.GetDriveType(root) == windows.DRIVE_REMOTE {
+		return "", fmt.Errorf("getPhysicalDriveName: volume %q is a network drive: %w", volumePath, ErrNoBlockDevice)
+	}
+
+	dosDevice, err := getVolumeDosDeviceName(volumePath)
+	if err != nil {
+		return "", fmt.Errorf("getPhysicalDriveName: %w", err)
+	}
+
+	target, err := queryDosDevice(dosDevice)
+	if err != nil {
+		return "", fmt.Errorf("getPhysicalDriveName: %w", err)
+	}
+
+	logger.Debug("discovered volume device",
+		sglog.String("dosDevice", dosDevice),
+		sglog.String("volumeDevice", target),
+	)
+
+	deviceNumber, err := getStorageDeviceNumber(`\\.\` + dosDevice)
+	if err != nil {
+		return "", fmt.Errorf("getPhysicalDriveName: %w", err)
+	}
+
+	return fmt.Sprintf("PhysicalDrive%d", deviceNumber.DeviceNumber), nil
+}
+
+// getVolumeDosDeviceName returns the name of the DOS device (example: "C:") that the volume
+// mounted at volumePath is available as.
+//
+// Volumes that are mounted at a drive letter (example: `C:\`) are available as a DOS device
+// that's named after the drive letter. Volumes can also be mounted into an empty directory
+// on another NTFS volume (example: `C:\mnt\data\`), which is only available as a DOS device
+// that's named after the volume's GUID (example: "Volume{26a21bda-a627-11d7-9931-806e6f6e6963}").
+func getVolumeDosDeviceName(volumePath string) (string, error) {
+	if drive := strings.TrimSuffix(volumePath, `\`); len(drive) == 2 && drive[1] == ':' {
+		return drive, nil
+	}
+
+	mountPoint, err := windows.UTF16PtrFromString(volumePath)
+	if err != nil {
+		return "", fmt.Errorf("getVolumeDosDeviceName: %w", err)
+	}
+
+	// volume GUID paths are 49 characters long, including the trailing NUL
+	buf := make([]uint16, windows.MAX_PATH)
+	err = windows.GetVolumeNameForVolumeMountPoint(mountPoint, &buf[0], uint32(len(buf)))
+	if err != nil {
+		return "", fmt.Errorf("getVolumeDosDeviceName: GetVolumeNameForVolumeMountPointW(%q): %w", volumePath, err)
+	}
+
+	return volumeGUIDDosDeviceName(windows.UTF16ToString(buf))
+}
+
+// volumeGUIDDosDeviceName returns the name of the DOS device (example:
+// "Volume{26a21bda-a627-11d7-9931-806e6f6e6963}") that the volume with the provided
+// volume GUID path (example: `\\?\Volume{26a21bda-a627-11d7-9931-806e6f6e6963}\`) is available as.
+func volumeGUIDDosDeviceName(volumeName string) (string, error) {
+	name := strings.TrimSuffix(strings.TrimPrefix(volumeName, `\\?\`), `\`)
+	if !strings.HasPrefix(name, "Volume{") || !strings.HasSuffix(name, "}") {
+		return "", fmt.Errorf("volumeGUIDDosDeviceName: %q isn't a volume GUID path", volumeName)
+	}
+
+	return name, nil
+}
+
+// queryDosDevice returns the NT device name (example: `\Device\HarddiskVolume3`) that the
+// provided DOS device name (example: "C:") maps to.
+func queryDosDevice(name string) (string, error) {
+	deviceName, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return "", fmt.Errorf("queryDosDevice: %w", err)
+	}
+
+	buf := make([]uint16, windows.MAX_PATH)
+	_, err = windows.QueryDosDevice(deviceName, &buf[0], uint32(len(buf)))
+	if err != nil {
+		return "", fmt.Errorf("queryDosDevice: QueryDosDeviceW(%q): %w", name, err)
+	}
+
+	// the buffer contains a list of NUL-terminated strings, the first of which is
+	// the current mapping for the device
+	return windows.UTF16ToString(buf), nil
+}
+
+// getStorageDeviceNumber returns the storage device number of the provided
+// device (example: `\\.\C:`).
+func getStorageDeviceNumber(device string) (storageDeviceNumber, error) {
+	path, err := windows.UTF16PtrFromString(device)
+	if err != nil {
+		return storageDeviceNumber{}, fmt.Errorf("getStorageDeviceNumber: %w", err)
+	}
+
+	// querying the device number doesn't require any access rights, which
+	// means that this works for unprivileged users as well
+	handle, err := windows.CreateFile(path, 0, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return storageDeviceNumber{}, fmt.Errorf("getStorageDeviceNumber: failed to open device %q: %w", device, err)
+	}
+
+	defer windows.CloseHandle(handle)
+
+	var number storageDeviceNumber
+	var bytesReturned uint32
+
+	err = windows.DeviceIoControl(handle, ioctlStorageGetDeviceNumber, nil, 0, (*byte)(unsafe.Pointer(&number)), uint32(unsafe.Sizeof(number)), &bytesReturned, nil)
+	if err != nil {
+		return storageDeviceNumber{}, fmt.Errorf("getStorageDeviceNumber: IOCTL_STORAGE_GET_DEVICE_NUMBER on device %q: %w", device, err)
+	}
+
+	return number, nil
+}
+
+// getVolumeFilesystemType returns the type of the filesystem (example: "NTFS") on the
+// volume mounted at volumePath.
+func getVolumeFilesystemType(volumePath string) (string, error) {
+	root, err := windows.UTF16PtrFromString(volumePath)
+	if err != nil {
+		return "", fmt.Errorf("getVolumeFilesystemType: %w", err)
+	}
+
+	buf := make([]uint16, windows.MAX_PATH+1)
+	err = windows.GetVolumeInformation(root, nil, 0, nil, nil, nil, &buf[0], uint32(len(buf)))
+	if err != nil {
+		return "", fmt.Errorf("getVolumeFilesystemType: GetVolumeInformationW(%q): %w", volumePath, err)
+	}
+
+	return windows.UTF16ToString(buf), nil
+}
+
+func getDeviceNumber(filePath string) (major, minor uint32, err error) {
+	return 0, 0, fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
+
+func getFileDeviceNumber(f *os.File) (major, minor uint32, err error) {
+	return 0, 0, fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
 }
@@ -0,0 +1,103 @@
+package mountinfo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sourcegraph/log/logtest"
+	"golang.org/x/sys/windows"
+)
+
+func Test_VolumeGUIDDosDeviceName(t *testing.T) {
+	for _, test := range []struct {
+		volumeName  string
+		expected    string
+		expectError bool
+	}{
+		{volumeName: `\\?\Volume{26a21bda-a627-11d7-9931-806e6f6e6963}\`, expected: "Volume{26a21bda-a627-11d7-9931-806e6f6e6963}"},
+		{volumeName: `\\?\Volume{26a21bda-a627-11d7-9931-806e6f6e6963}`, expected: "Volume{26a21bda-a627-11d7-9931-806e6f6e6963}"},
+		{volumeName: `C:\`, expectError: true},
+		{volumeName: ``, expectError: true},
+	} {
+		actual, err := volumeGUIDDosDeviceName(test.volumeName)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("expected error for %q, got %q", test.volumeName, actual)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", test.volumeName, err)
+			continue
+		}
+
+		if actual != test.expected {
+			t.Errorf("recieved unexpected DOS device name for %q (want %q, got %q)", test.volumeName, test.expected, actual)
+		}
+	}
+}
+
+func Test_DiscoverDevice_DirectoryMountPoint(t *testing.T) {
+	logger := logtest.Scoped(t)
+
+	dir := t.TempDir()
+
+	// mount the volume that stores the temporary directory into an empty directory on
+	// itself, so that the mount point has to be resolved through the volume's GUID
+	volumePath, err := getVolumePathName(dir)
+	if err != nil {
+		t.Fatalf("finding volume of %q: %s", dir, err)
+	}
+
+	root, err := windows.UTF16PtrFromString(volumePath)
+	if err != nil {
+		t.Fatalf("converting %q: %s", volumePath, err)
+	}
+
+	buf := make([]uint16, windows.MAX_PATH)
+	if err := windows.GetVolumeNameForVolumeMountPoint(root, &buf[0], uint32(len(buf))); err != nil {
+		t.Fatalf("finding volume GUID path of %q: %s", volumePath, err)
+	}
+
+	mountPoint := filepath.Join(dir, "mnt") + `\`
+	if err := os.Mkdir(mountPoint, 0755); err != nil {
+		t.Fatalf("creating mount point: %s", err)
+	}
+
+	mountPointPtr, err := windows.UTF16PtrFromString(mountPoint)
+	if err != nil {
+		t.Fatalf("converting %q: %s", mountPoint, err)
+	}
+
+	if err := windows.SetVolumeMountPoint(mountPointPtr, &buf[0]); err != nil {
+		if errors.Is(err, windows.ERROR_ACCESS_DENIED) || errors.Is(err, windows.ERROR_PRIVILEGE_NOT_HELD) {
+			t.Skipf("mounting volumes requires administrator privileges: %s", err)
+		}
+
+		t.Fatalf("mounting %q at %q: %s", windows.UTF16ToString(buf), mountPoint, err)
+	}
+
+	t.Cleanup(func() {
+		if err := windows.DeleteVolumeMountPoint(mountPointPtr); err != nil {
+			t.Errorf("unmounting %q: %s", mountPoint, err)
+		}
+	})
+
+	expected, err := DiscoverDevice(logger, dir)
+	if err != nil {
+		t.Fatalf("discovering device of %q: %s", dir, err)
+	}
+
+	actual, err := DiscoverDevice(logger, mountPoint)
+	if err != nil {
+		t.Fatalf("discovering device of path under mount point %q: %s", mountPoint, err)
+	}
+
+	if actual.Name != expected.Name {
+		t.Fatalf("recieved unexpected device name (want %q, got %q)", expected.Name, actual.Name)
+	}
+}
@@ -0,0 +1,785 @@
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/moby/sys/mountinfo"
+	sglog "github.com/sourcegraph/log"
+)
+
+// Device describes the block device that a file path is stored on.
+type Device struct {
+	// Name is the name of the block device (example: "sdb").
+	//
+	// Name never contains slashes or whitespace (so that it can be used as a metric label),
+	// and is never prefixed with "/dev/". See NormalizeDeviceName for details.
+	Name string `json:"name"`
+
+	// Major and Minor are the device numbers of the filesystem that
+	// the file path is stored on.
+	//
+	// For the devices that are returned by ListBlockDevices, they're the device numbers
+	// of the block device itself.
+	Major uint32 `json:"major"`
+	Minor uint32 `json:"minor"`
+
+	// Mountpoint is the mountpoint of the filesystem that contains
+	// the file path (example: "/home").
+	Mountpoint string `json:"mountpoint"`
+
+	// FSType is the type of the filesystem that contains the file path (example: "ext4").
+	FSType string `json:"fstype"`
+
+	// Rotational is true if the block device is a spinning disk (as opposed to e.x. an SSD).
+	//
+	// Rotational is only populated on Linux, and is false for devices that don't report
+	// whether they're rotational (e.x. some virtual devices).
+	Rotational bool `json:"rotational"`
+
+	// Model is the model of the block device (example: "Samsung SSD 970 EVO Plus 1TB").
+	//
+	// Model is only populated on Linux, and is empty for devices that don't report their
+	// model (e.x. virtual devices).
+	Model string `json:"model"`
+
+	// Size is the capacity of the block device in bytes.
+	//
+	// Size is only populated on Linux (and by ListBlockDevices on macOS), and is zero
+	// for devices that don't report their size.
+	Size uint64 `json:"size"`
+
+	// LogicalBlockSize is the size in bytes of the smallest unit that the block device can
+	// address (example: 512, or 4096 for "4Kn" drives).
+	//
+	// LogicalBlockSize is only populated on Linux and macOS, and is zero for devices that
+	// don't report it.
+	LogicalBlockSize uint64 `json:"logical_block_size"`
+
+	// PhysicalBlockSize is the size in bytes of the smallest unit that the block device can
+	// write without a read-modify-write cycle (example: 4096 for "512e" drives, which have
+	// 512 byte logical blocks).
+	//
+	// PhysicalBlockSize is only populated on Linux, and is zero for devices that don't report it.
+	PhysicalBlockSize uint64 `json:"physical_block_size"`
+
+	// Removable is true if the block device's media can be removed (e.x. USB drives and SD cards).
+	//
+	// Removable is only populated on Linux and macOS, and is false for devices that don't report
+	// whether they're removable.
+	Removable bool `json:"removable"`
+
+	// Network is true if the block device is backed by a remote server instead of local
+	// storage (e.x. a network block device such as "nbd0", or a Ceph RBD device such as "rbd0"),
+	// so its IO is subject to network latency.
+	//
+	// Network is only populated on Linux.
+	Network bool `json:"network"`
+
+	// WWN is the world-wide name that identifies the block device across hosts (example:
+	// "naa.5000c500a1b2c3d4" for a SCSI disk, or "eui.0025385b71b07e2f" for an NVMe namespace).
+	//
+	// WWN is only populated on Linux, and is empty for devices that don't report it (e.x. virtual
+	// disks, whose virtualization layer usually hides it).
+	WWN string `json:"wwn"`
+
+	// Serial is the serial number of the block device (example: "S4EWNX0R123456A"). For NVMe
+	// namespaces, it's the serial number of their controller.
+	//
+	// Serial is only populated on Linux, and is empty for devices that don't report it.
+	Serial string `json:"serial"`
+
+	// CompressedRAM is true if the block device stores its data compressed in memory instead of
+	// on a disk (e.x. a zram device such as "zram0", which is often used for swap or for /tmp).
+	// Such devices aren't backed by any hardware, so the attributes of physical disks (e.x.
+	// Rotational, Model, and Serial) are never populated for them.
+	//
+	// CompressedRAM is only populated on Linux.
+	CompressedRAM bool `json:"compressed_ram"`
+}
+
+// DeviceDiscoverer discovers the block devices that file paths are stored on. It's implemented
+// by Discoverer and CachingDiscoverer.
+//
+// Code that discovers devices can accept a DeviceDiscoverer, so that its tests can use the fake
+// implementation from the mountinfotest package instead of inspecting the current system.
+type DeviceDiscoverer interface {
+	// DiscoverDevice returns information about the block device that filePath is stored on.
+	DiscoverDevice(logger sglog.Logger, filePath string) (Device, error)
+
+	// DiscoverDeviceNames returns the names of all the block devices that filePath is stored on.
+	DiscoverDeviceNames(logger sglog.Logger, filePath string) ([]string, error)
+
+	// DiscoverDeviceNameContext returns the name of the block device that filePath is stored on.
+	DiscoverDeviceNameContext(ctx context.Context, logger sglog.Logger, filePath string) (string, error)
+}
+
+var (
+	_ DeviceDiscoverer = (*Discoverer)(nil)
+	_ DeviceDiscoverer = (*CachingDiscoverer)(nil)
+)
+
+// Discoverer discovers the block devices that file paths are stored on.
+//
+// A Discoverer is safe for concurrent use by multiple goroutines.
+type Discoverer struct {
+	// findSysfsMountpoint returns the location that the sysfs pseudo-filesystem is mounted at.
+	findSysfsMountpoint func() (mountpoint string, err error)
+
+	// resolvePath returns filePath as an absolute path with all symlinks resolved.
+	resolvePath func(filePath string) (string, error)
+
+	// getDeviceNumber returns the major and minor numbers of the device that filePath is stored on.
+	getDeviceNumber func(filePath string) (major, minor uint32, err error)
+
+	// getFileDeviceNumber returns the major and minor numbers of the device that the open file f is stored on.
+	getFileDeviceNumber func(f *os.File) (major, minor uint32, err error)
+
+	// findMount returns the most specific mount that contains filePath.
+	findMount func(filePath string) (*mountinfo.Info, error)
+
+	// findMountSnapshot returns a function that behaves like findMount, but only
+	// reads the mount table once (used for batch discovery).
+	findMountSnapshot func() (func(filePath string) (*mountinfo.Info, error), error)
+
+	// listMounts returns all of the mounts in the mount table.
+	listMounts func() ([]*mountinfo.Info, error)
+
+	// watchMountTable returns a channel that receives a value whenever the mount table
+	// changes, and is closed once ctx is done.
+	watchMountTable func(ctx context.Context) (<-chan struct{}, error)
+
+	// sysfsFS is the sysfs pseudo-filesystem that's used for device discovery
+	// (nil if it should be rooted at the result of findSysfsMountpoint)
+	sysfsFS fs.FS
+
+	// diskutilCache caches the parsed output of `diskutil info` for each BSD device, and
+	// of `diskutil list` (only used on macOS)
+	diskutilCache *lruCache[map[string]interface{}]
+
+	// commandTimeout is how long external commands (e.x. `diskutil`) are allowed to run for
+	// before they're killed (zero if they aren't killed)
+	commandTimeout time.Duration
+
+	// sysfsRetries is how many times reading a device's entry in sysfs is retried if it fails
+	// with a transient error (zero if it isn't retried)
+	sysfsRetries int
+
+	// sysfsRetryBackoff is how long to wait before the first retry of a sysfs read (the wait
+	// doubles after each retry)
+	sysfsRetryBackoff time.Duration
+
+	// deviceMapperNames is true if multipath maps should be reported by their device-mapper
+	// names (e.x. "mpatha") instead of the devices that back them
+	deviceMapperNames bool
+
+	// wholeDiskOnly is true if discovery should fail instead of reporting a device that isn't
+	// a whole disk (e.x. a partition or a device-mapper device)
+	wholeDiskOnly bool
+
+	// onResolutionFallback is called whenever discovery falls back to a less useful device
+	// name (nil if nobody is interested)
+	onResolutionFallback func(reason FallbackReason)
+
+	// fallbacks records the fallbacks that discovery takes, along with the devices that it
+	// reports because of them (nil if they aren't recorded)
+	fallbacks *fallbackCollector
+
+	// metrics records how long discoveries take (nil if they aren't measured)
+	metrics *discoveryMetrics
+
+	// sysfsMountpoint caches the result of the first successful call to findSysfsMountpoint
+	// (shared with the copies of the Discoverer that batch discoveries make)
+	sysfsMountpoint *sysfsMountpointCache
+}
+
+// sysfsMountpointCache caches the location of the sysfs pseudo-filesystem.
+type sysfsMountpointCache struct {
+	// mu protects mountpoint
+	mu sync.Mutex
+
+	// mountpoint is empty if the sysfs mountpoint hasn't been found yet
+	mountpoint string
+}
+
+const (
+	// diskutilCacheTTL is how long the output of `diskutil` is cached for.
+	diskutilCacheTTL = 10 * time.Second
+
+	// diskutilCacheMaxEntries is the maximum number of `diskutil` invocations whose
+	// output is cached.
+	diskutilCacheMaxEntries = 64
+
+	// defaultCommandTimeout is how long external commands are allowed to run for, unless
+	// the timeout is overridden with WithCommandTimeout.
+	defaultCommandTimeout = 5 * time.Second
+)
+
+// Option modifies the behavior of a Discoverer created by NewDiscoverer.
+type Option func(d *Discoverer)
+
+// WithSysfs makes the Discoverer inspect the provided file system instead of the sysfs
+// pseudo-filesystem that's mounted on the current system. The root of fsys must correspond
+// to the sysfs mountpoint (usually "/sys").
+//
+// Sysfs links devices to each other with relative symbolic links, so fsys must represent
+// them faithfully: either by implementing "Lstat(name string) (fs.FileInfo, error)" and
+// "ReadLink(name string) (string, error)" methods, or by reporting symbolic links with the
+// fs.ModeSymlink bit set and their destination as their contents (like fstest.MapFS does).
+//
+// This option is only used on Linux.
+func WithSysfs(fsys fs.FS) Option {
+	return func(d *Discoverer) {
+		d.sysfsFS = fsys
+	}
+}
+
+// WithFollowSymlinks sets whether the Discoverer follows file paths that are symlinks. By default,
+// it does, so the device that a symlink's target is stored on is reported.
+//
+// If follow is false, the device that the symlink itself is stored on (which is the device of the
+// directory that contains it) is reported instead. Symlinks among the directories that lead to the
+// file path are still followed, since the file path is stored wherever they point to.
+func WithFollowSymlinks(follow bool) Option {
+	return func(d *Discoverer) {
+		if follow {
+			d.resolvePath = resolveFilePath
+		} else {
+			d.resolvePath = resolveLiteralFilePath
+		}
+	}
+}
+
+// WithCommandTimeout sets how long the external commands that the Discoverer runs (e.x. `diskutil`
+// on macOS) are allowed to run for before they're killed. If timeout is zero or negative, commands
+// are only killed once the context of the discovery is done.
+//
+// If a command is killed, the error that discovery returns wraps context.DeadlineExceeded (so that
+// it can be told apart from the device not being found). The default timeout is 5 seconds.
+func WithCommandTimeout(timeout time.Duration) Option {
+	return func(d *Discoverer) {
+		d.commandTimeout = timeout
+	}
+}
+
+// WithSysfsRetries makes the Discoverer retry looking a device up in sysfs (in /sys/dev/block)
+// up to retries times if it fails with an error that might be transient (e.x. because udev is
+// still setting up a device that was just added). The Discoverer waits for backoff before the
+// first retry, and twice as long before each of the following ones.
+//
+// Retries stop as soon as the context of the discovery is done, so they don't extend a caller's
+// deadline. By default, sysfs reads aren't retried.
+//
+// This option is only used on Linux.
+func WithSysfsRetries(retries int, backoff time.Duration) Option {
+	return func(d *Discoverer) {
+		d.sysfsRetries = retries
+		d.sysfsRetryBackoff = backoff
+	}
+}
+
+// WithSysfsMountpoint makes the Discoverer inspect the sysfs pseudo-filesystem that's mounted at
+// mountpoint (example: "/host/sys") instead of looking the sysfs mountpoint up in the mount table.
+//
+// This option is only used on Linux.
+func WithSysfsMountpoint(mountpoint string) Option {
+	return func(d *Discoverer) {
+		d.findSysfsMountpoint = func() (string, error) {
+			return mountpoint, nil
+		}
+	}
+}
+
+// WithProcfsMountpoint makes the Discoverer read the mount table from the procfs pseudo-filesystem
+// that's mounted at mountpoint (example: "/host/proc"), instead of the one of the current process.
+//
+// The mount table of the initial process (PID 1) is read, so if the host's procfs is mounted into
+// a container, the host's mount table is used. Together with WithSysfsMountpoint, this lets a
+// Discoverer that runs in a different mount namespace than the host use the host's view of its
+// mounts and devices. File paths are still resolved in the current mount namespace, so they must
+// be visible at the same location in both (e.x. because they're bind-mounted).
+//
+// This option is only used on Linux.
+func WithProcfsMountpoint(mountpoint string) Option {
+	return func(d *Discoverer) {
+		d.findMount, d.findMountSnapshot, d.listMounts = d.procfsMountTable(mountpoint)
+		d.watchMountTable = mountTableWatcher(filepath.Join(mountpoint, "1", "mountinfo"))
+	}
+}
+
+// FallbackReason describes why discovery couldn't reach the physical disk that a file path
+// is stored on, and reported a less useful device name instead.
+type FallbackReason string
+
+const (
+	// FallbackLoopBackingFileUnresolved means that the file backing a loop device couldn't be
+	// found (e.x. because it has been deleted), so the loop device itself (e.x. "loop0") was reported.
+	FallbackLoopBackingFileUnresolved FallbackReason = "loop_backing_file_unresolved"
+
+	// FallbackDeviceMapperWithoutSlaves means that a device-mapper device didn't list the devices
+	// that back it, so the device-mapper device itself (e.x. "dm-0") was reported.
+	FallbackDeviceMapperWithoutSlaves FallbackReason = "device_mapper_without_slaves"
+
+	// FallbackThinPoolUnresolved means that the data device of an LVM thin pool couldn't be followed
+	// down to the disk that stores it, so the thin pool itself (e.x. "vg0-pool0-tpool") was reported.
+	FallbackThinPoolUnresolved FallbackReason = "thin_pool_unresolved"
+
+	// FallbackAnonymousDeviceFilePath means that an open file was stored on a filesystem with an
+	// anonymous device number (e.x. btrfs), so its device was looked up through its path instead
+	// of its file descriptor.
+	FallbackAnonymousDeviceFilePath FallbackReason = "anonymous_device_file_path"
+
+	// FallbackDiskutilList means that `diskutil info` didn't report the whole disk that a device
+	// is part of, so it was looked up in the output of `diskutil list` instead (macOS only).
+	FallbackDiskutilList FallbackReason = "diskutil_list"
+
+	// FallbackDiskutilUnavailable means that `diskutil` failed, so the whole disk was derived from
+	// the name of the BSD device that the filesystem is mounted from (e.x. "disk3" for "disk3s1s1")
+	// instead of resolving APFS containers to their physical stores (macOS only).
+	FallbackDiskutilUnavailable FallbackReason = "diskutil_unavailable"
+)
+
+// WithDeviceMapperNames makes the Discoverer stop at multipath maps instead of following them
+// down to the paths (e.x. "sdc" and "sdd") that they send IO through, and report them by the
+// name that they were created with (their dm/name attribute in sysfs, e.x. "mpatha") instead of
+// their kernel name (e.x. "dm-2"). That's what SAN tooling usually refers to them as. A file path
+// that's stored on a partition of a multipath map is reported to be stored on the map.
+//
+// Other device-mapper devices (e.x. LVM logical volumes) are still followed down to the devices
+// that back them, but ones that don't list those devices are reported by name as well.
+//
+// This option is only used on Linux.
+func WithDeviceMapperNames() Option {
+	return func(d *Discoverer) {
+		d.deviceMapperNames = true
+	}
+}
+
+// WithWholeDiskOnly makes the Discoverer guarantee that every device it reports is a whole disk:
+// a device that's listed in /sys/block, isn't a partition, and isn't a device-mapper device. If
+// discovery would report any other device (e.x. a device-mapper device that doesn't list the
+// devices that back it), it fails with an error that wraps ErrNotWholeDisk instead. File paths
+// that aren't stored on a block device at all (e.x. on NFS or tmpfs) still fail with an error
+// that wraps ErrNoBlockDevice.
+//
+// Multipath maps that are kept by WithDeviceMapperNames aren't whole disks, so combining both
+// options makes discovery fail for file paths that are stored on them.
+//
+// This option is only used on Linux.
+func WithWholeDiskOnly() Option {
+	return func(d *Discoverer) {
+		d.wholeDiskOnly = true
+	}
+}
+
+// WithResolutionFallbacks makes the Discoverer call fn whenever discovery takes a fallback path
+// instead of the usual one, which usually means that the reported device name is less useful
+// (e.x. "loop0" instead of the disk that stores the loop device's backing file).
+//
+// fn can be used to count fallbacks, so that hosts where many device names are misleading can
+// be alerted on:
+//
+//	fallbacks := prometheus.NewCounterVec(prometheus.CounterOpts{
+//		Name: "device_resolution_fallbacks_total",
+//	}, []string{"reason"})
+//
+//	d := NewDiscoverer(WithResolutionFallbacks(func(reason FallbackReason) {
+//		fallbacks.WithLabelValues(string(reason)).Inc()
+//	}))
+//
+// fn must be safe for concurrent use by multiple goroutines.
+func WithResolutionFallbacks(fn func(reason FallbackReason)) Option {
+	return func(d *Discoverer) {
+		d.onResolutionFallback = fn
+	}
+}
+
+// NewDiscoverer returns a Discoverer that inspects the current system.
+func NewDiscoverer(opts ...Option) *Discoverer {
+	d := &Discoverer{
+		findSysfsMountpoint: findSysfsMountpoint,
+		resolvePath:         resolveFilePath,
+		getDeviceNumber:     getDeviceNumber,
+		getFileDeviceNumber: getFileDeviceNumber,
+		listMounts:          listMounts,
+		watchMountTable:     mountTableWatcher(selfMountinfoPath),
+
+		diskutilCache:   newLRUCache[map[string]interface{}](diskutilCacheTTL, diskutilCacheMaxEntries),
+		commandTimeout:  defaultCommandTimeout,
+		sysfsMountpoint: &sysfsMountpointCache{},
+	}
+
+	d.findMount, d.findMountSnapshot = d.mountLookup()
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// defaultDiscoverer is used by the package-level discovery functions.
+var defaultDiscoverer = NewDiscoverer()
+
+// DiscoverDevice returns information about the block device that filePath is stored on.
+//
+// Relative file paths are resolved against the current working directory, and symlinks are
+// followed, so a symlink resolves to the device that its target is stored on (unless the
+// Discoverer was created with WithFollowSymlinks(false)). If filePath doesn't exist, the
+// returned error wraps ErrPathNotFound.
+//
+// See the doc comment for NewCollector for the list of supported operating systems.
+func (d *Discoverer) DiscoverDevice(logger sglog.Logger, filePath string) (Device, error) {
+	return d.discoverDeviceAt(context.Background(), logger, filePath)
+}
+
+// DiscoverDeviceNames returns the names of all the block devices that filePath is stored on.
+//
+// Some devices are backed by multiple block devices (example: an md RAID array that's backed by
+// "sda" and "sdb", or an APFS container on a macOS Fusion Drive that spans "disk0" and "disk1"),
+// in which case the names of all of the member devices are returned. For all other devices, the
+// returned slice contains a single name.
+//
+// See the doc comment for NewCollector for the list of supported operating systems.
+func (d *Discoverer) DiscoverDeviceNames(logger sglog.Logger, filePath string) ([]string, error) {
+	return d.discoverDeviceNamesAt(context.Background(), logger, filePath)
+}
+
+// DeviceNumber returns the major and minor numbers of the device that filePath is stored on.
+//
+// This operation is supported on all Unix-like operating systems. On all other operating systems
+// (including Windows), the returned error wraps ErrUnsupportedPlatform. If filePath doesn't exist,
+// the returned error wraps ErrPathNotFound.
+func (d *Discoverer) DeviceNumber(filePath string) (major, minor uint32, err error) {
+	return d.getDeviceNumber(filePath)
+}
+
+// DiscoverDeviceNameContext returns the name of the block device that filePath is stored on.
+//
+// Discovery is aborted as soon as possible once ctx is done. On macOS, this kills any in-flight
+// calls to diskutil (which can hang for several seconds while waiting for an external disk to spin up).
+//
+// See the doc comment for NewCollector for the list of supported operating systems.
+func (d *Discoverer) DiscoverDeviceNameContext(ctx context.Context, logger sglog.Logger, filePath string) (string, error) {
+	device, err := d.discoverDeviceAt(ctx, logger, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	return device.Name, nil
+}
+
+// DeviceName returns the name of the block device that filePath is stored on.
+//
+// DeviceName is a convenience for callers that don't have a logger at hand: it behaves
+// like DiscoverDeviceNameContext, but discards all of the logs that discovery produces.
+func (d *Discoverer) DeviceName(filePath string) (string, error) {
+	return d.DiscoverDeviceNameContext(context.Background(), sglog.NoOp(), filePath)
+}
+
+// DeviceNameFromNumber returns the name of the block device with the provided major and minor
+// numbers (example: the numbers that were returned by fstat for a file that's stored on it).
+//
+// Only the sysfs lookup of the device number and the resolution of partitions and virtual block
+// devices are performed, so this is cheaper than DeviceName when the device number is already known.
+// Like DeviceName, it discards all of the logs that discovery produces. Anonymous device numbers
+// (major 0, e.x. for btrfs filesystems) aren't backed by a block device, so the returned error wraps
+// ErrNoBlockDevice for them.
+//
+// This operation is currently only supported on Linux. On all other operating systems, the returned
+// error wraps ErrUnsupportedPlatform.
+func (d *Discoverer) DeviceNameFromNumber(major, minor uint32) (string, error) {
+	name, err := d.discoverDeviceNameFromNumber(context.Background(), sglog.NoOp(), major, minor)
+	if err != nil {
+		return "", err
+	}
+
+	return NormalizeDeviceName(name), nil
+}
+
+// SameDevice returns true if the file paths a and b are stored on the same block device.
+//
+// The physical devices that the file paths are stored on are compared (after resolving partitions
+// and virtual block devices), not the device numbers of their filesystems: two partitions of the
+// same disk count as the same device. If either file path is stored on multiple block devices
+// (e.x. a RAID array), they're on the same device if they share at least one of them.
+//
+// Like DeviceName, SameDevice discards all of the logs that discovery produces.
+//
+// See the doc comment for NewCollector for the list of supported operating systems.
+func (d *Discoverer) SameDevice(a, b string) (bool, error) {
+	namesA, err := d.discoverDeviceNamesAt(context.Background(), sglog.NoOp(), a)
+	if err != nil {
+		return false, fmt.Errorf("SameDevice: discovering devices of %q: %w", a, err)
+	}
+
+	namesB, err := d.discoverDeviceNamesAt(context.Background(), sglog.NoOp(), b)
+	if err != nil {
+		return false, fmt.Errorf("SameDevice: discovering devices of %q: %w", b, err)
+	}
+
+	for _, nameA := range namesA {
+		for _, nameB := range namesB {
+			if nameA == nameB {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// DiscoverDeviceForFile returns the name of the block device that the open file f is stored on.
+//
+// Unlike DiscoverDeviceNameContext, the device is looked up through f's file descriptor instead of
+// its path, so the result can't be affected by f being renamed (or its path being replaced) while
+// discovery is in progress. On filesystems that aren't stored on a single block device (e.x. btrfs),
+// the filesystem's mount is still looked up through f's path.
+//
+// This operation is currently only supported on Linux. On all other operating systems, the returned
+// error wraps ErrUnsupportedPlatform.
+func (d *Discoverer) DiscoverDeviceForFile(logger sglog.Logger, f *os.File) (string, error) {
+	name, err := d.discoverDeviceForFile(context.Background(), logger, f)
+	if err != nil {
+		return "", err
+	}
+
+	return NormalizeDeviceName(name), nil
+}
+
+// discoverDeviceAt calls discoverDevice with filePath resolved by resolvePath, so that
+// the result doesn't depend on how filePath is expressed.
+func (d *Discoverer) discoverDeviceAt(ctx context.Context, logger sglog.Logger, filePath string) (device Device, err error) {
+	if d.metrics != nil {
+		defer func(start time.Time) { d.metrics.observe(cacheMiss, start, err) }(time.Now())
+	}
+
+	resolvedPath, err := d.resolvePath(filePath)
+	if err != nil {
+		return Device{}, err
+	}
+
+	device, err = d.discoverDevice(ctx, logger, resolvedPath)
+	if err != nil {
+		return Device{}, err
+	}
+
+	device.Name = NormalizeDeviceName(device.Name)
+
+	logger.Debug("discovered device",
+		sglog.String("device", device.Name),
+		sglog.Int("major", int(device.Major)),
+		sglog.Int("minor", int(device.Minor)),
+		sglog.String("mountpoint", device.Mountpoint),
+	)
+
+	return device, nil
+}
+
+// discoverDeviceNamesAt calls discoverDeviceNames with filePath resolved by resolvePath, so
+// that the result doesn't depend on how filePath is expressed.
+func (d *Discoverer) discoverDeviceNamesAt(ctx context.Context, logger sglog.Logger, filePath string) (names []string, err error) {
+	if d.metrics != nil {
+		defer func(start time.Time) { d.metrics.observe(cacheMiss, start, err) }(time.Now())
+	}
+
+	resolvedPath, err := d.resolvePath(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err = d.discoverDeviceNames(ctx, logger, resolvedPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, name := range names {
+		names[i] = NormalizeDeviceName(name)
+	}
+
+	return names, nil
+}
+
+// resolveFilePath returns filePath as an absolute path with all symlinks resolved (which is
+// also the form that the mount table lists mountpoints in).
+func resolveFilePath(filePath string) (string, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to massage %q to absolute path: %w", filePath, err)
+	}
+
+	resolvedPath, err := filepath.EvalSymlinks(absPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve symlinks for %q: %w", absPath, wrapPathNotFound(err))
+	}
+
+	return resolvedPath, nil
+}
+
+// resolveLiteralFilePath is like resolveFilePath, but doesn't follow filePath itself if it's a
+// symlink. Instead, the directory that contains the symlink is returned, since that's where the
+// symlink (as opposed to its target) is stored.
+func resolveLiteralFilePath(filePath string) (string, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to massage %q to absolute path: %w", filePath, err)
+	}
+
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %q: %w", absPath, wrapPathNotFound(err))
+	}
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		absPath = filepath.Dir(absPath)
+	}
+
+	// the directories that lead to the path can still be symlinks themselves
+	resolvedPath, err := filepath.EvalSymlinks(absPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve symlinks for %q: %w", absPath, wrapPathNotFound(err))
+	}
+
+	return resolvedPath, nil
+}
+
+// NormalizeDeviceName returns name (as reported by any of the supported operating systems)
+// in the form that Discoverers return device names in: without a leading "/dev/", without
+// surrounding whitespace, and with all remaining slashes and whitespace replaced by underscores.
+//
+// The names that the supported operating systems use for block devices (example: "sda", "disk0",
+// "ada0", "PhysicalDrive0") are already in that form, so they're returned unchanged.
+func NormalizeDeviceName(name string) string {
+	name = strings.TrimSpace(name)
+	name = strings.TrimPrefix(name, "/dev/")
+
+	return strings.Map(func(r rune) rune {
+		if r == '/' || unicode.IsSpace(r) {
+			return '_'
+		}
+
+		return r
+	}, name)
+}
+
+// resolutionFallback records that discovery took the fallback path described by reason, and
+// reported device because of it (empty if the reported device isn't known).
+func (d *Discoverer) resolutionFallback(logger sglog.Logger, reason FallbackReason, device string) {
+	logger.Info("device resolution fell back to a less useful device name",
+		sglog.String("reason", string(reason)),
+	)
+
+	if d.onResolutionFallback != nil {
+		d.onResolutionFallback(reason)
+	}
+
+	if d.fallbacks != nil {
+		d.fallbacks.record(reason, device)
+	}
+}
+
+// InvalidateSysfsMountpoint discards the cached location of the sysfs pseudo-filesystem,
+// which forces the next discovery to look it up again.
+//
+// The sysfs mountpoint almost never moves, so this is only necessary if sysfs is remounted
+// elsewhere while the Discoverer is in use.
+func (d *Discoverer) InvalidateSysfsMountpoint() {
+	d.sysfsMountpoint.mu.Lock()
+	defer d.sysfsMountpoint.mu.Unlock()
+
+	d.sysfsMountpoint.mountpoint = ""
+}
+
+// Close releases the resources that the Discoverer has cached (e.x. the location of the sysfs
+// pseudo-filesystem, and the output of `diskutil` on macOS). Discoverers don't run any background
+// goroutines, so that's all there is to release.
+//
+// Close is safe to call multiple times, and always returns nil. A Discoverer can still be used
+// after it's closed, but it'll repopulate its caches.
+func (d *Discoverer) Close() error {
+	d.InvalidateSysfsMountpoint()
+
+	if d.diskutilCache != nil {
+		d.diskutilCache.purge()
+	}
+
+	return nil
+}
+
+// cachedSysfsMountpoint returns the location that the sysfs pseudo-filesystem is mounted at,
+// only looking it up if it hasn't been successfully found before.
+func (d *Discoverer) cachedSysfsMountpoint() (string, error) {
+	d.sysfsMountpoint.mu.Lock()
+	defer d.sysfsMountpoint.mu.Unlock()
+
+	if d.sysfsMountpoint.mountpoint != "" {
+		return d.sysfsMountpoint.mountpoint, nil
+	}
+
+	mountpoint, err := d.findSysfsMountpoint()
+	if err != nil {
+		return "", err
+	}
+
+	d.sysfsMountpoint.mountpoint = mountpoint
+	return mountpoint, nil
+}
+
+// DiscoverDevice calls DiscoverDevice on a Discoverer that inspects the current system.
+func DiscoverDevice(logger sglog.Logger, filePath string) (Device, error) {
+	return defaultDiscoverer.DiscoverDevice(logger, filePath)
+}
+
+// DiscoverDeviceNames calls DiscoverDeviceNames on a Discoverer that inspects the current system.
+func DiscoverDeviceNames(logger sglog.Logger, filePath string) ([]string, error) {
+	return defaultDiscoverer.DiscoverDeviceNames(logger, filePath)
+}
+
+// DeviceNumber calls DeviceNumber on a Discoverer that inspects the current system.
+func DeviceNumber(filePath string) (major, minor uint32, err error) {
+	return defaultDiscoverer.DeviceNumber(filePath)
+}
+
+// DiscoverDeviceNameContext calls DiscoverDeviceNameContext on a Discoverer that inspects the current system.
+func DiscoverDeviceNameContext(ctx context.Context, logger sglog.Logger, filePath string) (string, error) {
+	return defaultDiscoverer.DiscoverDeviceNameContext(ctx, logger, filePath)
+}
+
+// DeviceName calls DeviceName on a Discoverer that inspects the current system.
+func DeviceName(filePath string) (string, error) {
+	return defaultDiscoverer.DeviceName(filePath)
+}
+
+// DeviceNameFromNumber calls DeviceNameFromNumber on a Discoverer that inspects the current system.
+func DeviceNameFromNumber(major, minor uint32) (string, error) {
+	return defaultDiscoverer.DeviceNameFromNumber(major, minor)
+}
+
+// SameDevice calls SameDevice on a Discoverer that inspects the current system.
+func SameDevice(a, b string) (bool, error) {
+	return defaultDiscoverer.SameDevice(a, b)
+}
+
+// DiscoverDeviceForFile calls DiscoverDeviceForFile on a Discoverer that inspects the current system.
+func DiscoverDeviceForFile(logger sglog.Logger, f *os.File) (string, error) {
+	return defaultDiscoverer.DiscoverDeviceForFile(logger, f)
+}
+
+// InvalidateSysfsMountpoint calls InvalidateSysfsMountpoint on the Discoverer that's used by
+// the package-level discovery functions.
+func InvalidateSysfsMountpoint() {
+	defaultDiscoverer.InvalidateSysfsMountpoint()
+}
+
+// discoverDeviceName returns the name of the block device that filePath is
+// stored on.
+func discoverDeviceName(logger sglog.Logger, filePath string) (string, error) {
+	return DiscoverDeviceNameContext(context.Background(), logger, filePath)
+}
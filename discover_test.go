@@ -0,0 +1,276 @@
+package mountinfo
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/log/logtest"
+)
+
+func Test_Discoverer_CachesSysfsMountpoint(t *testing.T) {
+	calls := 0
+	fail := false
+
+	d := NewDiscoverer()
+	d.findSysfsMountpoint = func() (string, error) {
+		calls++
+		if fail {
+			return "", errors.New("sysfs not found")
+		}
+
+		return "/sys", nil
+	}
+
+	lookup := func(expectedCalls int) {
+		t.Helper()
+
+		mountpoint, err := d.cachedSysfsMountpoint()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if mountpoint != "/sys" {
+			t.Fatalf("expected mountpoint %q, got %q", "/sys", mountpoint)
+		}
+
+		if calls != expectedCalls {
+			t.Fatalf("expected findSysfsMountpoint to be called %d time(s), got %d", expectedCalls, calls)
+		}
+	}
+
+	lookup(1)
+	lookup(1) // cached
+
+	d.InvalidateSysfsMountpoint()
+	lookup(2)
+
+	// errors aren't cached
+	d.InvalidateSysfsMountpoint()
+	fail = true
+
+	if _, err := d.cachedSysfsMountpoint(); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	fail = false
+	lookup(4)
+}
+
+func Test_Discoverer_Close(t *testing.T) {
+	calls := 0
+
+	d := NewDiscoverer()
+	d.findSysfsMountpoint = func() (string, error) {
+		calls++
+		return "/sys", nil
+	}
+
+	if _, err := d.cachedSysfsMountpoint(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	d.diskutilCache.add("disk0", map[string]interface{}{"ParentWholeDisk": "disk0"})
+
+	for i := 0; i < 2; i++ {
+		// closing twice is safe
+		if err := d.Close(); err != nil {
+			t.Fatalf("closing discoverer: %s", err)
+		}
+	}
+
+	if _, ok := d.diskutilCache.get("disk0"); ok {
+		t.Error("expected the diskutil cache to be purged")
+	}
+
+	// the discoverer can still be used, but has to look the sysfs mountpoint up again
+	if _, err := d.cachedSysfsMountpoint(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if calls != 2 {
+		t.Fatalf("expected findSysfsMountpoint to be called 2 time(s), got %d", calls)
+	}
+}
+
+func Test_NormalizeDeviceName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"vda":            "vda",            // Linux
+		"nvme0n1":        "nvme0n1",        // Linux
+		"disk0":          "disk0",          // macOS
+		"/dev/disk0":     "disk0",          // macOS
+		"ada0":           "ada0",           // FreeBSD
+		"/dev/wd0":       "wd0",            // NetBSD
+		"sd0":            "sd0",            // OpenBSD
+		"c0t0d0":         "c0t0d0",         // illumos / Solaris
+		"PhysicalDrive0": "PhysicalDrive0", // Windows
+		" sda\n":         "sda",
+		"mirror/gm0":     "mirror_gm0",
+		"Macintosh HD":   "Macintosh_HD",
+	} {
+		if actual := NormalizeDeviceName(name); actual != expected {
+			t.Errorf("recieved unexpected normalized name for %q (want %q, got %q)", name, expected, actual)
+		}
+	}
+}
+
+func Test_DiscoverDeviceNames_NameInvariant(t *testing.T) {
+	// the names that are returned by the backend of the current operating system
+	// never contain slashes or whitespace
+	filePath, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getting current working directory: %s", err)
+	}
+
+	names, err := NewDiscoverer().DiscoverDeviceNames(logtest.Scoped(t), filePath)
+	if errors.Is(err, ErrUnsupportedPlatform) {
+		t.Skipf("device discovery isn't supported: %s", err)
+	}
+
+	if err != nil {
+		t.Fatalf("discovering device names for path %q: %s", filePath, err)
+	}
+
+	for _, name := range names {
+		if name == "" || strings.IndexFunc(name, func(r rune) bool { return r == '/' || unicode.IsSpace(r) }) != -1 {
+			t.Errorf("device name %q isn't normalized", name)
+		}
+	}
+}
+
+func Test_Device_JSON(t *testing.T) {
+	device := Device{
+		Name:              "sda",
+		Major:             8,
+		Minor:             1,
+		Mountpoint:        "/home",
+		FSType:            "ext4",
+		Rotational:        true,
+		Model:             "Samsung SSD 970 EVO Plus 1TB",
+		Size:              1000204886016,
+		LogicalBlockSize:  512,
+		PhysicalBlockSize: 4096,
+	}
+
+	data, err := json.Marshal(device)
+	if err != nil {
+		t.Fatalf("failed to marshal device: %s", err)
+	}
+
+	// Downstream tools depend on these field names and types, so they must stay stable.
+	expectedJSON := `{"name":"sda","major":8,"minor":1,"mountpoint":"/home","fstype":"ext4","rotational":true,"model":"Samsung SSD 970 EVO Plus 1TB","size":1000204886016,"logical_block_size":512,"physical_block_size":4096,"removable":false,"network":false,"wwn":"","serial":"","compressed_ram":false}`
+	if diff := cmp.Diff(expectedJSON, string(data)); diff != "" {
+		t.Errorf("recieved unexpected JSON (-want +got):\n%s", diff)
+	}
+
+	var actual Device
+	if err := json.Unmarshal(data, &actual); err != nil {
+		t.Fatalf("failed to unmarshal device: %s", err)
+	}
+
+	if diff := cmp.Diff(device, actual); diff != "" {
+		t.Errorf("recieved unexpected device after round-trip (-want +got):\n%s", diff)
+	}
+}
+
+func Test_DiscoverDevice_PathNotFound(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "deleted")
+
+	_, err := NewDiscoverer().DiscoverDevice(logtest.Scoped(t), filePath)
+	if !errors.Is(err, ErrPathNotFound) {
+		t.Fatalf("expected error wrapping ErrPathNotFound, got %v", err)
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected error wrapping fs.ErrNotExist, got %v", err)
+	}
+}
+
+func Test_WithFollowSymlinks(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("resolving temporary directory: %s", err)
+	}
+
+	// dir/volume stands in for a directory on another volume that dir/data links to
+	volume := filepath.Join(dir, "volume")
+	if err := os.MkdirAll(filepath.Join(volume, "index"), 0755); err != nil {
+		t.Fatalf("creating directories: %s", err)
+	}
+
+	for link, target := range map[string]string{
+		"data":     volume,
+		"dangling": filepath.Join(dir, "missing"),
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Skipf("creating symlinks isn't supported: %s", err)
+		}
+	}
+
+	for _, test := range []struct {
+		name     string
+		follow   bool
+		path     string
+		expected string
+	}{
+		{name: "symlink is followed", follow: true, path: filepath.Join(dir, "data"), expected: volume},
+		{name: "symlink isn't followed", follow: false, path: filepath.Join(dir, "data"), expected: dir},
+		{name: "dangling symlink isn't followed", follow: false, path: filepath.Join(dir, "dangling"), expected: dir},
+		{name: "symlinked directory is still followed", follow: false, path: filepath.Join(dir, "data", "index"), expected: filepath.Join(volume, "index")},
+		{name: "regular directory", follow: false, path: volume, expected: volume},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := NewDiscoverer(WithFollowSymlinks(test.follow)).resolvePath(test.path)
+			if err != nil {
+				t.Fatalf("resolving %q: %s", test.path, err)
+			}
+
+			if actual != test.expected {
+				t.Fatalf("recieved unexpected path (want %q, got %q)", test.expected, actual)
+			}
+		})
+	}
+
+	_, err = NewDiscoverer(WithFollowSymlinks(false)).DiscoverDevice(logtest.Scoped(t), filepath.Join(dir, "deleted"))
+	if !errors.Is(err, ErrPathNotFound) {
+		t.Fatalf("expected error wrapping ErrPathNotFound, got %v", err)
+	}
+}
+
+func Test_Discoverer_WithFindMount(t *testing.T) {
+	calls := 0
+
+	d := NewDiscoverer(WithWholeDiskOnly(), WithDeviceMapperNames())
+	d.findSysfsMountpoint = func() (string, error) {
+		calls++
+		return "/sys", nil
+	}
+
+	c := d.withFindMount(nil)
+	if c.findMount != nil {
+		t.Fatal("expected findMount to be replaced")
+	}
+
+	if c.watchMountTable == nil || !c.wholeDiskOnly || !c.deviceMapperNames {
+		t.Fatal("expected configuration of original Discoverer to be kept")
+	}
+
+	// the sysfs mountpoint is cached for both Discoverers
+	for _, discoverer := range []*Discoverer{c, d} {
+		if _, err := discoverer.cachedSysfsMountpoint(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	if calls != 1 {
+		t.Fatalf("expected findSysfsMountpoint to be called once, got %d", calls)
+	}
+}
@@ -0,0 +1,32 @@
+//go:build netbsd || openbsd
+
+package mountinfo
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// disklabelPartitionRegex matches the names of disklabel partitions (e.x. "wd0a"),
+// which consist of the name of the disk followed by the partition's letter.
+var disklabelPartitionRegex = regexp.MustCompile(`^([a-z]+\d+)[a-p]$`)
+
+// disklabelDiskName returns the name of the disk (example: "wd0") that the filesystem
+// mounted from source (example: "/dev/wd0a") is stored on.
+//
+// Devices that aren't disklabel partitions (e.x. "/dev/dk0" wedges or "/dev/cgd0"
+// encrypted disks) are returned as-is. If source isn't a device at all (e.x. tmpfs,
+// mfs, or NFS mounts), the returned error wraps ErrNoBlockDevice.
+func disklabelDiskName(source string) (string, error) {
+	device := strings.TrimPrefix(source, "/dev/")
+	if device == source || device == "" || strings.Contains(device, "/") {
+		return "", fmt.Errorf("disklabelDiskName: source %q isn't a block device: %w", source, ErrNoBlockDevice)
+	}
+
+	if match := disklabelPartitionRegex.FindStringSubmatch(device); match != nil {
+		return match[1], nil
+	}
+
+	return device, nil
+}
@@ -0,0 +1,65 @@
+//go:build netbsd || openbsd
+
+package mountinfo
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_DisklabelDiskName(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		source string
+
+		expectedDiskName string
+		expectError      bool
+	}{
+		{
+			name:             "partition",
+			source:           "/dev/wd0a",
+			expectedDiskName: "wd0",
+		},
+		{
+			name:             "partition on a second disk",
+			source:           "/dev/sd1e",
+			expectedDiskName: "sd1",
+		},
+		{
+			name:             "wedge",
+			source:           "/dev/dk0",
+			expectedDiskName: "dk0",
+		},
+		{
+			name:        "tmpfs",
+			source:      "tmpfs",
+			expectError: true,
+		},
+		{
+			name:        "nfs",
+			source:      "server:/export",
+			expectError: true,
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := disklabelDiskName(test.source)
+			if test.expectError {
+				if !errors.Is(err, ErrNoBlockDevice) {
+					t.Fatalf("expected error wrapping ErrNoBlockDevice, got %v (disk name %q)", err, actual)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if actual != test.expectedDiskName {
+				t.Fatalf("recieved unexpected disk name (want %q, got %q)", test.expectedDiskName, actual)
+			}
+		})
+	}
+}
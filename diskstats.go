@@ -0,0 +1,461 @@
+package mountinfo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DiskStats contains the IO statistics for a single block device, as reported
+// by /proc/diskstats.
+//
+// See https://www.kernel.org/doc/Documentation/ABI/testing/procfs-diskstats
+type DiskStats struct {
+	ReadsCompleted uint64
+	ReadsMerged    uint64
+	SectorsRead    uint64
+	ReadTime       time.Duration
+
+	WritesCompleted uint64
+	WritesMerged    uint64
+	SectorsWritten  uint64
+	WriteTime       time.Duration
+
+	IOsInProgress uint64
+
+	// IOTime is the amount of time that the device spent doing IO.
+	IOTime time.Duration
+
+	// WeightedIOTime is IOTime weighted by the number of IOs that were in progress.
+	WeightedIOTime time.Duration
+
+	// The discard statistics are only reported by Linux 4.18+, and are zero on
+	// older kernels.
+	DiscardsCompleted uint64
+	DiscardsMerged    uint64
+	SectorsDiscarded  uint64
+	DiscardTime       time.Duration
+
+	// The flush statistics are only reported by Linux 5.5+, and are zero on
+	// older kernels.
+	FlushesCompleted uint64
+	FlushTime        time.Duration
+}
+
+// diskstatsSectorSize is the size of the sectors that /proc/diskstats counts in, which is
+// always 512 bytes regardless of the device's actual sector size.
+const diskstatsSectorSize = 512
+
+// BytesRead returns the number of bytes that were read from the device.
+func (s DiskStats) BytesRead() uint64 {
+	return s.SectorsRead * diskstatsSectorSize
+}
+
+// BytesWritten returns the number of bytes that were written to the device.
+func (s DiskStats) BytesWritten() uint64 {
+	return s.SectorsWritten * diskstatsSectorSize
+}
+
+// DiskLatency describes how a block device performed between two samples of its DiskStats.
+//
+// The average service times are NaN if the device didn't complete any IOs of that kind between
+// the samples (or if its counters were reset, e.x. because it was removed and re-added).
+type DiskLatency struct {
+	// ReadTime and WriteTime are the average number of seconds that the device spent on each
+	// read and write that it completed.
+	ReadTime  float64
+	WriteTime float64
+
+	// DiscardTime and FlushTime are the average number of seconds that the device spent on each
+	// discard and flush that it completed. They're NaN on kernels that don't report them.
+	DiscardTime float64
+	FlushTime   float64
+
+	// BytesRead and BytesWritten are the number of bytes that were read from and written to the
+	// device.
+	BytesRead    uint64
+	BytesWritten uint64
+
+	// Utilization is the fraction of the interval (between 0 and 1) that the device spent doing
+	// IO, and AverageQueueSize is the average number of IOs that were in progress.
+	Utilization      float64
+	AverageQueueSize float64
+}
+
+// ComputeDiskLatency returns how the block device performed between the samples prev and cur
+// of its DiskStats, which were taken interval apart.
+//
+// Utilization and AverageQueueSize are NaN if interval isn't positive.
+func ComputeDiskLatency(prev, cur DiskStats, interval time.Duration) DiskLatency {
+	latency := DiskLatency{
+		ReadTime:    averageServiceTime(prev.ReadsCompleted, cur.ReadsCompleted, prev.ReadTime, cur.ReadTime),
+		WriteTime:   averageServiceTime(prev.WritesCompleted, cur.WritesCompleted, prev.WriteTime, cur.WriteTime),
+		DiscardTime: averageServiceTime(prev.DiscardsCompleted, cur.DiscardsCompleted, prev.DiscardTime, cur.DiscardTime),
+		FlushTime:   averageServiceTime(prev.FlushesCompleted, cur.FlushesCompleted, prev.FlushTime, cur.FlushTime),
+
+		Utilization:      math.NaN(),
+		AverageQueueSize: math.NaN(),
+	}
+
+	if cur.SectorsRead >= prev.SectorsRead {
+		latency.BytesRead = cur.BytesRead() - prev.BytesRead()
+	}
+
+	if cur.SectorsWritten >= prev.SectorsWritten {
+		latency.BytesWritten = cur.BytesWritten() - prev.BytesWritten()
+	}
+
+	if interval > 0 {
+		if cur.IOTime >= prev.IOTime {
+			latency.Utilization = math.Min((cur.IOTime-prev.IOTime).Seconds()/interval.Seconds(), 1)
+		}
+
+		if cur.WeightedIOTime >= prev.WeightedIOTime {
+			latency.AverageQueueSize = (cur.WeightedIOTime - prev.WeightedIOTime).Seconds() / interval.Seconds()
+		}
+	}
+
+	return latency
+}
+
+// averageServiceTime returns the average number of seconds that each of the IOs that were
+// completed between two samples took, given the samples' counts of completed IOs and the
+// time spent on them. It returns NaN if no IOs were completed.
+func averageServiceTime(prevCompleted, curCompleted uint64, prevTime, curTime time.Duration) float64 {
+	if curCompleted <= prevCompleted || curTime < prevTime {
+		return math.NaN()
+	}
+
+	return (curTime - prevTime).Seconds() / float64(curCompleted-prevCompleted)
+}
+
+// ReadDiskStats returns the IO statistics for every block device listed in /proc/diskstats,
+// keyed by device name (example: "sda").
+//
+// ReadDiskStats currently works only on Linux-based operating systems. On all other operating
+// systems, it returns an error that wraps ErrUnsupportedPlatform.
+func ReadDiskStats() (map[string]DiskStats, error) {
+	return readDiskStats()
+}
+
+// ReadDeviceStats returns the IO statistics for the block device with the provided name
+// (example: "sda"), which can also be the name of a partition (example: "sda1").
+//
+// Unlike ReadDiskStats, ReadDeviceStats only reads the statistics of a single device (from
+// /sys/class/block/<name>/stat), so it's cheaper for callers that frequently poll a few devices
+// on a system with many of them.
+//
+// ReadDeviceStats currently works only on Linux-based operating systems. On all other operating
+// systems, it returns an error that wraps ErrUnsupportedPlatform.
+func (d *Discoverer) ReadDeviceStats(name string) (DiskStats, error) {
+	return d.readDeviceStats(name)
+}
+
+// ReadDeviceStats calls ReadDeviceStats on a Discoverer that inspects the current system.
+func ReadDeviceStats(name string) (DiskStats, error) {
+	return defaultDiscoverer.ReadDeviceStats(name)
+}
+
+// parseDiskStats parses the contents of /proc/diskstats into a set of
+// device name -> IO statistics mappings.
+func parseDiskStats(r io.Reader) (map[string]DiskStats, error) {
+	stats := make(map[string]DiskStats)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		// <major> <minor> <name>, followed by 11 counters (older kernels),
+		// 15 counters (4.18+), or 17 counters (5.5+)
+		if len(fields) < 14 {
+			return nil, fmt.Errorf("parseDiskStats: malformed line %q", scanner.Text())
+		}
+
+		deviceStats, err := parseDiskStatsCounters(fields[3:])
+		if err != nil {
+			return nil, fmt.Errorf("parseDiskStats: malformed counter in line %q: %w", scanner.Text(), err)
+		}
+
+		stats[fields[2]] = deviceStats
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("parseDiskStats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// parseDeviceStats parses the contents of a block device's stat file in sysfs, which has the
+// same counters as the device's line in /proc/diskstats (without its number and name).
+//
+// See https://www.kernel.org/doc/Documentation/block/stat.txt
+func parseDeviceStats(contents []byte) (DiskStats, error) {
+	// 11 counters (older kernels), 15 counters (4.18+), or 17 counters (5.5+)
+	fields := strings.Fields(string(contents))
+	if len(fields) < 11 {
+		return DiskStats{}, fmt.Errorf("parseDeviceStats: malformed stat file %q", contents)
+	}
+
+	stats, err := parseDiskStatsCounters(fields)
+	if err != nil {
+		return DiskStats{}, fmt.Errorf("parseDeviceStats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// parseDiskStatsCounters converts the IO counters of a single block device (in the order that
+// they're listed in /proc/diskstats) into DiskStats. Counters that are missing (because they
+// aren't reported by older kernels) are zero.
+func parseDiskStatsCounters(fields []string) (DiskStats, error) {
+	var counters [17]uint64
+	for i := 0; i < len(counters) && i < len(fields); i++ {
+		counter, err := strconv.ParseUint(fields[i], 10, 64)
+		if err != nil {
+			return DiskStats{}, err
+		}
+
+		counters[i] = counter
+	}
+
+	return diskStatsFromCounters(&counters), nil
+}
+
+// diskStatsFromCounters converts the IO counters of a single block device (in the order that
+// they're listed in /proc/diskstats) into DiskStats.
+func diskStatsFromCounters(counters *[17]uint64) DiskStats {
+	millis := func(v uint64) time.Duration {
+		return time.Duration(v) * time.Millisecond
+	}
+
+	return DiskStats{
+		ReadsCompleted: counters[0],
+		ReadsMerged:    counters[1],
+		SectorsRead:    counters[2],
+		ReadTime:       millis(counters[3]),
+
+		WritesCompleted: counters[4],
+		WritesMerged:    counters[5],
+		SectorsWritten:  counters[6],
+		WriteTime:       millis(counters[7]),
+
+		IOsInProgress:  counters[8],
+		IOTime:         millis(counters[9]),
+		WeightedIOTime: millis(counters[10]),
+
+		DiscardsCompleted: counters[11],
+		DiscardsMerged:    counters[12],
+		SectorsDiscarded:  counters[13],
+		DiscardTime:       millis(counters[14]),
+
+		FlushesCompleted: counters[15],
+		FlushTime:        millis(counters[16]),
+	}
+}
+
+// DiskStatsParser parses the contents of /proc/diskstats like ReadDiskStats does, but reuses its
+// buffers (and the caller's map) across calls, so that polling the statistics of many devices
+// every few seconds doesn't allocate on every poll.
+//
+// The zero value is ready to use. A DiskStatsParser isn't safe for concurrent use by multiple
+// goroutines.
+type DiskStatsParser struct {
+	// buf holds the contents of the last parsed diskstats file
+	buf []byte
+
+	// names interns the device names that have been parsed, so that a device's name is only
+	// allocated the first time it's seen
+	names map[string]diskStatsName
+
+	// generation counts the calls to Parse, so that the devices that a call didn't see can
+	// be told apart from the ones that it did
+	generation uint64
+}
+
+// diskStatsName is a device name that has been interned by a DiskStatsParser.
+type diskStatsName struct {
+	name string
+
+	// generation is the last generation of the parser that saw the device
+	generation uint64
+}
+
+// ReadDiskStats replaces the contents of stats with the IO statistics for every block device
+// listed in /proc/diskstats, keyed by device name (example: "sda").
+//
+// ReadDiskStats currently works only on Linux-based operating systems. On all other operating
+// systems, it returns an error that wraps ErrUnsupportedPlatform.
+func (p *DiskStatsParser) ReadDiskStats(stats map[string]DiskStats) error {
+	return p.readDiskStats(stats)
+}
+
+// Parse replaces the contents of stats with the IO statistics parsed from r, which must have the
+// format of /proc/diskstats. If Parse returns an error, the contents of stats are undefined.
+func (p *DiskStatsParser) Parse(r io.Reader, stats map[string]DiskStats) error {
+	p.buf = p.buf[:0]
+	for {
+		if len(p.buf) == cap(p.buf) {
+			p.buf = append(p.buf, 0)[:len(p.buf)]
+		}
+
+		n, err := r.Read(p.buf[len(p.buf):cap(p.buf)])
+		p.buf = p.buf[:len(p.buf)+n]
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("parseDiskStats: %w", err)
+		}
+	}
+
+	if p.names == nil {
+		p.names = make(map[string]diskStatsName)
+	}
+
+	p.generation++
+
+	for contents := p.buf; len(contents) > 0; {
+		line := contents
+		if i := bytes.IndexByte(contents, '\n'); i >= 0 {
+			line, contents = contents[:i], contents[i+1:]
+		} else {
+			contents = nil
+		}
+
+		if err := p.parseLine(line, stats); err != nil {
+			return err
+		}
+	}
+
+	// devices are updated in place instead of clearing stats up front, since DiskStats is too
+	// large to be stored in a map without allocating whenever a key is added
+	for name := range stats {
+		if p.names[name].generation != p.generation {
+			delete(stats, name)
+		}
+	}
+
+	// forget the devices that have been removed, so that names doesn't grow without bound on
+	// systems that keep adding and removing devices (e.x. loop devices)
+	for name, interned := range p.names {
+		if interned.generation != p.generation {
+			delete(p.names, name)
+		}
+	}
+
+	return nil
+}
+
+// parseLine parses a single line of /proc/diskstats into stats, without allocating unless the
+// line has a device name that hasn't been seen before.
+func (p *DiskStatsParser) parseLine(line []byte, stats map[string]DiskStats) error {
+	var (
+		name     []byte
+		counters [17]uint64
+	)
+
+	fields := 0
+	for rest := line; ; fields++ {
+		field := nextDiskStatsField(&rest)
+		if field == nil {
+			break
+		}
+
+		switch {
+		case fields == 2:
+			name = field
+		case fields >= 3 && fields-3 < len(counters):
+			counter, ok := parseDiskStatsCounter(field)
+			if !ok {
+				return fmt.Errorf("parseDiskStats: malformed counter in line %q", line)
+			}
+
+			counters[fields-3] = counter
+		}
+	}
+
+	if fields == 0 {
+		return nil
+	}
+
+	// <major> <minor> <name>, followed by 11 counters (older kernels),
+	// 15 counters (4.18+), or 17 counters (5.5+)
+	if fields < 14 {
+		return fmt.Errorf("parseDiskStats: malformed line %q", line)
+	}
+
+	// looking a []byte up in a map after converting it to a string doesn't allocate
+	interned, ok := p.names[string(name)]
+	if !ok {
+		interned.name = string(name)
+	}
+
+	interned.generation = p.generation
+	p.names[interned.name] = interned
+
+	stats[interned.name] = diskStatsFromCounters(&counters)
+	return nil
+}
+
+// nextDiskStatsField returns the next whitespace-separated field in *rest (nil if there
+// isn't one), and advances *rest past it.
+func nextDiskStatsField(rest *[]byte) []byte {
+	b := *rest
+
+	start := 0
+	for start < len(b) && isDiskStatsSpace(b[start]) {
+		start++
+	}
+
+	end := start
+	for end < len(b) && !isDiskStatsSpace(b[end]) {
+		end++
+	}
+
+	*rest = b[end:]
+	if start == end {
+		return nil
+	}
+
+	return b[start:end]
+}
+
+// isDiskStatsSpace returns true if c separates the fields of a line of /proc/diskstats.
+func isDiskStatsSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// parseDiskStatsCounter parses a decimal counter like strconv.ParseUint(string(b), 10, 64),
+// without converting b to a string.
+func parseDiskStatsCounter(b []byte) (uint64, bool) {
+	if len(b) == 0 {
+		return 0, false
+	}
+
+	var n uint64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+
+		digit := uint64(c - '0')
+		if n > (math.MaxUint64-digit)/10 {
+			return 0, false
+		}
+
+		n = n*10 + digit
+	}
+
+	return n, true
+}
@@ -0,0 +1,52 @@
+package mountinfo
+
+import (
+	"fmt"
+	"os"
+	"path"
+)
+
+// diskstatsPath is the location of the kernel's IO statistics for each block device.
+const diskstatsPath = "/proc/diskstats"
+
+// readDiskStats returns the IO statistics for every block device listed in /proc/diskstats,
+// keyed by device name.
+func readDiskStats() (map[string]DiskStats, error) {
+	f, err := os.Open(diskstatsPath)
+	if err != nil {
+		return nil, fmt.Errorf("readDiskStats: %w", procfsError(standardProcfsMountpoint, err))
+	}
+
+	defer f.Close()
+
+	return parseDiskStats(f)
+}
+
+// readDiskStats reads /proc/diskstats into stats, reusing the buffers of p.
+func (p *DiskStatsParser) readDiskStats(stats map[string]DiskStats) error {
+	f, err := os.Open(diskstatsPath)
+	if err != nil {
+		return fmt.Errorf("readDiskStats: %w", procfsError(standardProcfsMountpoint, err))
+	}
+
+	defer f.Close()
+
+	return p.Parse(f, stats)
+}
+
+// readDeviceStats returns the IO statistics for the block device with the provided name,
+// as reported by its stat file in sysfs.
+func (d *Discoverer) readDeviceStats(name string) (DiskStats, error) {
+	sysfs, err := d.sysfs()
+	if err != nil {
+		return DiskStats{}, fmt.Errorf("readDeviceStats: finding sysfs mountpoint: %w", err)
+	}
+
+	// class/block contains both disks and partitions (unlike block, which only has disks)
+	contents, err := readSysfsFile(sysfs, path.Join("class", "block", name, "stat"))
+	if err != nil {
+		return DiskStats{}, fmt.Errorf("readDeviceStats: %w", err)
+	}
+
+	return parseDeviceStats(contents)
+}
@@ -0,0 +1,59 @@
+package mountinfo
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_ReadDeviceStats(t *testing.T) {
+	counters := "     182504    43117 11089090    90518   469873   389120 21637898  1372381        0   668224  1551540        0        0        0        0    57010    88640\n"
+
+	sysfs := fstest.MapFS{
+		"class/block/sda":                  symlink("../../devices/pci0/block/sda"),
+		"class/block/sda1":                 symlink("../../devices/pci0/block/sda/sda1"),
+		"class/block/sdb":                  symlink("../../devices/pci0/block/sdb"),
+		"devices/pci0/block/sda/stat":      {Data: []byte(counters)},
+		"devices/pci0/block/sda/sda1/stat": {Data: []byte("1 2 3 4 5 6 7 8 9 10 11\n")},
+		"devices/pci0/block/sdb/stat":      {Data: []byte("1 2 3\n")},
+	}
+
+	d := NewDiscoverer(WithSysfs(sysfs))
+
+	// the stat file has the same counters as the device's line in /proc/diskstats
+	expected, err := parseDiskStats(strings.NewReader("   8       0 sda " + counters))
+	if err != nil {
+		t.Fatalf("parsing diskstats: %s", err)
+	}
+
+	stats, err := d.ReadDeviceStats("sda")
+	if err != nil {
+		t.Fatalf("reading device stats: %s", err)
+	}
+
+	if diff := cmp.Diff(expected["sda"], stats); diff != "" {
+		t.Fatalf("recieved unexpected stats for sda (-want +got):\n%s", diff)
+	}
+
+	// partitions have stat files as well, and older kernels report fewer counters
+	stats, err = d.ReadDeviceStats("sda1")
+	if err != nil {
+		t.Fatalf("reading device stats: %s", err)
+	}
+
+	if stats.ReadsCompleted != 1 || stats.WeightedIOTime.Milliseconds() != 11 || stats.FlushesCompleted != 0 {
+		t.Fatalf("recieved unexpected stats for sda1: %+v", stats)
+	}
+
+	if _, err := d.ReadDeviceStats("sdb"); err == nil {
+		t.Fatal("expected error for malformed stat file, got nil")
+	}
+
+	if _, err := d.ReadDeviceStats("sdc"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected error wrapping fs.ErrNotExist for unknown device, got %v", err)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package mountinfo
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func readDiskStats() (map[string]DiskStats, error) {
+	return nil, fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
+
+func (p *DiskStatsParser) readDiskStats(stats map[string]DiskStats) error {
+	return fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
+
+func (d *Discoverer) readDeviceStats(name string) (DiskStats, error) {
+	return DiskStats{}, fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
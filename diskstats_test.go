@@ -0,0 +1,295 @@
+package mountinfo
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func Test_ParseDiskStats(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "diskstats"))
+	if err != nil {
+		t.Fatalf("opening diskstats fixture: %s", err)
+	}
+
+	defer f.Close()
+
+	stats, err := parseDiskStats(f)
+	if err != nil {
+		t.Fatalf("parsing diskstats: %s", err)
+	}
+
+	if len(stats) != 5 {
+		t.Fatalf("expected stats for 5 devices, got %d", len(stats))
+	}
+
+	expected := DiskStats{
+		ReadsCompleted: 182504,
+		ReadsMerged:    43117,
+		SectorsRead:    11089090,
+		ReadTime:       90518 * time.Millisecond,
+
+		WritesCompleted: 469873,
+		WritesMerged:    389120,
+		SectorsWritten:  21637898,
+		WriteTime:       1372381 * time.Millisecond,
+
+		IOsInProgress:  0,
+		IOTime:         668224 * time.Millisecond,
+		WeightedIOTime: 1551540 * time.Millisecond,
+
+		FlushesCompleted: 57010,
+		FlushTime:        88640 * time.Millisecond,
+	}
+
+	if diff := cmp.Diff(expected, stats["sda"]); diff != "" {
+		t.Fatalf("recieved unexpected stats for sda (-want +got):\n%s", diff)
+	}
+}
+
+func Test_ParseDiskStats_KernelVersions(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		line     string
+		expected DiskStats
+	}{
+		{
+			name: "without discard or flush statistics (< 4.18)",
+			line: "   8       0 sda 1 2 3 4 5 6 7 8 9 10 11",
+			expected: DiskStats{
+				ReadsCompleted: 1, ReadsMerged: 2, SectorsRead: 3, ReadTime: 4 * time.Millisecond,
+				WritesCompleted: 5, WritesMerged: 6, SectorsWritten: 7, WriteTime: 8 * time.Millisecond,
+				IOsInProgress: 9, IOTime: 10 * time.Millisecond, WeightedIOTime: 11 * time.Millisecond,
+			},
+		},
+		{
+			name: "with discard statistics (4.18+)",
+			line: "   8       0 sda 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15",
+			expected: DiskStats{
+				ReadsCompleted: 1, ReadsMerged: 2, SectorsRead: 3, ReadTime: 4 * time.Millisecond,
+				WritesCompleted: 5, WritesMerged: 6, SectorsWritten: 7, WriteTime: 8 * time.Millisecond,
+				IOsInProgress: 9, IOTime: 10 * time.Millisecond, WeightedIOTime: 11 * time.Millisecond,
+				DiscardsCompleted: 12, DiscardsMerged: 13, SectorsDiscarded: 14, DiscardTime: 15 * time.Millisecond,
+			},
+		},
+		{
+			name: "with discard and flush statistics (5.5+)",
+			line: "   8       0 sda 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17",
+			expected: DiskStats{
+				ReadsCompleted: 1, ReadsMerged: 2, SectorsRead: 3, ReadTime: 4 * time.Millisecond,
+				WritesCompleted: 5, WritesMerged: 6, SectorsWritten: 7, WriteTime: 8 * time.Millisecond,
+				IOsInProgress: 9, IOTime: 10 * time.Millisecond, WeightedIOTime: 11 * time.Millisecond,
+				DiscardsCompleted: 12, DiscardsMerged: 13, SectorsDiscarded: 14, DiscardTime: 15 * time.Millisecond,
+				FlushesCompleted: 16, FlushTime: 17 * time.Millisecond,
+			},
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			stats, err := parseDiskStats(strings.NewReader(test.line))
+			if err != nil {
+				t.Fatalf("parsing diskstats: %s", err)
+			}
+
+			if diff := cmp.Diff(test.expected, stats["sda"]); diff != "" {
+				t.Fatalf("recieved unexpected stats for sda (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_DiskStatsParser(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "diskstats"))
+	if err != nil {
+		t.Fatalf("reading diskstats fixture: %s", err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		contents string
+	}{
+		{name: "fixture", contents: string(fixture)},
+		{name: "without discard or flush statistics (< 4.18)", contents: "   8       0 sda 1 2 3 4 5 6 7 8 9 10 11"},
+		{name: "with discard statistics (4.18+)", contents: "   8       0 sda 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15\n"},
+		{name: "with extra counters", contents: "8\t0\tsda 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19\r\n"},
+		{name: "blank lines", contents: "\n   8       0 sda 1 2 3 4 5 6 7 8 9 10 11\n\n"},
+		{name: "maximum counter", contents: "8 0 sda 18446744073709551615 2 3 4 5 6 7 8 9 10 11"},
+		{name: "overflowing counter", contents: "8 0 sda 18446744073709551616 2 3 4 5 6 7 8 9 10 11"},
+		{name: "negative counter", contents: "8 0 sda -1 2 3 4 5 6 7 8 9 10 11"},
+		{name: "too few counters", contents: "8 0 sda 1 2 3 4 5 6 7 8 9 10"},
+		{name: "empty", contents: ""},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			expected, expectedErr := parseDiskStats(strings.NewReader(test.contents))
+
+			var p DiskStatsParser
+
+			// the parser must replace stale entries instead of merging into them
+			stats := map[string]DiskStats{"removed": {ReadsCompleted: 1}}
+			err := p.Parse(strings.NewReader(test.contents), stats)
+
+			if (err != nil) != (expectedErr != nil) {
+				t.Fatalf("recieved unexpected error (want %v, got %v)", expectedErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(expected, stats); diff != "" {
+				t.Fatalf("recieved unexpected stats (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func BenchmarkParseDiskStats(b *testing.B) {
+	// a system with many devices, like the ones whose stats are polled every few seconds
+	fixture, err := os.ReadFile(filepath.Join("testdata", "diskstats"))
+	if err != nil {
+		b.Fatalf("reading diskstats fixture: %s", err)
+	}
+
+	contents := append([]byte(nil), fixture...)
+	for i := 0; i < 50; i++ {
+		contents = append(contents, fmt.Sprintf("   8 %d sdx%d 182504 43117 11089090 90518 469873 389120 21637898 1372381 0 668224 1551540 0 0 0 0 57010 88640\n", i, i)...)
+	}
+
+	r := bytes.NewReader(contents)
+
+	b.Run("simple", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			r.Reset(contents)
+			if _, err := parseDiskStats(r); err != nil {
+				b.Fatalf("parsing diskstats: %s", err)
+			}
+		}
+	})
+
+	b.Run("parser", func(b *testing.B) {
+		b.ReportAllocs()
+
+		var p DiskStatsParser
+		stats := make(map[string]DiskStats)
+
+		for i := 0; i < b.N; i++ {
+			r.Reset(contents)
+			if err := p.Parse(r, stats); err != nil {
+				b.Fatalf("parsing diskstats: %s", err)
+			}
+		}
+	})
+}
+
+func Test_ComputeDiskLatency(t *testing.T) {
+	prev := DiskStats{
+		ReadsCompleted: 1000,
+		SectorsRead:    8000,
+		ReadTime:       2 * time.Second,
+
+		WritesCompleted: 500,
+		SectorsWritten:  4000,
+		WriteTime:       5 * time.Second,
+
+		IOTime:         10 * time.Second,
+		WeightedIOTime: 20 * time.Second,
+	}
+
+	for _, test := range []struct {
+		name     string
+		cur      DiskStats
+		interval time.Duration
+		expected DiskLatency
+	}{
+		{
+			name: "reads and writes",
+			cur: DiskStats{
+				ReadsCompleted: 1100,
+				SectorsRead:    8800,
+				ReadTime:       2500 * time.Millisecond,
+
+				WritesCompleted: 700,
+				SectorsWritten:  6000,
+				WriteTime:       7 * time.Second,
+
+				IOTime:         12500 * time.Millisecond,
+				WeightedIOTime: 30 * time.Second,
+			},
+			interval: 10 * time.Second,
+			expected: DiskLatency{
+				ReadTime:         0.005, // 500ms over 100 reads
+				WriteTime:        0.01,  // 2s over 200 writes
+				DiscardTime:      math.NaN(),
+				FlushTime:        math.NaN(),
+				BytesRead:        800 * 512,
+				BytesWritten:     2000 * 512,
+				Utilization:      0.25,
+				AverageQueueSize: 1,
+			},
+		},
+		{
+			name:     "idle device",
+			cur:      prev,
+			interval: 10 * time.Second,
+			expected: DiskLatency{
+				ReadTime:    math.NaN(),
+				WriteTime:   math.NaN(),
+				DiscardTime: math.NaN(),
+				FlushTime:   math.NaN(),
+			},
+		},
+		{
+			name: "counters were reset",
+			cur: DiskStats{
+				ReadsCompleted: 10,
+				SectorsRead:    80,
+				ReadTime:       10 * time.Millisecond,
+			},
+			interval: 10 * time.Second,
+			expected: DiskLatency{
+				ReadTime:         math.NaN(),
+				WriteTime:        math.NaN(),
+				DiscardTime:      math.NaN(),
+				FlushTime:        math.NaN(),
+				Utilization:      math.NaN(),
+				AverageQueueSize: math.NaN(),
+			},
+		},
+		{
+			name:     "no interval",
+			cur:      prev,
+			interval: 0,
+			expected: DiskLatency{
+				ReadTime:         math.NaN(),
+				WriteTime:        math.NaN(),
+				DiscardTime:      math.NaN(),
+				FlushTime:        math.NaN(),
+				Utilization:      math.NaN(),
+				AverageQueueSize: math.NaN(),
+			},
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			actual := ComputeDiskLatency(prev, test.cur, test.interval)
+
+			if diff := cmp.Diff(test.expected, actual, cmpopts.EquateNaNs(), cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+				t.Fatalf("recieved unexpected latency (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
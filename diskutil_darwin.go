@@ -0,0 +1,172 @@
+package mountinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+// diskutilListCacheKey is the key that the output of `diskutil list` is cached under. BSD
+// device names never contain spaces, so it can't collide with the output of `diskutil info`.
+const diskutilListCacheKey = "diskutil list"
+
+// diskutilInfo returns the output of `diskutil info -plist` for the provided BSD device
+// (example: "disk1s1").
+//
+// diskutil is slow to run (especially while Time Machine or FileVault are busy), so the
+// output for each device is cached for a short amount of time. This avoids running it
+// repeatedly when discovering the devices for several paths that are on the same volume.
+func (d *Discoverer) diskutilInfo(ctx context.Context, logger sglog.Logger, device string) (map[string]interface{}, error) {
+	return d.runDiskutil(ctx, logger, device, "info", "-plist", device)
+}
+
+// diskutilList returns the output of `diskutil list -plist`, which describes all of the
+// disks and their partitions. Like the output of diskutilInfo, it's cached for a short
+// amount of time.
+func (d *Discoverer) diskutilList(ctx context.Context, logger sglog.Logger) (map[string]interface{}, error) {
+	return d.runDiskutil(ctx, logger, diskutilListCacheKey, "list", "-plist")
+}
+
+// runDiskutil runs diskutil with the provided arguments, and decodes the property list that
+// it prints. The decoded output is cached under cacheKey.
+func (d *Discoverer) runDiskutil(ctx context.Context, logger sglog.Logger, cacheKey string, args ...string) (map[string]interface{}, error) {
+	if output, ok := d.diskutilCache.get(cacheKey); ok {
+		return output, nil
+	}
+
+	output, err := d.runCommand(ctx, "/usr/sbin/diskutil", args...)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// log the output from `diskutil` instead of including it in the error message because it may be multiline
+			logger.Error(fmt.Sprintf("unable to run diskutil %v. Output is (%s%s)", args, string(output), string(exitErr.Stderr)))
+		}
+
+		return nil, fmt.Errorf("unable to run diskutil %v: %w", args, err)
+	}
+
+	dict, err := decodePlistDict(output)
+	if err != nil {
+		// log the output from `diskutil` instead of including it in the error message because it may be multiline
+		logger.Error(fmt.Sprintf("unable to decode output of diskutil %v (%s)", args, string(output)))
+		return nil, fmt.Errorf("unable to decode output of diskutil %v: %w", args, err)
+	}
+
+	d.diskutilCache.add(cacheKey, dict)
+	return dict, nil
+}
+
+// findWholeDisk returns the whole disk (example: "disk0") that contains the provided
+// partition, APFS volume, or APFS snapshot (example: "disk0s1"), according to the output
+// of `diskutil list -plist`.
+func findWholeDisk(list map[string]interface{}, device string) (string, bool) {
+	disks, _ := list["AllDisksAndPartitions"].([]interface{})
+
+	for _, disk := range disks {
+		disk, ok := disk.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		wholeDisk := plistString(disk, "DeviceIdentifier")
+		if wholeDisk == device {
+			return wholeDisk, true
+		}
+
+		for _, key := range []string{"Partitions", "APFSVolumes"} {
+			children, _ := disk[key].([]interface{})
+
+			for _, child := range children {
+				child, ok := child.(map[string]interface{})
+				if !ok {
+					continue
+				}
+
+				if plistString(child, "DeviceIdentifier") == device {
+					return wholeDisk, true
+				}
+
+				// the system volume is mounted from a snapshot (example: "disk3s1s1") of the
+				// APFS volume (example: "disk3s1")
+				snapshots, _ := child["MountedSnapshots"].([]interface{})
+				for _, snapshot := range snapshots {
+					snapshot, ok := snapshot.(map[string]interface{})
+					if ok && plistString(snapshot, "SnapshotBSD") == device {
+						return wholeDisk, true
+					}
+				}
+			}
+		}
+	}
+
+	return "", false
+}
+
+// wholeDisks returns the names of all of the whole disks (example: "disk0"), according to
+// the output of `diskutil list -plist`.
+func wholeDisks(list map[string]interface{}) []string {
+	entries, _ := list["WholeDisks"].([]interface{})
+
+	var names []string
+	for _, entry := range entries {
+		if name, ok := entry.(string); ok && name != "" {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// diskutilBlockSize returns the logical block size in bytes of the device described by the
+// provided output of `diskutil info -plist`, or zero if it isn't reported.
+func diskutilBlockSize(info map[string]interface{}) uint64 {
+	size, ok := info["DeviceBlockSize"].(int64)
+	if !ok || size < 0 {
+		return 0
+	}
+
+	return uint64(size)
+}
+
+// diskutilRemovable returns true if the media of the device described by the provided output
+// of `diskutil info -plist` can be removed or ejected (e.x. USB drives and SD cards).
+func diskutilRemovable(info map[string]interface{}) bool {
+	removable, _ := info["RemovableMedia"].(bool)
+	ejectable, _ := info["Ejectable"].(bool)
+
+	return removable || ejectable
+}
+
+// diskutilEncrypted returns true if the volume described by the provided output of
+// `diskutil info -plist` is encrypted (e.x. with FileVault).
+func diskutilEncrypted(info map[string]interface{}) bool {
+	fileVault, _ := info["FileVault"].(bool)
+	encrypted, _ := info["Encryption"].(bool)
+
+	return fileVault || encrypted
+}
+
+// apfsPhysicalStores returns the physical stores (example: "disk0s2") of the APFS container
+// or volume described by the provided output of `diskutil info -plist`.
+func apfsPhysicalStores(info map[string]interface{}) []string {
+	entries, _ := info["APFSPhysicalStores"].([]interface{})
+
+	var stores []string
+	for _, entry := range entries {
+		entry, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if store := plistString(entry, "APFSPhysicalStore"); store != "" {
+			stores = append(stores, store)
+		}
+	}
+
+	return stores
+}
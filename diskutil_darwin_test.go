@@ -0,0 +1,275 @@
+package mountinfo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/log/logtest"
+)
+
+func Test_FindWholeDisk(t *testing.T) {
+	// output of `diskutil list -plist` (abbreviated) on an Apple Silicon Mac
+	data, err := os.ReadFile(filepath.Join("testdata", "diskutil-list.plist"))
+	if err != nil {
+		t.Fatalf("reading plist fixture: %s", err)
+	}
+
+	list, err := decodePlistDict(data)
+	if err != nil {
+		t.Fatalf("decoding plist: %s", err)
+	}
+
+	for device, expected := range map[string]string{
+		"disk0":     "disk0", // whole disk
+		"disk0s2":   "disk0", // partition
+		"disk3s5":   "disk3", // APFS volume
+		"disk3s1s1": "disk3", // APFS snapshot
+		"disk9s1":   "",      // unknown device
+	} {
+		actual, ok := findWholeDisk(list, device)
+		if ok != (expected != "") || actual != expected {
+			t.Errorf("recieved unexpected whole disk for %q (want %q, got %q)", device, expected, actual)
+		}
+	}
+}
+
+func Test_WholeDisks(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "diskutil-list.plist"))
+	if err != nil {
+		t.Fatalf("reading plist fixture: %s", err)
+	}
+
+	list, err := decodePlistDict(data)
+	if err != nil {
+		t.Fatalf("decoding plist: %s", err)
+	}
+
+	if diff := cmp.Diff([]string{"disk0", "disk3"}, wholeDisks(list)); diff != "" {
+		t.Fatalf("recieved unexpected whole disks (-want +got):\n%s", diff)
+	}
+}
+
+func Test_ResolvePhysicalDisks(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "diskutil-info.plist"))
+	if err != nil {
+		t.Fatalf("reading plist fixture: %s", err)
+	}
+
+	volumeInfo, err := decodePlistDict(data)
+	if err != nil {
+		t.Fatalf("decoding plist: %s", err)
+	}
+
+	// pre-populate the cache, so that diskutil isn't run
+	d := NewDiscoverer()
+	d.diskutilCache.add("disk3s1s1", volumeInfo)
+	d.diskutilCache.add("disk0s2", map[string]interface{}{"DeviceIdentifier": "disk0s2", "ParentWholeDisk": "disk0"})
+	d.diskutilCache.add("disk4s1", map[string]interface{}{"DeviceIdentifier": "disk4s1", "ParentWholeDisk": "disk4"})
+
+	// an APFS volume on a Fusion Drive, whose container spans an SSD (disk0) and an HDD (disk1)
+	d.diskutilCache.add("disk2s1", map[string]interface{}{
+		"DeviceIdentifier":       "disk2s1",
+		"ParentWholeDisk":        "disk2",
+		"APFSContainerReference": "disk2",
+		"APFSPhysicalStores": []interface{}{
+			map[string]interface{}{"APFSPhysicalStore": "disk0s2"},
+			map[string]interface{}{"APFSPhysicalStore": "disk1s2"},
+		},
+	})
+	d.diskutilCache.add("disk1s2", map[string]interface{}{"DeviceIdentifier": "disk1s2", "ParentWholeDisk": "disk1"})
+
+	if size := diskutilBlockSize(volumeInfo); size != 4096 {
+		t.Fatalf("recieved unexpected block size (want %d, got %d)", 4096, size)
+	}
+
+	if diskutilRemovable(volumeInfo) {
+		t.Fatal("expected internal volume not to be removable")
+	}
+
+	for _, info := range []map[string]interface{}{
+		{"DeviceIdentifier": "disk5", "RemovableMedia": true, "Ejectable": true},  // SD card
+		{"DeviceIdentifier": "disk6", "RemovableMedia": false, "Ejectable": true}, // USB drive
+	} {
+		if !diskutilRemovable(info) {
+			t.Fatalf("expected %q to be removable", plistString(info, "DeviceIdentifier"))
+		}
+	}
+
+	for device, expected := range map[string][]string{
+		"disk3s1s1": {"disk0"},          // APFS snapshot -> container disk3 -> physical store disk0s2 -> disk0
+		"disk4s1":   {"disk4"},          // partition that isn't part of an APFS container
+		"disk2s1":   {"disk0", "disk1"}, // APFS volume on a Fusion Drive -> physical stores disk0s2 and disk1s2
+	} {
+		actual, err := d.resolvePhysicalDisks(context.Background(), logtest.Scoped(t), device)
+		if err != nil {
+			t.Fatalf("resolving physical disks of %q: %s", device, err)
+		}
+
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Fatalf("recieved unexpected physical disks for %q (-want +got):\n%s", device, diff)
+		}
+	}
+}
+
+func Test_ResolvePhysicalDisks_FileVault(t *testing.T) {
+	// output of `diskutil info -plist disk3s5` for the locked data volume of a Mac that has
+	// FileVault enabled, which doesn't report the container that it's part of
+	data, err := os.ReadFile(filepath.Join("testdata", "diskutil-info-filevault.plist"))
+	if err != nil {
+		t.Fatalf("reading plist fixture: %s", err)
+	}
+
+	volumeInfo, err := decodePlistDict(data)
+	if err != nil {
+		t.Fatalf("decoding plist: %s", err)
+	}
+
+	if !diskutilEncrypted(volumeInfo) {
+		t.Fatal("expected FileVault volume to be encrypted")
+	}
+
+	// pre-populate the cache, so that diskutil isn't run
+	d := NewDiscoverer()
+	d.diskutilCache.add("disk3s5", volumeInfo)
+	d.diskutilCache.add("disk3", map[string]interface{}{
+		"DeviceIdentifier": "disk3",
+		"ParentWholeDisk":  "disk3",
+		"APFSPhysicalStores": []interface{}{
+			map[string]interface{}{"APFSPhysicalStore": "disk0s2"},
+		},
+	})
+	d.diskutilCache.add("disk0s2", map[string]interface{}{"DeviceIdentifier": "disk0s2", "ParentWholeDisk": "disk0"})
+
+	// an encrypted volume in a container that reports its physical stores through
+	// its container reference instead
+	d.diskutilCache.add("disk5s1", map[string]interface{}{
+		"DeviceIdentifier":       "disk5s1",
+		"ParentWholeDisk":        "disk5",
+		"APFSContainerReference": "disk5",
+		"FileVault":              true,
+	})
+	d.diskutilCache.add("disk5", map[string]interface{}{
+		"DeviceIdentifier": "disk5",
+		"ParentWholeDisk":  "disk5",
+		"APFSPhysicalStores": []interface{}{
+			map[string]interface{}{"APFSPhysicalStore": "disk4s2"},
+		},
+	})
+	d.diskutilCache.add("disk4s2", map[string]interface{}{"DeviceIdentifier": "disk4s2", "ParentWholeDisk": "disk4"})
+
+	for device, expected := range map[string][]string{
+		"disk3s5": {"disk0"}, // locked FileVault volume -> container disk3 -> physical store disk0s2 -> disk0
+		"disk5s1": {"disk4"}, // encrypted volume -> container disk5 -> physical store disk4s2 -> disk4
+	} {
+		actual, err := d.resolvePhysicalDisks(context.Background(), logtest.Scoped(t), device)
+		if err != nil {
+			t.Fatalf("resolving physical disks of %q: %s", device, err)
+		}
+
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Fatalf("recieved unexpected physical disks for %q (-want +got):\n%s", device, diff)
+		}
+	}
+}
+
+func Test_MountSourceDeviceName(t *testing.T) {
+	for _, test := range []struct {
+		source      string
+		fsType      string
+		expected    string
+		expectError bool
+	}{
+		{source: "/dev/disk3s1s1", fsType: "apfs", expected: "disk3s1s1"},
+		{source: "/dev/disk4s2", fsType: "hfs", expected: "disk4s2"},
+		{source: "devfs", fsType: "devfs", expectError: true},
+		{source: "//user@server/share", fsType: "smbfs", expectError: true},
+	} {
+		actual, err := mountSourceDeviceName(test.source, test.fsType)
+		if test.expectError {
+			if !errors.Is(err, ErrNoBlockDevice) {
+				t.Errorf("expected error wrapping ErrNoBlockDevice for source %q, got %v", test.source, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("unexpected error for source %q: %s", test.source, err)
+		}
+
+		if actual != test.expected {
+			t.Errorf("recieved unexpected device name for source %q (want %q, got %q)", test.source, test.expected, actual)
+		}
+	}
+}
+
+func Test_ResolveDiskNames_DiskutilUnavailable(t *testing.T) {
+	var fallbacks []FallbackReason
+
+	// pre-populate the cache with answers that can't be resolved, as if diskutil had failed
+	d := NewDiscoverer(WithResolutionFallbacks(func(reason FallbackReason) {
+		fallbacks = append(fallbacks, reason)
+	}))
+	d.diskutilCache.add("disk3s1s1", map[string]interface{}{"DeviceIdentifier": "disk3s1s1"})
+	d.diskutilCache.add(diskutilListCacheKey, map[string]interface{}{})
+
+	actual, err := d.resolveDiskNames(context.Background(), logtest.Scoped(t), "disk3s1s1")
+	if err != nil {
+		t.Fatalf("resolving disk names: %s", err)
+	}
+
+	if diff := cmp.Diff([]string{"disk3"}, actual); diff != "" {
+		t.Fatalf("recieved unexpected disk names (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]FallbackReason{FallbackDiskutilList, FallbackDiskutilUnavailable}, fallbacks); diff != "" {
+		t.Fatalf("recieved unexpected fallbacks (-want +got):\n%s", diff)
+	}
+
+	// a device whose whole disk can't be derived from its name still fails
+	d.diskutilCache.add("vnode0", map[string]interface{}{"DeviceIdentifier": "vnode0"})
+	if _, err := d.resolveDiskNames(context.Background(), logtest.Scoped(t), "vnode0"); err == nil {
+		t.Fatal("expected error for device without a whole disk, got nil")
+	}
+}
+
+func Test_ResolveDiskNames_DiskutilUnavailable_Candidates(t *testing.T) {
+	d := NewDiscoverer()
+	d.fallbacks = &fallbackCollector{}
+	d.diskutilCache.add("disk3s1s1", map[string]interface{}{"DeviceIdentifier": "disk3s1s1"})
+	d.diskutilCache.add(diskutilListCacheKey, map[string]interface{}{})
+
+	names, err := d.resolveDiskNames(context.Background(), logtest.Scoped(t), "disk3s1s1")
+	if err != nil {
+		t.Fatalf("resolving disk names: %s", err)
+	}
+
+	// the fallback is logged for the BSD device, but applies to the whole disk that's reported
+	expected := []DeviceCandidate{
+		{Name: "disk3", Confidence: ConfidenceLow, Reason: CandidateFallback, Fallback: FallbackDiskutilUnavailable},
+	}
+
+	if diff := cmp.Diff(expected, rankCandidates(names, d.fallbacks.recorded())); diff != "" {
+		t.Fatalf("recieved unexpected candidates (-want +got):\n%s", diff)
+	}
+}
+
+func Test_BSDWholeDiskName(t *testing.T) {
+	for device, expected := range map[string]string{
+		"disk0":     "disk0",
+		"disk0s2":   "disk0",
+		"disk3s1s1": "disk3",
+		"disk12s4":  "disk12",
+		"vnode0":    "",
+		"disk":      "",
+	} {
+		actual, ok := bsdWholeDiskName(device)
+		if ok != (expected != "") || actual != expected {
+			t.Errorf("recieved unexpected whole disk for %q (want %q, got %q)", device, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package mountinfo
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+// dockerVolumesDir is the directory that the Docker daemon stores named volumes in on the host,
+// unless its data root has been moved (with the "data-root" setting).
+const dockerVolumesDir = "/var/lib/docker/volumes"
+
+// dockerVolumeNameRegex matches the names that Docker allows for named volumes.
+var dockerVolumeNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// DockerVolumeHostPath returns the location (on the host) of the data of the named Docker volume
+// with the provided name (example: "/var/lib/docker/volumes/pgdata/_data"), assuming that the
+// Docker daemon uses its default data root.
+func DockerVolumeHostPath(name string) (string, error) {
+	if !dockerVolumeNameRegex.MatchString(name) {
+		return "", fmt.Errorf("DockerVolumeHostPath: %q isn't a valid volume name", name)
+	}
+
+	return path.Join(dockerVolumesDir, name, "_data"), nil
+}
+
+// DiscoverHostPathDevice returns information about the block device that hostPath is stored on,
+// where hostPath is a location in the host's mount namespace that doesn't need to be visible to
+// the current process (e.x. the data directory of a Docker volume, which containers only see
+// through their own mounts).
+//
+// hostPath must be absolute. It's only looked up in the mount table that the Discoverer reads
+// (see WithProcfsMountpoint), so its symlinks aren't resolved, and the device number of its
+// filesystem is taken from the mount that contains it. The Discoverer should also inspect the
+// host's sysfs (see WithSysfsMountpoint) if the current process runs in a container.
+//
+// This operation is currently only supported on Linux. On all other operating systems, the
+// returned error wraps ErrUnsupportedPlatform.
+func (d *Discoverer) DiscoverHostPathDevice(logger sglog.Logger, hostPath string) (Device, error) {
+	return d.discoverHostPathDevice(logger, hostPath)
+}
+
+// DiscoverHostPathDevice calls DiscoverHostPathDevice on a Discoverer that inspects the current system.
+func DiscoverHostPathDevice(logger sglog.Logger, hostPath string) (Device, error) {
+	return defaultDiscoverer.DiscoverHostPathDevice(logger, hostPath)
+}
+
+// DiscoverDockerVolumeDevice returns information about the block device that the named Docker
+// volume with the provided name is stored on. It calls DiscoverHostPathDevice with the result of
+// DockerVolumeHostPath, so if the Docker daemon's data root has been moved, DiscoverHostPathDevice
+// should be called with the volume's location instead.
+//
+// Containers usually see their volumes through a bind mount of the volume's data directory, so
+// the Discoverer must read the host's mount table to find the volume's filesystem on the host
+// (e.x. with WithProcfsMountpoint("/host/proc") and WithSysfsMountpoint("/host/sys")).
+func (d *Discoverer) DiscoverDockerVolumeDevice(logger sglog.Logger, name string) (Device, error) {
+	hostPath, err := DockerVolumeHostPath(name)
+	if err != nil {
+		return Device{}, fmt.Errorf("DiscoverDockerVolumeDevice: %w", err)
+	}
+
+	device, err := d.DiscoverHostPathDevice(logger, hostPath)
+	if err != nil {
+		return Device{}, fmt.Errorf("DiscoverDockerVolumeDevice: volume %q: %w", name, err)
+	}
+
+	return device, nil
+}
+
+// DiscoverDockerVolumeDevice calls DiscoverDockerVolumeDevice on a Discoverer that inspects the current system.
+func DiscoverDockerVolumeDevice(logger sglog.Logger, name string) (Device, error) {
+	return defaultDiscoverer.DiscoverDockerVolumeDevice(logger, name)
+}
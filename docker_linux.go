@@ -0,0 +1,23 @@
+package mountinfo
+
+import (
+	"fmt"
+	"path/filepath"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+// discoverHostPathDevice discovers the device that hostPath is stored on by looking it up in a
+// snapshot of the mount table that d reads, instead of inspecting it on the current system.
+func (d *Discoverer) discoverHostPathDevice(logger sglog.Logger, hostPath string) (Device, error) {
+	if !filepath.IsAbs(hostPath) {
+		return Device{}, fmt.Errorf("DiscoverHostPathDevice: host path %q isn't absolute", hostPath)
+	}
+
+	mounts, err := d.listMounts()
+	if err != nil {
+		return Device{}, fmt.Errorf("DiscoverHostPathDevice: %w", err)
+	}
+
+	return d.withCapturedMountTable(mounts).DiscoverDevice(logger, hostPath)
+}
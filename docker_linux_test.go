@@ -0,0 +1,74 @@
+package mountinfo
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/log/logtest"
+)
+
+func Test_DiscoverDockerVolumeDevice(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"class/block":     {Mode: fs.ModeDir},
+		"dev/block/254:1": symlink("../../devices/pci0/virtio0/block/vda/vda1"),
+		"dev/block/8:17":  symlink("../../devices/pci0/block/sdb/sdb1"),
+		"devices/pci0/virtio0/block/vda/subsystem":      symlink("../../../../../class/block"),
+		"devices/pci0/virtio0/block/vda/vda1/partition": {Data: []byte("1\n")},
+		"devices/pci0/block/sdb/subsystem":              symlink("../../../../class/block"),
+		"devices/pci0/block/sdb/sdb1/partition":         {Data: []byte("1\n")},
+	}
+
+	procfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(procfs, "1"), 0755); err != nil {
+		t.Fatalf("creating procfs directory: %s", err)
+	}
+
+	// the host keeps Docker's data on sdb1, which isn't visible inside of the container
+	mountTable := "21 1 254:1 / / rw,relatime shared:1 - ext4 /dev/vda1 rw\n" +
+		"42 21 8:17 / /var/lib/docker rw,relatime shared:2 - xfs /dev/sdb1 rw\n"
+
+	if err := os.WriteFile(filepath.Join(procfs, "1", "mountinfo"), []byte(mountTable), 0644); err != nil {
+		t.Fatalf("writing mount table: %s", err)
+	}
+
+	d := NewDiscoverer(WithSysfs(sysfs), WithProcfsMountpoint(procfs))
+	d.resolvePath = func(filePath string) (string, error) {
+		t.Fatalf("unexpected resolution of %q on the current system", filePath)
+		return "", nil
+	}
+	d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+		t.Fatalf("unexpected stat of %q on the current system", filePath)
+		return 0, 0, nil
+	}
+
+	device, err := d.DiscoverDockerVolumeDevice(logtest.Scoped(t), "pgdata")
+	if err != nil {
+		t.Fatalf("discovering device: %s", err)
+	}
+
+	expected := Device{Name: "sdb", Major: 8, Minor: 17, Mountpoint: "/var/lib/docker", FSType: "xfs"}
+	if diff := cmp.Diff(expected, device); diff != "" {
+		t.Fatalf("recieved unexpected device (-want +got):\n%s", diff)
+	}
+
+	device, err = d.DiscoverHostPathDevice(logtest.Scoped(t), "/srv/data")
+	if err != nil {
+		t.Fatalf("discovering device: %s", err)
+	}
+
+	if device.Name != "vda" {
+		t.Fatalf("recieved unexpected device name (want %q, got %q)", "vda", device.Name)
+	}
+
+	if _, err := d.DiscoverHostPathDevice(logtest.Scoped(t), "srv/data"); err == nil {
+		t.Fatal("expected error for relative host path, got nil")
+	}
+
+	if _, err := d.DiscoverDockerVolumeDevice(logtest.Scoped(t), "../etc"); err == nil {
+		t.Fatal("expected error for invalid volume name, got nil")
+	}
+}
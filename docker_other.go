@@ -0,0 +1,14 @@
+//go:build !linux
+
+package mountinfo
+
+import (
+	"fmt"
+	"runtime"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+func (d *Discoverer) discoverHostPathDevice(logger sglog.Logger, hostPath string) (Device, error) {
+	return Device{}, fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
@@ -0,0 +1,60 @@
+package mountinfo
+
+import "testing"
+
+func Test_DockerVolumeHostPath(t *testing.T) {
+	for _, test := range []struct {
+		name string
+
+		volume        string
+		expectedPath  string
+		expectedError bool
+	}{
+		{
+			name:         "named volume",
+			volume:       "pgdata",
+			expectedPath: "/var/lib/docker/volumes/pgdata/_data",
+		},
+		{
+			name:         "compose volume",
+			volume:       "sourcegraph_redis-store.1",
+			expectedPath: "/var/lib/docker/volumes/sourcegraph_redis-store.1/_data",
+		},
+		{
+			name:          "empty name",
+			volume:        "",
+			expectedError: true,
+		},
+		{
+			name:          "path traversal",
+			volume:        "../../etc",
+			expectedError: true,
+		},
+		{
+			name:          "nested path",
+			volume:        "pgdata/_data",
+			expectedError: true,
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			path, err := DockerVolumeHostPath(test.volume)
+			if test.expectedError {
+				if err == nil {
+					t.Fatalf("expected error for volume name %q, got path %q", test.volume, path)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("finding host path: %s", err)
+			}
+
+			if path != test.expectedPath {
+				t.Fatalf("recieved unexpected host path (want %q, got %q)", test.expectedPath, path)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package mountinfo
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// duidRegex matches the disklabel UIDs (DUIDs) that OpenBSD lets filesystems be mounted by
+// (e.x. "3eb7f9da875cb9ee.a"), which consist of the disk's DUID followed by the partition's letter.
+var duidRegex = regexp.MustCompile(`^([0-9a-f]{16})\.([a-p])$`)
+
+// resolveDUID returns the special file (example: "/dev/sd0a") of the partition that source
+// refers to if it's a DUID (example: "3eb7f9da875cb9ee.a"). Otherwise, source is returned as-is.
+//
+// disknames is the list of disks as exposed by the "hw.disknames" sysctl
+// (example: "sd0:3eb7f9da875cb9ee,cd0:,sd1:0fb8ea1f2ad44b68").
+func resolveDUID(disknames, source string) (string, error) {
+	match := duidRegex.FindStringSubmatch(source)
+	if match == nil {
+		return source, nil
+	}
+
+	for _, disk := range strings.Split(disknames, ",") {
+		name, duid, ok := strings.Cut(disk, ":")
+		if ok && duid == match[1] {
+			return "/dev/" + name + match[2], nil
+		}
+	}
+
+	return "", fmt.Errorf("resolveDUID: no disk with DUID %q found", match[1])
+}
@@ -0,0 +1,57 @@
+package mountinfo
+
+import "testing"
+
+func Test_ResolveDUID(t *testing.T) {
+	disknames := "sd0:3eb7f9da875cb9ee,cd0:,sd1:0fb8ea1f2ad44b68"
+
+	for _, test := range []struct {
+		name   string
+		source string
+
+		expected    string
+		expectError bool
+	}{
+		{
+			name:     "DUID",
+			source:   "3eb7f9da875cb9ee.a",
+			expected: "/dev/sd0a",
+		},
+		{
+			name:     "DUID of a softraid volume",
+			source:   "0fb8ea1f2ad44b68.d",
+			expected: "/dev/sd1d",
+		},
+		{
+			name:     "special file",
+			source:   "/dev/sd0e",
+			expected: "/dev/sd0e",
+		},
+		{
+			name:        "unknown DUID",
+			source:      "ffffffffffffffff.a",
+			expectError: true,
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := resolveDUID(disknames, test.source)
+			if test.expectError {
+				if err == nil {
+					t.Fatalf("expected error, got %q", actual)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if actual != test.expected {
+				t.Fatalf("recieved unexpected source (want %q, got %q)", test.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package mountinfo
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// ErrUnsupportedPlatform is returned when device discovery isn't implemented
+// for the current operating system.
+var ErrUnsupportedPlatform = errors.New("unsupported platform")
+
+// ErrSysfsNotMounted is returned when discovery needs to inspect the sysfs pseudo-filesystem
+// (Linux only), but it isn't mounted (e.x. in some hardened containers).
+var ErrSysfsNotMounted = errors.New("sysfs isn't mounted")
+
+// ErrProcNotMounted is returned when discovery needs to read the mount table or the IO statistics
+// of block devices from the procfs pseudo-filesystem (Linux only), but it isn't mounted (e.x. in
+// some minimal containers).
+var ErrProcNotMounted = errors.New("procfs isn't mounted")
+
+// ErrCgroupNotMounted is returned when neither the unified (v2) cgroup hierarchy nor the
+// blkio controller of the legacy (v1) hierarchy is mounted.
+var ErrCgroupNotMounted = errors.New("no cgroup hierarchy is mounted")
+
+// ErrOverlayWithoutUpperdir is returned when a file path is stored on an overlay filesystem
+// that doesn't have an upper directory (e.x. a read-only overlay), so there's no single
+// filesystem whose block devices store the overlay's data.
+var ErrOverlayWithoutUpperdir = errors.New("overlay filesystem doesn't have an upperdir")
+
+// ErrNoBlockDevice is returned when a file path is stored on a filesystem that isn't backed by
+// any block device (e.x. tmpfs or ramfs, which store their files in memory, or a network drive
+// on Windows).
+var ErrNoBlockDevice = errors.New("filesystem isn't backed by a block device")
+
+// ErrNotWholeDisk is returned when a Discoverer that was created with WithWholeDiskOnly can't
+// resolve a file path to the whole disk that it's stored on (e.x. because a device-mapper device
+// doesn't list the devices that back it).
+var ErrNotWholeDisk = errors.New("device isn't a whole disk")
+
+// ErrPathNotFound is returned when the file path that discovery was asked about doesn't exist
+// (e.x. because it has been deleted), as opposed to discovery failing for a path that does.
+//
+// Errors that wrap ErrPathNotFound also wrap the underlying error, so they still match
+// fs.ErrNotExist.
+var ErrPathNotFound = errors.New("path not found")
+
+// pathNotFoundError is an error that's caused by a file path not existing.
+type pathNotFoundError struct {
+	err error
+}
+
+func (e *pathNotFoundError) Error() string        { return e.err.Error() }
+func (e *pathNotFoundError) Unwrap() error        { return e.err }
+func (e *pathNotFoundError) Is(target error) bool { return target == ErrPathNotFound }
+
+// wrapPathNotFound makes err wrap ErrPathNotFound if it's caused by a file path not existing.
+// Otherwise, err is returned unchanged.
+func wrapPathNotFound(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return &pathNotFoundError{err: err}
+	}
+
+	return err
+}
@@ -0,0 +1,98 @@
+package mountinfo
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// geomProvider is a single provider from the GEOM configuration (example: "ada0p3").
+type geomProvider struct {
+	class string
+	name  string
+
+	// parent is the provider that this provider was created from, or
+	// nil if this provider is at the root of the GEOM tree (e.x. a disk).
+	parent *geomProvider
+}
+
+// geomDiskName returns the name of the disk (example: "ada0") that the
+// provider with the given name (example: "gpt/data") is stored on.
+//
+// conftxt is the GEOM configuration as exposed by the "kern.geom.conftxt" sysctl.
+func geomDiskName(conftxt, provider string) (string, error) {
+	providers, err := parseGeomConftxt(conftxt)
+	if err != nil {
+		return "", err
+	}
+
+	p, ok := providers[provider]
+	if !ok {
+		return "", fmt.Errorf("geomDiskName: provider %q not found", provider)
+	}
+
+	for p.parent != nil {
+		p = p.parent
+	}
+
+	if p.class != "DISK" {
+		return "", fmt.Errorf("geomDiskName: provider %q is stored on provider %q (class %s), which isn't a disk", provider, p.name, p.class)
+	}
+
+	return p.name, nil
+}
+
+// parseGeomConftxt parses the output of the "kern.geom.conftxt" sysctl into a
+// set of provider name -> provider mappings.
+//
+// Each line of the output describes a single provider in the form "<depth> <class> <name> ...", example:
+//
+//	0 DISK ada0 500107862016 512 hd 16 sc 63
+//	1 PART ada0p3 498000000000 512 i 3 o 2148000000 ty freebsd-ufs xs GPT xt 516e7cb6-6ecf-11d6-8ff8-00022d09712b
+//	2 LABEL gpt/data 498000000000 512 i 0 o 0
+//
+// The providers are listed in depth-first order, so a provider's parent is the most
+// recently listed provider with a depth that's one less than its own.
+func parseGeomConftxt(conftxt string) (map[string]*geomProvider, error) {
+	providers := make(map[string]*geomProvider)
+
+	// ancestors[i] is the most recently listed provider at depth i
+	var ancestors []*geomProvider
+
+	scanner := bufio.NewScanner(strings.NewReader(conftxt))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("parseGeomConftxt: malformed line %q", scanner.Text())
+		}
+
+		depth, err := strconv.Atoi(fields[0])
+		if err != nil || depth < 0 || depth > len(ancestors) {
+			return nil, fmt.Errorf("parseGeomConftxt: malformed depth in line %q", scanner.Text())
+		}
+
+		p := &geomProvider{class: fields[1], name: fields[2]}
+		if depth > 0 {
+			p.parent = ancestors[depth-1]
+		}
+
+		ancestors = append(ancestors[:depth], p)
+
+		// the same provider can be listed multiple times (e.x. a gmirror provider
+		// is listed underneath each of its member disks), keep the first occurrence
+		if _, ok := providers[p.name]; !ok {
+			providers[p.name] = p
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("parseGeomConftxt: %w", err)
+	}
+
+	return providers, nil
+}
@@ -0,0 +1,79 @@
+package mountinfo
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_GeomDiskName(t *testing.T) {
+	conftxt := `0 DISK ada0 500107862016 512 hd 16 sc 63
+1 PART ada0p3 498000000000 512 i 3 o 2148000000 ty freebsd-ufs xs GPT xt 516e7cb6-6ecf-11d6-8ff8-00022d09712b
+2 LABEL gpt/data 498000000000 512 i 0 o 0
+1 PART ada0p2 2147483648 512 i 2 o 544768 ty freebsd-swap xs GPT xt 516e7cb5-6ecf-11d6-8ff8-00022d09712b
+1 PART ada0p1 524288 512 i 1 o 20480 ty freebsd-boot xs GPT xt 83bd6b9d-7f41-11dc-be0b-001560b84f0f
+0 DISK ada1 500107862016 512 hd 16 sc 63
+1 PART ada1p1 500107821056 512 i 1 o 20480 ty freebsd-ufs xs GPT xt 516e7cb6-6ecf-11d6-8ff8-00022d09712b
+0 MD md0 1073741824 512 fs 0 fl 0
+`
+
+	for _, test := range []struct {
+		name     string
+		provider string
+
+		expectedDiskName string
+		expectError      bool
+	}{
+		{
+			name:             "partition",
+			provider:         "ada0p3",
+			expectedDiskName: "ada0",
+		},
+		{
+			name:             "label on top of a partition",
+			provider:         "gpt/data",
+			expectedDiskName: "ada0",
+		},
+		{
+			name:             "partition on a second disk",
+			provider:         "ada1p1",
+			expectedDiskName: "ada1",
+		},
+		{
+			name:             "whole disk",
+			provider:         "ada1",
+			expectedDiskName: "ada1",
+		},
+		{
+			name:        "memory disk",
+			provider:    "md0",
+			expectError: true,
+		},
+		{
+			name:        "unknown provider",
+			provider:    "da0p1",
+			expectError: true,
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			name, err := geomDiskName(conftxt, test.provider)
+			if test.expectError {
+				if err == nil {
+					t.Fatalf("expected error, got disk name %q", name)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if diff := cmp.Diff(test.expectedDiskName, name); diff != "" {
+				t.Fatalf("recieved unexpected disk name (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
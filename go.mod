@@ -7,6 +7,8 @@ require (
 	github.com/moby/sys/mountinfo v0.6.2
 	github.com/prometheus/client_golang v1.14.0
 	github.com/sourcegraph/log v0.0.0-20231018134238-fbadff7458bb
+	go.uber.org/multierr v1.11.0
+	go.uber.org/zap v1.24.0
 	golang.org/x/sys v0.8.0
 )
 
@@ -32,8 +34,6 @@ require (
 	github.com/prometheus/procfs v0.9.0 // indirect
 	github.com/rogpeppe/go-internal v1.10.0 // indirect
 	go.uber.org/atomic v1.11.0 // indirect
-	go.uber.org/multierr v1.11.0 // indirect
-	go.uber.org/zap v1.24.0 // indirect
 	golang.org/x/text v0.9.0 // indirect
 	google.golang.org/protobuf v1.29.1 // indirect
 )
@@ -7,11 +7,11 @@ import (
 	sglog "github.com/sourcegraph/log"
 )
 
-// CollectorOpts modifies the behavior of the metric created
-// by NewCollector.
+// CollectorOpts modifies the behavior of the metrics created
+// by NewCollector and NewDeviceCollector.
 type CollectorOpts struct {
-	// If non-empty, Namespace prefixes the "mount_point_info" metric by the provided string and
-	// an underscore ("_").
+	// If non-empty, Namespace prefixes the names of the metrics (example: "mount_point_info")
+	// by the provided string and an underscore ("_").
 	Namespace string
 }
 
@@ -24,8 +24,17 @@ type CollectorOpts struct {
 //   - mount_name: caller-provided name for the given mount (example: "indexDir")
 //   - device: name of the block device that backs the given mount file path (example: "sdb")
 //
-// This metric currently works only on Linux-based operating systems that have access to the sysfs pseudo-filesystem.
-// On all other operating systems, this metric will not emit any values.
+// This metric currently works on:
+//   - Linux-based operating systems that have access to the sysfs pseudo-filesystem
+//   - macOS
+//   - FreeBSD
+//   - NetBSD and OpenBSD (for filesystems stored on disklabel partitions, example: "wd0")
+//   - illumos and Solaris (for filesystems stored on disk slices, example: "c1t0d0")
+//   - AIX (for filesystems stored on logical volumes, example: "hdisk0")
+//   - Windows (where device names are physical drive names, example: "PhysicalDrive0")
+//
+// On all other operating systems, this metric will not emit any values, and discovery functions
+// such as DiscoverDevice return an error that wraps ErrUnsupportedPlatform.
 func NewCollector(logger sglog.Logger, opts CollectorOpts, mounts map[string]string) prometheus.Collector {
 	logger = logger.Scoped("mountPointInfo")
 
@@ -40,7 +49,7 @@ func NewCollector(logger sglog.Logger, opts CollectorOpts, mounts map[string]str
 		// discover the name of the block device that stores <mountFilePath>.
 		discoveryLogger := logger.Scoped("deviceNameDiscovery").With(
 			sglog.String("mountName", name),
-			sglog.String("mountFilePath", filePath),
+			sglog.String("path", filePath),
 		)
 
 		device, err := discoverDeviceName(discoveryLogger, filePath)
@@ -54,7 +63,7 @@ func NewCollector(logger sglog.Logger, opts CollectorOpts, mounts map[string]str
 		}
 
 		discoveryLogger.Debug("discovered device name",
-			sglog.String("deviceName", device),
+			sglog.String("device", device),
 		)
 
 		metric.WithLabelValues(name, device).Set(1)
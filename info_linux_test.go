@@ -3,17 +3,23 @@
 package mountinfo
 
 import (
+	"context"
+	"errors"
 	"log"
 	"os"
 	"testing"
 
 	"archive/tar"
 	"compress/gzip"
-	"fmt"
 	"io"
+	"io/fs"
 	"path/filepath"
+	"testing/fstest"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/moby/sys/mountinfo"
+	sglog "github.com/sourcegraph/log"
 	"github.com/sourcegraph/log/logtest"
 )
 
@@ -33,23 +39,216 @@ func Test_DeviceName_SmokeTest(t *testing.T) {
 		t.Fatalf("Unable to find device name for path %q: %s", filePath, err)
 	}
 
+	// the logger-less convenience function must agree
+	noLoggerDevice, err := DeviceName(filePath)
+	if err != nil {
+		t.Fatalf("Unable to find device name for path %q without a logger: %s", filePath, err)
+	}
+
+	if noLoggerDevice != device {
+		t.Fatalf("expected DeviceName to return %q, got %q", device, noLoggerDevice)
+	}
+
 	t.Logf("discovered device name %q for path %q", device, filePath)
 }
 
-func Test_DeviceName_Snapshots(t *testing.T) {
-	// This test uses sysfs snapshots from real linux machines to ensure
-	// that the device discovery logic returns the expected device name.
+func Test_DiscoverDevices_SmokeTest(t *testing.T) {
+	// Verify that discovering devices in a batch (against a snapshot of the mount table)
+	// finds the same device as discovering them one by one.
+	logger := logtest.Scoped(t)
 
-	for _, test := range []struct {
-		name string
+	filePath, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("getting current working directory: %s", err)
+	}
 
-		sysfsTarballFile string
+	expected, err := discoverDeviceName(logger, filePath)
+	if err != nil {
+		t.Fatalf("Unable to find device name for path %q: %s", filePath, err)
+	}
 
-		deviceMajor uint32
-		deviceMinor uint32
+	results := DiscoverDevices(logger, []string{filePath, filepath.Dir(filePath)})
 
-		expectedDeviceName string
-	}{
+	result := results[filePath]
+	if result.Err != nil {
+		t.Fatalf("Unable to find device name for path %q in a batch: %s", filePath, result.Err)
+	}
+
+	if result.Name != expected {
+		t.Fatalf("expected batch discovery to find device %q for path %q, got %q", expected, filePath, result.Name)
+	}
+}
+
+func Test_FilesystemType_SmokeTest(t *testing.T) {
+	// A simple smoke test to verify that we can find the filesystem type
+	// for the current working directory.
+	filePath, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("getting current working directory: %s", err)
+	}
+
+	fsType, err := FilesystemType(filePath)
+	if err != nil {
+		t.Fatalf("Unable to find filesystem type for path %q: %s", filePath, err)
+	}
+
+	t.Logf("discovered filesystem type %q for path %q", fsType, filePath)
+}
+
+func Test_DiscoverDeviceForFile_SmokeTest(t *testing.T) {
+	// Verify that looking up the device through a file descriptor finds the
+	// same device as looking it up through the path.
+	logger := logtest.Scoped(t)
+
+	filePath, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("getting current working directory: %s", err)
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		t.Fatalf("opening %q: %s", filePath, err)
+	}
+
+	defer f.Close()
+
+	actualDevice, err := DiscoverDeviceForFile(logger, f)
+	if err != nil {
+		t.Fatalf("Unable to find device name for file %q: %s", filePath, err)
+	}
+
+	expectedDevice, err := discoverDeviceName(logger, filePath)
+	if err != nil {
+		t.Fatalf("Unable to find device name for path %q: %s", filePath, err)
+	}
+
+	if actualDevice != expectedDevice {
+		t.Fatalf("recieved unexpected device name (want %q, got %q)", expectedDevice, actualDevice)
+	}
+}
+
+func Test_MountpointForPath_SmokeTest(t *testing.T) {
+	// Verify that symlinks are resolved before looking up the mountpoint
+	// of the current working directory.
+	filePath, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("getting current working directory: %s", err)
+	}
+
+	expected, err := MountpointForPath(filePath)
+	if err != nil {
+		t.Fatalf("Unable to find mountpoint for path %q: %s", filePath, err)
+	}
+
+	symlink := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(filePath, symlink); err != nil {
+		t.Fatalf("creating symlink (%q -> %q): %s", symlink, filePath, err)
+	}
+
+	actual, err := MountpointForPath(symlink)
+	if err != nil {
+		t.Fatalf("Unable to find mountpoint for path %q: %s", symlink, err)
+	}
+
+	if actual != expected {
+		t.Fatalf("recieved unexpected mountpoint for symlink %q (want %q, got %q)", symlink, expected, actual)
+	}
+
+	t.Logf("discovered mountpoint %q for path %q", actual, filePath)
+}
+
+func Test_MountOptions_SmokeTest(t *testing.T) {
+	// A simple smoke test to verify that we can find the mount options
+	// for the current working directory.
+	filePath, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("getting current working directory: %s", err)
+	}
+
+	options, err := MountOptions(filePath)
+	if err != nil {
+		t.Fatalf("Unable to find mount options for path %q: %s", filePath, err)
+	}
+
+	if len(options) == 0 {
+		t.Fatalf("expected mount options for path %q, got none", filePath)
+	}
+
+	t.Logf("discovered mount options %q for path %q", options, filePath)
+}
+
+func Test_MountForPath_SmokeTest(t *testing.T) {
+	// A simple smoke test to verify that the mount of the current working directory
+	// is part of the mount tree.
+	filePath, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("getting current working directory: %s", err)
+	}
+
+	mount, err := MountForPath(filePath)
+	if err != nil {
+		t.Fatalf("Unable to find mount for path %q: %s", filePath, err)
+	}
+
+	mountpoint, err := MountpointForPath(filePath)
+	if err != nil {
+		t.Fatalf("Unable to find mountpoint for path %q: %s", filePath, err)
+	}
+
+	if mount.Mountpoint != mountpoint {
+		t.Fatalf("recieved unexpected mountpoint (want %q, got %q)", mountpoint, mount.Mountpoint)
+	}
+
+	if mount.ID == 0 || mount.ParentID == 0 {
+		t.Fatalf("expected mount and parent IDs for path %q, got %d and %d", filePath, mount.ID, mount.ParentID)
+	}
+
+	t.Logf("discovered mount %+v for path %q", mount, filePath)
+}
+
+func Test_DiskUsage_SmokeTest(t *testing.T) {
+	// A simple smoke test to verify that we can find the capacity of the filesystem
+	// for the current working directory.
+	filePath, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("getting current working directory: %s", err)
+	}
+
+	usage, err := DiskUsage(filePath)
+	if err != nil {
+		t.Fatalf("Unable to find disk usage for path %q: %s", filePath, err)
+	}
+
+	if usage.Free > usage.Total || usage.Available > usage.Free {
+		t.Fatalf("inconsistent disk usage for path %q: %+v", filePath, usage)
+	}
+
+	t.Logf("discovered disk usage %+v for path %q", usage, filePath)
+}
+
+func Test_DeviceName_Canceled(t *testing.T) {
+	// Verify that discovery stops once the provided context is canceled.
+	logger := logtest.Scoped(t)
+
+	filePath, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("getting current working directory: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = DiscoverDeviceNameContext(ctx, logger, filePath)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected error to wrap %q, got: %v", context.Canceled, err)
+	}
+}
+
+func Test_DeviceName_Snapshots(t *testing.T) {
+	// This test uses sysfs snapshots from real linux machines to ensure
+	// that the device discovery logic returns the expected device name.
+
+	runDeviceNameTests(t, []deviceNameTest{
 		{
 			name: "should find the name of the block device that backs a partition (vda1 -> vda)",
 
@@ -86,7 +285,7 @@ func Test_DeviceName_Snapshots(t *testing.T) {
 			expectedDeviceName: "vda",
 		},
 		{
-			name: "should find the device name for a lvm volume backed by a single disk",
+			name: "should find the parent disk for a lvm volume backed by a single partition (dm-0 -> nvme0n1p6 -> nvme0n1)",
 
 			// ( lsblk output from the snapshotted machine)
 			// ~ # lsblk
@@ -102,54 +301,407 @@ func Test_DeviceName_Snapshots(t *testing.T) {
 			// └─nvme0n1p6    259:6    0  1.5T  0 part
 			//   └─pool-nixos 254:0    0  600G  0 lvm  /nix/store
 			//                                         / # test targets this device
+			//
+			// The snapshot in sysfs.lvm.dm-0.tar.gz didn't capture the entry of nvme0n1p6 that
+			// dm-0's slave links to, so this snapshot adds it (and the one of nvme0n1).
 
-			sysfsTarballFile: "sysfs.lvm.dm-0.tar.gz",
+			sysfsTarballFile: "sysfs.lvm.dm-0.partition.tar.gz",
 
 			deviceMajor: 254, // points to dm-0 device
 			deviceMinor: 0,
 
-			// TODO@ggilmore: technically, dm-0 is a lvm volume backed by a partition stored on the nvme device.
-			// For consistency with the other test case, we should be returning nvme0n1 (the parent disk device) as the
-			// device name. I'll revisit this later, as I need to figure out how to programmatically determine
-			// the nvme01n1 <-> dm-0 translation.
-			expectedDeviceName: "dm-0",
+			// dm-0 is a lvm volume backed by the nvme0n1p6 partition, which is stored on the nvme0n1 disk
+			expectedDeviceName: "nvme0n1",
 		},
-	} {
+	})
+}
+
+func Test_DeviceName_Synthetic(t *testing.T) {
+	// This test uses hand-built sysfs trees for storage layouts that we don't
+	// have snapshots of (yet). The trees are modeled on the kernel's sysfs layout,
+	// but only contain the entries that the device discovery logic reads. Prefer
+	// capturing a snapshot with testdata/snapshot.sh over adding a case here.
+	runDeviceNameTests(t, []deviceNameTest{
+		{
+			name: "should find all member disks of a md RAID array (md0 -> sda1, sdb1 -> sda, sdb)",
+
+			sysfs: mdRAIDSysfs(),
+
+			deviceMajor: 9, // points to md0 device
+			deviceMinor: 0,
+
+			expectedDeviceName:  "sda",
+			expectedDeviceNames: []string{"sda", "sdb"},
+		},
+		{
+			name: "should find the network block device that backs the root partition (nbd0p1 -> nbd0)",
+
+			sysfs: nbdSysfs(),
+
+			deviceMajor: 43, // points to nbd0p1 partition
+			deviceMinor: 1,
+
+			expectedDeviceName: "nbd0",
+			expectedNetwork:    true,
+		},
+		{
+			name: "should find the head namespace for a nvme multipath controller path (nvme0c1n1 -> nvme0n1)",
+
+			sysfs: nvmeMultipathSysfs(),
+
+			deviceMajor: 259, // points to nvme0c1n1 controller path
+			deviceMinor: 3,
+
+			expectedDeviceName: "nvme0n1",
+		},
+		{
+			name: "should find the head namespace for a partition on a nvme multipath namespace (nvme0n1p1 -> nvme0n1)",
+
+			sysfs: nvmeMultipathSysfs(),
+
+			deviceMajor: 259, // points to nvme0n1p1 partition
+			deviceMinor: 1,
+
+			expectedDeviceName: "nvme0n1",
+		},
+		{
+			name: "should find the disk that stores the data of a lvm thin pool (dm-7 -> dm-2 -> dm-1 -> sda1 -> sda)",
+
+			sysfs: lvmThinPoolSysfs(),
+
+			deviceMajor: 254, // points to dm-7 thin volume
+			deviceMinor: 7,
+
+			// the pool's metadata lives on sdb, but the thin volume's data is stored on sda
+			expectedDeviceName: "sda",
+		},
+		{
+			name: "should find all member disks of a btrfs filesystem that spans multiple disks (sdb, sdc)",
+
+			sysfs: btrfsSysfs(),
+
+			deviceMajor: 0, // btrfs filesystems have anonymous device numbers
+			deviceMinor: 45,
+
+			mount: &mountinfo.Info{Major: 0, Minor: 45, Mountpoint: "/data", FSType: "btrfs", Source: "/dev/sdb"},
+
+			expectedDeviceName:  "sdb",
+			expectedDeviceNames: []string{"sdb", "sdc"},
+		},
+		{
+			name: "should find all member disks of a btrfs filesystem that's mounted by its uuid",
+
+			// same filesystem as above, mounted from /dev/disk/by-uuid/5e2f9a1c-3b7d-4c6e-8a0f-9d1b4e7c2a65,
+			// a udev symlink that doesn't exist on the machine that runs the test
+
+			sysfs: btrfsSysfs(),
+
+			deviceMajor: 0,
+			deviceMinor: 45,
+
+			mount: &mountinfo.Info{Major: 0, Minor: 45, Mountpoint: "/data", FSType: "btrfs", Source: "/dev/disk/by-uuid/5e2f9a1c-3b7d-4c6e-8a0f-9d1b4e7c2a65"},
+
+			expectedDeviceName:  "sdb",
+			expectedDeviceNames: []string{"sdb", "sdc"},
+		},
+		{
+			name: "should find all member disks of a btrfs filesystem that's mounted by its label",
+
+			sysfs: btrfsSysfs(),
+
+			deviceMajor: 0,
+			deviceMinor: 45,
+
+			mount: &mountinfo.Info{Major: 0, Minor: 45, Mountpoint: "/data", FSType: "btrfs", Source: "/dev/disk/by-label/data"},
+
+			expectedDeviceName:  "sdb",
+			expectedDeviceNames: []string{"sdb", "sdc"},
+		},
+	})
+}
+
+// mdRAIDSysfs returns a hand-built sysfs tree of a md RAID1 array (md0, 9:0) whose
+// members are the sda1 (8:1) and sdb1 (8:17) partitions.
+func mdRAIDSysfs() fstest.MapFS {
+	return fstest.MapFS{
+		"class/block": {Mode: fs.ModeDir},
+
+		"dev/block/8:0":  symlink("../../devices/pci0/ata1/block/sda"),
+		"dev/block/8:1":  symlink("../../devices/pci0/ata1/block/sda/sda1"),
+		"dev/block/8:16": symlink("../../devices/pci0/ata2/block/sdb"),
+		"dev/block/8:17": symlink("../../devices/pci0/ata2/block/sdb/sdb1"),
+		"dev/block/9:0":  symlink("../../devices/virtual/block/md0"),
+
+		"block/sda": symlink("../devices/pci0/ata1/block/sda"),
+		"block/sdb": symlink("../devices/pci0/ata2/block/sdb"),
+		"block/md0": symlink("../devices/virtual/block/md0"),
+
+		"devices/pci0/ata1/block/sda/dev":            {Data: []byte("8:0\n")},
+		"devices/pci0/ata1/block/sda/size":           {Data: []byte("1953525168\n")},
+		"devices/pci0/ata1/block/sda/subsystem":      symlink("../../../../../class/block"),
+		"devices/pci0/ata1/block/sda/sda1/dev":       {Data: []byte("8:1\n")},
+		"devices/pci0/ata1/block/sda/sda1/partition": {Data: []byte("1\n")},
+		"devices/pci0/ata1/block/sda/sda1/size":      {Data: []byte("1953523120\n")},
+		"devices/pci0/ata1/block/sda/sda1/subsystem": symlink("../../../../../../class/block"),
+
+		"devices/pci0/ata2/block/sdb/dev":            {Data: []byte("8:16\n")},
+		"devices/pci0/ata2/block/sdb/size":           {Data: []byte("1953525168\n")},
+		"devices/pci0/ata2/block/sdb/subsystem":      symlink("../../../../../class/block"),
+		"devices/pci0/ata2/block/sdb/sdb1/dev":       {Data: []byte("8:17\n")},
+		"devices/pci0/ata2/block/sdb/sdb1/partition": {Data: []byte("1\n")},
+		"devices/pci0/ata2/block/sdb/sdb1/size":      {Data: []byte("1953523120\n")},
+		"devices/pci0/ata2/block/sdb/sdb1/subsystem": symlink("../../../../../../class/block"),
+
+		"devices/virtual/block/md0/dev":         {Data: []byte("9:0\n")},
+		"devices/virtual/block/md0/size":        {Data: []byte("1953257472\n")},
+		"devices/virtual/block/md0/md/level":    {Data: []byte("raid1\n")},
+		"devices/virtual/block/md0/subsystem":   symlink("../../../../class/block"),
+		"devices/virtual/block/md0/slaves/sda1": symlink("../../../../pci0/ata1/block/sda/sda1"),
+		"devices/virtual/block/md0/slaves/sdb1": symlink("../../../../pci0/ata2/block/sdb/sdb1"),
+	}
+}
+
+// nbdSysfs returns a hand-built sysfs tree of a machine whose root filesystem is stored on
+// the nbd0p1 (43:1) partition of the nbd0 network block device, and whose /scratch filesystem
+// is stored on the vda1 (254:1) partition of a local virtio disk.
+func nbdSysfs() fstest.MapFS {
+	return fstest.MapFS{
+		"class/block": {Mode: fs.ModeDir},
+
+		"dev/block/43:0":  symlink("../../devices/virtual/block/nbd0"),
+		"dev/block/43:1":  symlink("../../devices/virtual/block/nbd0/nbd0p1"),
+		"dev/block/254:0": symlink("../../devices/pci0/virtio1/block/vda"),
+		"dev/block/254:1": symlink("../../devices/pci0/virtio1/block/vda/vda1"),
+
+		"block/nbd0": symlink("../devices/virtual/block/nbd0"),
+		"block/vda":  symlink("../devices/pci0/virtio1/block/vda"),
+
+		"devices/virtual/block/nbd0/dev":              {Data: []byte("43:0\n")},
+		"devices/virtual/block/nbd0/size":             {Data: []byte("41943040\n")},
+		"devices/virtual/block/nbd0/removable":        {Data: []byte("0\n")},
+		"devices/virtual/block/nbd0/queue/rotational": {Data: []byte("0\n")},
+		"devices/virtual/block/nbd0/subsystem":        symlink("../../../../class/block"),
+		"devices/virtual/block/nbd0/nbd0p1/dev":       {Data: []byte("43:1\n")},
+		"devices/virtual/block/nbd0/nbd0p1/partition": {Data: []byte("1\n")},
+		"devices/virtual/block/nbd0/nbd0p1/size":      {Data: []byte("40894464\n")},
+		"devices/virtual/block/nbd0/nbd0p1/subsystem": symlink("../../../../../class/block"),
+
+		"devices/pci0/virtio1/block/vda/dev":            {Data: []byte("254:0\n")},
+		"devices/pci0/virtio1/block/vda/size":           {Data: []byte("20971520\n")},
+		"devices/pci0/virtio1/block/vda/removable":      {Data: []byte("0\n")},
+		"devices/pci0/virtio1/block/vda/subsystem":      symlink("../../../../../class/block"),
+		"devices/pci0/virtio1/block/vda/vda1/dev":       {Data: []byte("254:1\n")},
+		"devices/pci0/virtio1/block/vda/vda1/partition": {Data: []byte("1\n")},
+		"devices/pci0/virtio1/block/vda/vda1/size":      {Data: []byte("20969472\n")},
+		"devices/pci0/virtio1/block/vda/vda1/subsystem": symlink("../../../../../../class/block"),
+	}
+}
+
+// nvmeMultipathSysfs returns a hand-built sysfs tree of a nvme namespace that's reachable through
+// two controllers: the kernel exposes the nvme0n1 (259:0) head namespace (with the nvme0n1p1
+// (259:1) partition), and hides the nvme0c0n1 (259:2) and nvme0c1n1 (259:3) controller paths.
+func nvmeMultipathSysfs() fstest.MapFS {
+	return fstest.MapFS{
+		"class/block": {Mode: fs.ModeDir},
+
+		"dev/block/259:0": symlink("../../devices/virtual/nvme-subsystem/nvme-subsys0/nvme0n1"),
+		"dev/block/259:1": symlink("../../devices/virtual/nvme-subsystem/nvme-subsys0/nvme0n1/nvme0n1p1"),
+		"dev/block/259:2": symlink("../../devices/pci0/nvme/nvme0/nvme0c0n1"),
+		"dev/block/259:3": symlink("../../devices/pci1/nvme/nvme1/nvme0c1n1"),
+
+		"block/nvme0n1": symlink("../devices/virtual/nvme-subsystem/nvme-subsys0/nvme0n1"),
+
+		"devices/virtual/nvme-subsystem/nvme-subsys0/nvme0n1/dev":                 {Data: []byte("259:0\n")},
+		"devices/virtual/nvme-subsystem/nvme-subsys0/nvme0n1/size":                {Data: []byte("3907029168\n")},
+		"devices/virtual/nvme-subsystem/nvme-subsys0/nvme0n1/subsystem":           symlink("../../../../../class/block"),
+		"devices/virtual/nvme-subsystem/nvme-subsys0/nvme0n1/nvme0n1p1/dev":       {Data: []byte("259:1\n")},
+		"devices/virtual/nvme-subsystem/nvme-subsys0/nvme0n1/nvme0n1p1/partition": {Data: []byte("1\n")},
+		"devices/virtual/nvme-subsystem/nvme-subsys0/nvme0n1/nvme0n1p1/size":      {Data: []byte("3907027120\n")},
+		"devices/virtual/nvme-subsystem/nvme-subsys0/nvme0n1/nvme0n1p1/subsystem": symlink("../../../../../../class/block"),
+		"devices/virtual/nvme-subsystem/nvme-subsys0/nvme0":                       symlink("../../../pci0/nvme/nvme0"),
+		"devices/virtual/nvme-subsystem/nvme-subsys0/nvme1":                       symlink("../../../pci1/nvme/nvme1"),
+
+		"devices/pci0/nvme/nvme0/nvme0c0n1/dev":       {Data: []byte("259:2\n")},
+		"devices/pci0/nvme/nvme0/nvme0c0n1/hidden":    {Data: []byte("1\n")},
+		"devices/pci0/nvme/nvme0/nvme0c0n1/subsystem": symlink("../../../../../class/block"),
+		"devices/pci1/nvme/nvme1/nvme0c1n1/dev":       {Data: []byte("259:3\n")},
+		"devices/pci1/nvme/nvme1/nvme0c1n1/hidden":    {Data: []byte("1\n")},
+		"devices/pci1/nvme/nvme1/nvme0c1n1/subsystem": symlink("../../../../../class/block"),
+	}
+}
+
+// lvmThinPoolSysfs returns a hand-built sysfs tree of a LVM thin volume (vg0-thin1, dm-7) in the
+// vg0-pool0-tpool thin pool (dm-2), whose data sub-device (dm-1) is stored on the sda1 (8:1)
+// partition and whose metadata sub-device (dm-0) is stored on the sdb1 (8:17) partition.
+func lvmThinPoolSysfs() fstest.MapFS {
+	return fstest.MapFS{
+		"class/block": {Mode: fs.ModeDir},
+
+		"dev/block/8:0":   symlink("../../devices/pci0/ata1/block/sda"),
+		"dev/block/8:1":   symlink("../../devices/pci0/ata1/block/sda/sda1"),
+		"dev/block/8:16":  symlink("../../devices/pci0/ata2/block/sdb"),
+		"dev/block/8:17":  symlink("../../devices/pci0/ata2/block/sdb/sdb1"),
+		"dev/block/254:0": symlink("../../devices/virtual/block/dm-0"),
+		"dev/block/254:1": symlink("../../devices/virtual/block/dm-1"),
+		"dev/block/254:2": symlink("../../devices/virtual/block/dm-2"),
+		"dev/block/254:7": symlink("../../devices/virtual/block/dm-7"),
+
+		"block/sda":  symlink("../devices/pci0/ata1/block/sda"),
+		"block/sdb":  symlink("../devices/pci0/ata2/block/sdb"),
+		"block/dm-0": symlink("../devices/virtual/block/dm-0"),
+		"block/dm-1": symlink("../devices/virtual/block/dm-1"),
+		"block/dm-2": symlink("../devices/virtual/block/dm-2"),
+		"block/dm-7": symlink("../devices/virtual/block/dm-7"),
+
+		"devices/pci0/ata1/block/sda/dev":            {Data: []byte("8:0\n")},
+		"devices/pci0/ata1/block/sda/subsystem":      symlink("../../../../../class/block"),
+		"devices/pci0/ata1/block/sda/sda1/dev":       {Data: []byte("8:1\n")},
+		"devices/pci0/ata1/block/sda/sda1/partition": {Data: []byte("1\n")},
+		"devices/pci0/ata1/block/sda/sda1/subsystem": symlink("../../../../../../class/block"),
+
+		"devices/pci0/ata2/block/sdb/dev":            {Data: []byte("8:16\n")},
+		"devices/pci0/ata2/block/sdb/subsystem":      symlink("../../../../../class/block"),
+		"devices/pci0/ata2/block/sdb/sdb1/dev":       {Data: []byte("8:17\n")},
+		"devices/pci0/ata2/block/sdb/sdb1/partition": {Data: []byte("1\n")},
+		"devices/pci0/ata2/block/sdb/sdb1/subsystem": symlink("../../../../../../class/block"),
+
+		"devices/virtual/block/dm-0/dev":         {Data: []byte("254:0\n")},
+		"devices/virtual/block/dm-0/subsystem":   symlink("../../../../class/block"),
+		"devices/virtual/block/dm-0/dm/name":     {Data: []byte("vg0-pool0_tmeta\n")},
+		"devices/virtual/block/dm-0/dm/uuid":     {Data: []byte("LVM-vg0pool0-tmeta\n")},
+		"devices/virtual/block/dm-0/slaves/sdb1": symlink("../../../../pci0/ata2/block/sdb/sdb1"),
+
+		"devices/virtual/block/dm-1/dev":         {Data: []byte("254:1\n")},
+		"devices/virtual/block/dm-1/subsystem":   symlink("../../../../class/block"),
+		"devices/virtual/block/dm-1/dm/name":     {Data: []byte("vg0-pool0_tdata\n")},
+		"devices/virtual/block/dm-1/dm/uuid":     {Data: []byte("LVM-vg0pool0-tdata\n")},
+		"devices/virtual/block/dm-1/slaves/sda1": symlink("../../../../pci0/ata1/block/sda/sda1"),
+
+		"devices/virtual/block/dm-2/dev":         {Data: []byte("254:2\n")},
+		"devices/virtual/block/dm-2/subsystem":   symlink("../../../../class/block"),
+		"devices/virtual/block/dm-2/dm/name":     {Data: []byte("vg0-pool0-tpool\n")},
+		"devices/virtual/block/dm-2/dm/uuid":     {Data: []byte("LVM-vg0pool0-tpool\n")},
+		"devices/virtual/block/dm-2/slaves/dm-0": symlink("../../dm-0"),
+		"devices/virtual/block/dm-2/slaves/dm-1": symlink("../../dm-1"),
+
+		"devices/virtual/block/dm-7/dev":         {Data: []byte("254:7\n")},
+		"devices/virtual/block/dm-7/subsystem":   symlink("../../../../class/block"),
+		"devices/virtual/block/dm-7/dm/name":     {Data: []byte("vg0-thin1\n")},
+		"devices/virtual/block/dm-7/dm/uuid":     {Data: []byte("LVM-vg0thin1\n")},
+		"devices/virtual/block/dm-7/slaves/dm-2": symlink("../../dm-2"),
+	}
+}
+
+// btrfsSysfs returns a hand-built sysfs tree of a machine with two btrfs filesystems: "root"
+// (uuid 0b7a5c4e-6d3f-4a8e-9f1b-2c6d8e4a1f3b) on the sda1 (8:1) partition, and "data" (uuid
+// 5e2f9a1c-3b7d-4c6e-8a0f-9d1b4e7c2a65), which spans the sdb (8:16) and sdc (8:32) disks.
+func btrfsSysfs() fstest.MapFS {
+	return fstest.MapFS{
+		"class/block": {Mode: fs.ModeDir},
+
+		"dev/block/8:0":  symlink("../../devices/pci0/ata1/block/sda"),
+		"dev/block/8:1":  symlink("../../devices/pci0/ata1/block/sda/sda1"),
+		"dev/block/8:16": symlink("../../devices/pci0/ata2/block/sdb"),
+		"dev/block/8:32": symlink("../../devices/pci0/ata3/block/sdc"),
+
+		"block/sda": symlink("../devices/pci0/ata1/block/sda"),
+		"block/sdb": symlink("../devices/pci0/ata2/block/sdb"),
+		"block/sdc": symlink("../devices/pci0/ata3/block/sdc"),
+
+		"devices/pci0/ata1/block/sda/dev":            {Data: []byte("8:0\n")},
+		"devices/pci0/ata1/block/sda/subsystem":      symlink("../../../../../class/block"),
+		"devices/pci0/ata1/block/sda/sda1/dev":       {Data: []byte("8:1\n")},
+		"devices/pci0/ata1/block/sda/sda1/partition": {Data: []byte("1\n")},
+		"devices/pci0/ata1/block/sda/sda1/subsystem": symlink("../../../../../../class/block"),
+		"devices/pci0/ata2/block/sdb/dev":            {Data: []byte("8:16\n")},
+		"devices/pci0/ata2/block/sdb/subsystem":      symlink("../../../../../class/block"),
+		"devices/pci0/ata3/block/sdc/dev":            {Data: []byte("8:32\n")},
+		"devices/pci0/ata3/block/sdc/subsystem":      symlink("../../../../../class/block"),
+
+		"fs/btrfs/features/raid1c34": {Data: []byte("0\n")},
+
+		"fs/btrfs/0b7a5c4e-6d3f-4a8e-9f1b-2c6d8e4a1f3b/label":        {Data: []byte("root\n")},
+		"fs/btrfs/0b7a5c4e-6d3f-4a8e-9f1b-2c6d8e4a1f3b/devices/sda1": symlink("../../../../devices/pci0/ata1/block/sda/sda1"),
+		"fs/btrfs/5e2f9a1c-3b7d-4c6e-8a0f-9d1b4e7c2a65/label":        {Data: []byte("data\n")},
+		"fs/btrfs/5e2f9a1c-3b7d-4c6e-8a0f-9d1b4e7c2a65/devices/sdb":  symlink("../../../../devices/pci0/ata2/block/sdb"),
+		"fs/btrfs/5e2f9a1c-3b7d-4c6e-8a0f-9d1b4e7c2a65/devices/sdc":  symlink("../../../../devices/pci0/ata3/block/sdc"),
+	}
+}
+
+// deviceNameTest is a test case for runDeviceNameTests.
+type deviceNameTest struct {
+	name string
+
+	// the sysfs tree that the test case runs against: either the name of a sysfs
+	// snapshot in testdata, or a hand-built tree
+	sysfsTarballFile string
+	sysfs            fstest.MapFS
+
+	deviceMajor uint32
+	deviceMinor uint32
+
+	// if nil, defaults to an ext4 filesystem mounted at "/"
+	mount *mountinfo.Info
+
+	expectedDeviceName string
+
+	// if nil, defaults to []string{expectedDeviceName}
+	expectedDeviceNames []string
+
+	expectedNetwork bool
+}
+
+// runDeviceNameTests verifies that the device discovery logic returns the expected
+// device names for each test case.
+func runDeviceNameTests(t *testing.T, tests []deviceNameTest) {
+	for _, test := range tests {
 		test := test
 
-		t.Run(t.Name(), func(t *testing.T) {
+		t.Run(test.name, func(t *testing.T) {
 			t.Parallel()
 
-			// provide a custom sysfs location so that we can point the test
-			// at our sysfs snapshot
-			mockSysFSDir := filepath.Join(t.TempDir(), "sys")
+			var sysfs fs.FS = test.sysfs
+			if test.sysfsTarballFile != "" {
+				// provide a custom sysfs location so that we can point the test
+				// at our sysfs snapshot
+				mockSysFSDir := filepath.Join(t.TempDir(), "sys")
 
-			// unpack sysfs tarball
-			tarball := filepath.Join("testdata", test.sysfsTarballFile)
-			decompressSysFSTarball(t, tarball, mockSysFSDir)
+				// unpack sysfs tarball
+				tarball := filepath.Join("testdata", test.sysfsTarballFile)
+				decompressSysFSTarball(t, tarball, mockSysFSDir)
 
-			// now that our fake sysfs filesystem is in place, clean the path representation
-			// and resolve any symbolic links because further processing does the same thing
-			// which can make path comparisons fail when they shouldn't
-			mockSysFSDir, err := filepath.EvalSymlinks(filepath.Clean(mockSysFSDir))
-			if err != nil {
-				t.Fatalf("unable to set up temporary sysfs location: %s", err)
+				sysfs = sysfsDirFS(mockSysFSDir)
 			}
 
 			logger := logtest.Scoped(t)
 
 			fakeFilePath := "doesn't matter" // the file path itself doesn't matter since we hard-code the device number
 
-			// redefine functions with alternate behavior
-			findSysfsMountpoint = func() (mountpoint string, err error) {
-				return mockSysFSDir, nil
+			// construct a discoverer with alternate behavior
+			d := NewDiscoverer(WithSysfs(sysfs))
+			d.resolvePath = unresolvedPath
+			d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+				return test.deviceMajor, test.deviceMinor, nil
 			}
-			getDeviceNumber = func(filePath string) (deviceNumber string, err error) {
-				return fmt.Sprintf("%d:%d", test.deviceMajor, test.deviceMinor), nil
+			d.findMount = func(filePath string) (*mountinfo.Info, error) {
+				if test.mount != nil {
+					return test.mount, nil
+				}
+
+				return &mountinfo.Info{Mountpoint: "/", FSType: "ext4"}, nil
 			}
 
 			// execute the test with our injected mocks
-			actualDeviceName, err := discoverDeviceName(logger, fakeFilePath)
+			actualMajor, actualMinor, err := d.DeviceNumber(fakeFilePath)
+			if err != nil {
+				t.Fatalf("discovering device number for file path %q: %s", fakeFilePath, err)
+			}
+
+			if actualMajor != test.deviceMajor || actualMinor != test.deviceMinor {
+				t.Fatalf("recieved unexpected device number (want %d:%d, got %d:%d)", test.deviceMajor, test.deviceMinor, actualMajor, actualMinor)
+			}
+
+			actualDeviceName, err := d.DiscoverDeviceNameContext(context.Background(), logger, fakeFilePath)
 
 			if err != nil {
 				t.Fatalf("discovering device name for file path %q: %s", fakeFilePath, err)
@@ -160,11 +712,132 @@ func Test_DeviceName_Snapshots(t *testing.T) {
 			if diff := cmp.Diff(test.expectedDeviceName, actualDeviceName); diff != "" {
 				t.Fatalf("recieved unexpected device name (-want +got):\n%s", diff)
 			}
+
+			expectedDeviceNames := test.expectedDeviceNames
+			if expectedDeviceNames == nil {
+				expectedDeviceNames = []string{test.expectedDeviceName}
+			}
+
+			device, err := d.DiscoverDevice(logger, fakeFilePath)
+			if err != nil {
+				t.Fatalf("discovering device for file path %q: %s", fakeFilePath, err)
+			}
+
+			if device.Network != test.expectedNetwork {
+				t.Fatalf("recieved unexpected network flag for device %q (want %t, got %t)", device.Name, test.expectedNetwork, device.Network)
+			}
+
+			actualDeviceNames, err := d.DiscoverDeviceNames(logger, fakeFilePath)
+			if err != nil {
+				t.Fatalf("discovering device names for file path %q: %s", fakeFilePath, err)
+			}
+
+			if diff := cmp.Diff(expectedDeviceNames, actualDeviceNames); diff != "" {
+				t.Fatalf("recieved unexpected device names (-want +got):\n%s", diff)
+			}
+
+			// looking the device up by its number skips the path, so anonymous devices can't be resolved
+			actualNumberName, err := d.DeviceNameFromNumber(test.deviceMajor, test.deviceMinor)
+			if test.deviceMajor == 0 {
+				if !errors.Is(err, ErrNoBlockDevice) {
+					t.Fatalf("expected error wrapping ErrNoBlockDevice for anonymous device number, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("discovering device name for device number %d:%d: %s", test.deviceMajor, test.deviceMinor, err)
+			}
+
+			if diff := cmp.Diff(test.expectedDeviceName, actualNumberName); diff != "" {
+				t.Fatalf("recieved unexpected device name for device number (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_DeviceName_Snapshots_MissingSlave(t *testing.T) {
+	// this snapshot of a lvm volume (dm-0) didn't capture the entry of the partition that its
+	// slave links to, so the volume can't be followed down to its disk
+	mockSysFSDir := filepath.Join(t.TempDir(), "sys")
+	decompressSysFSTarball(t, filepath.Join("testdata", "sysfs.lvm.dm-0.tar.gz"), mockSysFSDir)
+
+	d := NewDiscoverer(WithSysfs(sysfsDirFS(mockSysFSDir)))
+	d.resolvePath = unresolvedPath
+	d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+		return 254, 0, nil
+	}
+	d.findMount = func(filePath string) (*mountinfo.Info, error) {
+		return &mountinfo.Info{Mountpoint: "/", FSType: "ext4"}, nil
+	}
+
+	if name, err := d.DiscoverDeviceNameContext(context.Background(), logtest.Scoped(t), "/"); err == nil {
+		t.Fatalf("expected error for lvm volume with missing slave, got device name %q", name)
+	}
+}
+
+func BenchmarkDiscoverDeviceName(b *testing.B) {
+	// This benchmark uses the sysfs snapshots from Test_DeviceName_Snapshots (and the
+	// hand-built md RAID tree from Test_DeviceName_Synthetic, which is read from memory
+	// instead of disk), so that the cost of the Linux device discovery logic is measured
+	// without touching the devices of the current system.
+
+	for _, fixture := range []struct {
+		name string
+
+		sysfsTarballFile string
+		sysfs            fstest.MapFS
+
+		deviceMajor uint32
+		deviceMinor uint32
+	}{
+		{name: "partition", sysfsTarballFile: "sysfs.vda1.tar.gz", deviceMajor: 254, deviceMinor: 1},
+		{name: "lvm", sysfsTarballFile: "sysfs.lvm.dm-0.partition.tar.gz", deviceMajor: 254, deviceMinor: 0},
+		{name: "md", sysfs: mdRAIDSysfs(), deviceMajor: 9, deviceMinor: 0},
+	} {
+		fixture := fixture
+
+		var sysfs fs.FS = fixture.sysfs
+		if fixture.sysfsTarballFile != "" {
+			mockSysFSDir := filepath.Join(b.TempDir(), "sys")
+			decompressSysFSTarball(b, filepath.Join("testdata", fixture.sysfsTarballFile), mockSysFSDir)
+
+			sysfs = sysfsDirFS(mockSysFSDir)
+		}
+
+		d := NewDiscoverer(WithSysfs(sysfs))
+		d.resolvePath = unresolvedPath
+		d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+			return fixture.deviceMajor, fixture.deviceMinor, nil
+		}
+		d.findMount = func(filePath string) (*mountinfo.Info, error) {
+			return &mountinfo.Info{Mountpoint: "/", FSType: "ext4"}, nil
+		}
+
+		fakeFilePath := "doesn't matter" // the file path itself doesn't matter since we hard-code the device number
+
+		b.Run(fixture.name+"/uncached", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := d.DiscoverDeviceNameContext(context.Background(), sglog.NoOp(), fakeFilePath); err != nil {
+					b.Fatalf("discovering device name: %s", err)
+				}
+			}
+		})
+
+		b.Run(fixture.name+"/cached", func(b *testing.B) {
+			c := NewCachingDiscoverer(d, time.Hour, 0)
+
+			for i := 0; i < b.N; i++ {
+				if _, err := c.DiscoverDeviceNameContext(context.Background(), sglog.NoOp(), fakeFilePath); err != nil {
+					b.Fatalf("discovering device name: %s", err)
+				}
+			}
 		})
 	}
 }
 
-func decompressSysFSTarball(t *testing.T, tarball, outputFolder string) {
+func decompressSysFSTarball(t testing.TB, tarball, outputFolder string) {
 	t.Helper()
 
 	file, err := os.Open(tarball)
@@ -0,0 +1,34 @@
+package mountinfo
+
+import (
+	"context"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+// ListBlockDevices returns all of the whole disks that are attached to the system (regardless
+// of whether any file paths are stored on them), sorted by name. Partitions are omitted.
+//
+// Since the returned devices aren't associated with a file path, their Mountpoint and FSType
+// are empty.
+//
+// This operation is currently only supported on Linux (where the disks are listed in /sys/block)
+// and macOS (where they're listed by `diskutil list`). On all other operating systems, the returned
+// error wraps ErrUnsupportedPlatform.
+func (d *Discoverer) ListBlockDevices(logger sglog.Logger) ([]Device, error) {
+	devices, err := d.listBlockDevices(context.Background(), logger)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range devices {
+		devices[i].Name = NormalizeDeviceName(devices[i].Name)
+	}
+
+	return devices, nil
+}
+
+// ListBlockDevices calls ListBlockDevices on a Discoverer that inspects the current system.
+func ListBlockDevices(logger sglog.Logger) ([]Device, error) {
+	return defaultDiscoverer.ListBlockDevices(logger)
+}
@@ -0,0 +1,43 @@
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	sglog "github.com/sourcegraph/log"
+	"golang.org/x/sys/unix"
+)
+
+func (d *Discoverer) listBlockDevices(ctx context.Context, logger sglog.Logger) ([]Device, error) {
+	list, err := d.diskutilList(ctx, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []Device
+	for _, name := range wholeDisks(list) {
+		info, err := d.diskutilInfo(ctx, logger, name)
+		if err != nil {
+			return nil, err
+		}
+
+		device := Device{Name: name, LogicalBlockSize: diskutilBlockSize(info), Removable: diskutilRemovable(info)}
+
+		if size, ok := info["Size"].(int64); ok && size > 0 {
+			device.Size = uint64(size)
+		}
+
+		var stat unix.Stat_t
+		if err := unix.Stat(filepath.Join("/dev", name), &stat); err != nil {
+			return nil, fmt.Errorf("unable to stat device node of %s: %w", name, err)
+		}
+
+		//nolint:unconvert // We need the unix.Major/Minor functions to perform the proper bit-shifts
+		device.Major, device.Minor = unix.Major(uint64(stat.Rdev)), unix.Minor(uint64(stat.Rdev))
+
+		devices = append(devices, device)
+	}
+
+	return devices, nil
+}
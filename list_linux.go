@@ -0,0 +1,85 @@
+package mountinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+func (d *Discoverer) listBlockDevices(ctx context.Context, logger sglog.Logger) ([]Device, error) {
+	sysfs, err := d.sysfs()
+	if err != nil {
+		return nil, fmt.Errorf("finding sysfs mountpoint: %w", err)
+	}
+
+	// /sys/block contains a symlink to the device directory of every block device that
+	// isn't a partition (partitions are nested in the directory of their disk)
+	entries, err := fs.ReadDir(sysfs, "block")
+	if err != nil {
+		return nil, fmt.Errorf("listing block devices: %w", err)
+	}
+
+	var devices []Device
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		name := entry.Name()
+
+		// skip partitions, in case sysfs is laid out in the deprecated way
+		// that lists them in /sys/block as well
+		if _, err := readSysfsFile(sysfs, path.Join("block", name, "partition")); err == nil {
+			continue
+		}
+
+		major, minor, err := readSysfsDeviceNumber(sysfs, path.Join("block", name, "dev"))
+		if err != nil {
+			return nil, fmt.Errorf("discovering number of device %q: %w", name, err)
+		}
+
+		device := Device{
+			Name:  name,
+			Major: major,
+			Minor: minor,
+		}
+
+		readSysfsDeviceAttributes(logger, sysfs, name, &device)
+
+		devices = append(devices, device)
+	}
+
+	return devices, nil
+}
+
+// readSysfsDeviceNumber parses the device number in <major>:<minor> format that's stored
+// in the sysfs attribute file at name (example: "block/sda/dev").
+func readSysfsDeviceNumber(sysfs fs.FS, name string) (major, minor uint32, err error) {
+	contents, err := readSysfsFile(sysfs, name)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	majorText, minorText, ok := strings.Cut(strings.TrimSpace(string(contents)), ":")
+	if !ok {
+		return 0, 0, errors.New("readSysfsDeviceNumber: device number isn't in <major>:<minor> format")
+	}
+
+	majorNumber, err := strconv.ParseUint(majorText, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("readSysfsDeviceNumber: malformed major number: %w", err)
+	}
+
+	minorNumber, err := strconv.ParseUint(minorText, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("readSysfsDeviceNumber: malformed minor number: %w", err)
+	}
+
+	return uint32(majorNumber), uint32(minorNumber), nil
+}
@@ -0,0 +1,63 @@
+package mountinfo
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/log/logtest"
+)
+
+func Test_ListBlockDevices(t *testing.T) {
+	// sda is a spinning disk with a partition, nvme0n1 is an SSD, and sdb1 is a partition
+	// that's (deprecatedly) listed in /sys/block
+	sysfs := fstest.MapFS{
+		"block/sda":     symlink("../devices/pci0/block/sda"),
+		"block/sdb1":    symlink("../devices/pci0/block/sdb/sdb1"),
+		"block/nvme0n1": symlink("../devices/pci1/nvme/nvme0/nvme0n1"),
+
+		"devices/pci0/block/sda/dev":              {Data: []byte("8:0\n")},
+		"devices/pci0/block/sda/size":             {Data: []byte("7814037168\n")},
+		"devices/pci0/block/sda/queue/rotational": {Data: []byte("1\n")},
+		"devices/pci0/block/sda/sda1/dev":         {Data: []byte("8:1\n")},
+		"devices/pci0/block/sda/sda1/partition":   {Data: []byte("1\n")},
+
+		"devices/pci0/block/sdb/sdb1/dev":       {Data: []byte("8:17\n")},
+		"devices/pci0/block/sdb/sdb1/partition": {Data: []byte("1\n")},
+
+		"devices/pci1/nvme/nvme0/model":                    {Data: []byte("Samsung SSD 970 EVO Plus 1TB           \n")},
+		"devices/pci1/nvme/nvme0/nvme0n1/dev":              {Data: []byte("259:0\n")},
+		"devices/pci1/nvme/nvme0/nvme0n1/size":             {Data: []byte("1953525168\n")},
+		"devices/pci1/nvme/nvme0/nvme0n1/device":           symlink("../../nvme0"),
+		"devices/pci1/nvme/nvme0/nvme0n1/queue/rotational": {Data: []byte("0\n")},
+	}
+
+	d := NewDiscoverer(WithSysfs(sysfs))
+
+	actual, err := d.ListBlockDevices(logtest.Scoped(t))
+	if err != nil {
+		t.Fatalf("listing block devices: %s", err)
+	}
+
+	expected := []Device{
+		{Name: "nvme0n1", Major: 259, Minor: 0, Model: "Samsung SSD 970 EVO Plus 1TB", Size: 1953525168 * 512},
+		{Name: "sda", Major: 8, Minor: 0, Rotational: true, Size: 7814037168 * 512},
+	}
+
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("recieved unexpected block devices (-want +got):\n%s", diff)
+	}
+
+	// a device without a number can't be described
+	sysfs["block/sdc"] = symlink("../devices/pci0/block/sdc")
+	sysfs["devices/pci0/block/sdc/size"] = &fstest.MapFile{Data: []byte("0\n")}
+
+	if _, err := d.ListBlockDevices(logtest.Scoped(t)); err == nil {
+		t.Fatal("expected error for device without a device number, got nil")
+	}
+
+	if _, err := NewDiscoverer(WithSysfs(fstest.MapFS{"class": {Mode: fs.ModeDir}})).ListBlockDevices(logtest.Scoped(t)); err == nil {
+		t.Fatal("expected error for sysfs without /sys/block, got nil")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !(linux || darwin)
+
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+func (d *Discoverer) listBlockDevices(ctx context.Context, logger sglog.Logger) ([]Device, error) {
+	return nil, fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
@@ -0,0 +1,95 @@
+package mountinfo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// aixLogicalVolume returns the name of the logical volume (example: "hd4") whose special
+// file is source (example: "/dev/hd4").
+//
+// Sources that aren't special files (e.x. NFS exports) wrap ErrNoBlockDevice.
+func aixLogicalVolume(source string) (string, error) {
+	if !strings.HasPrefix(source, "/dev/") {
+		return "", fmt.Errorf("mount source %q isn't a logical volume: %w", source, ErrNoBlockDevice)
+	}
+
+	lv := strings.TrimPrefix(source, "/dev/")
+	if lv == "" || strings.Contains(lv, "/") {
+		return "", fmt.Errorf("mount source %q isn't a logical volume: %w", source, ErrNoBlockDevice)
+	}
+
+	return lv, nil
+}
+
+// parseDfPortable returns the source (example: "/dev/hd4") and mountpoint of the filesystem
+// that's described by the output of `df -P <path>`, example:
+//
+//	Filesystem    512-blocks      Used Available Capacity Mounted on
+//	/dev/hd4         4194304   1234567   2959737      30% /
+func parseDfPortable(output string) (source, mountpoint string, err error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return "", "", errors.New("parseDfPortable: df didn't describe any filesystem")
+	}
+
+	// the mountpoint can contain spaces, but the other columns can't
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 6 {
+		return "", "", errors.New("parseDfPortable: malformed df output")
+	}
+
+	return fields[0], strings.Join(fields[5:], " "), nil
+}
+
+// parseLsfsVFS returns the type of the filesystem mounted at mountpoint, according to the
+// (colon separated) output of `lsfs -c <mountpoint>`, example:
+//
+//	#MountPoint:Device:Vfs:Nodename:Type:Size:Options:AutoMount:Acct
+//	/:/dev/hd4:jfs2::bootfs:4194304:rw:yes:no
+//
+// An empty string is returned if the filesystem isn't listed.
+func parseLsfsVFS(output, mountpoint string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) >= 3 && fields[0] == mountpoint {
+			return fields[2]
+		}
+	}
+
+	return ""
+}
+
+// parseLslvPhysicalVolumes returns the names of the physical volumes (example: "hdisk0") that
+// are listed in the output of `lslv -l <logical volume>`, example:
+//
+//	hd4:/
+//	PV                COPIES        IN BAND       DISTRIBUTION
+//	hdisk0            002:000:000   100%          000:002:000:000:000
+func parseLslvPhysicalVolumes(output string) []string {
+	var names []string
+	inTable := false
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "PV" {
+			inTable = true
+			continue
+		}
+
+		if inTable {
+			names = append(names, fields[0])
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,67 @@
+package mountinfo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_ParseDfPortable(t *testing.T) {
+	output := "Filesystem    512-blocks      Used Available Capacity Mounted on\n" +
+		"/dev/fslv00      2097152    524288   1572864      25% /srv/index data\n"
+
+	source, mountpoint, err := parseDfPortable(output)
+	if err != nil {
+		t.Fatalf("parsing df output: %s", err)
+	}
+
+	if source != "/dev/fslv00" || mountpoint != "/srv/index data" {
+		t.Fatalf("recieved unexpected filesystem (want %q on %q, got %q on %q)", "/dev/fslv00", "/srv/index data", source, mountpoint)
+	}
+
+	if _, _, err := parseDfPortable("Filesystem    512-blocks      Used Available Capacity Mounted on\n"); err == nil {
+		t.Fatal("expected error for df output without filesystems, got nil")
+	}
+}
+
+func Test_ParseLsfsVFS(t *testing.T) {
+	output := "#MountPoint:Device:Vfs:Nodename:Type:Size:Options:AutoMount:Acct\n" +
+		"/:/dev/hd4:jfs2::bootfs:4194304:rw:yes:no\n"
+
+	if fsType := parseLsfsVFS(output, "/"); fsType != "jfs2" {
+		t.Fatalf("recieved unexpected filesystem type (want %q, got %q)", "jfs2", fsType)
+	}
+
+	if fsType := parseLsfsVFS(output, "/home"); fsType != "" {
+		t.Fatalf("expected no filesystem type for unlisted mountpoint, got %q", fsType)
+	}
+}
+
+func Test_ParseLslvPhysicalVolumes(t *testing.T) {
+	output := "datalv:/data\n" +
+		"PV                COPIES        IN BAND       DISTRIBUTION\n" +
+		"hdisk1            064:064:000   100%          000:064:000:000:000\n" +
+		"hdisk2            064:064:000   100%          000:064:000:000:000\n"
+
+	if diff := cmp.Diff([]string{"hdisk1", "hdisk2"}, parseLslvPhysicalVolumes(output)); diff != "" {
+		t.Fatalf("recieved unexpected physical volumes (-want +got):\n%s", diff)
+	}
+}
+
+func Test_AIXLogicalVolume(t *testing.T) {
+	lv, err := aixLogicalVolume("/dev/hd4")
+	if err != nil {
+		t.Fatalf("parsing mount source: %s", err)
+	}
+
+	if lv != "hd4" {
+		t.Fatalf("recieved unexpected logical volume (want %q, got %q)", "hd4", lv)
+	}
+
+	for _, source := range []string{"nfsserver:/export", "/proc", "/dev/"} {
+		if _, err := aixLogicalVolume(source); !errors.Is(err, ErrNoBlockDevice) {
+			t.Errorf("expected error wrapping ErrNoBlockDevice for %q, got %v", source, err)
+		}
+	}
+}
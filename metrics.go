@@ -0,0 +1,100 @@
+package mountinfo
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// cacheHit labels discoveries that were answered by a CachingDiscoverer's cache, or by
+	// the device names that a batch discovery already found for other file paths.
+	cacheHit = "hit"
+
+	// cacheMiss labels discoveries that inspected the system, either because they weren't
+	// cached or because they were made by a Discoverer that doesn't cache.
+	cacheMiss = "miss"
+)
+
+// discoveryMetrics records how long device discoveries take, and how many of them fail.
+type discoveryMetrics struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+// WithMetrics makes the Discoverer record the following metrics with registerer:
+//   - mountinfo_device_discovery_duration_seconds: histogram of how long device discoveries take
+//   - mountinfo_device_discovery_errors_total: number of device discoveries that failed
+//
+// Both metrics have a "backend" label that contains the operating system whose discovery logic
+// was used (example: "linux" for sysfs, "darwin" for diskutil). The histogram also has a "cache"
+// label, which is "hit" for discoveries that were answered by a CachingDiscoverer's cache (or by
+// the devices that a batch discovery, e.x. DiscoverDevices, already found for other file paths
+// on the same filesystem) and "miss" for all others.
+//
+// The same registerer can be passed to multiple Discoverers, in which case they share the
+// metrics. Like prometheus.MustRegister, WithMetrics panics if the metrics can't be registered
+// for any other reason. If registerer is nil, no metrics are recorded.
+func WithMetrics(registerer prometheus.Registerer) Option {
+	return func(d *Discoverer) {
+		if registerer == nil {
+			d.metrics = nil
+			return
+		}
+
+		d.metrics = newDiscoveryMetrics(registerer)
+	}
+}
+
+// newDiscoveryMetrics returns discoveryMetrics that are registered with registerer, reusing
+// the metrics that are already registered with it (e.x. by another Discoverer).
+func newDiscoveryMetrics(registerer prometheus.Registerer) *discoveryMetrics {
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "mountinfo_device_discovery_duration_seconds",
+		Help: "Time spent discovering the block devices that file paths are stored on.",
+
+		// sysfs lookups take microseconds, while diskutil can take several seconds to
+		// answer while an external disk spins up
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"backend", "cache"})
+
+	errs := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mountinfo_device_discovery_errors_total",
+		Help: "The total number of device discoveries that failed.",
+	}, []string{"backend"})
+
+	return &discoveryMetrics{
+		duration: registerCollector(registerer, duration),
+		errors:   registerCollector(registerer, errs),
+	}
+}
+
+// registerCollector registers c with registerer, and returns it. If an equivalent collector
+// is already registered, that one is returned instead.
+func registerCollector[C prometheus.Collector](registerer prometheus.Registerer, c C) C {
+	err := registerer.Register(c)
+	if err == nil {
+		return c
+	}
+
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		if existing, ok := alreadyRegistered.ExistingCollector.(C); ok {
+			return existing
+		}
+	}
+
+	panic(fmt.Sprintf("registering device discovery metrics: %s", err))
+}
+
+// observe records a discovery that started at start, and failed if err isn't nil.
+func (m *discoveryMetrics) observe(cache string, start time.Time, err error) {
+	m.duration.WithLabelValues(runtime.GOOS, cache).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		m.errors.WithLabelValues(runtime.GOOS).Inc()
+	}
+}
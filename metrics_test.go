@@ -0,0 +1,107 @@
+package mountinfo
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	sglog "github.com/sourcegraph/log"
+	"github.com/sourcegraph/log/logtest"
+)
+
+func Test_WithMetrics(t *testing.T) {
+	logger := logtest.Scoped(t)
+	registry := prometheus.NewRegistry()
+
+	d := NewDiscoverer(WithMetrics(registry))
+	d.resolvePath = func(filePath string) (string, error) {
+		return "", errors.New("resolving failed")
+	}
+
+	// failed discoveries are cache misses, and are counted as errors
+	if _, err := d.DiscoverDevice(logger, "/data"); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	if _, err := d.DiscoverDeviceNames(logger, "/data"); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	c := NewCachingDiscoverer(d, time.Minute, 0)
+	c.discoverDevice = func(ctx context.Context, logger sglog.Logger, filePath string) (Device, error) {
+		return Device{Name: "sda"}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.DiscoverDevice(logger, "/data"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	// another Discoverer shares the metrics that are already registered
+	other := NewDiscoverer(WithMetrics(registry))
+	other.resolvePath = d.resolvePath
+
+	if _, err := other.DiscoverDevice(logger, "/data"); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	actual := gatherDiscoveryMetrics(t, registry)
+
+	expected := map[string]map[string]uint64{
+		// the first lookup through the cache is answered by the fake discovery function,
+		// which isn't measured
+		"mountinfo_device_discovery_duration_seconds": {
+			"backend=" + runtime.GOOS + ",cache=hit,":  2,
+			"backend=" + runtime.GOOS + ",cache=miss,": 3,
+		},
+		"mountinfo_device_discovery_errors_total": {
+			"backend=" + runtime.GOOS + ",": 3,
+		},
+	}
+
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("recieved unexpected metrics (-want +got):\n%s", diff)
+	}
+
+	if NewDiscoverer(WithMetrics(nil)).metrics != nil {
+		t.Fatal("expected no metrics to be recorded without a registerer")
+	}
+}
+
+// gatherDiscoveryMetrics returns the sample counts of the histograms and the values of the
+// counters in registry, keyed by metric name and then by label values.
+func gatherDiscoveryMetrics(t *testing.T, registry *prometheus.Registry) map[string]map[string]uint64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %s", err)
+	}
+
+	// metric name -> label values -> count
+	actual := make(map[string]map[string]uint64)
+	for _, family := range families {
+		values := make(map[string]uint64)
+		for _, m := range family.GetMetric() {
+			var labels string
+			for _, label := range m.GetLabel() {
+				labels += label.GetName() + "=" + label.GetValue() + ","
+			}
+
+			if h := m.GetHistogram(); h != nil {
+				values[labels] = h.GetSampleCount()
+			} else {
+				values[labels] = uint64(m.GetCounter().GetValue())
+			}
+		}
+
+		actual[family.GetName()] = values
+	}
+
+	return actual
+}
@@ -0,0 +1,86 @@
+package mountinfo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/moby/sys/mountinfo"
+)
+
+// parseMnttab parses the contents of /etc/mnttab into a list of mounts, skipping the
+// ones that filter discards.
+//
+// Each line of /etc/mnttab describes a single mount with the following tab-separated
+// fields: <special> <mount point> <fstype> <options> <time>. See mnttab(5).
+func parseMnttab(r io.Reader, filter mountinfo.FilterFunc) ([]*mountinfo.Info, error) {
+	var mounts []*mountinfo.Info
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("parseMnttab: malformed line %q", scanner.Text())
+		}
+
+		mount := &mountinfo.Info{
+			Source:     fields[0],
+			Mountpoint: fields[1],
+			FSType:     fields[2],
+		}
+
+		if len(fields) > 3 {
+			mount.VFSOptions = fields[3]
+		}
+
+		if filter != nil {
+			skip, stop := filter(mount)
+			if !skip {
+				mounts = append(mounts, mount)
+			}
+
+			if stop {
+				break
+			}
+
+			continue
+		}
+
+		mounts = append(mounts, mount)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("parseMnttab: %w", err)
+	}
+
+	return mounts, nil
+}
+
+// ctdDiskRegex matches the names of disks (e.x. "c1t0d0" or "c0d0"), optionally followed by
+// a slice (e.x. "s0") or an fdisk partition (e.x. "p1").
+var ctdDiskRegex = regexp.MustCompile(`^(c\d+(?:t[0-9A-Fa-f]+)?d\d+)(?:[sp]\d+)?$`)
+
+// ctdDiskName returns the controller/target/disk name of the disk (example: "c1t0d0") that the
+// filesystem mounted from source (example: "/dev/dsk/c1t0d0s0") is stored on.
+//
+// If source isn't a disk (e.x. ZFS datasets, which can be stored on any number of disks,
+// or tmpfs mounts), the returned error wraps ErrNoBlockDevice.
+func ctdDiskName(source string) (string, error) {
+	device := strings.TrimPrefix(source, "/dev/dsk/")
+	if device == source {
+		return "", fmt.Errorf("ctdDiskName: source %q isn't a disk: %w", source, ErrNoBlockDevice)
+	}
+
+	match := ctdDiskRegex.FindStringSubmatch(device)
+	if match == nil {
+		return "", fmt.Errorf("ctdDiskName: malformed disk name %q", device)
+	}
+
+	return match[1], nil
+}
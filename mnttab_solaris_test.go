@@ -0,0 +1,105 @@
+package mountinfo
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/moby/sys/mountinfo"
+)
+
+func Test_ParseMnttab(t *testing.T) {
+	mnttab := strings.Join([]string{
+		"rpool/ROOT/illumos\t/\tzfs\tdev=4010002\t1700000000",
+		"/devices\t/devices\tdevfs\tdev=8880000\t1700000000",
+		"swap\t/tmp\ttmpfs\txattr,dev=8a40002\t1700000000",
+		"/dev/dsk/c1t0d0s0\t/data\tufs\trw,intr,largefiles,logging,xattr,onerror=panic,dev=840000\t1700000000",
+	}, "\n")
+
+	mounts, err := parseMnttab(strings.NewReader(mnttab), parentsFilter("/data/index"))
+	if err != nil {
+		t.Fatalf("parsing mnttab: %s", err)
+	}
+
+	expected := []*mountinfo.Info{
+		{Source: "rpool/ROOT/illumos", Mountpoint: "/", FSType: "zfs", VFSOptions: "dev=4010002"},
+		{Source: "/dev/dsk/c1t0d0s0", Mountpoint: "/data", FSType: "ufs", VFSOptions: "rw,intr,largefiles,logging,xattr,onerror=panic,dev=840000"},
+	}
+
+	if diff := cmp.Diff(expected, mounts); diff != "" {
+		t.Fatalf("recieved unexpected mounts (-want +got):\n%s", diff)
+	}
+
+	if mount := mostSpecificMount(mounts); mount.Mountpoint != "/data" {
+		t.Fatalf("expected most specific mount to be %q, got %q", "/data", mount.Mountpoint)
+	}
+}
+
+func Test_CtdDiskName(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		source string
+
+		expectedDiskName    string
+		expectError         bool
+		expectNoBlockDevice bool
+	}{
+		{
+			name:             "slice",
+			source:           "/dev/dsk/c1t0d0s0",
+			expectedDiskName: "c1t0d0",
+		},
+		{
+			name:             "fdisk partition",
+			source:           "/dev/dsk/c0d0p1",
+			expectedDiskName: "c0d0",
+		},
+		{
+			name:             "WWN target",
+			source:           "/dev/dsk/c0t5000CCA012345678d0s0",
+			expectedDiskName: "c0t5000CCA012345678d0",
+		},
+		{
+			name:             "whole disk",
+			source:           "/dev/dsk/c2t1d0",
+			expectedDiskName: "c2t1d0",
+		},
+		{
+			name:                "ZFS dataset",
+			source:              "rpool/ROOT/illumos",
+			expectError:         true,
+			expectNoBlockDevice: true,
+		},
+		{
+			name:        "malformed disk name",
+			source:      "/dev/dsk/foo",
+			expectError: true,
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := ctdDiskName(test.source)
+			if test.expectError {
+				if err == nil {
+					t.Fatalf("expected error, got disk name %q", actual)
+				}
+
+				if test.expectNoBlockDevice && !errors.Is(err, ErrNoBlockDevice) {
+					t.Fatalf("expected error wrapping ErrNoBlockDevice, got %s", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if actual != test.expectedDiskName {
+				t.Fatalf("recieved unexpected disk name (want %q, got %q)", test.expectedDiskName, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package mountinfo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/moby/sys/mountinfo"
+)
+
+// standardSysfsMountpoint is the location that sysfs is mounted at on virtually every system.
+const standardSysfsMountpoint = "/sys"
+
+// standardProcfsMountpoint is the location that procfs is mounted at on virtually every system.
+const standardProcfsMountpoint = "/proc"
+
+// findSysfsMountpoint returns the location that the sysfs pseudo-filesystem is mounted at.
+//
+// If sysfs isn't mounted, the returned error wraps ErrSysfsNotMounted.
+func findSysfsMountpoint() (mountpoint string, err error) {
+	// skip parsing the whole mount table in the common case
+	if isSysfsMountpoint(standardSysfsMountpoint) {
+		return standardSysfsMountpoint, nil
+	}
+
+	fsinfo := func(info *mountinfo.Info) (skip, stop bool) {
+		if info.FSType == "sysfs" {
+			return false, true
+		}
+		return true, false
+	}
+	info, err := getMounts(fsinfo)
+	if err != nil {
+		return "", fmt.Errorf("findSysfsMountpoint: %w", procfsError(standardProcfsMountpoint, err))
+	}
+	return sysfsMountpoint(info)
+}
+
+// isSysfsMountpoint returns true if sysfs appears to be mounted at mountpoint, which is
+// the case if it lists the block devices by their device numbers.
+func isSysfsMountpoint(mountpoint string) bool {
+	info, err := os.Stat(filepath.Join(mountpoint, "dev", "block"))
+	return err == nil && info.IsDir()
+}
+
+// sysfsMountpoint returns the location of the first sysfs mount in mounts.
+//
+// If there's no sysfs mount, the returned error wraps ErrSysfsNotMounted.
+func sysfsMountpoint(mounts []*mountinfo.Info) (string, error) {
+	for _, mount := range mounts {
+		if mount.FSType != "sysfs" {
+			continue
+		}
+
+		// the provided sysfs mountpoint could itself be a symlink, so we
+		// resolve it immediately so that future file path
+		// evaluations / massaging doesn't break
+		cleanedPath, err := filepath.EvalSymlinks(filepath.Clean(mount.Mountpoint))
+		if err != nil {
+			return "", fmt.Errorf("findSysfsMountpoint: verifying sysfs mountpoint %q: failed to resolve symlink: %w", mount.Mountpoint, err)
+		}
+
+		return cleanedPath, nil
+	}
+
+	return "", fmt.Errorf("findSysfsMountpoint: %w", ErrSysfsNotMounted)
+}
+
+// FilesystemType returns the type of the filesystem (example: "ext4") that filePath is stored on.
+//
+// If filePath is contained by multiple mounts (e.x. a bind mount inside of an overlay mount), the
+// type of the most specific mount is returned.
+func (d *Discoverer) FilesystemType(filePath string) (string, error) {
+	mount, err := d.findMount(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	return mount.FSType, nil
+}
+
+// FilesystemType calls FilesystemType on a Discoverer that inspects the current system.
+func FilesystemType(filePath string) (string, error) {
+	return defaultDiscoverer.FilesystemType(filePath)
+}
+
+// MountpointForPath returns the mountpoint of the filesystem that filePath is stored on
+// (example: "/data" for "/data/index").
+//
+// filePath is made absolute and has all of its symlinks resolved before it's compared against
+// the mount table. If filePath is contained by multiple mounts (e.x. nested mounts), the
+// mountpoint of the most specific mount is returned. If filePath is itself a mountpoint, it's
+// returned unchanged.
+//
+// On Windows, the root of the volume that filePath is stored on is returned (example: `C:\`).
+func (d *Discoverer) MountpointForPath(filePath string) (string, error) {
+	mount, err := d.findMount(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	return mount.Mountpoint, nil
+}
+
+// MountpointForPath calls MountpointForPath on a Discoverer that inspects the current system.
+func MountpointForPath(filePath string) (string, error) {
+	return defaultDiscoverer.MountpointForPath(filePath)
+}
+
+// Mount describes an entry of the mount table.
+type Mount struct {
+	// ID is the unique ID of the mount, and ParentID is the ID of the mount that it's mounted
+	// on top of (or of the mount itself, for the root of the mount namespace). Together, they
+	// describe the mount tree (see proc(5)).
+	//
+	// ID and ParentID are only populated on Linux, and are zero on all other operating systems.
+	ID       int `json:"id"`
+	ParentID int `json:"parent_id"`
+
+	// Major and Minor are the device number of the mount's filesystem, as reported by the
+	// mount table (only populated on Linux).
+	Major uint32 `json:"major"`
+	Minor uint32 `json:"minor"`
+
+	// Root is the directory of the filesystem that's mounted at Mountpoint (example:
+	// "/exports/data" for a bind mount of that directory, or "/" for the filesystem's root).
+	// It's only populated on Linux.
+	Root string `json:"root"`
+
+	// Mountpoint is the location that the filesystem is mounted at (example: "/data").
+	Mountpoint string `json:"mountpoint"`
+
+	// FSType is the type of the mounted filesystem (example: "ext4").
+	FSType string `json:"fstype"`
+
+	// Source is the filesystem-specific source of the mount (example: "/dev/sda1").
+	Source string `json:"source"`
+
+	// Options are the effective options of the mount (see MountOptions).
+	Options []string `json:"options"`
+}
+
+// MountForPath returns the entry of the mount table for the filesystem that filePath is stored
+// on. Like MountpointForPath, it returns the most specific mount that contains filePath (after
+// resolving its symlinks).
+//
+// Callers can reconstruct the mount tree from the IDs of mounts and their parents, without
+// parsing the mount table themselves.
+func (d *Discoverer) MountForPath(filePath string) (Mount, error) {
+	mount, err := d.findMount(filePath)
+	if err != nil {
+		return Mount{}, err
+	}
+
+	return newMount(mount), nil
+}
+
+// MountForPath calls MountForPath on a Discoverer that inspects the current system.
+func MountForPath(filePath string) (Mount, error) {
+	return defaultDiscoverer.MountForPath(filePath)
+}
+
+// newMount converts an entry of the mount table into a Mount.
+func newMount(mount *mountinfo.Info) Mount {
+	return Mount{
+		ID:         mount.ID,
+		ParentID:   mount.Parent,
+		Major:      uint32(mount.Major),
+		Minor:      uint32(mount.Minor),
+		Root:       mount.Root,
+		Mountpoint: mount.Mountpoint,
+		FSType:     mount.FSType,
+		Source:     mount.Source,
+		Options:    mountOptions(mount),
+	}
+}
+
+// MountOptions returns the options (example: "ro", "noatime", or "nodev") of the mount that
+// filePath is stored on.
+//
+// On Linux, the per-mount options are followed by the options of the filesystem's superblock
+// (example: "errors=remount-ro"). Options that are set on both are only returned once, and the
+// per-mount "ro" / "rw" option takes precedence over the superblock's, since it's the one that
+// decides whether filePath can be written to. If filePath is contained by multiple mounts, the
+// options of the most specific mount are returned.
+//
+// The returned options are empty on operating systems whose mount table doesn't record them.
+func (d *Discoverer) MountOptions(filePath string) ([]string, error) {
+	mount, err := d.findMount(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return mountOptions(mount), nil
+}
+
+// MountOptions calls MountOptions on a Discoverer that inspects the current system.
+func MountOptions(filePath string) ([]string, error) {
+	return defaultDiscoverer.MountOptions(filePath)
+}
+
+// mountOptions returns the effective options of mount, which are its per-mount options
+// followed by the superblock options that they don't already contain or override.
+func mountOptions(mount *mountinfo.Info) []string {
+	options := []string{}
+	seen := make(map[string]struct{})
+
+	add := func(opts string, superblock bool) {
+		for _, opt := range strings.Split(opts, ",") {
+			if opt == "" {
+				continue
+			}
+
+			if _, ok := seen[opt]; ok {
+				continue
+			}
+
+			if superblock && (opt == "ro" || opt == "rw") {
+				// a read-only bind mount of a writable filesystem is read-only, and
+				// vice versa
+				_, ro := seen["ro"]
+				_, rw := seen["rw"]
+				if ro || rw {
+					continue
+				}
+			}
+
+			seen[opt] = struct{}{}
+			options = append(options, opt)
+		}
+	}
+
+	add(mount.Options, false)
+	add(mount.VFSOptions, true)
+
+	return options
+}
+
+// networkFilesystemTypes is the set of filesystem types (as reported by the mount table) that
+// are backed by a remote server instead of a local block device.
+var networkFilesystemTypes = map[string]struct{}{
+	"9p":             {},
+	"afpfs":          {}, // macOS
+	"afs":            {},
+	"ceph":           {},
+	"cifs":           {},
+	"coda":           {},
+	"fuse.ceph":      {},
+	"fuse.glusterfs": {},
+	"fuse.s3fs":      {},
+	"fuse.sshfs":     {},
+	"glusterfs":      {},
+	"lustre":         {},
+	"ncpfs":          {},
+	"nfs":            {},
+	"nfs4":           {},
+	"smb3":           {},
+	"smbfs":          {}, // macOS, BSDs
+	"webdav":         {}, // macOS
+}
+
+// IsNetworkFilesystem returns true if filePath is stored on a network filesystem
+// (example: NFS, CIFS, or sshfs), which isn't backed by a local block device.
+//
+// Callers can use this to skip device discovery for such paths, since
+// it'll either fail or return a device name that isn't meaningful.
+func (d *Discoverer) IsNetworkFilesystem(filePath string) (bool, error) {
+	fsType, err := d.FilesystemType(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	return isNetworkFilesystemType(fsType), nil
+}
+
+// IsNetworkFilesystem calls IsNetworkFilesystem on a Discoverer that inspects the current system.
+func IsNetworkFilesystem(filePath string) (bool, error) {
+	return defaultDiscoverer.IsNetworkFilesystem(filePath)
+}
+
+// isNetworkFilesystemType returns true if fsType is the type of a network filesystem.
+func isNetworkFilesystemType(fsType string) bool {
+	_, ok := networkFilesystemTypes[fsType]
+	return ok
+}
+
+// parentsFilter returns a filter that discards all mounts whose mountpoints
+// aren't either equal to filePath or one of its parent directories.
+//
+// Unlike mountinfo.ParentsFilter, parentsFilter treats mountpoints as paths
+// instead of partial prefixes ("/data" isn't a parent of "/database").
+func parentsFilter(filePath string) mountinfo.FilterFunc {
+	return func(m *mountinfo.Info) (skip, stop bool) {
+		return !isSubpath(m.Mountpoint, filePath), false
+	}
+}
+
+// isSubpath returns true if filePath is equal to parent, or is located underneath it.
+func isSubpath(parent, filePath string) bool {
+	if parent == filePath {
+		return true
+	}
+
+	parent = strings.TrimSuffix(parent, string(filepath.Separator)) + string(filepath.Separator)
+	return strings.HasPrefix(filePath, parent)
+}
+
+// mostSpecificMount returns the mount with the longest mountpoint out of the
+// provided mounts, or nil if there are none.
+//
+// If multiple mounts share the same mountpoint, the last one in the mount table wins,
+// since it's the one that shadows all of the others.
+func mostSpecificMount(mounts []*mountinfo.Info) *mountinfo.Info {
+	var mount *mountinfo.Info
+	for _, m := range mounts {
+		if mount == nil || len(m.Mountpoint) >= len(mount.Mountpoint) {
+			mount = m
+		}
+	}
+
+	return mount
+}
@@ -0,0 +1,101 @@
+package mountinfo
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ResolveMountSource returns the kernel name of the whole disk (as listed in /sys/block, example:
+// "sda") that the provided device spec refers to, which is useful for validating entries of
+// /etc/fstab (or of other configuration) against the devices of the current system.
+//
+// The spec can either be a device node (example: "/dev/sda1", or a symlink to one such as
+// "/dev/mapper/vg0-data"), or a tag that udev creates a symlink in /dev/disk for: "UUID=<uuid>",
+// "LABEL=<label>", "PARTUUID=<uuid>", or "PARTLABEL=<label>" (the value can be quoted). Partitions
+// resolve to the disk that they're part of, but virtual block devices (e.x. "dm-0" for
+// "/dev/mapper/vg0-data") aren't followed down to the devices that back them, since they're
+// listed in /sys/block themselves.
+//
+// If the spec refers to a device that doesn't exist, the returned error wraps fs.ErrNotExist.
+// Like DeviceName, ResolveMountSource discards all of the logs that discovery produces.
+//
+// This operation is currently only supported on Linux. On all other operating systems, the
+// returned error wraps ErrUnsupportedPlatform.
+func (d *Discoverer) ResolveMountSource(spec string) (string, error) {
+	nodePath, err := deviceSpecNodePath(spec)
+	if err != nil {
+		return "", fmt.Errorf("ResolveMountSource: %w", err)
+	}
+
+	name, err := d.resolveDeviceNode(nodePath)
+	if err != nil {
+		return "", fmt.Errorf("ResolveMountSource: %w", err)
+	}
+
+	return name, nil
+}
+
+// ResolveMountSource calls ResolveMountSource on a Discoverer that inspects the current system.
+func ResolveMountSource(spec string) (string, error) {
+	return defaultDiscoverer.ResolveMountSource(spec)
+}
+
+// deviceSpecTagDirs maps the tags that device specs can use to the directories in /dev/disk
+// that udev creates the symlinks for them in.
+var deviceSpecTagDirs = map[string]string{
+	"UUID":      "by-uuid",
+	"LABEL":     "by-label",
+	"PARTUUID":  "by-partuuid",
+	"PARTLABEL": "by-partlabel",
+}
+
+// deviceSpecNodePath returns the location of the device node (or of the udev symlink to it) that
+// the provided device spec refers to (example: "/dev/disk/by-uuid/<uuid>" for "UUID=<uuid>").
+func deviceSpecNodePath(spec string) (string, error) {
+	spec = strings.TrimSpace(spec)
+
+	if strings.HasPrefix(spec, "/dev/") {
+		return spec, nil
+	}
+
+	tag, value, ok := strings.Cut(spec, "=")
+	if !ok {
+		return "", fmt.Errorf("deviceSpecNodePath: %q is neither a device node nor a tag (e.x. UUID=<uuid>)", spec)
+	}
+
+	dir, ok := deviceSpecTagDirs[tag]
+	if !ok {
+		return "", fmt.Errorf("deviceSpecNodePath: unsupported tag %q in %q", tag, spec)
+	}
+
+	value = strings.Trim(value, `"'`)
+	if value == "" || value == "." || value == ".." {
+		return "", fmt.Errorf("deviceSpecNodePath: invalid value for tag %q in %q", tag, spec)
+	}
+
+	return path.Join("/dev", "disk", dir, udevEscape(value)), nil
+}
+
+// udevEscape escapes value like udev does for the names of the symlinks that it creates in
+// /dev/disk: bytes that aren't allowed in them (e.x. "/" and whitespace) are replaced by a
+// "\x<hex>" escape sequence (example: "my\x20disk" for "my disk").
+func udevEscape(value string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', strings.IndexByte("#+-.:=@_", c) >= 0:
+			b.WriteByte(c)
+		case c >= 0x80:
+			// udev keeps valid UTF-8 sequences as they are
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,52 @@
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	sglog "github.com/sourcegraph/log"
+	"golang.org/x/sys/unix"
+)
+
+// resolveDeviceNode returns the kernel name of the whole disk that the device node at nodePath
+// (or that the symlink at nodePath points to) is part of.
+func (d *Discoverer) resolveDeviceNode(nodePath string) (string, error) {
+	major, minor, err := deviceNodeNumber(nodePath)
+	if err != nil {
+		return "", err
+	}
+
+	sysfs, err := d.sysfs()
+	if err != nil {
+		return "", fmt.Errorf("finding sysfs mountpoint: %w", err)
+	}
+
+	devicePath, err := discoverSysfsDevicePath(sysfs, fmt.Sprintf("%d:%d", major, minor))
+	if err != nil {
+		return "", fmt.Errorf("discovering device path: %w", err)
+	}
+
+	return getDeviceBlockName(context.Background(), sglog.NoOp(), sysfs, devicePath)
+}
+
+// deviceNodeNumber returns the major and minor numbers of the block device whose device node
+// is at nodePath (or is pointed to by the symlink at nodePath).
+func deviceNodeNumber(nodePath string) (major, minor uint32, err error) {
+	resolvedPath, err := filepath.EvalSymlinks(nodePath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("deviceNodeNumber: %w", err)
+	}
+
+	var stat unix.Stat_t
+	if err := unix.Stat(resolvedPath, &stat); err != nil {
+		return 0, 0, fmt.Errorf("deviceNodeNumber: stat %q: %w", resolvedPath, err)
+	}
+
+	if stat.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return 0, 0, fmt.Errorf("deviceNodeNumber: %q isn't a block device", resolvedPath)
+	}
+
+	//nolint:unconvert // We need the unix.Major/Minor functions to perform the proper bit-shifts
+	return unix.Major(uint64(stat.Rdev)), unix.Minor(uint64(stat.Rdev)), nil
+}
@@ -0,0 +1,19 @@
+package mountinfo
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func Test_ResolveMountSource_Missing(t *testing.T) {
+	if _, err := ResolveMountSource("UUID=00000000-0000-0000-0000-000000000000"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected error wrapping fs.ErrNotExist, got %v", err)
+	}
+}
+
+func Test_ResolveMountSource_NotBlockDevice(t *testing.T) {
+	if _, err := ResolveMountSource("/dev/null"); err == nil {
+		t.Fatal("expected error for character device /dev/null")
+	}
+}
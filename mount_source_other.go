@@ -0,0 +1,12 @@
+//go:build !linux
+
+package mountinfo
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func (d *Discoverer) resolveDeviceNode(nodePath string) (string, error) {
+	return "", fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
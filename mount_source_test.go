@@ -0,0 +1,51 @@
+package mountinfo
+
+import (
+	"testing"
+)
+
+func Test_DeviceSpecNodePath(t *testing.T) {
+	for _, test := range []struct {
+		spec     string
+		expected string
+	}{
+		{spec: "/dev/sda1", expected: "/dev/sda1"},
+		{spec: " /dev/mapper/vg0-data\n", expected: "/dev/mapper/vg0-data"},
+		{spec: "UUID=0a3407de-014b-458b-b5c1-848e92a327a3", expected: "/dev/disk/by-uuid/0a3407de-014b-458b-b5c1-848e92a327a3"},
+		{spec: `UUID="0a3407de-014b-458b-b5c1-848e92a327a3"`, expected: "/dev/disk/by-uuid/0a3407de-014b-458b-b5c1-848e92a327a3"},
+		{spec: "LABEL=data", expected: "/dev/disk/by-label/data"},
+		{spec: "LABEL='my disk'", expected: `/dev/disk/by-label/my\x20disk`},
+		{spec: "LABEL=a/b", expected: `/dev/disk/by-label/a\x2fb`},
+		{spec: "PARTUUID=6c4e7d5a-01", expected: "/dev/disk/by-partuuid/6c4e7d5a-01"},
+		{spec: "PARTLABEL=EFI system partition", expected: `/dev/disk/by-partlabel/EFI\x20system\x20partition`},
+	} {
+		test := test
+
+		t.Run(test.spec, func(t *testing.T) {
+			actual, err := deviceSpecNodePath(test.spec)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if actual != test.expected {
+				t.Errorf("recieved unexpected node path (want %q, got %q)", test.expected, actual)
+			}
+		})
+	}
+}
+
+func Test_DeviceSpecNodePath_Invalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"sda1",
+		"proc",
+		"ID=1234",
+		"UUID=",
+		`LABEL=""`,
+		"LABEL=..",
+	} {
+		if _, err := deviceSpecNodePath(spec); err == nil {
+			t.Errorf("expected error for spec %q", spec)
+		}
+	}
+}
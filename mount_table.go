@@ -0,0 +1,86 @@
+//go:build !(windows || netbsd || solaris || aix)
+
+package mountinfo
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/moby/sys/mountinfo"
+)
+
+// mountLookup returns the functions that d looks mounts up with, unless it's configured otherwise.
+func (d *Discoverer) mountLookup() (
+	func(filePath string) (*mountinfo.Info, error),
+	func() (func(filePath string) (*mountinfo.Info, error), error),
+) {
+	return findMount, findMountSnapshot
+}
+
+// findMount returns the most specific mount that contains filePath.
+func findMount(filePath string) (*mountinfo.Info, error) {
+	resolvedPath, err := resolveFilePath(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("findMount: %w", err)
+	}
+
+	mounts, err := getMounts(parentsFilter(resolvedPath))
+	if err != nil {
+		return nil, fmt.Errorf("findMount: %w", procfsError(standardProcfsMountpoint, err))
+	}
+
+	mount := mostSpecificMount(mounts)
+	if mount == nil {
+		return nil, errors.New("findMount: no mountpoint found")
+	}
+
+	return mount, nil
+}
+
+// findMountSnapshot reads the mount table once, and returns a function that behaves like
+// findMount, but looks mounts up in that snapshot of the mount table instead of re-reading it.
+func findMountSnapshot() (func(filePath string) (*mountinfo.Info, error), error) {
+	mounts, err := getMounts(nil)
+	if err != nil {
+		return nil, fmt.Errorf("findMountSnapshot: %w", procfsError(standardProcfsMountpoint, err))
+	}
+
+	return findMountIn(mounts), nil
+}
+
+// listMounts returns all of the mounts in the mount table.
+func listMounts() ([]*mountinfo.Info, error) {
+	mounts, err := getMounts(nil)
+	if err != nil {
+		return nil, fmt.Errorf("listMounts: %w", procfsError(standardProcfsMountpoint, err))
+	}
+
+	return mounts, nil
+}
+
+// findMountIn returns a function that behaves like findMount, but looks mounts up in
+// the provided mount table.
+func findMountIn(mounts []*mountinfo.Info) func(filePath string) (*mountinfo.Info, error) {
+	return func(filePath string) (*mountinfo.Info, error) {
+		resolvedPath, err := resolveFilePath(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("findMount: %w", err)
+		}
+
+		var parents []*mountinfo.Info
+		filter := parentsFilter(resolvedPath)
+
+		for _, mount := range mounts {
+			if skip, _ := filter(mount); !skip {
+				parents = append(parents, mount)
+			}
+		}
+
+		mount := mostSpecificMount(parents)
+		if mount == nil {
+			return nil, errors.New("findMount: no mountpoint found")
+		}
+
+		return mount, nil
+	}
+}
@@ -0,0 +1,29 @@
+//go:build windows || netbsd || solaris
+
+package mountinfo
+
+import (
+	"fmt"
+
+	"github.com/moby/sys/mountinfo"
+)
+
+// mountLookup returns the functions that d looks mounts up with, unless it's configured otherwise.
+func (d *Discoverer) mountLookup() (
+	func(filePath string) (*mountinfo.Info, error),
+	func() (func(filePath string) (*mountinfo.Info, error), error),
+) {
+	return findMount, findMountSnapshot
+}
+
+// findMountSnapshot returns findMount, since there's no mount table that
+// github.com/moby/sys/mountinfo can read on this operating system.
+func findMountSnapshot() (func(filePath string) (*mountinfo.Info, error), error) {
+	return findMount, nil
+}
+
+// listMounts returns an error that wraps ErrUnsupportedPlatform, since there's no mount
+// table that github.com/moby/sys/mountinfo can read on this operating system.
+func listMounts() ([]*mountinfo.Info, error) {
+	return nil, fmt.Errorf("listMounts: %w", ErrUnsupportedPlatform)
+}
@@ -0,0 +1,240 @@
+package mountinfo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/moby/sys/mountinfo"
+)
+
+func Test_MostSpecificMount(t *testing.T) {
+	// a mount table (in mount order) for a container with an overlay root filesystem
+	mounts := []*mountinfo.Info{
+		{ID: 1, Mountpoint: "/", FSType: "overlay"},
+		{ID: 2, Mountpoint: "/data", FSType: "ext4"},
+		{ID: 3, Mountpoint: "/data/index", FSType: "xfs"},
+		{ID: 4, Mountpoint: "/database", FSType: "btrfs"},
+		{ID: 5, Mountpoint: "/tmp", FSType: "ext4"},
+		{ID: 6, Mountpoint: "/tmp", FSType: "tmpfs"},                     // shadows the previous /tmp mount
+		{ID: 7, Mountpoint: "/srv/index", Root: "/index", FSType: "xfs"}, // bind mount of /data/index
+	}
+
+	for _, test := range []struct {
+		name     string
+		filePath string
+
+		expectedMountID int
+	}{
+		{
+			name:            "root filesystem",
+			filePath:        "/etc/hosts",
+			expectedMountID: 1,
+		},
+		{
+			name:            "path is a mountpoint",
+			filePath:        "/data",
+			expectedMountID: 2,
+		},
+		{
+			name:            "nested mount",
+			filePath:        "/data/index/shard",
+			expectedMountID: 3,
+		},
+		{
+			name:            "mountpoint that shares a prefix with another mountpoint",
+			filePath:        "/database/table",
+			expectedMountID: 4,
+		},
+		{
+			name:            "shadowed mount",
+			filePath:        "/tmp/file",
+			expectedMountID: 6,
+		},
+		{
+			name:            "bind mount",
+			filePath:        "/srv/index/shard",
+			expectedMountID: 7,
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			var parents []*mountinfo.Info
+
+			filter := parentsFilter(test.filePath)
+			for _, m := range mounts {
+				if skip, _ := filter(m); !skip {
+					parents = append(parents, m)
+				}
+			}
+
+			mount := mostSpecificMount(parents)
+			if mount == nil {
+				t.Fatalf("no mount found for %q", test.filePath)
+			}
+
+			if diff := cmp.Diff(test.expectedMountID, mount.ID); diff != "" {
+				t.Fatalf("recieved unexpected mount (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_MountOptions(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		mount *mountinfo.Info
+
+		expected []string
+	}{
+		{
+			name:     "per-mount and superblock options",
+			mount:    &mountinfo.Info{Options: "rw,nodev,noatime", VFSOptions: "rw,errors=remount-ro"},
+			expected: []string{"rw", "nodev", "noatime", "errors=remount-ro"},
+		},
+		{
+			name:     "read-only bind mount of a writable filesystem",
+			mount:    &mountinfo.Info{Options: "ro,relatime", VFSOptions: "rw,seclabel"},
+			expected: []string{"ro", "relatime", "seclabel"},
+		},
+		{
+			name:     "superblock options only",
+			mount:    &mountinfo.Info{VFSOptions: "ro,size=1024k"},
+			expected: []string{"ro", "size=1024k"},
+		},
+		{
+			name:     "no options",
+			mount:    &mountinfo.Info{},
+			expected: []string{},
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			actual := mountOptions(test.mount)
+			if diff := cmp.Diff(test.expected, actual); diff != "" {
+				t.Fatalf("recieved unexpected mount options (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_MountForPath(t *testing.T) {
+	d := NewDiscoverer()
+	d.findMount = func(filePath string) (*mountinfo.Info, error) {
+		return &mountinfo.Info{
+			ID:         42,
+			Parent:     21,
+			Major:      8,
+			Minor:      17,
+			Root:       "/exports/data",
+			Mountpoint: "/data",
+			Options:    "rw,relatime",
+			FSType:     "xfs",
+			Source:     "/dev/sdb1",
+			VFSOptions: "rw,inode64",
+		}, nil
+	}
+
+	mount, err := d.MountForPath("/data/index")
+	if err != nil {
+		t.Fatalf("finding mount: %s", err)
+	}
+
+	expected := Mount{
+		ID:         42,
+		ParentID:   21,
+		Major:      8,
+		Minor:      17,
+		Root:       "/exports/data",
+		Mountpoint: "/data",
+		FSType:     "xfs",
+		Source:     "/dev/sdb1",
+		Options:    []string{"rw", "relatime", "inode64"},
+	}
+
+	if diff := cmp.Diff(expected, mount); diff != "" {
+		t.Fatalf("recieved unexpected mount (-want +got):\n%s", diff)
+	}
+}
+
+func Test_IsNetworkFilesystemType(t *testing.T) {
+	for fsType, expected := range map[string]bool{
+		"nfs":        true,
+		"nfs4":       true,
+		"cifs":       true,
+		"smb3":       true,
+		"fuse.sshfs": true,
+		"9p":         true,
+		"ext4":       false,
+		"xfs":        false,
+		"btrfs":      false,
+		"tmpfs":      false,
+		"overlay":    false,
+		"fuse":       false,
+		"apfs":       false,
+	} {
+		if actual := isNetworkFilesystemType(fsType); actual != expected {
+			t.Errorf("isNetworkFilesystemType(%q): expected %t, got %t", fsType, expected, actual)
+		}
+	}
+}
+
+func Test_SysfsMountpoint(t *testing.T) {
+	// sysfs can be mounted at a nonstandard location
+	dir := t.TempDir()
+
+	mounts := []*mountinfo.Info{
+		{Mountpoint: "/", FSType: "ext4"},
+		{Mountpoint: dir, FSType: "sysfs"},
+	}
+
+	mountpoint, err := sysfsMountpoint(mounts)
+	if err != nil {
+		t.Fatalf("finding sysfs mountpoint: %s", err)
+	}
+
+	if mountpoint != dir {
+		t.Fatalf("recieved unexpected mountpoint (want %q, got %q)", dir, mountpoint)
+	}
+
+	for _, mounts := range [][]*mountinfo.Info{nil, mounts[:1]} {
+		if _, err := sysfsMountpoint(mounts); !errors.Is(err, ErrSysfsNotMounted) {
+			t.Fatalf("expected error wrapping ErrSysfsNotMounted, got %v", err)
+		}
+	}
+}
+
+func Test_IsSysfsMountpoint(t *testing.T) {
+	sysfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(sysfs, "dev", "block"), 0755); err != nil {
+		t.Fatalf("creating fake sysfs: %s", err)
+	}
+
+	if !isSysfsMountpoint(sysfs) {
+		t.Errorf("expected %q to be detected as a sysfs mountpoint", sysfs)
+	}
+
+	// a directory that doesn't list block devices (e.x. an empty /sys in a container that
+	// mounts sysfs elsewhere) requires the mount table to be read
+	empty := t.TempDir()
+	if isSysfsMountpoint(empty) {
+		t.Errorf("expected %q not to be detected as a sysfs mountpoint", empty)
+	}
+
+	notDir := filepath.Join(t.TempDir(), "sys")
+	if err := os.MkdirAll(filepath.Join(notDir, "dev"), 0755); err != nil {
+		t.Fatalf("creating fake sysfs: %s", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(notDir, "dev", "block"), nil, 0644); err != nil {
+		t.Fatalf("creating fake sysfs: %s", err)
+	}
+
+	if isSysfsMountpoint(notDir) {
+		t.Errorf("expected %q not to be detected as a sysfs mountpoint", notDir)
+	}
+}
@@ -0,0 +1,26 @@
+package mountinfo
+
+import (
+	"io/fs"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+// DiscoverDeviceFromMountinfo returns information about the block device that filePath is
+// stored on, according to a captured mount table and sysfs instead of the ones of the
+// current system.
+//
+// mountTable must have the format of /proc/<pid>/mountinfo, and sysfs must correspond to the
+// sysfs pseudo-filesystem of the same system (see WithSysfs for its requirements). This allows
+// discovery to run against data that was captured on another host (e.x. a customer-submitted
+// dump that reproduces a bug).
+//
+// filePath must be absolute. It isn't inspected on the current system, so its symlinks aren't
+// resolved, and it's only looked up in mountTable: the device number of its filesystem is taken
+// from the mount that contains it.
+//
+// This operation is currently only supported on Linux. On all other operating systems, the
+// returned error wraps ErrUnsupportedPlatform.
+func DiscoverDeviceFromMountinfo(logger sglog.Logger, mountTable string, sysfs fs.FS, filePath string) (Device, error) {
+	return discoverDeviceFromMountinfo(logger, mountTable, sysfs, filePath)
+}
@@ -0,0 +1,79 @@
+package mountinfo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/moby/sys/mountinfo"
+	sglog "github.com/sourcegraph/log"
+)
+
+// discoverDeviceFromMountinfo discovers the device that filePath is stored on with a Discoverer
+// that only inspects the captured mount table and sysfs.
+func discoverDeviceFromMountinfo(logger sglog.Logger, mountTable string, sysfs fs.FS, filePath string) (Device, error) {
+	mounts, err := mountinfo.GetMountsFromReader(strings.NewReader(mountTable), nil)
+	if err != nil {
+		return Device{}, fmt.Errorf("DiscoverDeviceFromMountinfo: parsing mount table: %w", err)
+	}
+
+	if !filepath.IsAbs(filePath) {
+		return Device{}, fmt.Errorf("DiscoverDeviceFromMountinfo: file path %q isn't absolute", filePath)
+	}
+
+	d := NewDiscoverer(WithSysfs(sysfs)).withCapturedMountTable(mounts)
+
+	return d.DiscoverDevice(logger, filePath)
+}
+
+// withCapturedMountTable returns a Discoverer that shares the configuration of d, but looks
+// file paths up in a captured mount table instead of inspecting them on the current system.
+// The device number of a file path is taken from the mount that contains it.
+func (d *Discoverer) withCapturedMountTable(mounts []*mountinfo.Info) *Discoverer {
+	findMount := capturedMountLookup(mounts)
+
+	captured := d.withFindMount(findMount)
+	captured.resolvePath = func(filePath string) (string, error) {
+		return filepath.Clean(filePath), nil
+	}
+	captured.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+		mount, err := findMount(filePath)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		return uint32(mount.Major), uint32(mount.Minor), nil
+	}
+	captured.findMountSnapshot = func() (func(filePath string) (*mountinfo.Info, error), error) {
+		return findMount, nil
+	}
+	captured.listMounts = func() ([]*mountinfo.Info, error) {
+		return mounts, nil
+	}
+
+	return captured
+}
+
+// capturedMountLookup returns a function that behaves like findMount, but looks mounts up in
+// a captured mount table without inspecting the file paths on the current system.
+func capturedMountLookup(mounts []*mountinfo.Info) func(filePath string) (*mountinfo.Info, error) {
+	return func(filePath string) (*mountinfo.Info, error) {
+		var parents []*mountinfo.Info
+
+		filter := parentsFilter(filepath.Clean(filePath))
+		for _, mount := range mounts {
+			if skip, _ := filter(mount); !skip {
+				parents = append(parents, mount)
+			}
+		}
+
+		mount := mostSpecificMount(parents)
+		if mount == nil {
+			return nil, errors.New("findMount: no mountpoint found")
+		}
+
+		return mount, nil
+	}
+}
@@ -0,0 +1,56 @@
+package mountinfo
+
+import (
+	"testing"
+
+	"github.com/sourcegraph/log/logtest"
+)
+
+func Test_DiscoverDeviceFromMountinfo(t *testing.T) {
+	// the mount table of a machine whose root filesystem is stored on a network block device
+	// (see nbdSysfs)
+	mountTable := "" +
+		"25 1 43:1 / / rw,relatime shared:1 - ext4 /dev/nbd0p1 rw\n" +
+		"26 25 0:5 / /dev rw,nosuid shared:2 - devtmpfs devtmpfs rw,size=4096k\n" +
+		"27 25 254:1 / /scratch rw,relatime shared:3 - xfs /dev/vda1 rw\n" +
+		"28 25 254:1 /cache /var/cache rw,relatime shared:3 - xfs /dev/vda1 rw\n"
+
+	sysfs := nbdSysfs()
+
+	for _, test := range []struct {
+		filePath string
+
+		expectedName       string
+		expectedMountpoint string
+	}{
+		{filePath: "/home/user", expectedName: "nbd0", expectedMountpoint: "/"},
+		{filePath: "/scratch/tmp", expectedName: "vda", expectedMountpoint: "/scratch"},
+		{filePath: "/var/cache/apt", expectedName: "vda", expectedMountpoint: "/var/cache"},
+		{filePath: "/var/lib/../../scratch", expectedName: "vda", expectedMountpoint: "/scratch"},
+	} {
+		device, err := DiscoverDeviceFromMountinfo(logtest.Scoped(t), mountTable, sysfs, test.filePath)
+		if err != nil {
+			t.Fatalf("discovering device of %q: %s", test.filePath, err)
+		}
+
+		if device.Name != test.expectedName || device.Mountpoint != test.expectedMountpoint {
+			t.Errorf("recieved unexpected device for %q (want %q mounted at %q, got %q mounted at %q)",
+				test.filePath, test.expectedName, test.expectedMountpoint, device.Name, device.Mountpoint)
+		}
+	}
+
+	// file paths on filesystems that aren't backed by a block device, relative file paths,
+	// and malformed mount tables are rejected
+	for _, test := range []struct {
+		mountTable string
+		filePath   string
+	}{
+		{mountTable: mountTable, filePath: "/dev/null"},
+		{mountTable: mountTable, filePath: "home/user"},
+		{mountTable: "not a mount table\n", filePath: "/home/user"},
+	} {
+		if device, err := DiscoverDeviceFromMountinfo(logtest.Scoped(t), test.mountTable, sysfs, test.filePath); err == nil {
+			t.Errorf("expected error for %q, got device %q", test.filePath, device.Name)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package mountinfo
+
+import (
+	"fmt"
+	"io/fs"
+	"runtime"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+func discoverDeviceFromMountinfo(logger sglog.Logger, mountTable string, sysfs fs.FS, filePath string) (Device, error) {
+	return Device{}, fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
@@ -0,0 +1,126 @@
+// Package mountinfotest provides a fake implementation of mountinfo.DeviceDiscoverer, so that code
+// which discovers devices can be tested without inspecting the devices of the current system.
+package mountinfotest
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sync"
+
+	sglog "github.com/sourcegraph/log"
+
+	"github.com/sourcegraph/mountinfo"
+)
+
+// Fake is a mountinfo.DeviceDiscoverer that returns preloaded results for each file path.
+//
+// File paths are matched exactly (they aren't resolved like mountinfo.Discoverer does). Discovering
+// the device of a file path that doesn't have a result fails with an error that wraps fs.ErrNotExist.
+//
+// A Fake is safe for concurrent use by multiple goroutines.
+type Fake struct {
+	// mu protects devices, names, and errs
+	mu sync.Mutex
+
+	devices map[string]mountinfo.Device
+	names   map[string][]string
+	errs    map[string]error
+}
+
+var _ mountinfo.DeviceDiscoverer = (*Fake)(nil)
+
+// NewFake returns a Fake without any results.
+func NewFake() *Fake {
+	return &Fake{
+		devices: make(map[string]mountinfo.Device),
+		names:   make(map[string][]string),
+		errs:    make(map[string]error),
+	}
+}
+
+// SetDevice makes filePath resolve to device. DiscoverDeviceNames returns device's name,
+// unless other names have been set with SetDeviceNames.
+func (f *Fake) SetDevice(filePath string, device mountinfo.Device) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.devices[filePath] = device
+	delete(f.errs, filePath)
+}
+
+// SetDeviceNames makes DiscoverDeviceNames return names for filePath (example: the member
+// disks of a RAID array). If no device has been set for filePath, the first name is used as
+// the name of its device.
+func (f *Fake) SetDeviceNames(filePath string, names ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.names[filePath] = append([]string(nil), names...)
+	delete(f.errs, filePath)
+}
+
+// SetError makes discovering the device of filePath fail with err.
+func (f *Fake) SetError(filePath string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.errs[filePath] = err
+}
+
+// DiscoverDevice returns the device that has been set for filePath.
+func (f *Fake) DiscoverDevice(logger sglog.Logger, filePath string) (mountinfo.Device, error) {
+	return f.DiscoverDeviceContext(context.Background(), logger, filePath)
+}
+
+// DiscoverDeviceContext returns the device that has been set for filePath, unless ctx is done.
+func (f *Fake) DiscoverDeviceContext(ctx context.Context, logger sglog.Logger, filePath string) (mountinfo.Device, error) {
+	if err := ctx.Err(); err != nil {
+		return mountinfo.Device{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err, ok := f.errs[filePath]; ok {
+		return mountinfo.Device{}, err
+	}
+
+	if device, ok := f.devices[filePath]; ok {
+		return device, nil
+	}
+
+	if names, ok := f.names[filePath]; ok && len(names) > 0 {
+		return mountinfo.Device{Name: names[0]}, nil
+	}
+
+	return mountinfo.Device{}, fmt.Errorf("mountinfotest: no device has been set for %q: %w", filePath, fs.ErrNotExist)
+}
+
+// DiscoverDeviceNames returns the names that have been set for filePath.
+func (f *Fake) DiscoverDeviceNames(logger sglog.Logger, filePath string) ([]string, error) {
+	device, err := f.DiscoverDevice(logger, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if names, ok := f.names[filePath]; ok {
+		return append([]string(nil), names...), nil
+	}
+
+	return []string{device.Name}, nil
+}
+
+// DiscoverDeviceNameContext returns the name of the device that has been set for filePath,
+// unless ctx is done.
+func (f *Fake) DiscoverDeviceNameContext(ctx context.Context, logger sglog.Logger, filePath string) (string, error) {
+	device, err := f.DiscoverDeviceContext(ctx, logger, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	return device.Name, nil
+}
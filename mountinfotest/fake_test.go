@@ -0,0 +1,65 @@
+package mountinfotest
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/log/logtest"
+
+	"github.com/sourcegraph/mountinfo"
+)
+
+func Test_Fake(t *testing.T) {
+	logger := logtest.Scoped(t)
+	injected := errors.New("injected")
+
+	f := NewFake()
+	f.SetDevice("/data", mountinfo.Device{Name: "sda", Mountpoint: "/data", FSType: "ext4"})
+	f.SetDeviceNames("/raid", "sdb", "sdc")
+	f.SetError("/broken", injected)
+
+	device, err := f.DiscoverDevice(logger, "/data")
+	if err != nil {
+		t.Fatalf("discovering device: %s", err)
+	}
+
+	if diff := cmp.Diff(mountinfo.Device{Name: "sda", Mountpoint: "/data", FSType: "ext4"}, device); diff != "" {
+		t.Fatalf("recieved unexpected device (-want +got):\n%s", diff)
+	}
+
+	names, err := f.DiscoverDeviceNames(logger, "/raid")
+	if err != nil {
+		t.Fatalf("discovering device names: %s", err)
+	}
+
+	if diff := cmp.Diff([]string{"sdb", "sdc"}, names); diff != "" {
+		t.Fatalf("recieved unexpected device names (-want +got):\n%s", diff)
+	}
+
+	name, err := f.DiscoverDeviceNameContext(context.Background(), logger, "/raid")
+	if err != nil {
+		t.Fatalf("discovering device name: %s", err)
+	}
+
+	if name != "sdb" {
+		t.Fatalf("recieved unexpected device name (want %q, got %q)", "sdb", name)
+	}
+
+	if _, err := f.DiscoverDeviceNames(logger, "/broken"); !errors.Is(err, injected) {
+		t.Fatalf("expected injected error, got %v", err)
+	}
+
+	if _, err := f.DiscoverDevice(logger, "/unknown"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected error wrapping fs.ErrNotExist, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := f.DiscoverDeviceNameContext(ctx, logger, "/data"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected error wrapping context.Canceled, got %v", err)
+	}
+}
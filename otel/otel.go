@@ -0,0 +1,180 @@
+// Package otel reports the IO statistics of the block devices that back a set of file paths
+// through OpenTelemetry instruments.
+//
+// It lives in its own module so that users of the Prometheus collectors in the parent package
+// don't have to depend on OpenTelemetry.
+package otel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	sglog "github.com/sourcegraph/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/sourcegraph/mountinfo"
+)
+
+// RegisterDeviceMetrics registers instruments on meter that report IO statistics for the block
+// devices backing each of the requested file paths:
+//   - system.disk.io (By): number of bytes transferred, with "device" and "direction" ("read" or
+//     "write") attributes
+//   - system.disk.io_time (s): number of seconds that the device spent doing IO, with a "device"
+//     attribute
+//   - mountinfo.discovery.errors ({error}): number of times that the devices backing a file path
+//     couldn't be discovered, with a "path" attribute
+//
+// The block devices backing each file path are re-discovered on every collection. Failing to
+// discover them doesn't fail registration (or collection), and is recorded by the
+// mountinfo.discovery.errors instrument instead.
+//
+// Statistics are currently only reported on Linux-based operating systems (see
+// mountinfo.ReadDiskStats). The returned registration can be used to unregister the instruments'
+// callback.
+func RegisterDeviceMetrics(logger sglog.Logger, meter metric.Meter, paths []string) (metric.Registration, error) {
+	return registerDeviceMetrics(logger, meter, mountinfo.ReadDiskStats, mountinfo.DiscoverDeviceNames, paths)
+}
+
+func registerDeviceMetrics(
+	logger sglog.Logger,
+	meter metric.Meter,
+	readDiskStats func() (map[string]mountinfo.DiskStats, error),
+	discoverDeviceNames func(logger sglog.Logger, filePath string) ([]string, error),
+	paths []string,
+) (metric.Registration, error) {
+	ioBytes, err := meter.Int64ObservableCounter("system.disk.io",
+		metric.WithUnit("By"),
+		metric.WithDescription("The number of bytes transferred to and from the device."),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("RegisterDeviceMetrics: %w", err)
+	}
+
+	ioTime, err := meter.Float64ObservableCounter("system.disk.io_time",
+		metric.WithUnit("s"),
+		metric.WithDescription("The number of seconds that the device spent doing IO."),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("RegisterDeviceMetrics: %w", err)
+	}
+
+	discoveryErrors, err := meter.Int64ObservableCounter("mountinfo.discovery.errors",
+		metric.WithUnit("{error}"),
+		metric.WithDescription("The number of times that the devices backing a file path couldn't be discovered."),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("RegisterDeviceMetrics: %w", err)
+	}
+
+	c := &deviceCollector{
+		logger:              logger.Scoped("otelDeviceCollector"),
+		readDiskStats:       readDiskStats,
+		discoverDeviceNames: discoverDeviceNames,
+		paths:               paths,
+
+		ioBytes:         ioBytes,
+		ioTime:          ioTime,
+		discoveryErrors: discoveryErrors,
+		errorCounts:     make(map[string]int64),
+	}
+
+	// report a zero value for every file path, so that the first failure is visible as an increase
+	for _, filePath := range paths {
+		c.errorCounts[filePath] = 0
+	}
+
+	registration, err := meter.RegisterCallback(c.observe, ioBytes, ioTime, discoveryErrors)
+	if err != nil {
+		return nil, fmt.Errorf("RegisterDeviceMetrics: %w", err)
+	}
+
+	return registration, nil
+}
+
+type deviceCollector struct {
+	logger              sglog.Logger
+	readDiskStats       func() (map[string]mountinfo.DiskStats, error)
+	discoverDeviceNames func(logger sglog.Logger, filePath string) ([]string, error)
+	paths               []string
+
+	ioBytes         metric.Int64ObservableCounter
+	ioTime          metric.Float64ObservableCounter
+	discoveryErrors metric.Int64ObservableCounter
+
+	// mu protects errorCounts
+	mu sync.Mutex
+
+	// errorCounts is the total number of failed discoveries for each file path
+	errorCounts map[string]int64
+}
+
+func (c *deviceCollector) observe(ctx context.Context, o metric.Observer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	defer func() {
+		for filePath, count := range c.errorCounts {
+			o.ObserveInt64(c.discoveryErrors, count, metric.WithAttributes(attribute.String("path", filePath)))
+		}
+	}()
+
+	stats, err := c.readDiskStats()
+	if err != nil {
+		if !errors.Is(err, mountinfo.ErrUnsupportedPlatform) {
+			c.logger.Warn("skipping collection",
+				sglog.String("reason", "failed to read disk statistics"),
+				sglog.Error(err),
+			)
+		}
+
+		return nil
+	}
+
+	seen := make(map[string]struct{})
+
+	for _, filePath := range c.paths {
+		discoveryLogger := c.logger.Scoped("deviceNameDiscovery").With(
+			sglog.String("path", filePath),
+		)
+
+		devices, err := c.discoverDeviceNames(discoveryLogger, filePath)
+		if err != nil {
+			discoveryLogger.Warn("skipping metric collection",
+				sglog.String("reason", "failed to discover device names"),
+				sglog.Error(err),
+			)
+
+			c.errorCounts[filePath]++
+			continue
+		}
+
+		for _, device := range devices {
+			if _, ok := seen[device]; ok {
+				continue
+			}
+
+			seen[device] = struct{}{}
+
+			s, ok := stats[device]
+			if !ok {
+				discoveryLogger.Warn("skipping metric collection",
+					sglog.String("reason", "device not found in disk statistics"),
+					sglog.String("device", device),
+				)
+
+				continue
+			}
+
+			deviceAttribute := attribute.String("device", device)
+
+			o.ObserveInt64(c.ioBytes, int64(s.BytesRead()), metric.WithAttributes(deviceAttribute, attribute.String("direction", "read")))
+			o.ObserveInt64(c.ioBytes, int64(s.BytesWritten()), metric.WithAttributes(deviceAttribute, attribute.String("direction", "write")))
+			o.ObserveFloat64(c.ioTime, s.IOTime.Seconds(), metric.WithAttributes(deviceAttribute))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	sglog "github.com/sourcegraph/log"
+	"github.com/sourcegraph/log/logtest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+
+	"github.com/sourcegraph/mountinfo"
+)
+
+func Test_RegisterDeviceMetrics(t *testing.T) {
+	meter := &recordingMeter{}
+
+	readDiskStats := func() (map[string]mountinfo.DiskStats, error) {
+		return map[string]mountinfo.DiskStats{
+			"sda": {SectorsRead: 2, SectorsWritten: 4, IOTime: 1500 * time.Millisecond},
+			"sdb": {SectorsRead: 8, SectorsWritten: 16, IOTime: 3 * time.Second},
+		}, nil
+	}
+
+	// both paths are stored on the RAID array of sda and sdb, and the third one is missing
+	discoverDeviceNames := func(logger sglog.Logger, filePath string) ([]string, error) {
+		if filePath == "/missing" {
+			return nil, errors.New("no such file or directory")
+		}
+
+		return []string{"sda", "sdb"}, nil
+	}
+
+	_, err := registerDeviceMetrics(logtest.Scoped(t), meter, readDiskStats, discoverDeviceNames, []string{"/data/index", "/data/repos", "/missing"})
+	if err != nil {
+		t.Fatalf("registering metrics: %s", err)
+	}
+
+	observer := &recordingObserver{values: make(map[string]float64)}
+	for i := 0; i < 2; i++ {
+		if err := meter.callback(context.Background(), observer); err != nil {
+			t.Fatalf("collecting metrics: %s", err)
+		}
+	}
+
+	expected := map[string]float64{
+		"system.disk.io{device=sda,direction=read}":    1024,
+		"system.disk.io{device=sda,direction=write}":   2048,
+		"system.disk.io{device=sdb,direction=read}":    4096,
+		"system.disk.io{device=sdb,direction=write}":   8192,
+		"system.disk.io_time{device=sda}":              1.5,
+		"system.disk.io_time{device=sdb}":              3,
+		"mountinfo.discovery.errors{path=/data/index}": 0,
+		"mountinfo.discovery.errors{path=/data/repos}": 0,
+		"mountinfo.discovery.errors{path=/missing}":    2,
+	}
+
+	if diff := cmp.Diff(expected, observer.values); diff != "" {
+		t.Fatalf("recieved unexpected metrics (-want +got):\n%s", diff)
+	}
+}
+
+// recordingMeter is a metric.Meter that keeps track of the callback that's registered on it.
+type recordingMeter struct {
+	noop.Meter
+
+	callback metric.Callback
+}
+
+func (m *recordingMeter) Int64ObservableCounter(name string, _ ...metric.Int64ObservableCounterOption) (metric.Int64ObservableCounter, error) {
+	return int64Counter{name: name}, nil
+}
+
+func (m *recordingMeter) Float64ObservableCounter(name string, _ ...metric.Float64ObservableCounterOption) (metric.Float64ObservableCounter, error) {
+	return float64Counter{name: name}, nil
+}
+
+func (m *recordingMeter) RegisterCallback(callback metric.Callback, _ ...metric.Observable) (metric.Registration, error) {
+	m.callback = callback
+	return noop.Registration{}, nil
+}
+
+type int64Counter struct {
+	noop.Int64ObservableCounter
+
+	name string
+}
+
+type float64Counter struct {
+	noop.Float64ObservableCounter
+
+	name string
+}
+
+// recordingObserver is a metric.Observer that keeps the last value observed for each instrument
+// and set of attributes, keyed by "<instrument>{<attribute>=<value>,...}".
+type recordingObserver struct {
+	noop.Observer
+
+	values map[string]float64
+}
+
+func (o *recordingObserver) ObserveInt64(instrument metric.Int64Observable, value int64, opts ...metric.ObserveOption) {
+	o.values[observationKey(instrument.(int64Counter).name, opts)] = float64(value)
+}
+
+func (o *recordingObserver) ObserveFloat64(instrument metric.Float64Observable, value float64, opts ...metric.ObserveOption) {
+	o.values[observationKey(instrument.(float64Counter).name, opts)] = value
+}
+
+func observationKey(name string, opts []metric.ObserveOption) string {
+	attributes := metric.NewObserveConfig(opts).Attributes()
+
+	return name + "{" + attributes.Encoded(attribute.DefaultEncoder()) + "}"
+}
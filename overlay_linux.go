@@ -0,0 +1,91 @@
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/moby/sys/mountinfo"
+	sglog "github.com/sourcegraph/log"
+)
+
+// discoverOverlayDeviceNames returns the names of the block devices that back the upper
+// directory of the provided overlay mount, which is where all writes to the mount land.
+//
+// The upper directory is a path in the mount namespace that the overlay was created in, so
+// discovery only succeeds if that path is visible to the current process (e.x. it fails inside
+// of containers whose root filesystem is an overlay created by the container runtime).
+func (d *Discoverer) discoverOverlayDeviceNames(ctx context.Context, logger sglog.Logger, sysfs fs.FS, mount *mountinfo.Info) ([]string, error) {
+	upperdir, ok, err := overlayUpperdir(mount.VFSOptions)
+	if err != nil {
+		return nil, fmt.Errorf("parsing options of overlay mounted at %q: %w", mount.Mountpoint, err)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("overlay mounted at %q: %w", mount.Mountpoint, ErrOverlayWithoutUpperdir)
+	}
+
+	logger.Debug("discovered overlay upper directory",
+		sglog.String("mountpoint", mount.Mountpoint),
+		sglog.String("upperdir", upperdir),
+	)
+
+	_, _, names, err := d.discoverFileDeviceNames(ctx, logger, sysfs, upperdir)
+	if err != nil {
+		return nil, fmt.Errorf("discovering devices of overlay upper directory %q: %w", upperdir, err)
+	}
+
+	return names, nil
+}
+
+// overlayUpperdir returns the value of the "upperdir" option in the provided (comma separated)
+// super block options of an overlay mount. ok is false if there's no such option, which is the
+// case for read-only overlays.
+func overlayUpperdir(options string) (upperdir string, ok bool, err error) {
+	for _, option := range strings.Split(options, ",") {
+		if !strings.HasPrefix(option, "upperdir=") {
+			continue
+		}
+
+		upperdir, err := unescapeMountOption(strings.TrimPrefix(option, "upperdir="))
+		if err != nil {
+			return "", false, fmt.Errorf("overlayUpperdir: %w", err)
+		}
+
+		return upperdir, upperdir != "", nil
+	}
+
+	return "", false, nil
+}
+
+// unescapeMountOption replaces the octal escape sequences (e.x. "\054" for ",") that the kernel
+// uses for special characters in mount options with the characters that they represent.
+func unescapeMountOption(value string) (string, error) {
+	if !strings.Contains(value, `\`) {
+		return value, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			b.WriteByte(value[i])
+			continue
+		}
+
+		if i+4 > len(value) {
+			return "", fmt.Errorf("unescapeMountOption: truncated escape sequence in %q", value)
+		}
+
+		c, err := strconv.ParseUint(value[i+1:i+4], 8, 8)
+		if err != nil {
+			return "", fmt.Errorf("unescapeMountOption: malformed escape sequence %q in %q", value[i:i+4], value)
+		}
+
+		b.WriteByte(byte(c))
+		i += 3
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,95 @@
+package mountinfo
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/moby/sys/mountinfo"
+	"github.com/sourcegraph/log/logtest"
+)
+
+func Test_DiscoverDeviceNames_Overlay(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"class/block":                           {Mode: fs.ModeDir},
+		"dev/block/8:1":                         symlink("../../devices/pci0/block/sda/sda1"),
+		"devices/pci0/block/sda/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sda/sda1/partition": {Data: []byte("1\n")},
+	}
+
+	for _, test := range []struct {
+		name    string
+		options string
+
+		expectedDeviceNames []string
+		expectedError       error
+	}{
+		{
+			name:                "upperdir",
+			options:             "rw,lowerdir=/var/lib/docker/overlay2/l/ABC:/var/lib/docker/overlay2/l/DEF,upperdir=/var/lib/docker/overlay2/123/diff,workdir=/var/lib/docker/overlay2/123/work",
+			expectedDeviceNames: []string{"sda"},
+		},
+		{
+			name:          "read-only overlay",
+			options:       "ro,lowerdir=/lower1:/lower2",
+			expectedError: ErrOverlayWithoutUpperdir,
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			d := NewDiscoverer(WithSysfs(sysfs))
+			d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+				if filePath == "/var/lib/docker/overlay2/123/diff" {
+					return 8, 1, nil
+				}
+
+				// overlays have anonymous device numbers
+				return 0, 50, nil
+			}
+			d.findMount = func(filePath string) (*mountinfo.Info, error) {
+				return &mountinfo.Info{Mountpoint: "/", FSType: "overlay", Source: "overlay", VFSOptions: test.options}, nil
+			}
+
+			actualDeviceNames, err := d.DiscoverDeviceNames(logtest.Scoped(t), "/app")
+			if test.expectedError != nil {
+				if !errors.Is(err, test.expectedError) {
+					t.Fatalf("expected error wrapping %q, got %v (device names %q)", test.expectedError, err, actualDeviceNames)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("discovering device names: %s", err)
+			}
+
+			if diff := cmp.Diff(test.expectedDeviceNames, actualDeviceNames); diff != "" {
+				t.Fatalf("recieved unexpected device names (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_OverlayUpperdir(t *testing.T) {
+	for options, expected := range map[string]string{
+		"rw,lowerdir=/l,upperdir=/u,workdir=/w":           "/u",
+		`rw,lowerdir=/l,upperdir=/a\054b\040c,workdir=/w`: "/a,b c",
+		"ro,lowerdir=/l1:/l2":                             "",
+	} {
+		actual, _, err := overlayUpperdir(options)
+		if err != nil {
+			t.Fatalf("parsing options %q: %s", options, err)
+		}
+
+		if actual != expected {
+			t.Errorf("recieved unexpected upperdir for options %q (want %q, got %q)", options, expected, actual)
+		}
+	}
+
+	if _, _, err := overlayUpperdir(`upperdir=/u\05`); err == nil {
+		t.Fatal("expected error for truncated escape sequence, got nil")
+	}
+}
@@ -0,0 +1,34 @@
+package mountinfo
+
+import "regexp"
+
+var (
+	// letterDiskPartitionRegex matches the names of partitions of disks whose names end with
+	// letters (e.x. "sda1", "hdb2", "vdc3", or "xvda1"), where the partition number is appended
+	// directly to the disk's name.
+	letterDiskPartitionRegex = regexp.MustCompile(`^((?:s|h|v|xv)d[a-z]+)\d+$`)
+
+	// numberedDiskPartitionRegex matches the names of partitions of disks whose names end with
+	// a number (e.x. "nvme0n1p6", "mmcblk0p2", or "loop0p1"), where the partition number is
+	// separated from the disk's name by a "p".
+	numberedDiskPartitionRegex = regexp.MustCompile(`^([a-z]+(?:\d+[a-z]+)*\d+)p\d+$`)
+)
+
+// baseDiskName returns the name of the disk (example: "sda") that the partition with the
+// provided name (example: "sda1") is part of. If name isn't the name of a partition, it's
+// returned unchanged.
+//
+// The following naming conventions are supported:
+//   - sd, hd, vd, and xvd disks: "sda1" -> "sda"
+//   - NVMe namespaces: "nvme0n1p6" -> "nvme0n1"
+//   - MMC/SD cards: "mmcblk0p2" -> "mmcblk0"
+//   - loop devices (and all other disks whose names end with a number): "loop0p1" -> "loop0"
+func baseDiskName(name string) string {
+	for _, regex := range []*regexp.Regexp{letterDiskPartitionRegex, numberedDiskPartitionRegex} {
+		if match := regex.FindStringSubmatch(name); match != nil {
+			return match[1]
+		}
+	}
+
+	return name
+}
@@ -0,0 +1,49 @@
+package mountinfo
+
+import "testing"
+
+func Test_BaseDiskName(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		expected string
+	}{
+		// SCSI / SATA disks
+		{name: "sda", expected: "sda"},
+		{name: "sda1", expected: "sda"},
+		{name: "sdab12", expected: "sdab"},
+
+		// IDE disks
+		{name: "hda", expected: "hda"},
+		{name: "hdb2", expected: "hdb"},
+
+		// virtio disks
+		{name: "vda", expected: "vda"},
+		{name: "vdc3", expected: "vdc"},
+
+		// Xen disks
+		{name: "xvda1", expected: "xvda"},
+
+		// NVMe namespaces
+		{name: "nvme0n1", expected: "nvme0n1"},
+		{name: "nvme0n1p6", expected: "nvme0n1"},
+		{name: "nvme12n3p10", expected: "nvme12n3"},
+
+		// MMC/SD cards
+		{name: "mmcblk0", expected: "mmcblk0"},
+		{name: "mmcblk0p2", expected: "mmcblk0"},
+		{name: "mmcblk0boot0", expected: "mmcblk0boot0"},
+
+		// loop devices
+		{name: "loop0", expected: "loop0"},
+		{name: "loop7p1", expected: "loop7"},
+
+		// devices that are never partitions
+		{name: "md0", expected: "md0"},
+		{name: "dm-0", expected: "dm-0"},
+		{name: "nbd0p1", expected: "nbd0"},
+	} {
+		if actual := baseDiskName(test.name); actual != test.expected {
+			t.Errorf("recieved unexpected base disk name for %q (want %q, got %q)", test.name, test.expected, actual)
+		}
+	}
+}
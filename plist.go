@@ -0,0 +1,174 @@
+package mountinfo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// decodePlist decodes an XML property list (like the ones that are printed by
+// `diskutil info -plist` and `diskutil list -plist`) into the following Go values:
+//   - dict: map[string]interface{}
+//   - array: []interface{}
+//   - string, date: string
+//   - integer: int64
+//   - real: float64
+//   - true, false: bool
+//   - data: []byte
+func decodePlist(data []byte) (interface{}, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, errors.New("decodePlist: no value found")
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("decodePlist: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local == "plist" {
+			continue
+		}
+
+		value, err := decodePlistValue(decoder, start)
+		if err != nil {
+			return nil, fmt.Errorf("decodePlist: %w", err)
+		}
+
+		return value, nil
+	}
+}
+
+// decodePlistDict decodes an XML property list whose top-level value is a dictionary.
+func decodePlistDict(data []byte) (map[string]interface{}, error) {
+	value, err := decodePlist(data)
+	if err != nil {
+		return nil, err
+	}
+
+	dict, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("decodePlistDict: top-level value is a %T, not a dictionary", value)
+	}
+
+	return dict, nil
+}
+
+// decodePlistValue decodes the value that starts with the provided element.
+func decodePlistValue(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := make(map[string]interface{})
+		var key string
+
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			switch token := token.(type) {
+			case xml.EndElement:
+				return dict, nil
+
+			case xml.StartElement:
+				if token.Name.Local == "key" {
+					if err := decoder.DecodeElement(&key, &token); err != nil {
+						return nil, err
+					}
+
+					continue
+				}
+
+				value, err := decodePlistValue(decoder, token)
+				if err != nil {
+					return nil, err
+				}
+
+				dict[key] = value
+			}
+		}
+
+	case "array":
+		array := []interface{}{}
+
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			switch token := token.(type) {
+			case xml.EndElement:
+				return array, nil
+
+			case xml.StartElement:
+				value, err := decodePlistValue(decoder, token)
+				if err != nil {
+					return nil, err
+				}
+
+				array = append(array, value)
+			}
+		}
+
+	case "true", "false":
+		if err := decoder.Skip(); err != nil {
+			return nil, err
+		}
+
+		return start.Name.Local == "true", nil
+	}
+
+	var text string
+	if err := decoder.DecodeElement(&text, &start); err != nil {
+		return nil, err
+	}
+
+	switch start.Name.Local {
+	case "string", "date":
+		return text, nil
+
+	case "integer":
+		value, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed integer %q: %w", text, err)
+		}
+
+		return value, nil
+
+	case "real":
+		value, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed real %q: %w", text, err)
+		}
+
+		return value, nil
+
+	case "data":
+		// base64 encoded data can be split over multiple (indented) lines
+		value, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+		if err != nil {
+			return nil, fmt.Errorf("malformed data: %w", err)
+		}
+
+		return value, nil
+	}
+
+	return nil, fmt.Errorf("unknown element %q", start.Name.Local)
+}
+
+// plistString returns the string value of key in dict, or an empty string if
+// there's no such key or its value isn't a string.
+func plistString(dict map[string]interface{}, key string) string {
+	value, _ := dict[key].(string)
+	return value
+}
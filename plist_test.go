@@ -0,0 +1,84 @@
+package mountinfo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_DecodePlist(t *testing.T) {
+	// output of `diskutil info -plist disk3s1s1` (abbreviated) on an Apple Silicon Mac
+	data, err := os.ReadFile(filepath.Join("testdata", "diskutil-info.plist"))
+	if err != nil {
+		t.Fatalf("reading plist fixture: %s", err)
+	}
+
+	dict, err := decodePlistDict(data)
+	if err != nil {
+		t.Fatalf("decoding plist: %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"APFSContainerReference": "disk3",
+		"APFSPhysicalStores": []interface{}{
+			map[string]interface{}{"APFSPhysicalStore": "disk0s2"},
+		},
+		"Bootable":         true,
+		"BusProtocol":      "Apple Fabric",
+		"DeviceBlockSize":  int64(4096),
+		"DeviceIdentifier": "disk3s1s1",
+		"DeviceNode":       "/dev/disk3s1s1",
+		"Ejectable":        false,
+		"FilesystemType":   "apfs",
+		"MediaName":        "",
+		"MountPoint":       "/",
+		"ParentWholeDisk":  "disk3",
+		"Size":             int64(494384795648),
+		"SolidState":       true,
+		"VolumeName":       "Macintosh HD",
+	}
+
+	if diff := cmp.Diff(expected, dict); diff != "" {
+		t.Fatalf("recieved unexpected values (-want +got):\n%s", diff)
+	}
+}
+
+func Test_DecodePlist_Values(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		plist    string
+		expected interface{}
+	}{
+		{name: "string", plist: `<plist><string>disk0</string></plist>`, expected: "disk0"},
+		{name: "integer", plist: `<plist><integer>-42</integer></plist>`, expected: int64(-42)},
+		{name: "real", plist: `<plist><real>1.5</real></plist>`, expected: 1.5},
+		{name: "data", plist: "<plist><data>\n\taGVs\n\tbG8=\n</data></plist>", expected: []byte("hello")},
+		{name: "empty array", plist: `<plist><array/></plist>`, expected: []interface{}{}},
+		{name: "empty dict", plist: `<plist><dict/></plist>`, expected: map[string]interface{}{}},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := decodePlist([]byte(test.plist))
+			if err != nil {
+				t.Fatalf("decoding plist: %s", err)
+			}
+
+			if diff := cmp.Diff(test.expected, actual); diff != "" {
+				t.Fatalf("recieved unexpected value (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	for _, plist := range []string{
+		"Could not find disk: disk9",
+		`<plist><integer>twelve</integer></plist>`,
+		`<plist><dict><key>unterminated</key>`,
+	} {
+		if _, err := decodePlist([]byte(plist)); err == nil {
+			t.Errorf("expected error for %q, got nil", plist)
+		}
+	}
+}
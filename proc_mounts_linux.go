@@ -0,0 +1,119 @@
+package mountinfo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/moby/sys/mountinfo"
+	"go.uber.org/multierr"
+)
+
+// getMounts returns the mounts in the mount table of the current process that filter doesn't
+// skip, like mountinfo.GetMounts.
+func getMounts(filter mountinfo.FilterFunc) ([]*mountinfo.Info, error) {
+	return readProcMountTable(filepath.Join(standardProcfsMountpoint, "self"), filter)
+}
+
+// readProcMountTable returns the mounts in the mount table of the process whose procfs
+// directory is procDir (example: "/proc/self") that filter doesn't skip.
+//
+// The mount table is read from procDir/mountinfo. If that file doesn't exist (on kernels older
+// than 2.6.26) or can't be read (e.x. because of a security policy), it's read from
+// procDir/mounts instead, which doesn't record the IDs, device numbers, and roots of mounts.
+// Those are left empty, so discovery stats the file paths that are stored on the mounts to find
+// their device numbers.
+func readProcMountTable(procDir string, filter mountinfo.FilterFunc) ([]*mountinfo.Info, error) {
+	f, err := os.Open(filepath.Join(procDir, "mountinfo"))
+	if err == nil {
+		defer f.Close()
+
+		return mountinfo.GetMountsFromReader(f, filter)
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, fs.ErrPermission) {
+		return nil, err
+	}
+
+	mounts, mountsErr := readProcMounts(filepath.Join(procDir, "mounts"), filter)
+	if mountsErr != nil {
+		return nil, multierr.Combine(err, mountsErr)
+	}
+
+	return mounts, nil
+}
+
+// readProcMounts returns the mounts in the mount table at mountsPath (which has the format of
+// /proc/mounts) that filter doesn't skip.
+func readProcMounts(mountsPath string, filter mountinfo.FilterFunc) ([]*mountinfo.Info, error) {
+	f, err := os.Open(mountsPath)
+	if err != nil {
+		return nil, fmt.Errorf("readProcMounts: %w", err)
+	}
+
+	defer f.Close()
+
+	return parseProcMounts(f, filter)
+}
+
+// parseProcMounts parses the mount table in r (which has the format of /proc/mounts), and returns
+// the mounts that filter doesn't skip.
+//
+// Each line describes a mount as "<source> <mountpoint> <fstype> <options> <dump> <pass>". The
+// options combine the per-mount and superblock options, so they're all returned as Options.
+func parseProcMounts(r io.Reader, filter mountinfo.FilterFunc) ([]*mountinfo.Info, error) {
+	var mounts []*mountinfo.Info
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("parseProcMounts: malformed line %q", scanner.Text())
+		}
+
+		source, err := unescapeMountOption(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("parseProcMounts: source: %w", err)
+		}
+
+		mountpoint, err := unescapeMountOption(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("parseProcMounts: mountpoint: %w", err)
+		}
+
+		mount := &mountinfo.Info{
+			Source:     source,
+			Mountpoint: mountpoint,
+			FSType:     fields[2],
+			Options:    fields[3],
+		}
+
+		var skip, stop bool
+		if filter != nil {
+			skip, stop = filter(mount)
+		}
+
+		if !skip {
+			mounts = append(mounts, mount)
+		}
+
+		if stop {
+			break
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("parseProcMounts: %w", err)
+	}
+
+	return mounts, nil
+}
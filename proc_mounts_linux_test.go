@@ -0,0 +1,97 @@
+package mountinfo
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/moby/sys/mountinfo"
+)
+
+func Test_ParseProcMounts(t *testing.T) {
+	mountTable := "/dev/vda1 / ext4 rw,relatime,errors=remount-ro 0 0\n" +
+		"\n" +
+		"/dev/sdb1 /mnt/my\\040data xfs rw,noatime,inode64 0 0\n" +
+		"server:/export /mnt/nfs nfs4 rw,vers=4.2 0 0\n"
+
+	mounts, err := parseProcMounts(strings.NewReader(mountTable), nil)
+	if err != nil {
+		t.Fatalf("parsing mount table: %s", err)
+	}
+
+	expected := []*mountinfo.Info{
+		{Source: "/dev/vda1", Mountpoint: "/", FSType: "ext4", Options: "rw,relatime,errors=remount-ro"},
+		{Source: "/dev/sdb1", Mountpoint: "/mnt/my data", FSType: "xfs", Options: "rw,noatime,inode64"},
+		{Source: "server:/export", Mountpoint: "/mnt/nfs", FSType: "nfs4", Options: "rw,vers=4.2"},
+	}
+
+	if diff := cmp.Diff(expected, mounts); diff != "" {
+		t.Fatalf("recieved unexpected mounts (-want +got):\n%s", diff)
+	}
+
+	// the filter is applied like it is for mountinfo
+	mounts, err = parseProcMounts(strings.NewReader(mountTable), mountinfo.FSTypeFilter("xfs"))
+	if err != nil {
+		t.Fatalf("parsing mount table: %s", err)
+	}
+
+	if len(mounts) != 1 || mounts[0].Mountpoint != "/mnt/my data" {
+		t.Fatalf("expected only the xfs mount, got %+v", mounts)
+	}
+
+	if _, err := parseProcMounts(strings.NewReader("/dev/vda1 /\n"), nil); err == nil {
+		t.Fatal("expected error for malformed line, got nil")
+	}
+}
+
+func Test_ReadProcMountTable_Fallback(t *testing.T) {
+	// a procfs directory that only has the old-style mount table
+	procDir := t.TempDir()
+	mountTable := "/dev/sdb1 /data xfs rw,relatime 0 0\n"
+
+	if err := os.WriteFile(filepath.Join(procDir, "mounts"), []byte(mountTable), 0644); err != nil {
+		t.Fatalf("writing mount table: %s", err)
+	}
+
+	mounts, err := readProcMountTable(procDir, nil)
+	if err != nil {
+		t.Fatalf("reading mount table: %s", err)
+	}
+
+	// the mountpoint isn't stat'ed, so discovery stats the file path instead
+	expected := []*mountinfo.Info{{Source: "/dev/sdb1", Mountpoint: "/data", FSType: "xfs", Options: "rw,relatime"}}
+	if diff := cmp.Diff(expected, mounts); diff != "" {
+		t.Fatalf("recieved unexpected mounts (-want +got):\n%s", diff)
+	}
+
+	// mountinfo is preferred once it exists
+	mountinfoTable := "42 21 8:17 / /data rw,relatime shared:2 - xfs /dev/sdb1 rw\n"
+	if err := os.WriteFile(filepath.Join(procDir, "mountinfo"), []byte(mountinfoTable), 0644); err != nil {
+		t.Fatalf("writing mount table: %s", err)
+	}
+
+	mounts, err = readProcMountTable(procDir, nil)
+	if err != nil {
+		t.Fatalf("reading mount table: %s", err)
+	}
+
+	if len(mounts) != 1 || mounts[0].ID != 42 || mounts[0].Major != 8 || mounts[0].Minor != 17 {
+		t.Fatalf("expected the mount from mountinfo, got %+v", mounts)
+	}
+
+	// without either mount table, the errors of both are reported
+	_, err = readProcMountTable(t.TempDir(), nil)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected error for missing mount tables, got %v", err)
+	}
+
+	for _, name := range []string{"mountinfo", "mounts"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("expected error to mention %q, got %q", name, err)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package mountinfo
+
+import "github.com/moby/sys/mountinfo"
+
+// getMounts returns the mounts in the mount table that filter doesn't skip, like
+// mountinfo.GetMounts. There's no /proc/mounts to fall back to on this operating system.
+func getMounts(filter mountinfo.FilterFunc) ([]*mountinfo.Info, error) {
+	return mountinfo.GetMounts(filter)
+}
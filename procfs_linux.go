@@ -0,0 +1,76 @@
+package mountinfo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/moby/sys/mountinfo"
+)
+
+// procfsMountTable returns functions that behave like findMount, findMountSnapshot, and listMounts, but read
+// the mount table of the initial process (PID 1) from the procfs pseudo-filesystem that's mounted
+// at mountpoint.
+func (d *Discoverer) procfsMountTable(mountpoint string) (
+	findMount func(filePath string) (*mountinfo.Info, error),
+	findMountSnapshot func() (func(filePath string) (*mountinfo.Info, error), error),
+	listMounts func() ([]*mountinfo.Info, error),
+) {
+	readMounts := func() ([]*mountinfo.Info, error) {
+		mounts, err := readProcMountTable(filepath.Join(mountpoint, "1"), nil)
+		if err != nil {
+			return nil, procfsError(mountpoint, err)
+		}
+
+		return mounts, nil
+	}
+
+	findMount = func(filePath string) (*mountinfo.Info, error) {
+		mounts, err := readMounts()
+		if err != nil {
+			return nil, fmt.Errorf("findMount: %w", err)
+		}
+
+		return findMountIn(mounts)(filePath)
+	}
+
+	findMountSnapshot = func() (func(filePath string) (*mountinfo.Info, error), error) {
+		mounts, err := readMounts()
+		if err != nil {
+			return nil, fmt.Errorf("findMountSnapshot: %w", err)
+		}
+
+		return findMountIn(mounts), nil
+	}
+
+	listMounts = func() ([]*mountinfo.Info, error) {
+		mounts, err := readMounts()
+		if err != nil {
+			return nil, fmt.Errorf("listMounts: %w", err)
+		}
+
+		return mounts, nil
+	}
+
+	return findMount, findMountSnapshot, listMounts
+}
+
+// procfsError returns an error that wraps ErrProcNotMounted if err was caused by a file missing
+// from the procfs pseudo-filesystem that should be mounted at mountpoint, because procfs isn't
+// mounted there. Otherwise, err is returned unchanged.
+func procfsError(mountpoint string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) && !isProcfsMountpoint(mountpoint) {
+		return fmt.Errorf("%w at %q", ErrProcNotMounted, mountpoint)
+	}
+
+	return err
+}
+
+// isProcfsMountpoint returns true if procfs appears to be mounted at mountpoint, which is the
+// case if it reports the kernel's statistics.
+func isProcfsMountpoint(mountpoint string) bool {
+	info, err := os.Stat(filepath.Join(mountpoint, "stat"))
+	return err == nil && info.Mode().IsRegular()
+}
@@ -0,0 +1,143 @@
+package mountinfo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/log/logtest"
+)
+
+func Test_WithProcfsMountpoint(t *testing.T) {
+	// the host's mount table, as seen through its procfs mounted at <procfs>
+	dataDir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("resolving temporary directory: %s", err)
+	}
+
+	procfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(procfs, "1"), 0755); err != nil {
+		t.Fatalf("creating procfs directory: %s", err)
+	}
+
+	mountTable := fmt.Sprintf("21 1 254:1 / / rw,relatime shared:1 - ext4 /dev/vda1 rw\n"+
+		"42 21 8:16 / %s rw,relatime shared:2 - xfs /dev/sdb rw\n", dataDir)
+
+	if err := os.WriteFile(filepath.Join(procfs, "1", "mountinfo"), []byte(mountTable), 0644); err != nil {
+		t.Fatalf("writing mount table: %s", err)
+	}
+
+	d := NewDiscoverer(WithProcfsMountpoint(procfs), WithSysfsMountpoint("/host/sys"))
+
+	mount, err := d.findMount(dataDir)
+	if err != nil {
+		t.Fatalf("finding mount: %s", err)
+	}
+
+	if mount.Mountpoint != dataDir || mount.FSType != "xfs" || mount.Source != "/dev/sdb" {
+		t.Fatalf("recieved unexpected mount (want xfs on %q from /dev/sdb, got %s on %q from %s)", dataDir, mount.FSType, mount.Mountpoint, mount.Source)
+	}
+
+	findMount, err := d.findMountSnapshot()
+	if err != nil {
+		t.Fatalf("taking snapshot of mount table: %s", err)
+	}
+
+	if mount, err := findMount(filepath.Dir(dataDir)); err != nil || mount.FSType != "ext4" {
+		t.Fatalf("expected the root mount from the snapshot, got %+v (error: %v)", mount, err)
+	}
+
+	mountpoint, err := d.cachedSysfsMountpoint()
+	if err != nil {
+		t.Fatalf("finding sysfs mountpoint: %s", err)
+	}
+
+	if mountpoint != "/host/sys" {
+		t.Fatalf("recieved unexpected sysfs mountpoint (want %q, got %q)", "/host/sys", mountpoint)
+	}
+
+	// the mount table can't be read if procfs isn't mounted at the provided location
+	d = NewDiscoverer(WithProcfsMountpoint(filepath.Join(procfs, "missing")))
+	if _, err := d.findMount(dataDir); !errors.Is(err, ErrProcNotMounted) {
+		t.Fatalf("expected error wrapping ErrProcNotMounted, got %v", err)
+	}
+}
+
+func Test_ProcfsError(t *testing.T) {
+	// an empty directory, like /proc in a minimal container
+	emptyDir := t.TempDir()
+
+	if err := procfsError(emptyDir, fs.ErrNotExist); !errors.Is(err, ErrProcNotMounted) {
+		t.Fatalf("expected error wrapping ErrProcNotMounted, got %v", err)
+	}
+
+	// a missing file in a procfs that is mounted isn't a mount problem (e.x. the process exited)
+	if err := procfsError(standardProcfsMountpoint, fs.ErrNotExist); errors.Is(err, ErrProcNotMounted) {
+		t.Fatalf("expected error that doesn't wrap ErrProcNotMounted, got %v", err)
+	}
+
+	// other errors are returned unchanged
+	if err := procfsError(emptyDir, fs.ErrPermission); err != fs.ErrPermission {
+		t.Fatalf("recieved unexpected error (want %v, got %v)", fs.ErrPermission, err)
+	}
+}
+
+func Test_DiscoverDevice_BindMount(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"class/block":     {Mode: fs.ModeDir},
+		"dev/block/254:1": symlink("../../devices/pci0/virtio0/block/vda/vda1"),
+		"dev/block/8:17":  symlink("../../devices/pci0/block/sdb/sdb1"),
+		"devices/pci0/virtio0/block/vda/subsystem":      symlink("../../../../../class/block"),
+		"devices/pci0/virtio0/block/vda/vda1/partition": {Data: []byte("1\n")},
+		"devices/pci0/block/sdb/subsystem":              symlink("../../../../class/block"),
+		"devices/pci0/block/sdb/sdb1/partition":         {Data: []byte("1\n")},
+	}
+
+	dataDir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("resolving temporary directory: %s", err)
+	}
+
+	procfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(procfs, "1"), 0755); err != nil {
+		t.Fatalf("creating procfs directory: %s", err)
+	}
+
+	// /exports/data on sdb1 is bind mounted at <dataDir>, which is inside the root filesystem on vda1
+	mountTable := fmt.Sprintf("21 1 254:1 / / rw,relatime shared:1 - ext4 /dev/vda1 rw\n"+
+		"42 21 8:17 /exports/data %s rw,relatime shared:2 - xfs /dev/sdb1 rw\n", dataDir)
+
+	if err := os.WriteFile(filepath.Join(procfs, "1", "mountinfo"), []byte(mountTable), 0644); err != nil {
+		t.Fatalf("writing mount table: %s", err)
+	}
+
+	d := NewDiscoverer(WithSysfs(sysfs), WithProcfsMountpoint(procfs))
+	d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+		// the device of the bind target's parent
+		return 254, 1, nil
+	}
+
+	device, err := d.DiscoverDevice(logtest.Scoped(t), dataDir)
+	if err != nil {
+		t.Fatalf("discovering device: %s", err)
+	}
+
+	expected := Device{Name: "sdb", Major: 8, Minor: 17, Mountpoint: dataDir, FSType: "xfs"}
+	if diff := cmp.Diff(expected, device); diff != "" {
+		t.Fatalf("recieved unexpected device (-want +got):\n%s", diff)
+	}
+
+	names, err := d.DiscoverDeviceNames(logtest.Scoped(t), dataDir)
+	if err != nil {
+		t.Fatalf("discovering device names: %s", err)
+	}
+
+	if diff := cmp.Diff([]string{"sdb"}, names); diff != "" {
+		t.Fatalf("recieved unexpected device names (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package mountinfo
+
+import "github.com/moby/sys/mountinfo"
+
+// procfsMountTable returns the functions that d looks mounts up with by default (see mountLookup)
+// and listMounts, since there's no procfs pseudo-filesystem to read the mount table from on this
+// operating system.
+func (d *Discoverer) procfsMountTable(mountpoint string) (
+	func(filePath string) (*mountinfo.Info, error),
+	func() (func(filePath string) (*mountinfo.Info, error), error),
+	func() ([]*mountinfo.Info, error),
+) {
+	findMount, findMountSnapshot := d.mountLookup()
+	return findMount, findMountSnapshot, listMounts
+}
+
+// procfsError returns err unchanged, since there's no procfs pseudo-filesystem that could be
+// missing on this operating system.
+func procfsError(mountpoint string, err error) error {
+	return err
+}
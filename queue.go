@@ -0,0 +1,60 @@
+package mountinfo
+
+import (
+	"strings"
+)
+
+// QueueInfo describes how the kernel queues the IO requests of a block device.
+type QueueInfo struct {
+	// Scheduler is the active IO scheduler of the device (example: "mq-deadline"), or "none"
+	// if requests are passed to the device without being reordered. Scheduler is empty if the
+	// device doesn't report its scheduler.
+	Scheduler string
+
+	// AvailableSchedulers are the IO schedulers that the device can be switched to,
+	// including the active one (example: ["mq-deadline", "kyber", "bfq", "none"]).
+	AvailableSchedulers []string
+
+	// NrRequests is the maximum number of read and write requests that can be queued for the
+	// device at the same time (the queue depth of its scheduler), or zero if the device doesn't
+	// report it.
+	NrRequests uint64
+}
+
+// DeviceQueueInfo returns information about the request queue of the block device with the
+// provided name (example: "sda"), as configured in /sys/block/<name>/queue.
+//
+// An error is only returned if the device doesn't exist: attributes that the device doesn't
+// report are left zero-valued.
+//
+// DeviceQueueInfo currently works only on Linux-based operating systems. On all other operating
+// systems, it returns an error that wraps ErrUnsupportedPlatform.
+func (d *Discoverer) DeviceQueueInfo(name string) (QueueInfo, error) {
+	return d.deviceQueueInfo(name)
+}
+
+// DeviceQueueInfo calls DeviceQueueInfo on a Discoverer that inspects the current system.
+func DeviceQueueInfo(name string) (QueueInfo, error) {
+	return defaultDiscoverer.DeviceQueueInfo(name)
+}
+
+// parseScheduler parses the contents of a queue/scheduler sysfs attribute, which lists the
+// available schedulers with the active one in brackets (example: "mq-deadline kyber [bfq] none").
+func parseScheduler(contents string) (active string, available []string) {
+	for _, field := range strings.Fields(contents) {
+		if strings.HasPrefix(field, "[") && strings.HasSuffix(field, "]") {
+			field = strings.TrimSuffix(strings.TrimPrefix(field, "["), "]")
+			active = field
+		}
+
+		available = append(available, field)
+	}
+
+	// devices without a request queue (e.x. some device-mapper targets) only list "none",
+	// without marking it as active
+	if active == "" && len(available) == 1 {
+		active = available[0]
+	}
+
+	return active, available
+}
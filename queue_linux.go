@@ -0,0 +1,31 @@
+package mountinfo
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+func (d *Discoverer) deviceQueueInfo(name string) (QueueInfo, error) {
+	sysfs, err := d.sysfs()
+	if err != nil {
+		return QueueInfo{}, fmt.Errorf("DeviceQueueInfo: finding sysfs mountpoint: %w", err)
+	}
+
+	if _, err := lstat(sysfs, path.Join("block", name)); err != nil {
+		return QueueInfo{}, fmt.Errorf("DeviceQueueInfo: %w", err)
+	}
+
+	logger := sglog.NoOp()
+
+	var info QueueInfo
+	info.Scheduler, info.AvailableSchedulers = parseScheduler(readSysfsAttribute(logger, sysfs, path.Join("block", name, "queue", "scheduler")))
+
+	if nrRequests, err := strconv.ParseUint(readSysfsAttribute(logger, sysfs, path.Join("block", name, "queue", "nr_requests")), 10, 64); err == nil {
+		info.NrRequests = nrRequests
+	}
+
+	return info, nil
+}
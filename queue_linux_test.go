@@ -0,0 +1,69 @@
+package mountinfo
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_DeviceQueueInfo(t *testing.T) {
+	// sda has a scheduler, nvme0n1 bypasses it, and dm-0 doesn't report its queue depth
+	sysfs := fstest.MapFS{
+		"block/sda":     symlink("../devices/pci0/block/sda"),
+		"block/nvme0n1": symlink("../devices/pci0/nvme/block/nvme0n1"),
+		"block/dm-0":    symlink("../devices/virtual/block/dm-0"),
+
+		"devices/pci0/block/sda/queue/scheduler":            {Data: []byte("[mq-deadline] kyber bfq none\n")},
+		"devices/pci0/block/sda/queue/nr_requests":          {Data: []byte("64\n")},
+		"devices/pci0/nvme/block/nvme0n1/queue/scheduler":   {Data: []byte("mq-deadline kyber [none]\n")},
+		"devices/pci0/nvme/block/nvme0n1/queue/nr_requests": {Data: []byte("1023\n")},
+		"devices/virtual/block/dm-0/queue/scheduler":        {Data: []byte("none\n")},
+	}
+
+	d := NewDiscoverer(WithSysfs(sysfs))
+
+	for _, test := range []struct {
+		name     string
+		expected QueueInfo
+	}{
+		{
+			name: "sda",
+			expected: QueueInfo{
+				Scheduler:           "mq-deadline",
+				AvailableSchedulers: []string{"mq-deadline", "kyber", "bfq", "none"},
+				NrRequests:          64,
+			},
+		},
+		{
+			name: "nvme0n1",
+			expected: QueueInfo{
+				Scheduler:           "none",
+				AvailableSchedulers: []string{"mq-deadline", "kyber", "none"},
+				NrRequests:          1023,
+			},
+		},
+		{
+			name: "dm-0",
+			expected: QueueInfo{
+				Scheduler:           "none",
+				AvailableSchedulers: []string{"none"},
+			},
+		},
+	} {
+		actual, err := d.DeviceQueueInfo(test.name)
+		if err != nil {
+			t.Fatalf("reading queue of %q: %s", test.name, err)
+		}
+
+		if diff := cmp.Diff(test.expected, actual); diff != "" {
+			t.Errorf("recieved unexpected queue info for %q (-want +got):\n%s", test.name, diff)
+		}
+	}
+
+	if info, err := d.DeviceQueueInfo("sdz"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected error wrapping fs.ErrNotExist for missing device, got %v (queue info %+v)", err, info)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package mountinfo
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func (d *Discoverer) deviceQueueInfo(name string) (QueueInfo, error) {
+	return QueueInfo{}, fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
@@ -0,0 +1,52 @@
+package mountinfo
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_ParseScheduler(t *testing.T) {
+	for _, test := range []struct {
+		contents string
+
+		expectedActive    string
+		expectedAvailable []string
+	}{
+		{
+			contents:          "[mq-deadline] kyber bfq none\n",
+			expectedActive:    "mq-deadline",
+			expectedAvailable: []string{"mq-deadline", "kyber", "bfq", "none"},
+		},
+		{
+			contents:          "mq-deadline kyber [none]",
+			expectedActive:    "none",
+			expectedAvailable: []string{"mq-deadline", "kyber", "none"},
+		},
+		{
+			// legacy (single-queue) schedulers
+			contents:          "noop deadline [cfq]",
+			expectedActive:    "cfq",
+			expectedAvailable: []string{"noop", "deadline", "cfq"},
+		},
+		{
+			// devices without a request queue
+			contents:          "none",
+			expectedActive:    "none",
+			expectedAvailable: []string{"none"},
+		},
+		{
+			contents: "",
+		},
+	} {
+		active, available := parseScheduler(test.contents)
+
+		if active != test.expectedActive {
+			t.Errorf("recieved unexpected active scheduler for %q (want %q, got %q)", test.contents, test.expectedActive, active)
+		}
+
+		if diff := cmp.Diff(test.expectedAvailable, available); diff != "" {
+			t.Errorf("recieved unexpected available schedulers for %q (-want +got):\n%s", test.contents, diff)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	sglog "github.com/sourcegraph/log"
+	"go.uber.org/multierr"
+)
+
+// SelfCheck verifies that disk metrics can be collected on the current system: that the
+// sysfs pseudo-filesystem can be found, that the block device of the current working
+// directory can be discovered, and that /proc/diskstats can be parsed.
+//
+// Every check is run even if an earlier one fails, and the returned error combines the
+// failures of all of them (nil if every check passed). errors.Is and errors.As can be used
+// to inspect the individual failures.
+//
+// The checks currently only pass on Linux-based operating systems.
+func (d *Discoverer) SelfCheck(logger sglog.Logger) error {
+	var err error
+
+	// the sysfs mountpoint isn't needed if a sysfs file system was provided
+	if d.sysfsFS == nil {
+		if _, sysfsErr := d.cachedSysfsMountpoint(); sysfsErr != nil {
+			err = multierr.Append(err, fmt.Errorf("SelfCheck: finding sysfs mountpoint: %w", sysfsErr))
+		}
+	}
+
+	if wd, wdErr := os.Getwd(); wdErr != nil {
+		err = multierr.Append(err, fmt.Errorf("SelfCheck: finding working directory: %w", wdErr))
+	} else if _, deviceErr := d.discoverDeviceNamesAt(context.Background(), logger, wd); deviceErr != nil {
+		err = multierr.Append(err, fmt.Errorf("SelfCheck: discovering device of working directory %q: %w", wd, deviceErr))
+	}
+
+	if _, statsErr := readDiskStats(); statsErr != nil {
+		err = multierr.Append(err, fmt.Errorf("SelfCheck: %w", statsErr))
+	}
+
+	return err
+}
+
+// SelfCheck calls SelfCheck on a Discoverer that inspects the current system.
+func SelfCheck(logger sglog.Logger) error {
+	return defaultDiscoverer.SelfCheck(logger)
+}
@@ -0,0 +1,40 @@
+package mountinfo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sourcegraph/log/logtest"
+	"go.uber.org/multierr"
+)
+
+func Test_SelfCheck_AggregatesFailures(t *testing.T) {
+	errResolve := errors.New("resolve failed")
+
+	d := NewDiscoverer()
+	d.findSysfsMountpoint = func() (string, error) {
+		// an empty mount table
+		return sysfsMountpoint(nil)
+	}
+	d.resolvePath = func(filePath string) (string, error) {
+		return "", errResolve
+	}
+
+	err := d.SelfCheck(logtest.Scoped(t))
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	// a failing check doesn't stop the other checks from running
+	if !errors.Is(err, ErrSysfsNotMounted) {
+		t.Errorf("expected error wrapping ErrSysfsNotMounted, got %v", err)
+	}
+
+	if !errors.Is(err, errResolve) {
+		t.Errorf("expected error wrapping %q, got %v", errResolve, err)
+	}
+
+	if errs := multierr.Errors(err); len(errs) < 2 {
+		t.Errorf("expected at least 2 failed checks, got %d: %v", len(errs), err)
+	}
+}
@@ -0,0 +1,21 @@
+package mountinfo
+
+import (
+	"context"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+// DeviceSize returns the capacity in bytes of the block device with the provided name
+// (example: "sda").
+//
+// This operation is currently only supported on Linux and macOS. On all other operating systems,
+// the returned error wraps ErrUnsupportedPlatform.
+func (d *Discoverer) DeviceSize(name string) (uint64, error) {
+	return d.deviceSize(context.Background(), sglog.NoOp(), name)
+}
+
+// DeviceSize calls DeviceSize on a Discoverer that inspects the current system.
+func DeviceSize(name string) (uint64, error) {
+	return defaultDiscoverer.DeviceSize(name)
+}
@@ -0,0 +1,22 @@
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+func (d *Discoverer) deviceSize(ctx context.Context, logger sglog.Logger, name string) (uint64, error) {
+	info, err := d.diskutilInfo(ctx, logger, name)
+	if err != nil {
+		return 0, err
+	}
+
+	size, ok := info["Size"].(int64)
+	if !ok || size < 0 {
+		return 0, fmt.Errorf("unable to find size of %s: diskutil didn't report it", name)
+	}
+
+	return uint64(size), nil
+}
@@ -0,0 +1,83 @@
+package mountinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+// sysfsSectorSize is the size of the sectors that sysfs reports block device sizes in.
+//
+// The kernel always uses 512 byte sectors for this, regardless of the device's logical block
+// size (example: a drive with 4096 byte sectors reports eight times as many sectors), so
+// queue/logical_block_size must not be used to convert the size to bytes.
+const sysfsSectorSize = 512
+
+func (d *Discoverer) deviceSize(ctx context.Context, logger sglog.Logger, name string) (uint64, error) {
+	sysfs, err := d.sysfs()
+	if err != nil {
+		return 0, fmt.Errorf("finding sysfs mountpoint: %w", err)
+	}
+
+	var size uint64
+	err = d.retrySysfs(ctx, logger, func() (err error) {
+		size, err = readDeviceSize(sysfs, name)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// readDeviceSize returns the capacity in bytes of the block device with the provided name.
+func readDeviceSize(sysfs fs.FS, name string) (uint64, error) {
+	contents, err := readSysfsFile(sysfs, path.Join("block", name, "size"))
+	if err != nil {
+		return 0, fmt.Errorf("readDeviceSize: %w", err)
+	}
+
+	sectors, err := strconv.ParseUint(strings.TrimSpace(string(contents)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("readDeviceSize: malformed size of device %q: %w", name, err)
+	}
+
+	return sectors * sysfsSectorSize, nil
+}
+
+// readSysfsBlockSize returns the block size (in bytes) that's stored in the queue attribute
+// with the provided name (example: "logical_block_size") of the block device with the provided
+// name, or zero if it can't be read.
+func readSysfsBlockSize(logger sglog.Logger, sysfs fs.FS, name, attribute string) uint64 {
+	size, err := strconv.ParseUint(readSysfsAttribute(logger, sysfs, path.Join("block", name, "queue", attribute)), 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return size
+}
+
+// readSysfsDeviceSize behaves like readDeviceSize, but returns zero if the size can't be read
+// (similar to readSysfsAttribute).
+func readSysfsDeviceSize(logger sglog.Logger, sysfs fs.FS, name string) uint64 {
+	size, err := readDeviceSize(sysfs, name)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logger.Debug("failed to read device size",
+				sglog.String("device", name),
+				sglog.Error(err),
+			)
+		}
+
+		return 0
+	}
+
+	return size
+}
@@ -0,0 +1,42 @@
+package mountinfo
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func Test_DeviceSize(t *testing.T) {
+	// sda has 512 byte sectors, sdb is a 4Kn drive (4096 byte logical sectors)
+	// of the same capacity, and sdc reports a malformed size
+	sysfs := fstest.MapFS{
+		"block/sda": symlink("../devices/pci0/block/sda"),
+		"block/sdb": symlink("../devices/pci0/block/sdb"),
+		"block/sdc": symlink("../devices/pci0/block/sdc"),
+
+		"devices/pci0/block/sda/size":                     {Data: []byte("7814037168\n")},
+		"devices/pci0/block/sda/queue/logical_block_size": {Data: []byte("512\n")},
+		"devices/pci0/block/sdb/size":                     {Data: []byte("7814037168\n")},
+		"devices/pci0/block/sdb/queue/logical_block_size": {Data: []byte("4096\n")},
+		"devices/pci0/block/sdc/size":                     {Data: []byte("lots\n")},
+	}
+
+	d := NewDiscoverer(WithSysfs(sysfs))
+
+	for _, name := range []string{"sda", "sdb"} {
+		// sysfs reports sizes in 512 byte sectors, regardless of the logical block size
+		size, err := d.DeviceSize(name)
+		if err != nil {
+			t.Fatalf("reading size of %q: %s", name, err)
+		}
+
+		if expected := uint64(4000787030016); size != expected {
+			t.Errorf("recieved unexpected size of %q (want %d, got %d)", name, expected, size)
+		}
+	}
+
+	for _, name := range []string{"sdc", "sdd"} {
+		if size, err := d.DeviceSize(name); err == nil {
+			t.Errorf("expected error for %q, got size %d", name, size)
+		}
+	}
+}
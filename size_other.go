@@ -0,0 +1,15 @@
+//go:build !(linux || darwin)
+
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+func (d *Discoverer) deviceSize(ctx context.Context, logger sglog.Logger, name string) (uint64, error) {
+	return 0, fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
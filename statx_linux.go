@@ -0,0 +1,43 @@
+package mountinfo
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+)
+
+// statxUnsupported is true once statx has failed because the running kernel doesn't implement
+// it (it was added in Linux 4.11), or because a seccomp filter blocks it (e.x. in containers run
+// by older versions of Docker), so that later lookups go straight to stat.
+var statxUnsupported atomic.Bool
+
+// statxDeviceNumber returns the major and minor numbers of the device that filePath is stored
+// on, using the statx system call.
+//
+// Unlike stat, statx reports the device number as separate major and minor numbers (so they
+// don't have to be decoded from the packed form that differs between architectures), and can be
+// told not to synchronize the file's attributes with the server on network filesystems, which
+// the device number doesn't depend on.
+//
+// If statx isn't available, ok is false and the caller should fall back to stat.
+func statxDeviceNumber(filePath string) (major, minor uint32, ok bool, err error) {
+	if statxUnsupported.Load() {
+		return 0, 0, false, nil
+	}
+
+	// the device number is always returned, so no other fields need to be requested
+	var stx unix.Statx_t
+	err = unix.Statx(unix.AT_FDCWD, filePath, unix.AT_STATX_DONT_SYNC, 0, &stx)
+	if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EPERM) {
+		statxUnsupported.Store(true)
+		return 0, 0, false, nil
+	}
+
+	if err != nil {
+		return 0, 0, true, fmt.Errorf("getDeviceNumber: failed to statx %q: %w", filePath, wrapPathNotFound(err))
+	}
+
+	return stx.Dev_major, stx.Dev_minor, true, nil
+}
@@ -0,0 +1,55 @@
+package mountinfo
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func Test_StatxDeviceNumber(t *testing.T) {
+	dir := t.TempDir()
+
+	var stat unix.Stat_t
+	if err := unix.Stat(dir, &stat); err != nil {
+		t.Fatalf("stat %q: %s", dir, err)
+	}
+
+	//nolint:unconvert // We need the unix.Major/Minor functions to perform the proper bit-shifts
+	expectedMajor, expectedMinor := unix.Major(uint64(stat.Dev)), unix.Minor(uint64(stat.Dev))
+
+	major, minor, ok, err := statxDeviceNumber(dir)
+	if !ok {
+		t.Skip("statx isn't supported by the running kernel")
+	}
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if major != expectedMajor || minor != expectedMinor {
+		t.Fatalf("recieved unexpected device number (want %d:%d, got %d:%d)", expectedMajor, expectedMinor, major, minor)
+	}
+
+	if _, _, _, err := statxDeviceNumber(filepath.Join(dir, "deleted")); !errors.Is(err, ErrPathNotFound) {
+		t.Fatalf("expected error wrapping ErrPathNotFound, got %v", err)
+	}
+
+	// once statx is known to be unsupported, getDeviceNumber falls back to stat
+	statxUnsupported.Store(true)
+	t.Cleanup(func() { statxUnsupported.Store(false) })
+
+	if _, _, ok, _ := statxDeviceNumber(dir); ok {
+		t.Fatal("expected statx to be skipped")
+	}
+
+	major, minor, err = getDeviceNumber(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if major != expectedMajor || minor != expectedMinor {
+		t.Fatalf("recieved unexpected device number after falling back to stat (want %d:%d, got %d:%d)", expectedMajor, expectedMinor, major, minor)
+	}
+}
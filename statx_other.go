@@ -0,0 +1,9 @@
+//go:build unix && !linux
+
+package mountinfo
+
+// statxDeviceNumber always returns ok == false, since the statx system call is only
+// available on Linux.
+func statxDeviceNumber(filePath string) (major, minor uint32, ok bool, err error) {
+	return 0, 0, false, nil
+}
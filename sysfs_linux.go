@@ -0,0 +1,206 @@
+package mountinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+// maxSymlinks is the maximum number of symbolic links that evalSymlinks follows
+// before giving up (matching the limit of path/filepath.EvalSymlinks).
+const maxSymlinks = 255
+
+// sysfsDirFS is the file system rooted at the directory that the sysfs pseudo-filesystem
+// is mounted at.
+//
+// Unlike the file system returned by os.DirFS, sysfsDirFS implements Lstat and ReadLink,
+// which are needed to follow the symbolic links that sysfs uses to link devices to each other.
+type sysfsDirFS string
+
+func (dir sysfsDirFS) Open(name string) (fs.File, error) {
+	return os.DirFS(string(dir)).Open(name)
+}
+
+func (dir sysfsDirFS) Lstat(name string) (fs.FileInfo, error) {
+	fullPath, err := dir.join("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Lstat(fullPath)
+}
+
+func (dir sysfsDirFS) ReadLink(name string) (string, error) {
+	fullPath, err := dir.join("readlink", name)
+	if err != nil {
+		return "", err
+	}
+
+	return os.Readlink(fullPath)
+}
+
+// join returns the location of name on the host's filesystem.
+func (dir sysfsDirFS) join(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	return filepath.Join(string(dir), filepath.FromSlash(name)), nil
+}
+
+// sysfs returns the file system that's rooted at the sysfs mountpoint.
+func (d *Discoverer) sysfs() (fs.FS, error) {
+	if d.sysfsFS != nil {
+		return d.sysfsFS, nil
+	}
+
+	mountpoint, err := d.cachedSysfsMountpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	return sysfsDirFS(mountpoint), nil
+}
+
+// lstat returns information about the file name in fsys without following
+// it if it's a symbolic link.
+//
+// If fsys doesn't implement Lstat, lstat falls back to fs.Stat.
+func lstat(fsys fs.FS, name string) (fs.FileInfo, error) {
+	if fsys, ok := fsys.(interface {
+		Lstat(name string) (fs.FileInfo, error)
+	}); ok {
+		return fsys.Lstat(name)
+	}
+
+	return fs.Stat(fsys, name)
+}
+
+// readLink returns the destination of the symbolic link name in fsys.
+//
+// If fsys doesn't implement ReadLink, the contents of the file are used as the
+// destination instead (which is how fstest.MapFS files with the fs.ModeSymlink
+// bit set are interpreted).
+func readLink(fsys fs.FS, name string) (string, error) {
+	if fsys, ok := fsys.(interface {
+		ReadLink(name string) (string, error)
+	}); ok {
+		return fsys.ReadLink(name)
+	}
+
+	target, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return "", err
+	}
+
+	return string(target), nil
+}
+
+// evalSymlinks returns name after following all of the symbolic links that it
+// contains. The returned path is relative to the root of fsys.
+//
+// Symbolic links must be relative, and must not point outside of fsys. At most maxSymlinks
+// links are followed, so that a circular chain of links fails with an error that wraps
+// syscall.ELOOP instead of being followed forever.
+func evalSymlinks(fsys fs.FS, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", fmt.Errorf("evalSymlinks: %w", &fs.PathError{Op: "evalsymlinks", Path: name, Err: fs.ErrInvalid})
+	}
+
+	resolved := "."
+	remaining := strings.Split(name, "/")
+	links := 0
+
+	for len(remaining) > 0 {
+		component := remaining[0]
+		remaining = remaining[1:]
+
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			if resolved == "." {
+				return "", fmt.Errorf("evalSymlinks: path %q points outside of the file system", name)
+			}
+
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		next := path.Join(resolved, component)
+
+		info, err := lstat(fsys, next)
+		if err != nil {
+			return "", fmt.Errorf("evalSymlinks: %w", err)
+		}
+
+		if info.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("evalSymlinks: too many symbolic links in path %q: %w", name, syscall.ELOOP)
+		}
+
+		target, err := readLink(fsys, next)
+		if err != nil {
+			return "", fmt.Errorf("evalSymlinks: %w", err)
+		}
+
+		if path.IsAbs(target) {
+			return "", fmt.Errorf("evalSymlinks: symbolic link %q has an absolute destination %q, which isn't supported", next, target)
+		}
+
+		remaining = append(strings.Split(target, "/"), remaining...)
+	}
+
+	return resolved, nil
+}
+
+// retrySysfs calls read until it succeeds, fails with an error that isn't transient, or has been
+// retried as many times as configured with WithSysfsRetries.
+//
+// If ctx is done while retrySysfs is waiting to retry, it gives up immediately.
+func (d *Discoverer) retrySysfs(ctx context.Context, logger sglog.Logger, read func() error) error {
+	backoff := d.sysfsRetryBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := read()
+		if err == nil || attempt > d.sysfsRetries || !isTransientSysfsError(err) {
+			return err
+		}
+
+		logger.Debug("retrying sysfs read",
+			sglog.Int("attempt", attempt),
+			sglog.Error(err),
+		)
+
+		timer := time.NewTimer(backoff)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("retrySysfs: %w (last error: %s)", ctx.Err(), err)
+		case <-timer.C:
+		}
+
+		backoff *= 2
+	}
+}
+
+// isTransientSysfsError returns true if err might not occur again if the sysfs read that
+// caused it is retried (e.x. because the device that's being read is still being set up).
+func isTransientSysfsError(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.EBUSY)
+}
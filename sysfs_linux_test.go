@@ -0,0 +1,1364 @@
+package mountinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/moby/sys/mountinfo"
+	"github.com/sourcegraph/log/logtest"
+)
+
+// symlink returns a fstest.MapFile that represents a symbolic link to target.
+func symlink(target string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(target), Mode: fs.ModeSymlink}
+}
+
+// unresolvedPath stubs out Discoverer.resolvePath for tests that use made-up file paths
+// (since their device numbers and mounts are stubbed out as well).
+func unresolvedPath(filePath string) (string, error) {
+	return filePath, nil
+}
+
+func Test_DiscoverDeviceNames_MapFS(t *testing.T) {
+	// sda1 and sdb1 are partitions that back the md0 RAID array, dm-0 is a LUKS volume on sdb1
+	// that backs the dm-1 LVM logical volume, dm-2 doesn't list its slaves, loop0 is backed by
+	// a file that's stored on md0, loop1 doesn't have a backing file, md1 is (impossibly) backed
+	// by itself, mmcblk0p2 isn't nested in the directory of its disk, dm-3 is a LUKS volume on the
+	// dm-4 LVM logical volume on the dm-5 LUKS volume on sdc2, and mem/null is a character device
+	// that isn't part of the block subsystem
+	sysfs := fstest.MapFS{
+		"class/block": {Mode: fs.ModeDir},
+		"class/mem":   {Mode: fs.ModeDir},
+
+		"dev/block/8:1":   symlink("../../devices/pci0/block/sda/sda1"),
+		"dev/block/9:0":   symlink("../../devices/virtual/block/md0"),
+		"dev/block/1:3":   symlink("../../devices/virtual/mem/null"),
+		"dev/block/7:0":   symlink("../../devices/virtual/block/loop0"),
+		"dev/block/7:1":   symlink("../../devices/virtual/block/loop1"),
+		"dev/block/9:1":   symlink("../../devices/virtual/block/md1"),
+		"dev/block/179:2": symlink("../../devices/platform/mmc/mmcblk0p2"),
+		"dev/block/253:0": symlink("../../devices/virtual/block/dm-0"),
+		"dev/block/253:1": symlink("../../devices/virtual/block/dm-1"),
+		"dev/block/253:2": symlink("../../devices/virtual/block/dm-2"),
+		"dev/block/253:3": symlink("../../devices/virtual/block/dm-3"),
+
+		"block/loop0":   symlink("../devices/virtual/block/loop0"),
+		"block/loop1":   symlink("../devices/virtual/block/loop1"),
+		"block/mmcblk0": symlink("../devices/platform/mmc/host/mmcblk0"),
+
+		"devices/platform/mmc/mmcblk0p2/partition":    {Data: []byte("2\n")},
+		"devices/platform/mmc/host/mmcblk0/subsystem": symlink("../../../../../class/block"),
+
+		"devices/pci0/block/sda/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sda/sda1/partition": {Data: []byte("1\n")},
+		"devices/pci0/block/sdb/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sdb/sdb1/partition": {Data: []byte("1\n")},
+		"devices/pci0/block/sdc/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sdc/sdc2/partition": {Data: []byte("2\n")},
+
+		"devices/virtual/block/md0/subsystem":   symlink("../../../../class/block"),
+		"devices/virtual/block/md0/slaves/sda1": symlink("../../../../pci0/block/sda/sda1"),
+		"devices/virtual/block/md0/slaves/sdb1": symlink("../../../../pci0/block/sdb/sdb1"),
+
+		"devices/virtual/block/md1/subsystem":  symlink("../../../../class/block"),
+		"devices/virtual/block/md1/slaves/md1": symlink("../../md1"),
+
+		"devices/virtual/block/dm-0/subsystem":   symlink("../../../../class/block"),
+		"devices/virtual/block/dm-0/dm/name":     {Data: []byte("luks-abc\n")},
+		"devices/virtual/block/dm-0/dm/uuid":     {Data: []byte("CRYPT-LUKS2-abc-luks-abc\n")},
+		"devices/virtual/block/dm-0/slaves/sdb1": symlink("../../../../pci0/block/sdb/sdb1"),
+		"devices/virtual/block/dm-1/subsystem":   symlink("../../../../class/block"),
+		"devices/virtual/block/dm-1/dm/name":     {Data: []byte("vg0-data\n")},
+		"devices/virtual/block/dm-1/dm/uuid":     {Data: []byte("LVM-abcdef\n")},
+		"devices/virtual/block/dm-1/slaves/dm-0": symlink("../../dm-0"),
+		"devices/virtual/block/dm-2/subsystem":   symlink("../../../../class/block"),
+		"devices/virtual/block/dm-3/subsystem":   symlink("../../../../class/block"),
+		"devices/virtual/block/dm-3/dm/uuid":     {Data: []byte("CRYPT-LUKS2-def-luks-def\n")},
+		"devices/virtual/block/dm-3/slaves/dm-4": symlink("../../dm-4"),
+		"devices/virtual/block/dm-4/subsystem":   symlink("../../../../class/block"),
+		"devices/virtual/block/dm-4/dm/uuid":     {Data: []byte("LVM-ghijkl\n")},
+		"devices/virtual/block/dm-4/slaves/dm-5": symlink("../../dm-5"),
+		"devices/virtual/block/dm-5/subsystem":   symlink("../../../../class/block"),
+		"devices/virtual/block/dm-5/dm/uuid":     {Data: []byte("CRYPT-LUKS2-ghi-luks-ghi\n")},
+		"devices/virtual/block/dm-5/slaves/sdc2": symlink("../../../../pci0/block/sdc/sdc2"),
+
+		"devices/virtual/block/loop0/subsystem":         symlink("../../../../class/block"),
+		"devices/virtual/block/loop0/loop/backing_file": {Data: []byte("/data/disk.img\n")},
+		"devices/virtual/block/loop1/subsystem":         symlink("../../../../class/block"),
+
+		"devices/virtual/mem/null/subsystem": symlink("../../../../class/mem"),
+	}
+
+	for _, test := range []struct {
+		name string
+
+		deviceMajor uint32
+		deviceMinor uint32
+
+		expectedDeviceNames []string
+		expectedFallbacks   []FallbackReason
+		expectError         bool
+	}{
+		{
+			name:                "partition",
+			deviceMajor:         8,
+			deviceMinor:         1,
+			expectedDeviceNames: []string{"sda"},
+		},
+		{
+			name:                "md RAID array",
+			deviceMajor:         9,
+			deviceMinor:         0,
+			expectedDeviceNames: []string{"sda", "sdb"},
+		},
+		{
+			name:                "dm-crypt volume",
+			deviceMajor:         253,
+			deviceMinor:         0,
+			expectedDeviceNames: []string{"sdb"},
+		},
+		{
+			name:                "LVM logical volume on a dm-crypt volume",
+			deviceMajor:         253,
+			deviceMinor:         1,
+			expectedDeviceNames: []string{"sdb"},
+		},
+		{
+			name:                "dm-crypt volume on an LVM logical volume on a dm-crypt volume",
+			deviceMajor:         253,
+			deviceMinor:         3,
+			expectedDeviceNames: []string{"sdc"},
+		},
+		{
+			name:                "loop device backed by a file",
+			deviceMajor:         7,
+			deviceMinor:         0,
+			expectedDeviceNames: []string{"sda", "sdb"},
+		},
+		{
+			name:                "loop device without a backing file",
+			deviceMajor:         7,
+			deviceMinor:         1,
+			expectedDeviceNames: []string{"loop1"},
+			expectedFallbacks:   []FallbackReason{FallbackLoopBackingFileUnresolved},
+		},
+		{
+			name:                "device-mapper device without slaves",
+			deviceMajor:         253,
+			deviceMinor:         2,
+			expectedDeviceNames: []string{"dm-2"},
+			expectedFallbacks:   []FallbackReason{FallbackDeviceMapperWithoutSlaves},
+		},
+		{
+			name:                "partition that isn't nested in its disk's directory",
+			deviceMajor:         179,
+			deviceMinor:         2,
+			expectedDeviceNames: []string{"mmcblk0"},
+		},
+		{
+			name:        "not a block device",
+			deviceMajor: 1,
+			deviceMinor: 3,
+			expectError: true,
+		},
+		{
+			name:        "device that's backed by itself",
+			deviceMajor: 9,
+			deviceMinor: 1,
+			expectError: true,
+		},
+		{
+			name:        "unknown device number",
+			deviceMajor: 259,
+			deviceMinor: 0,
+			expectError: true,
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			var actualFallbacks []FallbackReason
+
+			d := NewDiscoverer(WithSysfs(sysfs), WithResolutionFallbacks(func(reason FallbackReason) {
+				actualFallbacks = append(actualFallbacks, reason)
+			}))
+			d.resolvePath = unresolvedPath
+			d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+				if filePath == "/data/disk.img" {
+					// backing file of loop0, which is stored on md0
+					return 9, 0, nil
+				}
+
+				return test.deviceMajor, test.deviceMinor, nil
+			}
+			d.findMount = func(filePath string) (*mountinfo.Info, error) {
+				return &mountinfo.Info{Mountpoint: "/", FSType: "ext4"}, nil
+			}
+
+			actualDeviceNames, err := d.DiscoverDeviceNames(logtest.Scoped(t), "doesn't matter")
+			if test.expectError {
+				if err == nil {
+					t.Fatalf("expected error, got device names %q", actualDeviceNames)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("discovering device names: %s", err)
+			}
+
+			if diff := cmp.Diff(test.expectedDeviceNames, actualDeviceNames); diff != "" {
+				t.Fatalf("recieved unexpected device names (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(test.expectedFallbacks, actualFallbacks); diff != "" {
+				t.Fatalf("recieved unexpected resolution fallbacks (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_ResolveSlaves_MaxDepth(t *testing.T) {
+	// dm-<N> is backed by dm-<N+1>, and the last one is backed by sda
+	newStack := func(depth int) fstest.MapFS {
+		sysfs := fstest.MapFS{
+			"class/block":                      {Mode: fs.ModeDir},
+			"devices/pci0/block/sda/subsystem": symlink("../../../../class/block"),
+		}
+
+		for i := 0; i < depth; i++ {
+			dir := fmt.Sprintf("devices/virtual/block/dm-%d", i)
+			sysfs[dir+"/subsystem"] = symlink("../../../../class/block")
+
+			if i == depth-1 {
+				sysfs[dir+"/slaves/sda"] = symlink("../../../../pci0/block/sda")
+			} else {
+				sysfs[fmt.Sprintf("%s/slaves/dm-%d", dir, i+1)] = symlink(fmt.Sprintf("../../dm-%d", i+1))
+			}
+		}
+
+		return sysfs
+	}
+
+	paths, err := resolveSlaves(context.Background(), logtest.Scoped(t), newStack(maxSlaveDepth), "devices/virtual/block/dm-0", false)
+	if err != nil {
+		t.Fatalf("resolving slaves: %s", err)
+	}
+
+	if diff := cmp.Diff([]string{"devices/pci0/block/sda"}, paths); diff != "" {
+		t.Fatalf("recieved unexpected slave paths (-want +got):\n%s", diff)
+	}
+
+	if _, err := resolveSlaves(context.Background(), logtest.Scoped(t), newStack(maxSlaveDepth+1), "devices/virtual/block/dm-0", false); err == nil {
+		t.Fatal("expected error for a stack that's too deep, got nil")
+	}
+}
+
+func Test_DiscoverDeviceNames_NoBlockDevice(t *testing.T) {
+	for _, fsType := range []string{"tmpfs", "ramfs", "proc"} {
+		fsType := fsType
+
+		t.Run(fsType, func(t *testing.T) {
+			d := NewDiscoverer(WithSysfs(fstest.MapFS{}))
+			d.resolvePath = unresolvedPath
+			d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+				// in-memory filesystems have anonymous device numbers
+				return 0, 45, nil
+			}
+			d.findMount = func(filePath string) (*mountinfo.Info, error) {
+				return &mountinfo.Info{Mountpoint: "/run", FSType: fsType}, nil
+			}
+
+			if _, err := d.DiscoverDeviceNames(logtest.Scoped(t), "/run/lock"); !errors.Is(err, ErrNoBlockDevice) {
+				t.Fatalf("expected error wrapping ErrNoBlockDevice, got %v", err)
+			}
+
+			if _, err := d.DiscoverDevice(logtest.Scoped(t), "/run/lock"); !errors.Is(err, ErrNoBlockDevice) {
+				t.Fatalf("expected error wrapping ErrNoBlockDevice, got %v", err)
+			}
+		})
+	}
+}
+
+func Test_DiscoverDeviceNames_Multipath(t *testing.T) {
+	// dm-5 is the first partition (created by kpartx) of the dm-2 multipath map, which sends IO
+	// through sdc and sdd (two paths to the same LUN), and dm-6 doesn't list its slaves
+	sysfs := fstest.MapFS{
+		"class/block": {Mode: fs.ModeDir},
+
+		"dev/block/253:5": symlink("../../devices/virtual/block/dm-5"),
+		"dev/block/253:6": symlink("../../devices/virtual/block/dm-6"),
+
+		"devices/pci0/host2/block/sdc/subsystem": symlink("../../../../../class/block"),
+		"devices/pci0/host3/block/sdd/subsystem": symlink("../../../../../class/block"),
+
+		"devices/virtual/block/dm-2/subsystem":   symlink("../../../../class/block"),
+		"devices/virtual/block/dm-2/dm/name":     {Data: []byte("mpatha\n")},
+		"devices/virtual/block/dm-2/dm/uuid":     {Data: []byte("mpath-3600a098038303053453f463045727a4b\n")},
+		"devices/virtual/block/dm-2/slaves/sdc":  symlink("../../../../pci0/host2/block/sdc"),
+		"devices/virtual/block/dm-2/slaves/sdd":  symlink("../../../../pci0/host3/block/sdd"),
+		"devices/virtual/block/dm-5/subsystem":   symlink("../../../../class/block"),
+		"devices/virtual/block/dm-5/dm/name":     {Data: []byte("mpatha1\n")},
+		"devices/virtual/block/dm-5/dm/uuid":     {Data: []byte("part1-mpath-3600a098038303053453f463045727a4b\n")},
+		"devices/virtual/block/dm-5/slaves/dm-2": symlink("../../dm-2"),
+		"devices/virtual/block/dm-6/subsystem":   symlink("../../../../class/block"),
+		"devices/virtual/block/dm-6/dm/name":     {Data: []byte("vg0-scratch\n")},
+	}
+
+	for _, test := range []struct {
+		name string
+
+		deviceMapperNames bool
+		deviceMinor       uint32
+
+		expectedDeviceNames []string
+		expectedFallbacks   []FallbackReason
+	}{
+		{
+			name:                "partition of multipath map",
+			deviceMinor:         5,
+			expectedDeviceNames: []string{"sdc", "sdd"},
+		},
+		{
+			name:                "partition of multipath map with device-mapper names",
+			deviceMapperNames:   true,
+			deviceMinor:         5,
+			expectedDeviceNames: []string{"mpatha"},
+		},
+		{
+			name:                "device-mapper device without slaves",
+			deviceMinor:         6,
+			expectedDeviceNames: []string{"dm-6"},
+			expectedFallbacks:   []FallbackReason{FallbackDeviceMapperWithoutSlaves},
+		},
+		{
+			name:                "device-mapper device without slaves with device-mapper names",
+			deviceMapperNames:   true,
+			deviceMinor:         6,
+			expectedDeviceNames: []string{"vg0-scratch"},
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			var actualFallbacks []FallbackReason
+
+			opts := []Option{WithSysfs(sysfs), WithResolutionFallbacks(func(reason FallbackReason) {
+				actualFallbacks = append(actualFallbacks, reason)
+			})}
+			if test.deviceMapperNames {
+				opts = append(opts, WithDeviceMapperNames())
+			}
+
+			d := NewDiscoverer(opts...)
+			d.resolvePath = unresolvedPath
+			d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+				return 253, test.deviceMinor, nil
+			}
+			d.findMount = func(filePath string) (*mountinfo.Info, error) {
+				return &mountinfo.Info{Mountpoint: "/san", FSType: "xfs"}, nil
+			}
+
+			actualDeviceNames, err := d.DiscoverDeviceNames(logtest.Scoped(t), "doesn't matter")
+			if err != nil {
+				t.Fatalf("discovering device names: %s", err)
+			}
+
+			if diff := cmp.Diff(test.expectedDeviceNames, actualDeviceNames); diff != "" {
+				t.Fatalf("recieved unexpected device names (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(test.expectedFallbacks, actualFallbacks); diff != "" {
+				t.Fatalf("recieved unexpected resolution fallbacks (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_DiscoverDevice_MultipathAttributes(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"class/block": {Mode: fs.ModeDir},
+
+		"block/dm-2":      symlink("../devices/virtual/block/dm-2"),
+		"block/sdc":       symlink("../devices/pci0/host2/block/sdc"),
+		"dev/block/253:2": symlink("../../devices/virtual/block/dm-2"),
+
+		"devices/pci0/host2/block/sdc/subsystem":      symlink("../../../../../class/block"),
+		"devices/virtual/block/dm-2/subsystem":        symlink("../../../../class/block"),
+		"devices/virtual/block/dm-2/dm/name":          {Data: []byte("mpatha\n")},
+		"devices/virtual/block/dm-2/dm/uuid":          {Data: []byte("mpath-3600a098038303053453f463045727a4b\n")},
+		"devices/virtual/block/dm-2/size":             {Data: []byte("2048\n")},
+		"devices/virtual/block/dm-2/slaves/sdc":       symlink("../../../../pci0/host2/block/sdc"),
+		"devices/virtual/block/dm-2/queue/rotational": {Data: []byte("1\n")},
+	}
+
+	d := NewDiscoverer(WithSysfs(sysfs), WithDeviceMapperNames())
+	d.resolvePath = unresolvedPath
+	d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+		return 253, 2, nil
+	}
+	d.findMount = func(filePath string) (*mountinfo.Info, error) {
+		return &mountinfo.Info{Mountpoint: "/san", FSType: "xfs"}, nil
+	}
+
+	device, err := d.DiscoverDevice(logtest.Scoped(t), "doesn't matter")
+	if err != nil {
+		t.Fatalf("discovering device: %s", err)
+	}
+
+	// the attributes are read from the multipath map's kernel name
+	expected := Device{Name: "mpatha", Major: 253, Minor: 2, Mountpoint: "/san", FSType: "xfs", Rotational: true, Size: 2048 * sysfsSectorSize}
+	if diff := cmp.Diff(expected, device); diff != "" {
+		t.Fatalf("recieved unexpected device (-want +got):\n%s", diff)
+	}
+}
+
+func Test_DeviceMapperType(t *testing.T) {
+	for _, test := range []struct {
+		uuid     string
+		expected string
+	}{
+		{uuid: "CRYPT-LUKS2-abc-luks-abc", expected: "crypt"},
+		{uuid: "LVM-abcdef", expected: "linear"},
+		{uuid: "LVM-abcdef-tpool", expected: "thin-pool"},
+		{uuid: "LVM-abcdef-pool", expected: "thin-pool"},
+		{uuid: "LVM-abcdef-tdata", expected: "thin-pool-data"},
+		{uuid: "LVM-abcdef-tmeta", expected: "thin-pool-metadata"},
+		{uuid: "LVM-abcdef-thin", expected: "thin"},
+		{uuid: "mpath-3600a098038303053453f463045727a4b", expected: "multipath"},
+		{uuid: "part1-mpath-3600a098038303053453f463045727a4b", expected: "partition"},
+		{uuid: "something-else", expected: "unknown"},
+	} {
+		if actual := deviceMapperType(test.uuid); actual != test.expected {
+			t.Errorf("recieved unexpected type for UUID %q (want %q, got %q)", test.uuid, test.expected, actual)
+		}
+	}
+}
+
+func Test_MountSourceDeviceName(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"class/block": {Mode: fs.ModeDir},
+
+		"block/sdb":  symlink("../devices/pci0/host1/block/sdb"),
+		"block/dm-0": symlink("../devices/virtual/block/dm-0"),
+
+		"devices/pci0/host1/block/sdb/subsystem": symlink("../../../../../class/block"),
+		"devices/virtual/block/dm-0/subsystem":   symlink("../../../../class/block"),
+		"devices/virtual/block/dm-0/dm/name":     {Data: []byte("vg0-data\n")},
+		"devices/virtual/block/dm-0/slaves/sdb":  symlink("../../../../pci0/host1/block/sdb"),
+	}
+
+	// a udev symlink that exists on the current system
+	devDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(devDir, "sdb"), nil, 0644); err != nil {
+		t.Fatalf("creating device node: %s", err)
+	}
+
+	byUUID := filepath.Join(devDir, "disk", "by-uuid")
+	if err := os.MkdirAll(byUUID, 0755); err != nil {
+		t.Fatalf("creating udev directory: %s", err)
+	}
+
+	if err := os.Symlink("../../sdb", filepath.Join(byUUID, "2f7c1d9e")); err != nil {
+		t.Fatalf("creating udev symlink: %s", err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{name: "device node", source: "/dev/sdb", expected: "sdb"},
+		{name: "udev symlink", source: filepath.Join(byUUID, "2f7c1d9e"), expected: "sdb"},
+		{name: "device-mapper name missing from /dev", source: "/dev/mapper/vg0-data", expected: "dm-0"},
+		{name: "unknown device-mapper name", source: "/dev/mapper/vg0-missing", expected: "vg0-missing"},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			if actual := mountSourceDeviceName(logtest.Scoped(t), sysfs, test.source); actual != test.expected {
+				t.Fatalf("recieved unexpected device name for %q (want %q, got %q)", test.source, test.expected, actual)
+			}
+		})
+	}
+}
+
+func Test_DiscoverDeviceNames_ThinPoolUnresolved(t *testing.T) {
+	// the thin pool's data device doesn't list the partition that backs it
+	sysfs := fstest.MapFS{
+		"class/block":                            {Mode: fs.ModeDir},
+		"dev/block/254:7":                        symlink("../../devices/virtual/block/dm-7"),
+		"devices/virtual/block/dm-7/dm/uuid":     {Data: []byte("LVM-abcdefthin1\n")},
+		"devices/virtual/block/dm-7/slaves/dm-2": symlink("../../dm-2"),
+		"devices/virtual/block/dm-2/subsystem":   symlink("../../../../class/block"),
+		"devices/virtual/block/dm-2/dm/name":     {Data: []byte("vg0-pool0-tpool\n")},
+		"devices/virtual/block/dm-2/dm/uuid":     {Data: []byte("LVM-abcdefpool0-tpool\n")},
+		"devices/virtual/block/dm-2/slaves/dm-0": symlink("../../dm-0"),
+		"devices/virtual/block/dm-2/slaves/dm-1": symlink("../../dm-1"),
+		"devices/virtual/block/dm-0/dm/uuid":     {Data: []byte("LVM-abcdefpool0-tmeta\n")},
+		"devices/virtual/block/dm-0/slaves/sda1": symlink("../../../../pci0/block/sda/sda1"),
+		"devices/virtual/block/dm-1/dm/uuid":     {Data: []byte("LVM-abcdefpool0-tdata\n")},
+		"devices/virtual/block/dm-1/slaves":      {Mode: fs.ModeDir},
+		"devices/pci0/block/sda/sda1/partition":  {Data: []byte("1\n")},
+	}
+
+	var fallbacks []FallbackReason
+
+	d := NewDiscoverer(WithSysfs(sysfs), WithResolutionFallbacks(func(reason FallbackReason) {
+		fallbacks = append(fallbacks, reason)
+	}))
+	d.resolvePath = unresolvedPath
+	d.getDeviceNumber = func(string) (uint32, uint32, error) {
+		return 254, 7, nil
+	}
+	d.findMount = func(string) (*mountinfo.Info, error) {
+		return &mountinfo.Info{Major: 254, Minor: 7, Mountpoint: "/data", FSType: "ext4"}, nil
+	}
+
+	names, err := d.DiscoverDeviceNames(logtest.Scoped(t), "/data/file")
+	if err != nil {
+		t.Fatalf("discovering device names: %s", err)
+	}
+
+	if diff := cmp.Diff([]string{"vg0-pool0-tpool"}, names); diff != "" {
+		t.Errorf("recieved unexpected device names (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]FallbackReason{FallbackThinPoolUnresolved}, fallbacks); diff != "" {
+		t.Errorf("recieved unexpected fallbacks (-want +got):\n%s", diff)
+	}
+}
+
+// flakySysfs is a sysfs file system whose entries in dev/block can't be found (or are busy)
+// until they have been looked up a few times.
+type flakySysfs struct {
+	fs.FS
+
+	// failures is how many lookups fail, and err is what they fail with
+	failures int
+	err      error
+
+	lookups int
+}
+
+func (f *flakySysfs) Lstat(name string) (fs.FileInfo, error) {
+	if strings.HasPrefix(name, "dev/block/") {
+		f.lookups++
+
+		if f.lookups <= f.failures {
+			return nil, &fs.PathError{Op: "lstat", Path: name, Err: f.err}
+		}
+	}
+
+	return lstat(f.FS, name)
+}
+
+func (f *flakySysfs) ReadLink(name string) (string, error) {
+	return readLink(f.FS, name)
+}
+
+func Test_DiscoverDeviceNames_SysfsRetries(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"class/block":                           {Mode: fs.ModeDir},
+		"dev/block/8:1":                         symlink("../../devices/pci0/block/sda/sda1"),
+		"devices/pci0/block/sda/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sda/sda1/partition": {Data: []byte("1\n")},
+	}
+
+	for _, test := range []struct {
+		name string
+
+		retries  int
+		failures int
+		err      error
+
+		expectError   bool
+		expectLookups int
+	}{
+		{
+			name:          "retries are disabled by default",
+			failures:      1,
+			err:           syscall.ENOENT,
+			expectError:   true,
+			expectLookups: 1,
+		},
+		{
+			name:          "device appears while retrying",
+			retries:       3,
+			failures:      2,
+			err:           syscall.ENOENT,
+			expectLookups: 3,
+		},
+		{
+			name:          "device is busy while retrying",
+			retries:       3,
+			failures:      3,
+			err:           syscall.EBUSY,
+			expectLookups: 4,
+		},
+		{
+			name:          "device doesn't appear before retries run out",
+			retries:       2,
+			failures:      3,
+			err:           syscall.ENOENT,
+			expectError:   true,
+			expectLookups: 3,
+		},
+		{
+			name:          "errors that aren't transient aren't retried",
+			retries:       3,
+			failures:      1,
+			err:           syscall.EACCES,
+			expectError:   true,
+			expectLookups: 1,
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			flaky := &flakySysfs{FS: sysfs, failures: test.failures, err: test.err}
+
+			d := NewDiscoverer(WithSysfs(flaky), WithSysfsRetries(test.retries, time.Millisecond))
+			d.resolvePath = unresolvedPath
+			d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+				return 8, 1, nil
+			}
+			d.findMount = func(filePath string) (*mountinfo.Info, error) {
+				return &mountinfo.Info{Mountpoint: "/", FSType: "ext4"}, nil
+			}
+
+			names, err := d.DiscoverDeviceNames(logtest.Scoped(t), "doesn't matter")
+			if test.expectError != (err != nil) {
+				t.Fatalf("unexpected error state (expected error: %t, got %v)", test.expectError, err)
+			}
+
+			if !test.expectError {
+				if diff := cmp.Diff([]string{"sda"}, names); diff != "" {
+					t.Fatalf("recieved unexpected device names (-want +got):\n%s", diff)
+				}
+			}
+
+			if flaky.lookups != test.expectLookups {
+				t.Fatalf("recieved unexpected number of lookups (want %d, got %d)", test.expectLookups, flaky.lookups)
+			}
+		})
+	}
+
+	t.Run("retries stop once the context is done", func(t *testing.T) {
+		flaky := &flakySysfs{FS: sysfs, failures: 1, err: syscall.ENOENT}
+
+		d := NewDiscoverer(WithSysfs(flaky), WithSysfsRetries(3, time.Hour))
+		d.resolvePath = unresolvedPath
+		d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+			return 8, 1, nil
+		}
+		d.findMount = func(filePath string) (*mountinfo.Info, error) {
+			return &mountinfo.Info{Mountpoint: "/", FSType: "ext4"}, nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if _, err := d.DiscoverDeviceNameContext(ctx, logtest.Scoped(t), "doesn't matter"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected error wrapping context.DeadlineExceeded, got %v", err)
+		}
+	})
+}
+
+func Test_DiscoverDeviceNames_CircularSymlinks(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		sysfs fstest.MapFS
+
+		deviceMajor uint32
+		deviceMinor uint32
+
+		expectedErr error
+	}{
+		{
+			name: "device number links to itself through its disk",
+			sysfs: fstest.MapFS{
+				"class/block":               {Mode: fs.ModeDir},
+				"dev/block/254:1":           symlink("../../devices/virtual/block/vda"),
+				"devices/virtual/block/vda": symlink("../../../dev/block/254:1"),
+			},
+			deviceMajor: 254,
+			deviceMinor: 1,
+			expectedErr: syscall.ELOOP,
+		},
+		{
+			name: "slave links back to its holder",
+			sysfs: fstest.MapFS{
+				"class/block":                            {Mode: fs.ModeDir},
+				"dev/block/254:1":                        symlink("../../devices/virtual/block/dm-1"),
+				"devices/virtual/block/dm-1/slaves/dm-2": symlink("../../dm-2/slaves/dm-1"),
+				"devices/virtual/block/dm-2/slaves/dm-1": symlink("../../dm-1/slaves/dm-2"),
+			},
+			deviceMajor: 254,
+			deviceMinor: 1,
+			expectedErr: syscall.ELOOP,
+		},
+		{
+			name: "partition's disk is the partition itself",
+			sysfs: fstest.MapFS{
+				"class/block":                       {Mode: fs.ModeDir},
+				"dev/block/8:1":                     symlink("../../devices/pci0/block/sda1"),
+				"block/sda":                         symlink("../devices/pci0/block/sda1"),
+				"devices/pci0/block/sda1/partition": {Data: []byte("1\n")},
+				"devices/pci0/block/sda1/subsystem": symlink("../../../../class/block"),
+			},
+			deviceMajor: 8,
+			deviceMinor: 1,
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			d := NewDiscoverer(WithSysfs(test.sysfs))
+			d.resolvePath = unresolvedPath
+			d.getDeviceNumber = func(string) (uint32, uint32, error) {
+				return test.deviceMajor, test.deviceMinor, nil
+			}
+			d.findMount = func(string) (*mountinfo.Info, error) {
+				return nil, errors.New("not mounted")
+			}
+
+			// a resolver that follows the links forever would never return, so give up
+			// on it instead of hanging the test suite
+			errs := make(chan error, 1)
+			go func() {
+				_, err := d.DiscoverDeviceNames(logtest.Scoped(t), "doesn't matter")
+				errs <- err
+			}()
+
+			select {
+			case err := <-errs:
+				if err == nil {
+					t.Fatal("expected error for circular symbolic links, got nil")
+				}
+
+				if test.expectedErr != nil && !errors.Is(err, test.expectedErr) {
+					t.Fatalf("expected error wrapping %v, got %v", test.expectedErr, err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("timed out resolving circular symbolic links")
+			}
+		})
+	}
+}
+
+func Test_DiscoverDeviceNames_SysfsNotMounted(t *testing.T) {
+	d := NewDiscoverer()
+	d.resolvePath = unresolvedPath
+	d.findSysfsMountpoint = func() (string, error) {
+		// an empty mount table
+		return sysfsMountpoint(nil)
+	}
+	d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+		return 8, 1, nil
+	}
+
+	if _, err := d.DiscoverDeviceNames(logtest.Scoped(t), "doesn't matter"); !errors.Is(err, ErrSysfsNotMounted) {
+		t.Fatalf("expected error wrapping ErrSysfsNotMounted, got %v", err)
+	}
+}
+
+func Test_EvalSymlinks(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"a/b/c":    {Data: []byte("file")},
+		"a/link":   symlink("b"),
+		"a/chain":  symlink("link/c"),
+		"a/escape": symlink("../../b"),
+		"a/abs":    symlink("/a/b"),
+		"a/loop":   symlink("loop"),
+		"a/ping":   symlink("pong/c"),
+		"a/pong":   symlink("ping"),
+	}
+
+	for _, test := range []struct {
+		name        string
+		path        string
+		expected    string
+		expectError bool
+	}{
+		{name: "no symbolic links", path: "a/b/c", expected: "a/b/c"},
+		{name: "symbolic link to directory", path: "a/link/c", expected: "a/b/c"},
+		{name: "chained symbolic links", path: "a/chain", expected: "a/b/c"},
+		{name: "points outside of the file system", path: "a/escape", expectError: true},
+		{name: "absolute destination", path: "a/abs", expectError: true},
+		{name: "symbolic link loop", path: "a/loop", expectError: true},
+		{name: "circular chain of symbolic links", path: "a/ping", expectError: true},
+		{name: "doesn't exist", path: "a/missing", expectError: true},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := evalSymlinks(sysfs, test.path)
+			if test.expectError {
+				if err == nil {
+					t.Fatalf("expected error, got %q", actual)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("evaluating symlinks in %q: %s", test.path, err)
+			}
+
+			if actual != test.expected {
+				t.Fatalf("recieved unexpected path (want %q, got %q)", test.expected, actual)
+			}
+		})
+	}
+}
+
+func Test_DiscoverDevice_ResolvesFilePaths(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"class/block":                      {Mode: fs.ModeDir},
+		"dev/block/8:0":                    symlink("../../devices/pci0/block/sda"),
+		"devices/pci0/block/sda/subsystem": symlink("../../../../class/block"),
+	}
+
+	// link is a symbolic link to the data directory, which stores file
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("resolving temporary directory: %s", err)
+	}
+
+	filePath := filepath.Join(dir, "data", "file")
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		t.Fatalf("creating data directory: %s", err)
+	}
+
+	if err := os.WriteFile(filePath, nil, 0644); err != nil {
+		t.Fatalf("creating file: %s", err)
+	}
+
+	if err := os.Symlink(filepath.Join(dir, "data"), filepath.Join(dir, "link")); err != nil {
+		t.Fatalf("creating symbolic link: %s", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getting working directory: %s", err)
+	}
+
+	relativePath, err := filepath.Rel(wd, filePath)
+	if err != nil {
+		t.Fatalf("making %q relative: %s", filePath, err)
+	}
+
+	for _, test := range []struct {
+		name string
+		path string
+	}{
+		{name: "absolute path", path: filePath},
+		{name: "path with parent directory components", path: dir + "/data/../data/./file"},
+		{name: "path through a symbolic link", path: filepath.Join(dir, "link", "file")},
+		{name: "relative path", path: relativePath},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			d := NewDiscoverer(WithSysfs(sysfs))
+			d.getDeviceNumber = func(actualPath string) (major, minor uint32, err error) {
+				if actualPath != filePath {
+					t.Errorf("recieved unexpected file path (want %q, got %q)", filePath, actualPath)
+				}
+
+				return 8, 0, nil
+			}
+			d.findMount = func(actualPath string) (*mountinfo.Info, error) {
+				if actualPath != filePath {
+					t.Errorf("recieved unexpected file path (want %q, got %q)", filePath, actualPath)
+				}
+
+				return &mountinfo.Info{Mountpoint: "/", FSType: "ext4"}, nil
+			}
+
+			device, err := d.DiscoverDevice(logtest.Scoped(t), test.path)
+			if err != nil {
+				t.Fatalf("discovering device: %s", err)
+			}
+
+			if device.Name != "sda" {
+				t.Fatalf("recieved unexpected device name (want %q, got %q)", "sda", device.Name)
+			}
+		})
+	}
+}
+
+func Test_DiscoverDevice_Attributes(t *testing.T) {
+	// sda is a spinning "512e" disk (512 byte logical blocks on 4096 byte physical sectors),
+	// nvme0n1 is a "4Kn" SSD (4096 byte logical blocks), sdb is a USB stick, and vda is a
+	// virtual disk that doesn't report any attributes (including its WWN and serial number)
+	sysfs := fstest.MapFS{
+		"class/block": {Mode: fs.ModeDir},
+
+		"dev/block/8:0":   symlink("../../devices/pci0/target0/0:0:0:0/block/sda"),
+		"dev/block/259:0": symlink("../../devices/pci1/nvme/nvme0/nvme0n1"),
+		"dev/block/254:0": symlink("../../devices/virtio0/block/vda"),
+		"dev/block/8:16":  symlink("../../devices/usb1/1-1/host6/target6:0:0/6:0:0:0/block/sdb"),
+
+		"block/sda":     symlink("../devices/pci0/target0/0:0:0:0/block/sda"),
+		"block/nvme0n1": symlink("../devices/pci1/nvme/nvme0/nvme0n1"),
+		"block/vda":     symlink("../devices/virtio0/block/vda"),
+		"block/sdb":     symlink("../devices/usb1/1-1/host6/target6:0:0/6:0:0:0/block/sdb"),
+
+		"devices/pci0/target0/0:0:0:0/model":                               {Data: []byte("ST4000DM004-2CV1    \n")},
+		"devices/pci0/target0/0:0:0:0/wwid":                                {Data: []byte("naa.5000c500a1b2c3d4\n")},
+		"devices/pci0/target0/0:0:0:0/vpd_pg80":                            {Data: []byte("\x00\x80\x00\x08ZFN0ABCD")},
+		"devices/pci0/target0/0:0:0:0/block/sda/subsystem":                 symlink("../../../../../../class/block"),
+		"devices/pci0/target0/0:0:0:0/block/sda/device":                    symlink("../../../0:0:0:0"),
+		"devices/pci0/target0/0:0:0:0/block/sda/queue/rotational":          {Data: []byte("1\n")},
+		"devices/pci0/target0/0:0:0:0/block/sda/size":                      {Data: []byte("7814037168\n")},
+		"devices/pci0/target0/0:0:0:0/block/sda/queue/logical_block_size":  {Data: []byte("512\n")},
+		"devices/pci0/target0/0:0:0:0/block/sda/queue/physical_block_size": {Data: []byte("4096\n")},
+		"devices/pci0/target0/0:0:0:0/block/sda/removable":                 {Data: []byte("0\n")},
+
+		"devices/pci1/nvme/nvme0/model":                             {Data: []byte("Samsung SSD 970 EVO Plus 1TB           \n")},
+		"devices/pci1/nvme/nvme0/serial":                            {Data: []byte("S4EWNX0R123456A     \n")},
+		"devices/pci1/nvme/nvme0/nvme0n1/wwid":                      {Data: []byte("eui.0025385b71b07e2f\n")},
+		"devices/pci1/nvme/nvme0/nvme0n1/subsystem":                 symlink("../../../../../class/block"),
+		"devices/pci1/nvme/nvme0/nvme0n1/device":                    symlink("../../nvme0"),
+		"devices/pci1/nvme/nvme0/nvme0n1/queue/rotational":          {Data: []byte("0\n")},
+		"devices/pci1/nvme/nvme0/nvme0n1/queue/logical_block_size":  {Data: []byte("4096\n")},
+		"devices/pci1/nvme/nvme0/nvme0n1/queue/physical_block_size": {Data: []byte("4096\n")},
+
+		"devices/usb1/1-1/host6/target6:0:0/6:0:0:0/model":                      {Data: []byte("Ultra Fit       \n")},
+		"devices/usb1/1-1/host6/target6:0:0/6:0:0:0/block/sdb/subsystem":        symlink("../../../../../../../../class/block"),
+		"devices/usb1/1-1/host6/target6:0:0/6:0:0:0/block/sdb/device":           symlink("../../../6:0:0:0"),
+		"devices/usb1/1-1/host6/target6:0:0/6:0:0:0/block/sdb/removable":        {Data: []byte("1\n")},
+		"devices/usb1/1-1/host6/target6:0:0/6:0:0:0/block/sdb/size":             {Data: []byte("60063744\n")},
+		"devices/usb1/1-1/host6/target6:0:0/6:0:0:0/block/sdb/queue/rotational": {Data: []byte("1\n")},
+
+		"devices/virtio0/block/vda/subsystem": symlink("../../../../class/block"),
+	}
+
+	for _, test := range []struct {
+		name string
+
+		deviceMajor uint32
+		deviceMinor uint32
+
+		expectedRotational bool
+		expectedModel      string
+		expectedSize       uint64
+		expectedRemovable  bool
+
+		expectedLogicalBlockSize  uint64
+		expectedPhysicalBlockSize uint64
+
+		expectedWWN    string
+		expectedSerial string
+	}{
+		{
+			name:               "spinning disk",
+			deviceMajor:        8,
+			deviceMinor:        0,
+			expectedRotational: true,
+			expectedModel:      "ST4000DM004-2CV1",
+			expectedSize:       4000787030016,
+
+			expectedLogicalBlockSize:  512,
+			expectedPhysicalBlockSize: 4096,
+
+			expectedWWN:    "naa.5000c500a1b2c3d4",
+			expectedSerial: "ZFN0ABCD",
+		},
+		{
+			name:               "ssd",
+			deviceMajor:        259,
+			deviceMinor:        0,
+			expectedRotational: false,
+			expectedModel:      "Samsung SSD 970 EVO Plus 1TB",
+
+			expectedLogicalBlockSize:  4096,
+			expectedPhysicalBlockSize: 4096,
+
+			expectedWWN:    "eui.0025385b71b07e2f",
+			expectedSerial: "S4EWNX0R123456A",
+		},
+		{
+			name:               "usb stick",
+			deviceMajor:        8,
+			deviceMinor:        16,
+			expectedRotational: true,
+			expectedModel:      "Ultra Fit",
+			expectedSize:       30752636928,
+			expectedRemovable:  true,
+		},
+		{
+			name:               "virtual disk without attributes",
+			deviceMajor:        254,
+			deviceMinor:        0,
+			expectedRotational: false,
+			expectedModel:      "",
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			d := NewDiscoverer(WithSysfs(sysfs))
+			d.resolvePath = unresolvedPath
+			d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+				return test.deviceMajor, test.deviceMinor, nil
+			}
+			d.findMount = func(filePath string) (*mountinfo.Info, error) {
+				return &mountinfo.Info{Mountpoint: "/", FSType: "ext4"}, nil
+			}
+
+			device, err := d.DiscoverDevice(logtest.Scoped(t), "doesn't matter")
+			if err != nil {
+				t.Fatalf("discovering device: %s", err)
+			}
+
+			if device.Rotational != test.expectedRotational {
+				t.Fatalf("recieved unexpected rotational flag (want %t, got %t)", test.expectedRotational, device.Rotational)
+			}
+
+			if device.Model != test.expectedModel {
+				t.Fatalf("recieved unexpected model (want %q, got %q)", test.expectedModel, device.Model)
+			}
+
+			if device.Size != test.expectedSize {
+				t.Fatalf("recieved unexpected size (want %d, got %d)", test.expectedSize, device.Size)
+			}
+
+			if device.Removable != test.expectedRemovable {
+				t.Fatalf("recieved unexpected removable flag (want %t, got %t)", test.expectedRemovable, device.Removable)
+			}
+
+			if device.LogicalBlockSize != test.expectedLogicalBlockSize || device.PhysicalBlockSize != test.expectedPhysicalBlockSize {
+				t.Fatalf("recieved unexpected block sizes (want %d/%d, got %d/%d)", test.expectedLogicalBlockSize, test.expectedPhysicalBlockSize, device.LogicalBlockSize, device.PhysicalBlockSize)
+			}
+
+			if device.WWN != test.expectedWWN {
+				t.Fatalf("recieved unexpected WWN (want %q, got %q)", test.expectedWWN, device.WWN)
+			}
+
+			if device.Serial != test.expectedSerial {
+				t.Fatalf("recieved unexpected serial (want %q, got %q)", test.expectedSerial, device.Serial)
+			}
+		})
+	}
+}
+
+// FuzzDiscoverBlockDeviceNames feeds arbitrary sysfs layouts and device numbers to the logic that
+// maps a device number to the names of its block devices, to make sure that it's safe to run
+// against an untrusted sysfs (e.x. one that's bind-mounted into a container).
+//
+// Each line of layout describes one entry of the sysfs tree:
+//   - "<name> -> <target>" is a symbolic link to target
+//   - "<name>: <data>" is a file that contains data
+//   - "<name>" is a directory
+func FuzzDiscoverBlockDeviceNames(f *testing.F) {
+	f.Add(strings.Join([]string{
+		"class/block",
+		"dev/block/8:1 -> ../../devices/pci0/block/sda/sda1",
+		"devices/pci0/block/sda/subsystem -> ../../../../class/block",
+		"devices/pci0/block/sda/sda1/partition: 1",
+	}, "\n"), "8:1")
+	f.Add(strings.Join([]string{
+		"class/block",
+		"dev/block/9:0 -> ../../devices/virtual/block/md0",
+		"devices/virtual/block/md0/subsystem -> ../../../../class/block",
+		"devices/virtual/block/md0/slaves/sda -> ../../../../pci0/block/sda",
+		"devices/virtual/block/md0/slaves/md0 -> ../../md0",
+		"devices/pci0/block/sda/subsystem -> ../../../../class/block",
+	}, "\n"), "9:0")
+	f.Add(strings.Join([]string{
+		"class/block",
+		"block/loop0 -> ../devices/virtual/block/loop0",
+		"dev/block/7:0 -> ../../devices/virtual/block/loop0",
+		"devices/virtual/block/loop0/subsystem -> ../../../../class/block",
+		"devices/virtual/block/loop0/loop/backing_file: /data/disk.img",
+	}, "\n"), "7:0")
+	f.Add("dev/block/1:1 -> ../../../etc\ndev/block/1:2 -> /etc\ndev/block/1:3 -> 1:3", "1:1")
+	f.Add("partition: 1\nsubsystem -> class/block\nclass/block", "../..")
+
+	f.Fuzz(func(t *testing.T, layout, deviceNumber string) {
+		sysfs := fstest.MapFS{}
+
+		for _, line := range strings.Split(layout, "\n") {
+			var file fstest.MapFile
+
+			name := line
+			if before, after, ok := strings.Cut(line, " -> "); ok {
+				name, file = before, *symlink(after)
+			} else if before, after, ok := strings.Cut(line, ": "); ok {
+				name, file = before, fstest.MapFile{Data: []byte(after)}
+			} else {
+				file.Mode = fs.ModeDir
+			}
+
+			if !fs.ValidPath(name) || name == "." {
+				continue
+			}
+
+			sysfs[name] = &file
+		}
+
+		d := NewDiscoverer(WithSysfs(sysfs))
+		d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+			// don't let the backing files of loop devices refer to the host's files
+			return 0, 0, errors.New("not supported")
+		}
+
+		devicePath, err := discoverSysfsDevicePath(sysfs, deviceNumber)
+		if err != nil {
+			return
+		}
+
+		if !fs.ValidPath(devicePath) {
+			t.Fatalf("device path %q points outside of sysfs", devicePath)
+		}
+
+		names, err := d.resolveDevicePaths(context.Background(), logtest.NoOp(t), sysfs, []string{devicePath})
+		if err != nil {
+			return
+		}
+
+		for _, name := range names {
+			if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+				t.Fatalf("invalid device name %q", name)
+			}
+		}
+	})
+}
+
+func Test_DiscoverDevice_CompressedRAM(t *testing.T) {
+	// zram0 stores /tmp compressed in memory, and doesn't have a parent disk
+	sysfs := fstest.MapFS{
+		"class/block":     {Mode: fs.ModeDir},
+		"dev/block/252:0": symlink("../../devices/virtual/block/zram0"),
+		"block/zram0":     symlink("../devices/virtual/block/zram0"),
+
+		"devices/virtual/block/zram0/subsystem":                 symlink("../../../../class/block"),
+		"devices/virtual/block/zram0/size":                      {Data: []byte("16777216\n")},
+		"devices/virtual/block/zram0/queue/rotational":          {Data: []byte("1\n")},
+		"devices/virtual/block/zram0/queue/logical_block_size":  {Data: []byte("4096\n")},
+		"devices/virtual/block/zram0/queue/physical_block_size": {Data: []byte("4096\n")},
+	}
+
+	d := NewDiscoverer(WithSysfs(sysfs))
+	d.resolvePath = unresolvedPath
+	d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+		return 252, 0, nil
+	}
+	d.findMount = func(filePath string) (*mountinfo.Info, error) {
+		return &mountinfo.Info{Mountpoint: "/tmp", FSType: "ext4"}, nil
+	}
+
+	device, err := d.DiscoverDevice(logtest.Scoped(t), "doesn't matter")
+	if err != nil {
+		t.Fatalf("discovering device: %s", err)
+	}
+
+	// the physical disk attributes aren't read, even if the device reports them
+	expected := Device{
+		Name:              "zram0",
+		Major:             252,
+		Minor:             0,
+		Mountpoint:        "/tmp",
+		FSType:            "ext4",
+		Size:              16777216 * sysfsSectorSize,
+		LogicalBlockSize:  4096,
+		PhysicalBlockSize: 4096,
+		CompressedRAM:     true,
+	}
+
+	if diff := cmp.Diff(expected, device); diff != "" {
+		t.Fatalf("recieved unexpected device (-want +got):\n%s", diff)
+	}
+}
+
+func Test_SameDevice(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"class/block":                           {Mode: fs.ModeDir},
+		"dev/block/8:1":                         symlink("../../devices/pci0/block/sda/sda1"),
+		"dev/block/8:2":                         symlink("../../devices/pci0/block/sda/sda2"),
+		"dev/block/8:17":                        symlink("../../devices/pci0/block/sdb/sdb1"),
+		"devices/pci0/block/sda/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sda/sda1/partition": {Data: []byte("1\n")},
+		"devices/pci0/block/sda/sda2/partition": {Data: []byte("2\n")},
+		"devices/pci0/block/sdb/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sdb/sdb1/partition": {Data: []byte("1\n")},
+	}
+
+	deviceNumbers := map[string][2]uint32{
+		"/data/index":  {8, 1},
+		"/data/logs":   {8, 1},
+		"/backup":      {8, 2},
+		"/scratch":     {8, 17},
+		"/data/broken": {8, 99},
+	}
+
+	d := NewDiscoverer(WithSysfs(sysfs))
+	d.resolvePath = unresolvedPath
+	d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+		number, ok := deviceNumbers[filePath]
+		if !ok {
+			return 0, 0, fmt.Errorf("stat %s: %w", filePath, fs.ErrNotExist)
+		}
+
+		return number[0], number[1], nil
+	}
+	d.findMount = func(filePath string) (*mountinfo.Info, error) {
+		return &mountinfo.Info{Mountpoint: "/", FSType: "ext4"}, nil
+	}
+
+	for _, test := range []struct {
+		name string
+		a, b string
+
+		expected bool
+	}{
+		{name: "same filesystem", a: "/data/index", b: "/data/logs", expected: true},
+		{name: "different partitions of the same disk", a: "/data/index", b: "/backup", expected: true},
+		{name: "different disks", a: "/data/index", b: "/scratch", expected: false},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := d.SameDevice(test.a, test.b)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if actual != test.expected {
+				t.Fatalf("recieved unexpected result for %q and %q (want %t, got %t)", test.a, test.b, test.expected, actual)
+			}
+		})
+	}
+
+	for _, b := range []string{"/data/broken", "/missing"} {
+		if _, err := d.SameDevice("/data/index", b); err == nil {
+			t.Errorf("expected error for %q, got nil", b)
+		}
+	}
+
+	if _, err := d.SameDevice("/missing", "/data/index"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected error wrapping fs.ErrNotExist, got %v", err)
+	}
+}
+
+func Test_WithWholeDiskOnly(t *testing.T) {
+	// sda1 is a partition of sda, dm-0 is a device-mapper device that doesn't list the devices
+	// that back it, and dm-1 is a multipath map over sdb and sdc
+	sysfs := fstest.MapFS{
+		"class/block": {Mode: fs.ModeDir},
+
+		"dev/block/8:1":   symlink("../../devices/pci0/block/sda/sda1"),
+		"dev/block/253:0": symlink("../../devices/virtual/block/dm-0"),
+		"dev/block/253:1": symlink("../../devices/virtual/block/dm-1"),
+
+		"block/sda":  symlink("../devices/pci0/block/sda"),
+		"block/sdb":  symlink("../devices/pci0/block/sdb"),
+		"block/sdc":  symlink("../devices/pci0/block/sdc"),
+		"block/dm-0": symlink("../devices/virtual/block/dm-0"),
+		"block/dm-1": symlink("../devices/virtual/block/dm-1"),
+
+		"devices/pci0/block/sda/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sda/sda1/partition": {Data: []byte("1\n")},
+		"devices/pci0/block/sdb/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sdc/subsystem":      symlink("../../../../class/block"),
+
+		"devices/virtual/block/dm-0/subsystem": symlink("../../../../class/block"),
+		"devices/virtual/block/dm-0/slaves":    {Mode: fs.ModeDir},
+
+		"devices/virtual/block/dm-1/subsystem":  symlink("../../../../class/block"),
+		"devices/virtual/block/dm-1/dm/name":    {Data: []byte("mpatha\n")},
+		"devices/virtual/block/dm-1/dm/uuid":    {Data: []byte("mpath-3600508b400105e210000900000490000\n")},
+		"devices/virtual/block/dm-1/slaves/sdb": symlink("../../../../pci0/block/sdb"),
+		"devices/virtual/block/dm-1/slaves/sdc": symlink("../../../../pci0/block/sdc"),
+	}
+
+	for _, test := range []struct {
+		name        string
+		deviceMajor uint32
+		deviceMinor uint32
+		opts        []Option
+
+		expectedDeviceNames []string
+		expectedErr         error
+	}{
+		{
+			name:                "partition",
+			deviceMajor:         8,
+			deviceMinor:         1,
+			expectedDeviceNames: []string{"sda"},
+		},
+		{
+			name:                "multipath map",
+			deviceMajor:         253,
+			deviceMinor:         1,
+			expectedDeviceNames: []string{"sdb", "sdc"},
+		},
+		{
+			name:        "device-mapper device without slaves",
+			deviceMajor: 253,
+			deviceMinor: 0,
+			expectedErr: ErrNotWholeDisk,
+		},
+		{
+			name:        "multipath map that's kept by name",
+			deviceMajor: 253,
+			deviceMinor: 1,
+			opts:        []Option{WithDeviceMapperNames()},
+			expectedErr: ErrNotWholeDisk,
+		},
+		{
+			name:        "filesystem that isn't backed by a block device",
+			deviceMajor: 0,
+			deviceMinor: 50,
+			expectedErr: ErrNoBlockDevice,
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			d := NewDiscoverer(append([]Option{WithSysfs(sysfs), WithWholeDiskOnly()}, test.opts...)...)
+			d.resolvePath = unresolvedPath
+			d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+				return test.deviceMajor, test.deviceMinor, nil
+			}
+			d.findMount = func(filePath string) (*mountinfo.Info, error) {
+				if test.deviceMajor == 0 {
+					return &mountinfo.Info{Mountpoint: "/mnt", FSType: "nfs4"}, nil
+				}
+
+				return &mountinfo.Info{Mountpoint: "/", FSType: "ext4"}, nil
+			}
+
+			names, err := d.DiscoverDeviceNames(logtest.Scoped(t), "doesn't matter")
+			if test.expectedErr != nil {
+				if !errors.Is(err, test.expectedErr) {
+					t.Fatalf("expected error wrapping %q, got %v (device names %q)", test.expectedErr, err, names)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if diff := cmp.Diff(test.expectedDeviceNames, names); diff != "" {
+				t.Fatalf("recieved unexpected device names (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package mountinfo
+
+import (
+	"context"
+	"sync"
+
+	sglog "github.com/sourcegraph/log"
+	"go.uber.org/zap/zapcore"
+)
+
+// TraceStep is a single step that was taken while discovering the device that a file path is
+// stored on (example: following a virtual device to the devices that back it).
+type TraceStep struct {
+	// Message describes the step (example: "discovered device path").
+	Message string
+
+	// Attributes contains the details of the step (example: {"devicePath": "devices/virtual/block/dm-0"}).
+	Attributes map[string]interface{}
+}
+
+// DiscoverDeviceTrace returns the name of the block device that filePath is stored on, along with
+// the ordered list of steps that discovery took to find it (example: the mount that was found, the
+// device number, the sysfs entries that were followed, the partitions that were stripped, etc.)
+//
+// The steps are returned even if discovery fails, since they're most useful for explaining why
+// a file path resolved to a surprising device (or to no device at all). All of the steps are also
+// logged to logger at debug level.
+//
+// See the doc comment for NewCollector for the list of supported operating systems.
+func (d *Discoverer) DiscoverDeviceTrace(logger sglog.Logger, filePath string) (string, []TraceStep, error) {
+	t := &trace{}
+
+	device, err := d.discoverDeviceAt(context.Background(), &traceLogger{Logger: logger, trace: t}, filePath)
+	if err != nil {
+		return "", t.steps, err
+	}
+
+	return device.Name, t.steps, nil
+}
+
+// DiscoverDeviceTrace calls DiscoverDeviceTrace on a Discoverer that inspects the current system.
+func DiscoverDeviceTrace(logger sglog.Logger, filePath string) (string, []TraceStep, error) {
+	return defaultDiscoverer.DiscoverDeviceTrace(logger, filePath)
+}
+
+// trace collects the steps that are logged by a traceLogger (and all of the loggers derived from it).
+type trace struct {
+	// mu protects steps
+	mu    sync.Mutex
+	steps []TraceStep
+}
+
+// traceLogger is a logger that records every message that's logged through it as a step of
+// a trace, and then forwards it to the wrapped logger.
+type traceLogger struct {
+	sglog.Logger
+
+	trace *trace
+
+	// fields contains the fields that have been attached to the logger with With
+	fields []sglog.Field
+}
+
+func (l *traceLogger) Scoped(scope string) sglog.Logger {
+	return &traceLogger{Logger: l.Logger.Scoped(scope), trace: l.trace, fields: l.fields}
+}
+
+func (l *traceLogger) With(fields ...sglog.Field) sglog.Logger {
+	return &traceLogger{
+		Logger: l.Logger.With(fields...),
+		trace:  l.trace,
+		fields: append(append([]sglog.Field(nil), l.fields...), fields...),
+	}
+}
+
+func (l *traceLogger) WithTrace(tc sglog.TraceContext) sglog.Logger {
+	return &traceLogger{Logger: l.Logger.WithTrace(tc), trace: l.trace, fields: l.fields}
+}
+
+func (l *traceLogger) AddCallerSkip(skip int) sglog.Logger {
+	return &traceLogger{Logger: l.Logger.AddCallerSkip(skip), trace: l.trace, fields: l.fields}
+}
+
+func (l *traceLogger) IncreaseLevel(scope string, description string, level sglog.Level) sglog.Logger {
+	// the level only applies to the wrapped logger, all steps are still recorded
+	return &traceLogger{Logger: l.Logger.IncreaseLevel(scope, description, level), trace: l.trace, fields: l.fields}
+}
+
+func (l *traceLogger) Debug(message string, fields ...sglog.Field) {
+	l.record(message, fields)
+	l.Logger.Debug(message, fields...)
+}
+
+func (l *traceLogger) Info(message string, fields ...sglog.Field) {
+	l.record(message, fields)
+	l.Logger.Info(message, fields...)
+}
+
+func (l *traceLogger) Warn(message string, fields ...sglog.Field) {
+	l.record(message, fields)
+	l.Logger.Warn(message, fields...)
+}
+
+func (l *traceLogger) Error(message string, fields ...sglog.Field) {
+	l.record(message, fields)
+	l.Logger.Error(message, fields...)
+}
+
+// record adds a step with the provided message and fields (along with the fields that have
+// been attached to the logger) to the trace.
+func (l *traceLogger) record(message string, fields []sglog.Field) {
+	encoder := zapcore.NewMapObjectEncoder()
+	for _, field := range l.fields {
+		field.AddTo(encoder)
+	}
+
+	for _, field := range fields {
+		field.AddTo(encoder)
+	}
+
+	l.trace.mu.Lock()
+	defer l.trace.mu.Unlock()
+
+	l.trace.steps = append(l.trace.steps, TraceStep{Message: message, Attributes: encoder.Fields})
+}
@@ -0,0 +1,196 @@
+package mountinfo
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/moby/sys/mountinfo"
+	"github.com/sourcegraph/log/logtest"
+)
+
+func Test_DiscoverDeviceTrace(t *testing.T) {
+	// dm-0 is an LVM logical volume on sda1, and mem/null is a character device that isn't
+	// part of the block subsystem
+	sysfs := fstest.MapFS{
+		"class/block": {Mode: fs.ModeDir},
+		"class/mem":   {Mode: fs.ModeDir},
+
+		"dev/block/253:0": symlink("../../devices/virtual/block/dm-0"),
+		"dev/block/1:3":   symlink("../../devices/virtual/mem/null"),
+
+		"devices/pci0/block/sda/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sda/sda1/partition": {Data: []byte("1\n")},
+
+		"devices/virtual/block/dm-0/subsystem":   symlink("../../../../class/block"),
+		"devices/virtual/block/dm-0/dm/name":     {Data: []byte("vg0-data\n")},
+		"devices/virtual/block/dm-0/dm/uuid":     {Data: []byte("LVM-abcdef\n")},
+		"devices/virtual/block/dm-0/slaves/sda1": symlink("../../../../pci0/block/sda/sda1"),
+
+		"devices/virtual/mem/null/subsystem": symlink("../../../../class/mem"),
+	}
+
+	for _, test := range []struct {
+		name string
+
+		deviceMajor uint32
+		deviceMinor uint32
+
+		expectedName     string
+		expectedMessages []string
+		expectError      bool
+	}{
+		{
+			name:         "partition behind logical volume",
+			deviceMajor:  253,
+			deviceMinor:  0,
+			expectedName: "sda",
+			expectedMessages: []string{
+				"discovered mount",
+				"discovered device number",
+				"discovered device path",
+				"traversing device-mapper device",
+				"resolved slave",
+				"stripped partition",
+				"discovered device",
+			},
+		},
+		{
+			name:        "steps are returned on failure",
+			deviceMajor: 1,
+			deviceMinor: 3,
+			expectedMessages: []string{
+				"discovered mount",
+				"discovered device number",
+				"discovered device path",
+			},
+			expectError: true,
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			d := NewDiscoverer(WithSysfs(sysfs))
+			d.resolvePath = unresolvedPath
+			d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+				return test.deviceMajor, test.deviceMinor, nil
+			}
+			d.findMount = func(filePath string) (*mountinfo.Info, error) {
+				return &mountinfo.Info{Mountpoint: "/data", FSType: "ext4"}, nil
+			}
+
+			name, steps, err := d.DiscoverDeviceTrace(logtest.Scoped(t), "doesn't matter")
+			if test.expectError != (err != nil) {
+				t.Fatalf("unexpected error state (expected error: %t, got %v)", test.expectError, err)
+			}
+
+			if name != test.expectedName {
+				t.Errorf("recieved unexpected device name (want %q, got %q)", test.expectedName, name)
+			}
+
+			var actualMessages []string
+			for _, step := range steps {
+				actualMessages = append(actualMessages, step.Message)
+			}
+
+			if diff := cmp.Diff(test.expectedMessages, actualMessages); diff != "" {
+				t.Fatalf("recieved unexpected trace steps (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_DiscoverDeviceTrace_Attributes(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"class/block": {Mode: fs.ModeDir},
+
+		"dev/block/8:1": symlink("../../devices/pci0/block/sda/sda1"),
+
+		"devices/pci0/block/sda/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sda/sda1/partition": {Data: []byte("1\n")},
+	}
+
+	d := NewDiscoverer(WithSysfs(sysfs))
+	d.resolvePath = unresolvedPath
+	d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+		return 8, 1, nil
+	}
+	d.findMount = func(filePath string) (*mountinfo.Info, error) {
+		return &mountinfo.Info{Mountpoint: "/", FSType: "ext4"}, nil
+	}
+
+	_, steps, err := d.DiscoverDeviceTrace(logtest.Scoped(t), "doesn't matter")
+	if err != nil {
+		t.Fatalf("discovering device: %s", err)
+	}
+
+	expected := []TraceStep{
+		{Message: "discovered mount", Attributes: map[string]interface{}{"mountpoint": "/", "fsType": "ext4"}},
+		{Message: "discovered device number", Attributes: map[string]interface{}{"deviceNumber": "8:1", "major": int64(8), "minor": int64(1)}},
+		{Message: "discovered device path", Attributes: map[string]interface{}{"devicePath": "devices/pci0/block/sda/sda1"}},
+		{Message: "stripped partition", Attributes: map[string]interface{}{"partitionPath": "devices/pci0/block/sda/sda1", "diskPath": "devices/pci0/block/sda"}},
+		{Message: "discovered device", Attributes: map[string]interface{}{"device": "sda", "major": int64(8), "minor": int64(1), "mountpoint": "/"}},
+	}
+
+	if diff := cmp.Diff(expected, steps); diff != "" {
+		t.Fatalf("recieved unexpected trace steps (-want +got):\n%s", diff)
+	}
+}
+
+func Test_DiscoverDeviceTrace_AmbiguousDisk(t *testing.T) {
+	// sda1 is nested in the directory of the sda disk on host0, but block/sda points to a
+	// (stale) sda disk on host1, so both disks could contain the partition
+	sysfs := fstest.MapFS{
+		"class/block": {Mode: fs.ModeDir},
+
+		"block/sda":     symlink("../devices/pci0/host1/block/sda"),
+		"dev/block/8:1": symlink("../../devices/pci0/host0/block/sda/sda1"),
+
+		"devices/pci0/host0/block/sda/subsystem":      symlink("../../../../../class/block"),
+		"devices/pci0/host0/block/sda/sda1/partition": {Data: []byte("1\n")},
+		"devices/pci0/host1/block/sda/subsystem":      symlink("../../../../../class/block"),
+	}
+
+	d := NewDiscoverer(WithSysfs(sysfs))
+	d.resolvePath = unresolvedPath
+	d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+		return 8, 1, nil
+	}
+	d.findMount = func(filePath string) (*mountinfo.Info, error) {
+		return &mountinfo.Info{Mountpoint: "/", FSType: "ext4"}, nil
+	}
+
+	name, steps, err := d.DiscoverDeviceTrace(logtest.Scoped(t), "doesn't matter")
+	if err != nil {
+		t.Fatalf("discovering device: %s", err)
+	}
+
+	if name != "sda" {
+		t.Errorf("recieved unexpected device name (want %q, got %q)", "sda", name)
+	}
+
+	expected := []TraceStep{
+		{Message: "multiple disks match partition", Attributes: map[string]interface{}{
+			"partitionPath": "devices/pci0/host0/block/sda/sda1",
+			"parentPath":    "devices/pci0/host0/block/sda",
+			"diskPath":      "devices/pci0/host1/block/sda",
+		}},
+		// the disk that the partition is nested in is picked
+		{Message: "stripped partition", Attributes: map[string]interface{}{
+			"partitionPath": "devices/pci0/host0/block/sda/sda1",
+			"diskPath":      "devices/pci0/host0/block/sda",
+		}},
+	}
+
+	var actual []TraceStep
+	for _, step := range steps {
+		if step.Message == "multiple disks match partition" || step.Message == "stripped partition" {
+			actual = append(actual, step)
+		}
+	}
+
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("recieved unexpected trace steps (-want +got):\n%s", diff)
+	}
+}
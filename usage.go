@@ -0,0 +1,30 @@
+package mountinfo
+
+// Usage describes the capacity of the filesystem that a file path is stored on.
+type Usage struct {
+	// Total is the size of the filesystem, in bytes.
+	Total uint64
+
+	// Free is the number of bytes that are free on the filesystem, including
+	// any space that's reserved for privileged users.
+	Free uint64
+
+	// Available is the number of bytes that are available to unprivileged users.
+	Available uint64
+
+	// Inodes is the total number of inodes on the filesystem. It's zero on
+	// operating systems that don't report inode counts (Windows).
+	Inodes uint64
+
+	// InodesFree is the number of free inodes on the filesystem. It's zero on
+	// operating systems that don't report inode counts (Windows).
+	InodesFree uint64
+}
+
+// DiskUsage returns the capacity of the filesystem that filePath is stored on.
+//
+// This operation is supported on Linux, macOS, FreeBSD, and Windows. On all other
+// operating systems, the returned error wraps ErrUnsupportedPlatform.
+func DiskUsage(filePath string) (Usage, error) {
+	return diskUsage(filePath)
+}
@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || freebsd || windows)
+
+package mountinfo
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func diskUsage(filePath string) (Usage, error) {
+	return Usage{}, fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
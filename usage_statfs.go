@@ -0,0 +1,42 @@
+//go:build linux || darwin || freebsd
+
+package mountinfo
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// diskUsage returns the capacity of the filesystem that filePath is stored on.
+func diskUsage(filePath string) (Usage, error) {
+	var stat unix.Statfs_t
+	err := unix.Statfs(filePath, &stat)
+	if err != nil {
+		return Usage{}, fmt.Errorf("diskUsage: failed to statfs %q: %w", filePath, err)
+	}
+
+	// the field types of Statfs_t differ between operating systems (and architectures), so
+	// everything is converted explicitly
+	blockSize := uint64(stat.Bsize)
+
+	// FreeBSD reports the available blocks and free inodes as signed values, which are negative
+	// once the reserved space is being used
+	available := int64(stat.Bavail)
+	if available < 0 {
+		available = 0
+	}
+
+	inodesFree := int64(stat.Ffree)
+	if inodesFree < 0 {
+		inodesFree = 0
+	}
+
+	return Usage{
+		Total:      uint64(stat.Blocks) * blockSize,
+		Free:       uint64(stat.Bfree) * blockSize,
+		Available:  uint64(available) * blockSize,
+		Inodes:     uint64(stat.Files),
+		InodesFree: uint64(inodesFree),
+	}, nil
+}
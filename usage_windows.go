@@ -0,0 +1,25 @@
+package mountinfo
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// diskUsage returns the capacity of the volume that filePath is stored on.
+//
+// Windows doesn't report inode counts, so Inodes and InodesFree are always zero.
+func diskUsage(filePath string) (Usage, error) {
+	path, err := windows.UTF16PtrFromString(filePath)
+	if err != nil {
+		return Usage{}, fmt.Errorf("diskUsage: %w", err)
+	}
+
+	var usage Usage
+	err = windows.GetDiskFreeSpaceEx(path, &usage.Available, &usage.Total, &usage.Free)
+	if err != nil {
+		return Usage{}, fmt.Errorf("diskUsage: GetDiskFreeSpaceExW(%q): %w", filePath, err)
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,115 @@
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+
+	sglog "github.com/sourcegraph/log"
+)
+
+// DeviceEvent reports that the block device that a watched file path is stored on has changed.
+type DeviceEvent struct {
+	// Path is the watched file path, as it was passed to WatchDevices.
+	Path string
+
+	// Device describes the block device that Path is now stored on. Device is empty if Err is set.
+	Device Device
+
+	// Err describes why the block device that Path is now stored on couldn't be discovered
+	// (e.x. because Path has been deleted), or nil if discovery succeeded.
+	Err error
+}
+
+// WatchDevices watches the mount table, and sends an event on the returned channel whenever the
+// block device that one of the provided file paths is stored on changes (e.x. because a volume
+// was remounted, or a hot-plugged disk was mounted over one of the file paths).
+//
+// The devices of the file paths are discovered when WatchDevices is called, and are re-discovered
+// every time that the mount table changes. An event is only sent for a file path if its device
+// differs from the last time that it was discovered (including if discovery started or stopped
+// failing). Events aren't buffered, so callers must keep receiving from the channel. The channel
+// is closed once ctx is done, or if the mount table can't be watched anymore.
+//
+// WatchDevices currently works only on Linux-based operating systems. On all other operating
+// systems, it returns an error that wraps ErrUnsupportedPlatform.
+func (d *Discoverer) WatchDevices(ctx context.Context, logger sglog.Logger, paths []string) (<-chan DeviceEvent, error) {
+	changes, err := d.watchMountTable(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("WatchDevices: %w", err)
+	}
+
+	discover := func(filePath string) DeviceEvent {
+		device, err := d.discoverDeviceAt(ctx, logger.With(sglog.String("path", filePath)), filePath)
+		return DeviceEvent{Path: filePath, Device: device, Err: err}
+	}
+
+	// the last event for each file path (including the ones that weren't sent because
+	// they describe the devices that the file paths were stored on initially)
+	last := make(map[string]DeviceEvent, len(paths))
+
+	var watched []string
+	for _, filePath := range paths {
+		if _, ok := last[filePath]; ok {
+			continue
+		}
+
+		last[filePath] = discover(filePath)
+		watched = append(watched, filePath)
+	}
+
+	events := make(chan DeviceEvent)
+
+	go func() {
+		defer close(events)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-changes:
+				if !ok {
+					return
+				}
+			}
+
+			logger.Debug("mount table changed")
+
+			for _, filePath := range watched {
+				event := discover(filePath)
+				if ctx.Err() != nil {
+					// discovery was aborted, so the event doesn't describe an actual change
+					return
+				}
+
+				if !deviceChanged(last[filePath], event) {
+					continue
+				}
+
+				last[filePath] = event
+
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// WatchDevices calls WatchDevices on a Discoverer that inspects the current system.
+func WatchDevices(ctx context.Context, logger sglog.Logger, paths []string) (<-chan DeviceEvent, error) {
+	return defaultDiscoverer.WatchDevices(ctx, logger, paths)
+}
+
+// deviceChanged returns true if current describes a different device than previous
+// (or if discovery started or stopped failing).
+func deviceChanged(previous, current DeviceEvent) bool {
+	if (previous.Err == nil) != (current.Err == nil) {
+		return true
+	}
+
+	return previous.Device != current.Device
+}
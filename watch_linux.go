@@ -0,0 +1,68 @@
+package mountinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// selfMountinfoPath is the location of the mount table of the current process.
+const selfMountinfoPath = "/proc/self/mountinfo"
+
+// mountTablePollTimeout is how long the mount table watcher waits for the mount table to
+// change before it checks whether it should stop watching.
+const mountTablePollTimeout = time.Second
+
+// mountTableWatcher returns a function that watches the mount table at mountinfoPath (in procfs),
+// and sends a value on the returned channel whenever it changes. The channel is closed once ctx
+// is done, or if the mount table can't be watched anymore.
+//
+// Changes that happen before the previous change has been received are coalesced into it.
+func mountTableWatcher(mountinfoPath string) func(ctx context.Context) (<-chan struct{}, error) {
+	return func(ctx context.Context) (<-chan struct{}, error) {
+		f, err := os.Open(mountinfoPath)
+		if err != nil {
+			// mountinfoPath is either <procfs>/self/mountinfo or <procfs>/1/mountinfo
+			procfs := filepath.Dir(filepath.Dir(mountinfoPath))
+			return nil, fmt.Errorf("watchMountTable: %w", procfsError(procfs, err))
+		}
+
+		changes := make(chan struct{}, 1)
+
+		go func() {
+			defer f.Close()
+			defer close(changes)
+
+			// the kernel reports changes to the mount table as "exceptional conditions" on the
+			// file (see proc(5)), which inotify doesn't support
+			fds := []unix.PollFd{{Fd: int32(f.Fd()), Events: unix.POLLPRI}}
+
+			for ctx.Err() == nil {
+				n, err := unix.Poll(fds, int(mountTablePollTimeout.Milliseconds()))
+				if errors.Is(err, unix.EINTR) {
+					continue
+				}
+
+				if err != nil {
+					return
+				}
+
+				if n == 0 || fds[0].Revents&(unix.POLLPRI|unix.POLLERR) == 0 {
+					continue
+				}
+
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}()
+
+		return changes, nil
+	}
+}
@@ -0,0 +1,142 @@
+package mountinfo
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/moby/sys/mountinfo"
+	"github.com/sourcegraph/log/logtest"
+)
+
+func Test_WatchDevices(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"class/block":                           {Mode: fs.ModeDir},
+		"dev/block/8:1":                         symlink("../../devices/pci0/block/sda/sda1"),
+		"dev/block/8:17":                        symlink("../../devices/pci0/block/sdb/sdb1"),
+		"devices/pci0/block/sda/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sda/sda1/partition": {Data: []byte("1\n")},
+		"devices/pci0/block/sdb/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sdb/sdb1/partition": {Data: []byte("1\n")},
+	}
+
+	var mu sync.Mutex
+	mounts := map[string]*mountinfo.Info{
+		"/data": {Mountpoint: "/data", FSType: "ext4", Major: 8, Minor: 1},
+		"/logs": {Mountpoint: "/logs", FSType: "ext4", Major: 8, Minor: 1},
+	}
+
+	// remount replaces the mount of filePath (or removes it if mount is nil), and reports
+	// that the mount table changed
+	changes := make(chan struct{})
+	remount := func(filePath string, mount *mountinfo.Info) {
+		mu.Lock()
+		if mount == nil {
+			delete(mounts, filePath)
+		} else {
+			mounts[filePath] = mount
+		}
+		mu.Unlock()
+
+		changes <- struct{}{}
+	}
+
+	d := NewDiscoverer(WithSysfs(sysfs))
+	d.resolvePath = unresolvedPath
+	d.findMount = func(filePath string) (*mountinfo.Info, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		mount, ok := mounts[filePath]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+
+		return mount, nil
+	}
+	d.getDeviceNumber = func(filePath string) (major, minor uint32, err error) {
+		return 0, 0, fs.ErrNotExist
+	}
+	d.watchMountTable = func(ctx context.Context) (<-chan struct{}, error) {
+		return changes, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := d.WatchDevices(ctx, logtest.Scoped(t), []string{"/data", "/logs", "/data"})
+	if err != nil {
+		t.Fatalf("watching devices: %s", err)
+	}
+
+	receive := func() DeviceEvent {
+		t.Helper()
+
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for event")
+			return DeviceEvent{}
+		}
+	}
+
+	// /data is moved to another disk
+	go remount("/data", &mountinfo.Info{Mountpoint: "/data", FSType: "xfs", Major: 8, Minor: 17})
+
+	expected := DeviceEvent{Path: "/data", Device: Device{Name: "sdb", Major: 8, Minor: 17, Mountpoint: "/data", FSType: "xfs"}}
+	if diff := cmp.Diff(expected, receive(), cmpopts.EquateErrors()); diff != "" {
+		t.Fatalf("recieved unexpected event (-want +got):\n%s", diff)
+	}
+
+	// /logs is unmounted, so its device can't be discovered anymore (and /data didn't change)
+	go remount("/logs", nil)
+
+	event := receive()
+	if event.Path != "/logs" || event.Err == nil {
+		t.Fatalf("expected event with error for %q, got %+v", "/logs", event)
+	}
+
+	cancel()
+
+	// the channel is closed once the context is done
+	for range events {
+	}
+}
+
+func Test_MountTableWatcher(t *testing.T) {
+	// regular files never report changes
+	mountinfoPath := filepath.Join(t.TempDir(), "mountinfo")
+	if err := os.WriteFile(mountinfoPath, nil, 0644); err != nil {
+		t.Fatalf("writing mount table: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	changes, err := mountTableWatcher(mountinfoPath)(ctx)
+	if err != nil {
+		t.Fatalf("watching mount table: %s", err)
+	}
+
+	cancel()
+
+	select {
+	case _, ok := <-changes:
+		if ok {
+			t.Fatal("expected no changes to be reported")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the changes channel to be closed")
+	}
+
+	if _, err := mountTableWatcher(filepath.Join(t.TempDir(), "missing"))(context.Background()); err == nil {
+		t.Fatal("expected error for missing mount table, got nil")
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package mountinfo
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+const selfMountinfoPath = ""
+
+func mountTableWatcher(mountinfoPath string) func(ctx context.Context) (<-chan struct{}, error) {
+	return func(ctx context.Context) (<-chan struct{}, error) {
+		return nil, fmt.Errorf("%w: not implemented on %s", ErrUnsupportedPlatform, runtime.GOOS)
+	}
+}
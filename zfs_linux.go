@@ -0,0 +1,145 @@
+package mountinfo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/moby/sys/mountinfo"
+	sglog "github.com/sourcegraph/log"
+)
+
+// discoverZFSDeviceNames returns the names of the block devices that store the data of the
+// ZFS pool that the dataset mounted at mount belongs to. For pools that consist of mirror or
+// raidz vdevs, all of the member devices are returned.
+//
+// The pool's vdevs are listed by `zpool status`, so discovery fails if the zpool command
+// isn't installed (or the current process isn't allowed to run it).
+func (d *Discoverer) discoverZFSDeviceNames(ctx context.Context, logger sglog.Logger, sysfs fs.FS, mount *mountinfo.Info) ([]string, error) {
+	if _, err := fs.Stat(sysfs, path.Join("module", "zfs")); err != nil {
+		return nil, fmt.Errorf("zfs dataset %q is mounted at %q, but the zfs kernel module isn't loaded: %w", mount.Source, mount.Mountpoint, err)
+	}
+
+	pool := zfsPoolName(mount.Source)
+
+	// -P prints the full paths of the vdevs, and -L resolves the symlinks in
+	// them (e.x. "/dev/disk/by-id/...") to the actual device nodes
+	output, err := d.runCommand(ctx, "zpool", "status", "-P", "-L", pool)
+	if err != nil {
+		return nil, fmt.Errorf("running zpool status for pool %q: %w", pool, err)
+	}
+
+	vdevs := parseZpoolStatusVdevs(output)
+	if len(vdevs) == 0 {
+		return nil, fmt.Errorf("zpool status didn't list any vdevs of pool %q", pool)
+	}
+
+	logger.Debug("discovered zfs pool vdevs",
+		sglog.String("pool", pool),
+		sglog.Strings("vdevs", vdevs),
+	)
+
+	devicePaths, err := zfsVdevDevicePaths(sysfs, vdevs)
+	if err != nil {
+		return nil, fmt.Errorf("discovering devices of zfs pool %q: %w", pool, err)
+	}
+
+	return d.resolveDevicePaths(ctx, logger, sysfs, devicePaths)
+}
+
+// zfsPoolName returns the name of the pool that the provided dataset or snapshot (example:
+// "tank/data@backup") belongs to (example: "tank").
+func zfsPoolName(dataset string) string {
+	pool, _, _ := strings.Cut(dataset, "/")
+	pool, _, _ = strings.Cut(pool, "@")
+
+	return pool
+}
+
+// zfsAuxiliarySections are the sections of the `zpool status` config that list vdevs which don't
+// store any of the pool's data: separate intent logs, L2ARC cache devices, and hot spares.
+var zfsAuxiliarySections = map[string]struct{}{
+	"logs":   {},
+	"cache":  {},
+	"spares": {},
+}
+
+// parseZpoolStatusVdevs returns the paths (example: "/dev/sda1") of the leaf vdevs that store
+// the data of the pool described by the output of `zpool status -P`, in the order that they're
+// listed in.
+func parseZpoolStatusVdevs(output []byte) []string {
+	var vdevs []string
+
+	inConfig := false
+	poolIndent := -1
+	skipSection := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		fields := strings.Fields(line)
+
+		if !inConfig {
+			// the vdevs are listed in a table that follows the "config:" line
+			inConfig = len(fields) == 1 && fields[0] == "config:"
+			continue
+		}
+
+		if len(fields) == 0 || fields[0] == "NAME" {
+			continue
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+
+		// the table ends with the first line that isn't indented (e.x. "errors: ...")
+		if indent == 0 {
+			break
+		}
+
+		// the pool itself is listed first, and the auxiliary sections (e.x. "logs") are
+		// listed at the same indentation as the pool
+		if poolIndent == -1 {
+			poolIndent = indent
+			continue
+		}
+
+		if indent == poolIndent {
+			_, skipSection = zfsAuxiliarySections[fields[0]]
+			continue
+		}
+
+		if !skipSection && strings.HasPrefix(fields[0], "/") {
+			vdevs = append(vdevs, fields[0])
+		}
+	}
+
+	return vdevs
+}
+
+// zfsVdevDevicePaths returns the sysfs paths of the block devices whose device nodes are at the
+// provided paths (example: "/dev/sda1").
+func zfsVdevDevicePaths(sysfs fs.FS, vdevs []string) ([]string, error) {
+	var devicePaths []string
+
+	for _, vdev := range vdevs {
+		// /sys/class/block contains a symlink to the device directory of every block
+		// device, including partitions
+		devicePath, err := evalSymlinks(sysfs, path.Join("class", "block", path.Base(vdev)))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("zfsVdevDevicePaths: vdev %q isn't a block device: %w", vdev, err)
+			}
+
+			return nil, fmt.Errorf("zfsVdevDevicePaths: %w", err)
+		}
+
+		devicePaths = append(devicePaths, devicePath)
+	}
+
+	return devicePaths, nil
+}
@@ -0,0 +1,122 @@
+package mountinfo
+
+import (
+	"context"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/moby/sys/mountinfo"
+	"github.com/sourcegraph/log/logtest"
+)
+
+func Test_ParseZpoolStatusVdevs(t *testing.T) {
+	output := strings.Join([]string{
+		"  pool: tank",
+		" state: ONLINE",
+		"  scan: scrub repaired 0B in 00:10:12 with 0 errors on Sun Oct 11 00:34:13 2026",
+		"config:",
+		"",
+		"\tNAME              STATE     READ WRITE CKSUM",
+		"\ttank              ONLINE       0     0     0",
+		"\t  mirror-0        ONLINE       0     0     0",
+		"\t    /dev/sda1     ONLINE       0     0     0",
+		"\t    /dev/sdb1     ONLINE       0     0     0",
+		"\t  raidz1-1        ONLINE       0     0     0",
+		"\t    /dev/sdc      ONLINE       0     0     0",
+		"\t    /dev/sdd      ONLINE       0     0     0",
+		"\t    /dev/sde      ONLINE       0     0     0",
+		"\tspecial",
+		"\t  /dev/nvme0n1p2  ONLINE       0     0     0",
+		"\tlogs",
+		"\t  /dev/nvme0n1p1  ONLINE       0     0     0",
+		"\tcache",
+		"\t  /dev/nvme1n1    ONLINE       0     0     0",
+		"\tspares",
+		"\t  /dev/sdf        AVAIL",
+		"",
+		"errors: No known data errors",
+	}, "\n")
+
+	expected := []string{"/dev/sda1", "/dev/sdb1", "/dev/sdc", "/dev/sdd", "/dev/sde", "/dev/nvme0n1p2"}
+	if diff := cmp.Diff(expected, parseZpoolStatusVdevs([]byte(output))); diff != "" {
+		t.Fatalf("recieved unexpected vdevs (-want +got):\n%s", diff)
+	}
+
+	// a pool with a single vdev
+	output = strings.Join([]string{
+		"  pool: rpool",
+		" state: ONLINE",
+		"config:",
+		"",
+		"\tNAME            STATE     READ WRITE CKSUM",
+		"\trpool           ONLINE       0     0     0",
+		"\t  /dev/vda3     ONLINE       0     0     0",
+		"",
+		"errors: No known data errors",
+	}, "\n")
+
+	if diff := cmp.Diff([]string{"/dev/vda3"}, parseZpoolStatusVdevs([]byte(output))); diff != "" {
+		t.Fatalf("recieved unexpected vdevs (-want +got):\n%s", diff)
+	}
+}
+
+func Test_ZFSPoolName(t *testing.T) {
+	for dataset, expected := range map[string]string{
+		"tank":               "tank",
+		"tank/data":          "tank",
+		"tank/data/nested":   "tank",
+		"tank@backup":        "tank",
+		"tank/data@snapshot": "tank",
+	} {
+		if actual := zfsPoolName(dataset); actual != expected {
+			t.Errorf("recieved unexpected pool name for %q (want %q, got %q)", dataset, expected, actual)
+		}
+	}
+}
+
+func Test_ZFSVdevDevicePaths(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"class/block/sda1": symlink("../../devices/pci0/block/sda/sda1"),
+		"class/block/sdb1": symlink("../../devices/pci0/block/sdb/sdb1"),
+		"class/block/sdb":  symlink("../../devices/pci0/block/sdb"),
+
+		"devices/pci0/block/sda/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sda/sda1/partition": {Data: []byte("1\n")},
+		"devices/pci0/block/sdb/subsystem":      symlink("../../../../class/block"),
+		"devices/pci0/block/sdb/sdb1/partition": {Data: []byte("1\n")},
+	}
+
+	devicePaths, err := zfsVdevDevicePaths(sysfs, []string{"/dev/sda1", "/dev/sdb1"})
+	if err != nil {
+		t.Fatalf("discovering vdev device paths: %s", err)
+	}
+
+	// mirrors return all of their member disks
+	d := NewDiscoverer(WithSysfs(sysfs))
+	names, err := d.resolveDevicePaths(context.Background(), logtest.Scoped(t), sysfs, devicePaths)
+	if err != nil {
+		t.Fatalf("resolving vdev device paths: %s", err)
+	}
+
+	if diff := cmp.Diff([]string{"sda", "sdb"}, names); diff != "" {
+		t.Fatalf("recieved unexpected device names (-want +got):\n%s", diff)
+	}
+
+	if _, err := zfsVdevDevicePaths(sysfs, []string{"/tmp/pool.img"}); err == nil {
+		t.Fatal("expected error for file vdev, got nil")
+	}
+}
+
+func Test_DiscoverZFSDeviceNames_WithoutModule(t *testing.T) {
+	sysfs := fstest.MapFS{"module": {Mode: fs.ModeDir}}
+
+	d := NewDiscoverer(WithSysfs(sysfs))
+	mount := &mountinfo.Info{Mountpoint: "/tank", Source: "tank/data", FSType: "zfs"}
+
+	if _, err := d.discoverZFSDeviceNames(context.Background(), logtest.Scoped(t), sysfs, mount); err == nil {
+		t.Fatal("expected error without the zfs kernel module, got nil")
+	}
+}